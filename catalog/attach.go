@@ -0,0 +1,188 @@
+package catalog
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// An Attachment is a file kept in the catalog along with a project, like a
+// screenshot or an exported document.  Attachments are stored by project ID,
+// so they follow a project through renames.
+type Attachment struct {
+	Name string
+	Size int64
+}
+
+// IsValidAttachmentName reports whether name can be used as the name of an
+// attachment.  Attachment names are file names: they may not be empty, start
+// with a dot, or contain slashes or control characters.
+func IsValidAttachmentName(name string) bool {
+	return name != "" && name[0] != '.' && strings.IndexFunc(name, func(r rune) bool {
+		return r == '/' || r == '\\' || unicode.IsControl(r)
+	}) == -1
+}
+
+// An AttachmentError is returned when an error occurs for a particular
+// attachment.
+type AttachmentError struct {
+	Name string
+	Err  error
+}
+
+func (e *AttachmentError) Error() string {
+	return "attachment " + e.Name + ": " + e.Err.Error()
+}
+
+func (e *AttachmentError) Unwrap() error {
+	return e.Err
+}
+
+// errBadAttachmentName is returned for attachment names that fail
+// IsValidAttachmentName.
+var errBadAttachmentName = errors.New("invalid attachment name")
+
+// An Attacher is a Catalog that can store attachments for its projects.
+type Attacher interface {
+	Catalog
+
+	// Attachments returns the attachments of the project with the given ID,
+	// sorted by name.
+	Attachments(id ID) ([]Attachment, error)
+
+	// ReadAttachment returns the contents of an attachment.  If the
+	// attachment does not exist, then ReadAttachment returns an error for
+	// which IsNotFound returns true.
+	ReadAttachment(id ID, name string) ([]byte, error)
+
+	// PutAttachment stores an attachment, replacing any attachment with
+	// the same name.  The project must be in the catalog.
+	PutAttachment(id ID, name string, data []byte) error
+
+	// DelAttachment removes an attachment.
+	DelAttachment(id ID, name string) error
+}
+
+// GetAttachments returns the attachments of the project with the given ID,
+// or nil if cat is not an Attacher.
+func GetAttachments(cat Catalog, id ID) ([]Attachment, error) {
+	if a, ok := cat.(Attacher); ok {
+		return a.Attachments(id)
+	}
+	return nil, nil
+}
+
+// errNoAttachments is returned when changing the attachments of a catalog
+// that is not an Attacher.
+var errNoAttachments = errors.New("catalog: catalog does not support attachments")
+
+// attachmentDir returns the directory of a project's attachments, relative
+// to the catalog root.
+func attachmentDir(id ID) string {
+	return filepath.Join(attachmentsDir, id.String())
+}
+
+// attachmentPath returns the path of an attachment, relative to the catalog
+// root.
+func attachmentPath(id ID, name string) string {
+	return filepath.Join(attachmentDir(id), name)
+}
+
+// readAttachments lists the attachments in dir.  A missing directory has no
+// attachments.
+func readAttachments(fs filesystem, dir string) ([]Attachment, error) {
+	f, err := fs.Open(dir)
+	if fs.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var list []Attachment
+	for {
+		entries, err := f.Readdir(100)
+		for _, ent := range entries {
+			if name := ent.Name(); IsValidAttachmentName(name) && ent.Mode()&os.ModeType == 0 {
+				list = append(list, Attachment{Name: name, Size: ent.Size()})
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	sort.Sort(byAttachmentName(list))
+	return list, nil
+}
+
+type byAttachmentName []Attachment
+
+func (a byAttachmentName) Len() int           { return len(a) }
+func (a byAttachmentName) Less(i, j int) bool { return a[i].Name < a[j].Name }
+func (a byAttachmentName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// readAttachment reads the attachment file at path.
+func readAttachment(fs filesystem, path string) ([]byte, error) {
+	name := filepath.Base(path)
+	if !IsValidAttachmentName(name) {
+		return nil, &AttachmentError{Name: name, Err: errBadAttachmentName}
+	}
+	data, err := readFile(fs, path)
+	if fs.IsNotExist(err) {
+		return nil, &AttachmentError{Name: name, Err: ErrNotFound}
+	} else if err != nil {
+		return nil, &AttachmentError{Name: name, Err: err}
+	}
+	return data, nil
+}
+
+// Attachments lists the files in the project's attachments directory.
+func (cat *localCatalog) Attachments(id ID) ([]Attachment, error) {
+	return readAttachments(cat.fs, filepath.Join(cat.root, attachmentDir(id)))
+}
+
+// ReadAttachment reads a file in the project's attachments directory.
+func (cat *localCatalog) ReadAttachment(id ID, name string) ([]byte, error) {
+	if !IsValidAttachmentName(name) {
+		return nil, &AttachmentError{Name: name, Err: errBadAttachmentName}
+	}
+	return readAttachment(cat.fs, filepath.Join(cat.root, attachmentPath(id, name)))
+}
+
+// PutAttachment writes a file to the project's attachments directory and
+// adds it to the working copy.
+func (cat *localCatalog) PutAttachment(id ID, name string, data []byte) error {
+	if !IsValidAttachmentName(name) {
+		return &AttachmentError{Name: name, Err: errBadAttachmentName}
+	}
+	sn, err := cat.ShortName(id)
+	if err != nil {
+		return err
+	}
+	return cat.Batch("attach "+name+" to "+sn, func(tx Catalog) error {
+		return tx.(*localTx).PutAttachment(id, name, data)
+	})
+}
+
+// DelAttachment removes a file from the project's attachments directory and
+// from the working copy.
+func (cat *localCatalog) DelAttachment(id ID, name string) error {
+	if !IsValidAttachmentName(name) {
+		return &AttachmentError{Name: name, Err: errBadAttachmentName}
+	}
+	sn, err := cat.ShortName(id)
+	if err != nil {
+		return err
+	}
+	if sn == "" {
+		sn = id.String()
+	}
+	return cat.Batch("detach "+name+" from "+sn, func(tx Catalog) error {
+		return tx.(*localTx).DelAttachment(id, name)
+	})
+}
@@ -0,0 +1,155 @@
+package catalog
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIsValidAttachmentName(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"screenshot.png", true},
+		{"design doc.pdf", true},
+		{"README", true},
+		{"", false},
+		{".hidden", false},
+		{"..", false},
+		{"docs/design.pdf", false},
+		{`docs\design.pdf`, false},
+		{"bad\nname", false},
+	}
+	for _, test := range tests {
+		if ok := IsValidAttachmentName(test.name); ok != test.ok {
+			t.Errorf("IsValidAttachmentName(%q) = %t; want %t", test.name, ok, test.ok)
+		}
+	}
+}
+
+func newAttachmentCatalog(t *testing.T) *Memory {
+	m := newMemoryWithProjects(t, &Project{ID: ID{1}, ShortName: "foo"})
+	if err := m.PutAttachment(ID{1}, "screenshot.png", []byte("PNG")); err != nil {
+		t.Fatal("PutAttachment error:", err)
+	}
+	if err := m.PutAttachment(ID{1}, "design.pdf", []byte("%PDF-1.4")); err != nil {
+		t.Fatal("PutAttachment error:", err)
+	}
+	return m
+}
+
+func TestLocalAttachments(t *testing.T) {
+	m := newAttachmentCatalog(t)
+	want := []Attachment{{Name: "design.pdf", Size: 8}, {Name: "screenshot.png", Size: 3}}
+	if list, err := m.Attachments(ID{1}); err != nil {
+		t.Error("Attachments error:", err)
+	} else if !reflect.DeepEqual(list, want) {
+		t.Errorf("Attachments(foo) = %v; want %v", list, want)
+	}
+	if list, err := m.Attachments(ID{2}); err != nil || len(list) != 0 {
+		t.Errorf("Attachments(missing) = %v, %v; want [], <nil>", list, err)
+	}
+
+	if err := m.PutAttachment(ID{1}, "screenshot.png", []byte("PNG2")); err != nil {
+		t.Error("PutAttachment replace error:", err)
+	}
+	if data, err := m.ReadAttachment(ID{1}, "screenshot.png"); err != nil || string(data) != "PNG2" {
+		t.Errorf("ReadAttachment(screenshot.png) = %q, %v; want \"PNG2\", <nil>", data, err)
+	}
+	if _, err := m.ReadAttachment(ID{1}, "missing.txt"); !IsNotFound(err) {
+		t.Errorf("ReadAttachment(missing.txt) error = %v; want not found", err)
+	}
+	if err := m.PutAttachment(ID{1}, "../catalog.json", []byte("{}")); !errors.Is(err, errBadAttachmentName) {
+		t.Errorf("PutAttachment(../catalog.json) = %v; want %v", err, errBadAttachmentName)
+	}
+	if err := m.PutAttachment(ID{2}, "orphan.txt", []byte("hi")); !IsNotFound(err) {
+		t.Errorf("PutAttachment for missing project = %v; want not found", err)
+	}
+
+	if err := m.DelAttachment(ID{1}, "design.pdf"); err != nil {
+		t.Error("DelAttachment error:", err)
+	}
+	if err := m.DelAttachment(ID{1}, "design.pdf"); !IsNotFound(err) {
+		t.Errorf("second DelAttachment = %v; want not found", err)
+	}
+	if list, err := m.Attachments(ID{1}); err != nil || len(list) != 1 || list[0].Name != "screenshot.png" {
+		t.Errorf("Attachments(foo) after detach = %v, %v; want only screenshot.png", list, err)
+	}
+}
+
+func TestLocalAttachments_Rename(t *testing.T) {
+	m := newAttachmentCatalog(t)
+	if err := m.PutProject(&Project{ID: ID{1}, ShortName: "bar"}); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	if list, err := m.Attachments(ID{1}); err != nil || len(list) != 2 {
+		t.Errorf("Attachments after rename = %v, %v; want 2 attachments", list, err)
+	}
+}
+
+func TestLocalAttachments_DelProject(t *testing.T) {
+	m := newAttachmentCatalog(t)
+	if err := m.DelProject("foo"); err != nil {
+		t.Fatal("DelProject error:", err)
+	}
+	if list, err := m.Attachments(ID{1}); err != nil || len(list) != 2 {
+		t.Errorf("Attachments after delete = %v, %v; want 2 attachments", list, err)
+	}
+	problems, err := Verify(m)
+	if err != nil {
+		t.Fatal("Verify error:", err)
+	}
+	checkProblems(t, "Verify", problems, nil)
+
+	if err := m.PurgeProject(ID{1}); err != nil {
+		t.Fatal("PurgeProject error:", err)
+	}
+	if list, err := m.Attachments(ID{1}); err != nil || len(list) != 0 {
+		t.Errorf("Attachments after purge = %v, %v; want none", list, err)
+	}
+}
+
+func TestLocalAttachments_Rollback(t *testing.T) {
+	m := newAttachmentCatalog(t)
+	errFail := errors.New("fail")
+	err := m.Batch("change attachments", func(tx Catalog) error {
+		a := tx.(Attacher)
+		if err := a.PutAttachment(ID{1}, "screenshot.png", []byte("changed")); err != nil {
+			return err
+		}
+		if err := a.PutAttachment(ID{1}, "new.txt", []byte("new")); err != nil {
+			return err
+		}
+		if err := a.DelAttachment(ID{1}, "design.pdf"); err != nil {
+			return err
+		}
+		return errFail
+	})
+	if err != errFail {
+		t.Fatalf("Batch error = %v; want %v", err, errFail)
+	}
+	want := []Attachment{{Name: "design.pdf", Size: 8}, {Name: "screenshot.png", Size: 3}}
+	if list, err := m.Attachments(ID{1}); err != nil || !reflect.DeepEqual(list, want) {
+		t.Errorf("Attachments after rollback = %v, %v; want %v", list, err, want)
+	}
+}
+
+func TestVerify_OrphanedAttachments(t *testing.T) {
+	m := newAttachmentCatalog(t)
+	dir := filepath.Join(m.root, attachmentDir(ID{2}))
+	if err := m.fs.Mkdir(dir); err != nil {
+		t.Fatal("Mkdir error:", err)
+	}
+	if err := writeFile(m.fs, filepath.Join(dir, "lost.txt"), []byte("lost"), true); err != nil {
+		t.Fatal("writeFile error:", err)
+	}
+	problems, err := Verify(m)
+	if err != nil {
+		t.Fatal("Verify error:", err)
+	}
+	checkProblems(t, "Verify", problems, []problemCheck{
+		{OrphanedAttachments, attachmentDir(ID{2}), false},
+	})
+}
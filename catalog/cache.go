@@ -1,6 +1,7 @@
 package catalog
 
 import (
+	"errors"
 	"sync"
 )
 
@@ -12,6 +13,13 @@ type Cache struct {
 	id   map[ID]string
 	tags map[string]stringSet
 	lock sync.RWMutex
+
+	// former maps short names that projects no longer use to the ID of the
+	// project that last used them.  It is nil if the underlying catalog does
+	// not remember former short names.
+	former map[string]ID
+
+	watches watchSet
 }
 
 // NewCache returns a new Cache given a Catalog.
@@ -24,7 +32,7 @@ func NewCache(cat Catalog) (*Cache, error) {
 // cache adds a project into the cache indices.  It does not acquire a lock.
 func (c *Cache) cache(p *Project) {
 	sn := p.ShortName
-	c.m[sn] = *p
+	c.m[sn] = *p.clone()
 	c.id[p.ID] = sn
 	for _, tag := range p.Tags {
 		if set := c.tags[tag]; set == nil {
@@ -50,33 +58,43 @@ func (c *Cache) uncache(shortName string) {
 }
 
 // RefreshProject updates a project's cache by getting the project from the
-// underlying catalog.  If there is an error getting the project, the cache
-// entry will be unchanged.
+// underlying catalog.  If the project is no longer in the underlying catalog,
+// then it is removed from the cache.  If there is any other error getting the
+// project, the cache entry will be unchanged and the cached project (if any)
+// is returned along with the error.  No events are sent for the change.
 func (c *Cache) RefreshProject(shortName string) (*Project, error) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
 	proj, err := c.cat.GetProject(shortName)
-	if err != nil {
-		p := c.m[shortName]
-		return &p, err
+	if rerr, ok := err.(*RenamedError); ok {
+		c.uncache(shortName)
+		c.renamed(shortName, rerr.ID)
+		return nil, err
+	} else if IsNotFound(err) {
+		c.uncache(shortName)
+		return nil, err
+	} else if err != nil {
+		if p, ok := c.m[shortName]; ok {
+			return p.clone(), err
+		}
+		return nil, err
 	}
 
 	c.uncache(shortName)
-	if proj != nil {
-		if old := c.id[proj.ID]; old != "" && old != shortName {
-			// This is a rename of an existing project.
-			// To maintain consistency, uncache previous short name.
-			c.uncache(old)
-		}
-		c.cache(proj)
+	if old := c.id[proj.ID]; old != "" && old != shortName {
+		// This is a rename of an existing project.
+		// To maintain consistency, uncache previous short name.
+		c.uncache(old)
 	}
+	c.cache(proj)
 	return proj, nil
 }
 
 // RefreshAll purges all keys from the cache and retrieves all the projects from
-// the underlying catalog.  Any error encountered in the process will abort the
-// refresh.
+// the underlying catalog, along with the former short names it knows of.  Any
+// error encountered in the process will abort the refresh.  No events are sent
+// for the changes.
 func (c *Cache) RefreshAll() error {
 	c.lock.Lock()
 	defer c.lock.Unlock()
@@ -88,13 +106,20 @@ func (c *Cache) RefreshAll() error {
 	c.m = make(map[string]Project, len(names))
 	c.id = make(map[ID]string, len(names))
 	c.tags = make(map[string]stringSet)
+	c.former = nil
+	if fn, ok := c.cat.(formerNamer); ok {
+		former, err := fn.formerNames()
+		if err != nil {
+			return err
+		}
+		c.former = former
+	}
 	for _, sn := range names {
 		p, err := c.cat.GetProject(sn)
 		if err != nil {
 			return err
-		} else if p != nil {
-			c.cache(p)
 		}
+		c.cache(p)
 	}
 	return nil
 }
@@ -133,17 +158,44 @@ func (c *Cache) List() ([]string, error) {
 	return names, nil
 }
 
-// GetProject fetches the project record with the given short name, or nil if
-// the project was not found in the cache.
+// GetProject fetches the project record with the given short name from the
+// cache.  If the short name is a former name of a project in the cache, then a
+// *RenamedError is returned.
 func (c *Cache) GetProject(shortName string) (*Project, error) {
+	if !isValidShortName(shortName) {
+		return nil, shortNameError(shortName)
+	}
 	c.lock.RLock()
 	defer c.lock.RUnlock()
 
 	p, ok := c.m[shortName]
 	if !ok {
-		return nil, nil
+		if id, ok := c.former[shortName]; ok {
+			if sn := c.id[id]; sn != "" {
+				return nil, &RenamedError{Old: shortName, New: sn, ID: id}
+			}
+		}
+		return nil, &ProjectError{ShortName: shortName, Op: "get", Err: ErrNotFound}
+	}
+	return p.clone(), nil
+}
+
+func isRenamed(err error) bool {
+	_, ok := err.(*RenamedError)
+	return ok
+}
+
+// GetProjectByID fetches the project record with the given ID from the cache.
+func (c *Cache) GetProjectByID(id ID) (*Project, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	sn, ok := c.id[id]
+	if !ok {
+		return nil, &ProjectError{ShortName: id.String(), Op: "get", Err: ErrNotFound}
 	}
-	return &p, nil
+	p := c.m[sn]
+	return p.clone(), nil
 }
 
 // PutProject stores a project record.  If the put fails in the catalog, the
@@ -155,12 +207,57 @@ func (c *Cache) PutProject(project *Project) error {
 	if err := c.cat.PutProject(project); err != nil {
 		return err
 	}
+	c.watches.post(c.put(project))
+	return nil
+}
 
+// put replaces a project in the cache indices, removing its old short name if
+// it was renamed, and returns the corresponding event.  It does not acquire a
+// lock.
+func (c *Cache) put(project *Project) Event {
+	ev := Event{Op: PutEvent, ID: project.ID, ShortName: project.ShortName}
 	if old, ok := c.id[project.ID]; ok {
 		c.uncache(old)
+		if old != project.ShortName {
+			ev.Op, ev.OldShortName = RenameEvent, old
+			c.renamed(old, project.ID)
+		}
 	}
+	delete(c.former, project.ShortName)
 	c.cache(project)
-	return nil
+	return ev
+}
+
+// del removes a project from the cache indices and returns the corresponding
+// event.  ok is false if the project was not in the cache.  It does not acquire
+// a lock.
+func (c *Cache) del(shortName string) (ev Event, ok bool) {
+	p, ok := c.m[shortName]
+	if !ok {
+		return Event{}, false
+	}
+	c.uncache(shortName)
+	c.forget(p.ID)
+	return Event{Op: DeleteEvent, ID: p.ID, ShortName: shortName}, true
+}
+
+// renamed records that a project no longer uses a short name, if the
+// underlying catalog remembers former short names.  It does not acquire a
+// lock.
+func (c *Cache) renamed(old string, id ID) {
+	if c.former != nil {
+		c.former[old] = id
+	}
+}
+
+// forget removes the former short names of a deleted project, as the
+// underlying catalog does.  It does not acquire a lock.
+func (c *Cache) forget(id ID) {
+	for former, formerID := range c.former {
+		if formerID == id {
+			delete(c.former, former)
+		}
+	}
 }
 
 // DelProject removes a project record from the catalog.  If the delete fails in
@@ -172,10 +269,181 @@ func (c *Cache) DelProject(shortName string) error {
 	if err := c.cat.DelProject(shortName); err != nil {
 		return err
 	}
-	c.uncache(shortName)
+	if ev, ok := c.del(shortName); ok {
+		c.watches.post(ev)
+	}
+	return nil
+}
+
+// Batch calls f with a transaction of the underlying catalog (see the Batch
+// function) and updates the cache with the changes once f succeeds.  The cache
+// is locked for the duration of the batch, so f must only access the catalog
+// through tx.
+func (c *Cache) Batch(message string, f func(tx Catalog) error) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var changes []cacheChange
+	err := Batch(c.cat, message, func(tx Catalog) error {
+		return f(&cacheTx{Catalog: tx, changes: &changes})
+	})
+	if _, ok := c.cat.(Batcher); ok && err != nil {
+		return err
+	}
+	// Either the batch succeeded or the underlying catalog applied each
+	// change as it was made.
+	events := make([]Event, 0, len(changes))
+	for _, ch := range changes {
+		if ch.project != nil {
+			events = append(events, c.put(ch.project))
+		} else if ev, ok := c.del(ch.shortName); ok {
+			events = append(events, ev)
+		}
+	}
+	c.watches.post(events...)
+	return err
+}
+
+// Watch reports changes made through the cache, including those applied
+// with Apply.
+func (c *Cache) Watch() (*Watch, error) {
+	return c.watches.add(), nil
+}
+
+// Apply updates the cache for an event from the underlying catalog, fetching
+// the project again if necessary.  The event is then passed on to the cache's
+// watches.
+func (c *Cache) Apply(ev Event) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	switch ev.Op {
+	case PutEvent, RenameEvent:
+		p, err := c.cat.GetProjectByID(ev.ID)
+		if err != nil {
+			return err
+		}
+		c.put(p)
+		if ev.Op == RenameEvent && ev.OldShortName != "" && ev.OldShortName != p.ShortName {
+			c.renamed(ev.OldShortName, ev.ID)
+		}
+	case DeleteEvent:
+		if sn, ok := c.id[ev.ID]; ok {
+			c.uncache(sn)
+		}
+		c.forget(ev.ID)
+	}
+	c.watches.post(ev)
+	return nil
+}
+
+func (c *Cache) ids() ([]ID, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	ids := make([]ID, 0, len(c.id))
+	for id := range c.id {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// A cacheTx records the changes made in a batch.
+type cacheTx struct {
+	Catalog
+	changes *[]cacheChange
+}
+
+// A cacheChange is either a put of project or a delete of shortName.
+type cacheChange struct {
+	project   *Project
+	shortName string
+}
+
+func (tx *cacheTx) PutProject(project *Project) error {
+	if err := tx.Catalog.PutProject(project); err != nil {
+		return err
+	}
+	*tx.changes = append(*tx.changes, cacheChange{project: project.clone()})
+	return nil
+}
+
+func (tx *cacheTx) DelProject(shortName string) error {
+	if err := tx.Catalog.DelProject(shortName); err != nil {
+		return err
+	}
+	*tx.changes = append(*tx.changes, cacheChange{shortName: shortName})
+	return nil
+}
+
+func (tx *cacheTx) Hosts() (*HostRegistry, error) {
+	return GetHosts(tx.Catalog)
+}
+
+func (tx *cacheTx) PutHosts(r *HostRegistry) error {
+	hr, ok := tx.Catalog.(HostRegistrar)
+	if !ok {
+		return errNoHosts
+	}
+	return hr.PutHosts(r)
+}
+
+func (tx *cacheTx) Attachments(id ID) ([]Attachment, error) {
+	return GetAttachments(tx.Catalog, id)
+}
+
+func (tx *cacheTx) ReadAttachment(id ID, name string) ([]byte, error) {
+	a, ok := tx.Catalog.(Attacher)
+	if !ok {
+		return nil, &AttachmentError{Name: name, Err: ErrNotFound}
+	}
+	return a.ReadAttachment(id, name)
+}
+
+func (tx *cacheTx) PutAttachment(id ID, name string, data []byte) error {
+	a, ok := tx.Catalog.(Attacher)
+	if !ok {
+		return errNoAttachments
+	}
+	return a.PutAttachment(id, name, data)
+}
+
+func (tx *cacheTx) DelAttachment(id ID, name string) error {
+	a, ok := tx.Catalog.(Attacher)
+	if !ok {
+		return errNoAttachments
+	}
+	return a.DelAttachment(id, name)
+}
+
+func (tx *cacheTx) Trash() ([]*TrashedProject, error) {
+	return GetTrash(tx.Catalog)
+}
+
+func (tx *cacheTx) RestoreProject(id ID, shortName string) error {
+	t, ok := tx.Catalog.(Trasher)
+	if !ok {
+		return errNoTrash
+	}
+	if err := t.RestoreProject(id, shortName); err != nil {
+		return err
+	}
+	p, err := tx.Catalog.GetProjectByID(id)
+	if err != nil {
+		return err
+	}
+	*tx.changes = append(*tx.changes, cacheChange{project: p})
 	return nil
 }
 
+func (tx *cacheTx) PurgeProject(id ID) error {
+	t, ok := tx.Catalog.(Trasher)
+	if !ok {
+		return errNoTrash
+	}
+	return t.PurgeProject(id)
+}
+
 // ShortName returns the short name for the given ID.  If the ID is not in the
 // cache, this method returns an empty string with no error.
 func (c *Cache) ShortName(id ID) (string, error) {
@@ -221,3 +489,103 @@ func (ss stringSet) Slice() []string {
 	}
 	return slice
 }
+
+// Schema returns the underlying catalog's field schema.
+func (c *Cache) Schema() (*Schema, error) {
+	return GetSchema(c.cat)
+}
+
+// PutSchema replaces the underlying catalog's field schema.
+func (c *Cache) PutSchema(s *Schema) error {
+	sc, ok := c.cat.(Schemer)
+	if !ok {
+		return errNoSchema
+	}
+	return sc.PutSchema(s)
+}
+
+// errNoSchema is returned when setting the schema of a catalog that is not a
+// Schemer.
+var errNoSchema = errors.New("catalog: catalog does not support field schemas")
+
+// Hosts returns the underlying catalog's host registry.
+func (c *Cache) Hosts() (*HostRegistry, error) {
+	return GetHosts(c.cat)
+}
+
+// PutHosts replaces the underlying catalog's host registry.
+func (c *Cache) PutHosts(r *HostRegistry) error {
+	hr, ok := c.cat.(HostRegistrar)
+	if !ok {
+		return errNoHosts
+	}
+	return hr.PutHosts(r)
+}
+
+// Attachments returns the attachments of a project in the underlying catalog.
+func (c *Cache) Attachments(id ID) ([]Attachment, error) {
+	return GetAttachments(c.cat, id)
+}
+
+// ReadAttachment reads an attachment from the underlying catalog.
+func (c *Cache) ReadAttachment(id ID, name string) ([]byte, error) {
+	a, ok := c.cat.(Attacher)
+	if !ok {
+		return nil, &AttachmentError{Name: name, Err: ErrNotFound}
+	}
+	return a.ReadAttachment(id, name)
+}
+
+// PutAttachment stores an attachment in the underlying catalog.
+func (c *Cache) PutAttachment(id ID, name string, data []byte) error {
+	a, ok := c.cat.(Attacher)
+	if !ok {
+		return errNoAttachments
+	}
+	return a.PutAttachment(id, name, data)
+}
+
+// DelAttachment removes an attachment from the underlying catalog.
+func (c *Cache) DelAttachment(id ID, name string) error {
+	a, ok := c.cat.(Attacher)
+	if !ok {
+		return errNoAttachments
+	}
+	return a.DelAttachment(id, name)
+}
+
+// Trash returns the underlying catalog's deleted projects.
+func (c *Cache) Trash() ([]*TrashedProject, error) {
+	return GetTrash(c.cat)
+}
+
+// RestoreProject moves a project out of the underlying catalog's trash and
+// adds it to the cache.
+func (c *Cache) RestoreProject(id ID, shortName string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	t, ok := c.cat.(Trasher)
+	if !ok {
+		return errNoTrash
+	}
+	if err := t.RestoreProject(id, shortName); err != nil {
+		return err
+	}
+	p, err := c.cat.GetProjectByID(id)
+	if err != nil {
+		return err
+	}
+	c.watches.post(c.put(p))
+	return nil
+}
+
+// PurgeProject permanently removes a project from the underlying catalog's
+// trash.
+func (c *Cache) PurgeProject(id ID) error {
+	t, ok := c.cat.(Trasher)
+	if !ok {
+		return errNoTrash
+	}
+	return t.PurgeProject(id)
+}
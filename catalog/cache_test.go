@@ -119,8 +119,8 @@ func TestCachePut(t *testing.T) {
 	if p != nil {
 		t.Errorf("Cache.GetProject(%q) = %v; want nil", "blackforest", p)
 	}
-	if err != nil {
-		t.Errorf("Cache.GetProject(%q) error: %v", "blackforest", err)
+	if !IsNotFound(err) {
+		t.Errorf("Cache.GetProject(%q) error = %v; want not found", "blackforest", err)
 	}
 
 	sn, err := c.ShortName(magicID)
@@ -270,7 +270,9 @@ func TestCache_RefreshProject_Delete(t *testing.T) {
 			step.Func()
 		}
 		proj, err := step.Check()
-		if err != nil {
+		if step.ExpectNil && !IsNotFound(err) {
+			t.Errorf("%s error = %v; want not found", step.Desc, err)
+		} else if !step.ExpectNil && err != nil {
 			t.Errorf("%s error: %v", step.Desc, err)
 		}
 		switch {
@@ -369,7 +371,9 @@ func TestCache_RefreshProject_Rename(t *testing.T) {
 			step.Func()
 		}
 		proj, err := step.Check()
-		if err != nil {
+		if step.ExpectNil && !IsNotFound(err) {
+			t.Errorf("%s error = %v; want not found", step.Desc, err)
+		} else if !step.ExpectNil && err != nil {
 			t.Errorf("%s error: %v", step.Desc, err)
 		}
 		switch {
@@ -455,6 +459,207 @@ func TestCache_RefreshProject_Fail(t *testing.T) {
 	}
 }
 
+func TestCacheBatch(t *testing.T) {
+	cat, _, wc := newTestCatalog()
+	c, err := NewCache(cat)
+	if err != nil {
+		t.Fatal("NewCache error:", err)
+	}
+	newID := ID{0xba, 0x7b, 0xbb, 0x6c, 0x2b, 0x66, 0x61, 0x54, 0xfb}
+	err = c.Batch("test batch", func(tx Catalog) error {
+		if err := tx.PutProject(&Project{ID: newID, ShortName: "foo", Name: "Teh Foo", Tags: []string{"junk"}}); err != nil {
+			return err
+		}
+		return tx.DelProject("blackforest")
+	})
+	if err != nil {
+		t.Error("Cache.Batch error:", err)
+	}
+	if !wc.committed {
+		t.Error("vcs not committed")
+	}
+
+	if list, _ := c.List(); !reflect.DeepEqual(list, []string{"foo"}) {
+		t.Errorf("Cache.List() = %v; want %v", list, []string{"foo"})
+	}
+	if sn, _ := c.ShortName(newID); sn != "foo" {
+		t.Errorf("Cache.ShortName(%v) = %q; want %q", newID, sn, "foo")
+	}
+	if names := c.FindTag("go"); len(names) != 0 {
+		t.Errorf("Cache.FindTag(%q) = %v; want []", "go", names)
+	}
+	if names := c.FindTag("junk"); !reflect.DeepEqual(names, []string{"foo"}) {
+		t.Errorf("Cache.FindTag(%q) = %v; want %v", "junk", names, []string{"foo"})
+	}
+}
+
+func TestCacheBatch_Fail(t *testing.T) {
+	cat, _, _ := newTestCatalog()
+	c, err := NewCache(cat)
+	if err != nil {
+		t.Fatal("NewCache error:", err)
+	}
+	errAbort := errors.New("abort")
+	err = c.Batch("test batch", func(tx Catalog) error {
+		if err := tx.DelProject("blackforest"); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if err != errAbort {
+		t.Errorf("Cache.Batch error = %v; want %v", err, errAbort)
+	}
+	if p, err := c.GetProject("blackforest"); p == nil || err != nil {
+		t.Errorf("Cache.GetProject(%q) = %v, %v; want project", "blackforest", p, err)
+	}
+}
+
+func TestCacheBatch_NoBatcher(t *testing.T) {
+	mc := newMockCatalog()
+	c, err := NewCache(mc)
+	if err != nil {
+		t.Fatal("NewCache error:", err)
+	}
+	errAbort := errors.New("abort")
+	err = c.Batch("test batch", func(tx Catalog) error {
+		if err := tx.DelProject("blackforest"); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if err != errAbort {
+		t.Errorf("Cache.Batch error = %v; want %v", err, errAbort)
+	}
+	// The underlying catalog has no batches, so the delete was kept.
+	if p, _ := c.GetProject("blackforest"); p != nil {
+		t.Errorf("Cache.GetProject(%q) = %v; want nil", "blackforest", p)
+	}
+}
+
+func TestCache_Renamed(t *testing.T) {
+	cat, _, _ := newTestCatalog()
+	c, err := NewCache(cat)
+	if err != nil {
+		t.Fatal("NewCache error:", err)
+	}
+	p, err := c.GetProject("blackforest")
+	if err != nil {
+		t.Fatal("Cache.GetProject error:", err)
+	}
+	p.ShortName = "foo"
+	if err := c.PutProject(p); err != nil {
+		t.Fatal("Cache.PutProject error:", err)
+	}
+
+	if p, err := c.GetProject("blackforest"); p != nil || !isRenamed(err) {
+		t.Errorf("Cache.GetProject(%q) = %v, %v; want *RenamedError", "blackforest", p, err)
+	}
+	if p, err := c.RefreshProject("blackforest"); p != nil || !isRenamed(err) {
+		t.Errorf("Cache.RefreshProject(%q) = %v, %v; want *RenamedError", "blackforest", p, err)
+	}
+}
+
+// countingCatalog counts the calls to GetProject.
+type countingCatalog struct {
+	*Memory
+	gets int
+}
+
+func (cc *countingCatalog) GetProject(shortName string) (*Project, error) {
+	cc.gets++
+	return cc.Memory.GetProject(shortName)
+}
+
+func TestCache_FormerNames(t *testing.T) {
+	m := NewMemory()
+	if err := m.PutProject(&Project{ID: ID{1}, ShortName: "foo"}); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	if err := m.PutProject(&Project{ID: ID{1}, ShortName: "bar"}); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	cc := &countingCatalog{Memory: m}
+	c, err := NewCache(cc)
+	if err != nil {
+		t.Fatal("NewCache error:", err)
+	}
+	cc.gets = 0
+	if _, err := c.GetProject("foo"); !isRenamed(err) || err.(*RenamedError).New != "bar" {
+		t.Errorf("Cache.GetProject(%q) error = %v; want renamed to bar", "foo", err)
+	}
+	if _, err := c.GetProject("nope"); !IsNotFound(err) {
+		t.Errorf("Cache.GetProject(%q) error = %v; want not found", "nope", err)
+	}
+	if cc.gets != 0 {
+		t.Errorf("Cache.GetProject read the underlying catalog %d times; want 0", cc.gets)
+	}
+
+	if err := c.PutProject(&Project{ID: ID{1}, ShortName: "baz"}); err != nil {
+		t.Fatal("Cache.PutProject error:", err)
+	}
+	for _, sn := range []string{"foo", "bar"} {
+		if _, err := c.GetProject(sn); !isRenamed(err) || err.(*RenamedError).New != "baz" {
+			t.Errorf("Cache.GetProject(%q) error = %v; want renamed to baz", sn, err)
+		}
+	}
+	if err := c.DelProject("baz"); err != nil {
+		t.Fatal("Cache.DelProject error:", err)
+	}
+	if _, err := c.GetProject("foo"); !IsNotFound(err) {
+		t.Errorf("Cache.GetProject(%q) after delete error = %v; want not found", "foo", err)
+	}
+}
+
+func TestCacheWatch(t *testing.T) {
+	magicID := ID{0x6f, 0x5d, 0x5d, 0xcc, 0x6b, 0x38, 0x49, 0x08, 0x9d}
+	mc := newMockCatalog()
+	c, err := NewCache(mc)
+	if err != nil {
+		t.Fatal("NewCache error:", err)
+	}
+	w, err := c.Watch()
+	if err != nil {
+		t.Fatal("Cache.Watch error:", err)
+	}
+	defer w.Close()
+
+	p, _ := c.GetProject("blackforest")
+	p.ShortName = "bf"
+	if err := c.PutProject(p); err != nil {
+		t.Fatal("Cache.PutProject error:", err)
+	}
+	if ev, ok := nextEvent(t, w); ok {
+		if want := (Event{Op: RenameEvent, ID: magicID, ShortName: "bf", OldShortName: "blackforest"}); ev != want {
+			t.Errorf("event = %v; want %v", ev, want)
+		}
+	}
+
+	// Change the underlying catalog and apply the event.
+	mc["bf"].Name = "Schwarzwald"
+	ev := Event{Op: PutEvent, ID: magicID, ShortName: "bf"}
+	if err := c.Apply(ev); err != nil {
+		t.Error("Cache.Apply error:", err)
+	}
+	if p, _ := c.GetProject("bf"); p == nil || p.Name != "Schwarzwald" {
+		t.Errorf("after Apply, Cache.GetProject(%q) = %v; want Name = %q", "bf", p, "Schwarzwald")
+	}
+	if got, ok := nextEvent(t, w); ok && got != ev {
+		t.Errorf("event = %v; want %v", got, ev)
+	}
+
+	delete(mc, "bf")
+	ev = Event{Op: DeleteEvent, ID: magicID, ShortName: "bf"}
+	if err := c.Apply(ev); err != nil {
+		t.Error("Cache.Apply error:", err)
+	}
+	if p, _ := c.GetProject("bf"); p != nil {
+		t.Errorf("after Apply, Cache.GetProject(%q) = %v; want nil", "bf", p)
+	}
+	if got, ok := nextEvent(t, w); ok && got != ev {
+		t.Errorf("event = %v; want %v", got, ev)
+	}
+}
+
 type mockCatalog map[string]*Project
 
 func (mc mockCatalog) List() ([]string, error) {
@@ -466,7 +671,19 @@ func (mc mockCatalog) List() ([]string, error) {
 }
 
 func (mc mockCatalog) GetProject(shortName string) (*Project, error) {
-	return mc[shortName], nil
+	p := mc[shortName]
+	if p == nil {
+		return nil, &ProjectError{ShortName: shortName, Op: "get", Err: ErrNotFound}
+	}
+	return p, nil
+}
+
+func (mc mockCatalog) GetProjectByID(id ID) (*Project, error) {
+	sn, _ := mc.ShortName(id)
+	if sn == "" {
+		return nil, &ProjectError{ShortName: id.String(), Op: "get", Err: ErrNotFound}
+	}
+	return mc[sn], nil
 }
 
 func (mc mockCatalog) PutProject(project *Project) error {
@@ -512,6 +729,13 @@ func (mc *mockFailCatalog) GetProject(shortName string) (*Project, error) {
 	return mc.mockCatalog.GetProject(shortName)
 }
 
+func (mc *mockFailCatalog) GetProjectByID(id ID) (*Project, error) {
+	if mc.Fail {
+		return nil, errMockCatalogFail
+	}
+	return mc.mockCatalog.GetProjectByID(id)
+}
+
 func (mc *mockFailCatalog) PutProject(project *Project) error {
 	if mc.Fail {
 		return errMockCatalogFail
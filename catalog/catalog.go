@@ -15,9 +15,18 @@ type Catalog interface {
 	List() ([]string, error)
 
 	// GetProject fetches the project record with the given short name.
+	// If the project does not exist, then GetProject returns a nil project
+	// and an error for which IsNotFound returns true.  If the short name was
+	// used by a project that has since been renamed, then GetProject returns
+	// a *RenamedError.  The caller may modify the returned project.
 	GetProject(shortName string) (*Project, error)
 
-	// PutProject stores a project record.
+	// GetProjectByID fetches the project record with the given ID.  Missing
+	// projects are reported in the same way as GetProject.
+	GetProjectByID(id ID) (*Project, error)
+
+	// PutProject stores a project record.  The catalog does not retain
+	// project, so the caller may modify it afterward.
 	PutProject(project *Project) error
 
 	// DelProject removes a project record from the catalog.
@@ -28,6 +37,26 @@ type Catalog interface {
 	ShortName(id ID) (string, error)
 }
 
+// A Batcher is a Catalog that can group several changes together.
+type Batcher interface {
+	Catalog
+
+	// Batch calls f with a catalog that applies changes as a single unit.
+	// If f returns an error, then none of its changes are kept.  message
+	// describes the changes; it is used as the commit message for catalogs
+	// stored in version control.  tx must not be used after f returns.
+	Batch(message string, f func(tx Catalog) error) error
+}
+
+// Batch calls f with a transaction of cat, if cat is a Batcher.  Otherwise,
+// f is called with cat itself, so each change is applied as it is made.
+func Batch(cat Catalog, message string, f func(tx Catalog) error) error {
+	if b, ok := cat.(Batcher); ok {
+		return b.Batch(message, f)
+	}
+	return f(cat)
+}
+
 // Project is the metadata associated with a project.
 type Project struct {
 	ID          ID     `json:"id"`
@@ -37,26 +66,103 @@ type Project struct {
 	Tags        TagSet `json:"tags,omitempty"`
 	Homepage    string `json:"homepage,omitempty"`
 
+	Status        Status         `json:"status,omitempty"`
+	StatusHistory []StatusChange `json:"status_history,omitempty"`
+
+	// Fields holds the values of the catalog's custom fields, keyed by
+	// field name.  See Schema.
+	Fields map[string]string `json:"fields,omitempty"`
+
+	// Links are the project's relationships to other projects.
+	Links []Link `json:"links,omitempty"`
+
+	// Parent is set if the project is a subproject.
+	Parent *ParentRef `json:"parent,omitempty"`
+
+	// Notes is the project's journal, oldest first.
+	Notes []Note `json:"notes,omitempty"`
+
 	CatalogTime time.Time `json:"catalog_time"`
 	CreateTime  time.Time `json:"create_time"`
 
-	VCS     *VCSInfo             `json:"vcs,omitempty"`
+	Remotes []Remote             `json:"remotes,omitempty"`
 	PerHost map[string]*HostInfo `json:"per_host,omitempty"`
 }
 
-// Path returns the project's path for a host.
+// Path returns the project's path for a host as it is stored, which may be
+// portable (see PathEnv).  The path is empty if the project has no path on the
+// host.
 func (proj *Project) Path(host string) string {
-	if proj.PerHost == nil {
+	if !proj.HasPath(host) {
 		return ""
 	}
+	return proj.PerHost[host].Path
+}
+
+// ExpandPath returns the project's path for a host, with a portable path
+// expanded with env.  The path is empty if the project has no path on the
+// host.  If env is nil, the path is returned as Path returns it.
+func (proj *Project) ExpandPath(host string, env *PathEnv) (string, error) {
+	p := proj.Path(host)
+	if p == "" || env == nil {
+		return p, nil
+	}
+	return env.Expand(p)
+}
+
+// HasPath reports whether the project has a path for a host.
+func (proj *Project) HasPath(host string) bool {
 	info := proj.PerHost[host]
-	if info == nil {
-		return ""
+	return info != nil && info.Path != ""
+}
+
+// clone returns a deep copy of proj.
+func (proj *Project) clone() *Project {
+	p := *proj
+	if proj.Tags != nil {
+		p.Tags = append(TagSet(nil), proj.Tags...)
+	}
+	if proj.StatusHistory != nil {
+		p.StatusHistory = append([]StatusChange(nil), proj.StatusHistory...)
+	}
+	if proj.Fields != nil {
+		p.Fields = make(map[string]string, len(proj.Fields))
+		for k, v := range proj.Fields {
+			p.Fields[k] = v
+		}
+	}
+	if proj.Links != nil {
+		p.Links = append([]Link(nil), proj.Links...)
+	}
+	if proj.Notes != nil {
+		p.Notes = append([]Note(nil), proj.Notes...)
 	}
-	return info.Path
+	if proj.Parent != nil {
+		parent := *proj.Parent
+		p.Parent = &parent
+	}
+	if proj.Remotes != nil {
+		p.Remotes = append([]Remote(nil), proj.Remotes...)
+	}
+	if proj.PerHost != nil {
+		p.PerHost = make(map[string]*HostInfo, len(proj.PerHost))
+		for host, info := range proj.PerHost {
+			if info != nil {
+				info2 := *info
+				if info.WC != nil {
+					wc := *info.WC
+					info2.WC = &wc
+				}
+				info = &info2
+			}
+			p.PerHost[host] = info
+		}
+	}
+	return &p
 }
 
-// SetPath sets the project's per-host path.
+// SetPath sets the project's per-host path.  path may be portable (see
+// PathEnv).
 func (proj *Project) SetPath(host, path string) {
 	if proj.PerHost == nil {
 		proj.PerHost = map[string]*HostInfo{host: new(HostInfo)}
@@ -66,13 +172,7 @@ func (proj *Project) SetPath(host, path string) {
 	proj.PerHost[host].Path = path
 }
 
-// VCSInfo holds the version control information in a project record.
-type VCSInfo struct {
-	Type string `json:"type"`
-	URL  string `json:"url,omitempty"`
-}
-
-// VCS types (for VCSInfo)
+// VCS types (for Remote)
 const (
 	CVS        = "cvs"
 	Git        = "git"
@@ -84,14 +184,59 @@ const (
 
 // HostInfo holds the per-host project information.
 type HostInfo struct {
+	// Path is the location of the project's working copy.  It is either
+	// absolute or portable (see PathEnv).
 	Path string `json:"path"`
+
+	// WC is the state of the working copy at Path when it was last
+	// checked, or nil if it has never been checked.
+	WC *WCStatus `json:"wc,omitempty"`
+}
+
+// WCStatus describes a project's working copy on a host.
+type WCStatus struct {
+	// Revision is the full identifier of the working copy's current
+	// revision.
+	Revision string `json:"revision"`
+
+	// Branch is the name of the working copy's branch.  It is empty if the
+	// VCS does not report branches or the working copy is not on a branch.
+	Branch string `json:"branch,omitempty"`
+
+	// Dirty is true if tracked files had uncommitted changes.
+	Dirty bool `json:"dirty,omitempty"`
+
+	// CheckTime is when the working copy was examined.
+	CheckTime time.Time `json:"check_time"`
+}
+
+// ShortRevision returns an abbreviated form of the revision for display.
+func (st *WCStatus) ShortRevision() string {
+	const n = 12
+	if len(st.Revision) > n {
+		return st.Revision[:n]
+	}
+	return st.Revision
 }
 
 // Errors
 var (
 	ErrLocked = errors.New("catalog is locked")
+
+	// ErrNotFound is returned, wrapped in a *ProjectError, when a project is
+	// not in the catalog.
+	ErrNotFound = errors.New("not found")
+
+	// ErrReadOnly is returned when changing a catalog opened with OpenRev.
+	ErrReadOnly = errors.New("catalog is read-only")
 )
 
+// IsNotFound reports whether err indicates that a project is not in a catalog.
+// It is equivalent to errors.Is(err, ErrNotFound).
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
 // VersionError is returned when opening a catalog from an incompatible version
 // of Black Forest.
 type VersionError int
@@ -116,13 +261,33 @@ func (e shortNameError) Error() string {
 	return `bad project short name: "` + string(e) + `"`
 }
 
-// projectError is returned when an error occurs for a particular project.
-type projectError struct {
+// A RenamedError is returned by GetProject when a short name belonged to a
+// project that has since been renamed.
+type RenamedError struct {
+	Old string
+	New string
+	ID  ID
+}
+
+func (e *RenamedError) Error() string {
+	return "catalog: project " + e.Old + " was renamed to " + e.New
+}
+
+// A ProjectError is returned when an error occurs for a particular project.
+type ProjectError struct {
+	// ShortName is the short name of the project, or the ID (or ID prefix)
+	// that was looked up.
 	ShortName string
-	Op        string
-	Err       error
+
+	Op  string
+	Err error
 }
 
-func (e *projectError) Error() string {
+func (e *ProjectError) Error() string {
 	return "catalog: " + e.Op + " project " + e.ShortName + ": " + e.Err.Error()
 }
+
+// Unwrap returns the underlying error.
+func (e *ProjectError) Unwrap() error {
+	return e.Err
+}
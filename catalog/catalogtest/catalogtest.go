@@ -0,0 +1,446 @@
+// Package catalogtest provides a conformance test suite for implementations of
+// catalog.Catalog.
+package catalogtest
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"bitbucket.org/zombiezen/blackforest/catalog"
+)
+
+// A Factory creates a new, empty catalog for a test.  done is called once the
+// test has finished with the catalog.  done may be nil.
+type Factory func() (cat catalog.Catalog, done func(), err error)
+
+// Test runs the conformance suite against catalogs created by newCatalog.
+// Each part of the suite is run as a subtest with a fresh catalog.
+func Test(t *testing.T, newCatalog Factory) {
+	tests := []struct {
+		name string
+		f    func(*testing.T, catalog.Catalog)
+	}{
+		{"Empty", testEmpty},
+		{"PutGet", testPutGet},
+		{"Update", testUpdate},
+		{"Copy", testCopy},
+		{"BadShortName", testBadShortName},
+		{"DuplicateShortName", testDuplicateShortName},
+		{"Rename", testRename},
+		{"Del", testDel},
+		{"Batch", testBatch},
+		{"Schema", testSchema},
+		{"BadStatus", testBadStatus},
+		{"Concurrent", testConcurrent},
+	}
+	for _, test := range tests {
+		f := test.f
+		t.Run(test.name, func(t *testing.T) {
+			cat, done, err := newCatalog()
+			if err != nil {
+				t.Fatal("creating catalog:", err)
+			}
+			if done != nil {
+				defer done()
+			}
+			f(t, cat)
+		})
+	}
+}
+
+var magicTime = time.Date(2013, 2, 7, 18, 51, 13, 0, time.UTC)
+
+// newProject returns a project record with every field set.
+func newProject(n int, shortName string) *catalog.Project {
+	return &catalog.Project{
+		ID:          catalog.ID{byte(n >> 8), byte(n), 0xcc, 0x6b, 0x38, 0x49, 0x08, 0x9d, 0x42},
+		ShortName:   shortName,
+		Name:        "Project " + strconv.Itoa(n),
+		Description: "A project for testing",
+		Tags:        catalog.TagSet{"go", "test"},
+		Homepage:    "https://example.com/" + shortName,
+		CatalogTime: magicTime,
+		CreateTime:  magicTime,
+		Links:       []catalog.Link{{Type: catalog.DependsOn, Target: catalog.ID{0xff, byte(n)}}},
+		Remotes:     []catalog.Remote{{Name: "origin", Role: catalog.RolePrimary, Type: catalog.Git, URL: "https://example.com/" + shortName + ".git"}},
+		PerHost: map[string]*catalog.HostInfo{"example": {
+			Path: "/src/" + shortName,
+			WC:   &catalog.WCStatus{Revision: "0d9c2b3c7bce68ef9950d237eac5ff67f117bff5", Branch: "master", CheckTime: magicTime},
+		}},
+	}
+}
+
+// projectEqual reports whether two project records hold the same data.
+func projectEqual(a, b *catalog.Project) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if !a.CatalogTime.Equal(b.CatalogTime) || !a.CreateTime.Equal(b.CreateTime) {
+		return false
+	}
+	aa, bb := *a, *b
+	aa.CatalogTime, bb.CatalogTime = time.Time{}, time.Time{}
+	aa.CreateTime, bb.CreateTime = time.Time{}, time.Time{}
+	return reflect.DeepEqual(&aa, &bb)
+}
+
+func sortedList(t *testing.T, cat catalog.Catalog) []string {
+	names, err := cat.List()
+	if err != nil {
+		t.Fatal("List error:", err)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func checkList(t *testing.T, cat catalog.Catalog, want ...string) {
+	names := sortedList(t, cat)
+	sort.Strings(want)
+	if len(names) != len(want) || (len(want) > 0 && !reflect.DeepEqual(names, want)) {
+		t.Errorf("List() = %q; want %q", names, want)
+	}
+}
+
+// checkProject verifies that a project can be fetched by both its short name
+// and its ID.
+func checkProject(t *testing.T, cat catalog.Catalog, want *catalog.Project) {
+	if p, err := cat.GetProject(want.ShortName); err != nil || !projectEqual(p, want) {
+		t.Errorf("GetProject(%q) = %+v, %v; want %+v, <nil>", want.ShortName, p, err, want)
+	}
+	if p, err := cat.GetProjectByID(want.ID); err != nil || !projectEqual(p, want) {
+		t.Errorf("GetProjectByID(%v) = %+v, %v; want %+v, <nil>", want.ID, p, err, want)
+	}
+	if sn, err := cat.ShortName(want.ID); err != nil || sn != want.ShortName {
+		t.Errorf("ShortName(%v) = %q, %v; want %q, <nil>", want.ID, sn, err, want.ShortName)
+	}
+}
+
+// checkMissing verifies that a short name and ID are not in the catalog.
+func checkMissing(t *testing.T, cat catalog.Catalog, shortName string, id catalog.ID) {
+	if p, err := cat.GetProject(shortName); err == nil || p != nil {
+		t.Errorf("GetProject(%q) = %+v, %v; want nil, not found", shortName, p, err)
+	} else if !isNotFound(err) {
+		t.Errorf("GetProject(%q) error = %v; want *ProjectError wrapping ErrNotFound", shortName, err)
+	}
+	if p, err := cat.GetProjectByID(id); err == nil || p != nil {
+		t.Errorf("GetProjectByID(%v) = %+v, %v; want nil, not found", id, p, err)
+	} else if !isNotFound(err) {
+		t.Errorf("GetProjectByID(%v) error = %v; want *ProjectError wrapping ErrNotFound", id, err)
+	}
+	if sn, err := cat.ShortName(id); err != nil || sn != "" {
+		t.Errorf("ShortName(%v) = %q, %v; want \"\", <nil>", id, sn, err)
+	}
+}
+
+// isNotFound reports whether err is a *catalog.ProjectError that wraps
+// catalog.ErrNotFound.
+func isNotFound(err error) bool {
+	var perr *catalog.ProjectError
+	return errors.As(err, &perr) && errors.Is(err, catalog.ErrNotFound)
+}
+
+func testEmpty(t *testing.T, cat catalog.Catalog) {
+	checkList(t, cat)
+	checkMissing(t, cat, "foo", newProject(1, "foo").ID)
+}
+
+func testPutGet(t *testing.T, cat catalog.Catalog) {
+	foo, bar := newProject(1, "foo"), newProject(2, "bar")
+	if err := cat.PutProject(foo); err != nil {
+		t.Fatal("PutProject(foo) error:", err)
+	}
+	if err := cat.PutProject(bar); err != nil {
+		t.Fatal("PutProject(bar) error:", err)
+	}
+	checkList(t, cat, "foo", "bar")
+	checkProject(t, cat, newProject(1, "foo"))
+	checkProject(t, cat, newProject(2, "bar"))
+	checkMissing(t, cat, "baz", newProject(3, "baz").ID)
+}
+
+func testUpdate(t *testing.T, cat catalog.Catalog) {
+	if err := cat.PutProject(newProject(1, "foo")); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	p := newProject(1, "foo")
+	p.Name = "Updated"
+	p.Tags = catalog.TagSet{"updated"}
+	p.Remotes = nil
+	if err := cat.PutProject(p); err != nil {
+		t.Fatal("PutProject update error:", err)
+	}
+	checkList(t, cat, "foo")
+	checkProject(t, cat, p)
+}
+
+// testCopy checks that callers cannot modify the catalog's records except
+// through PutProject.
+func testCopy(t *testing.T, cat catalog.Catalog) {
+	p := newProject(1, "foo")
+	if err := cat.PutProject(p); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	p.Tags[0] = "changed"
+	p.Links[0].Type = catalog.PartOf
+	p.Remotes[0].URL = "changed"
+	p.PerHost["example"].Path = "changed"
+	p.PerHost["example"].WC.Dirty = true
+	checkProject(t, cat, newProject(1, "foo"))
+
+	got, err := cat.GetProject("foo")
+	if err != nil {
+		t.Fatal("GetProject error:", err)
+	}
+	got.Tags[0] = "changed"
+	got.Links[0].Type = catalog.PartOf
+	got.Remotes[0].URL = "changed"
+	got.PerHost["example"].Path = "changed"
+	got.PerHost["example"].WC.Dirty = true
+	checkProject(t, cat, newProject(1, "foo"))
+}
+
+func testBadShortName(t *testing.T, cat catalog.Catalog) {
+	for _, sn := range []string{"", "foo bar", "foo/bar", "../foo", "foo.json"} {
+		if err := cat.PutProject(newProject(1, sn)); err == nil {
+			t.Errorf("PutProject with short name %q succeeded", sn)
+		}
+		if p, err := cat.GetProject(sn); err == nil || p != nil {
+			t.Errorf("GetProject(%q) = %+v, %v; want error", sn, p, err)
+		}
+		if err := cat.DelProject(sn); err == nil {
+			t.Errorf("DelProject(%q) succeeded", sn)
+		}
+	}
+	checkList(t, cat)
+}
+
+func testDuplicateShortName(t *testing.T, cat catalog.Catalog) {
+	foo := newProject(1, "foo")
+	if err := cat.PutProject(foo); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	if err := cat.PutProject(newProject(2, "foo")); err == nil {
+		t.Error("PutProject of a different project with the same short name succeeded")
+	}
+	checkList(t, cat, "foo")
+	checkProject(t, cat, foo)
+	checkMissing(t, cat, "bar", newProject(2, "foo").ID)
+}
+
+func testRename(t *testing.T, cat catalog.Catalog) {
+	if err := cat.PutProject(newProject(1, "foo")); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	bar := newProject(1, "bar")
+	if err := cat.PutProject(bar); err != nil {
+		t.Fatal("PutProject rename error:", err)
+	}
+	checkList(t, cat, "bar")
+	checkProject(t, cat, bar)
+	checkRenamed(t, cat, "foo", "bar", bar.ID)
+
+	baz := newProject(1, "baz")
+	if err := cat.PutProject(baz); err != nil {
+		t.Fatal("PutProject second rename error:", err)
+	}
+	checkList(t, cat, "baz")
+	checkProject(t, cat, baz)
+	checkRenamed(t, cat, "foo", "baz", baz.ID)
+	checkRenamed(t, cat, "bar", "baz", baz.ID)
+
+	// A former short name is free to be used again.
+	other := newProject(2, "foo")
+	if err := cat.PutProject(other); err != nil {
+		t.Fatal("PutProject reusing former short name error:", err)
+	}
+	checkList(t, cat, "baz", "foo")
+	checkProject(t, cat, other)
+	checkProject(t, cat, baz)
+	checkRenamed(t, cat, "bar", "baz", baz.ID)
+
+	// Deleting the project forgets its former short names.
+	if err := cat.DelProject("baz"); err != nil {
+		t.Fatal("DelProject error:", err)
+	}
+	checkMissing(t, cat, "bar", baz.ID)
+}
+
+func checkRenamed(t *testing.T, cat catalog.Catalog, old, new string, id catalog.ID) {
+	p, err := cat.GetProject(old)
+	rerr, ok := err.(*catalog.RenamedError)
+	if p != nil || !ok {
+		t.Errorf("GetProject(%q) = %+v, %v; want nil, *RenamedError", old, p, err)
+		return
+	}
+	if want := (catalog.RenamedError{Old: old, New: new, ID: id}); *rerr != want {
+		t.Errorf("GetProject(%q) error = %+v; want %+v", old, *rerr, want)
+	}
+}
+
+func testDel(t *testing.T, cat catalog.Catalog) {
+	foo, bar := newProject(1, "foo"), newProject(2, "bar")
+	if err := cat.PutProject(foo); err != nil {
+		t.Fatal("PutProject(foo) error:", err)
+	}
+	if err := cat.PutProject(bar); err != nil {
+		t.Fatal("PutProject(bar) error:", err)
+	}
+	if err := cat.DelProject("foo"); err != nil {
+		t.Fatal("DelProject error:", err)
+	}
+	checkList(t, cat, "bar")
+	checkMissing(t, cat, "foo", foo.ID)
+	checkProject(t, cat, bar)
+	if err := cat.DelProject("foo"); !isNotFound(err) {
+		t.Errorf("DelProject of missing project error = %v; want *ProjectError wrapping ErrNotFound", err)
+	}
+
+	// A deleted project can be added again.
+	if err := cat.PutProject(foo); err != nil {
+		t.Fatal("PutProject after delete error:", err)
+	}
+	checkProject(t, cat, foo)
+}
+
+func testBatch(t *testing.T, cat catalog.Catalog) {
+	if _, ok := cat.(catalog.Batcher); !ok {
+		t.Skip("catalog is not a Batcher")
+	}
+	foo, bar := newProject(1, "foo"), newProject(2, "bar")
+	err := catalog.Batch(cat, "add projects", func(tx catalog.Catalog) error {
+		if err := tx.PutProject(foo); err != nil {
+			return err
+		}
+		return tx.PutProject(bar)
+	})
+	if err != nil {
+		t.Fatal("Batch error:", err)
+	}
+	checkList(t, cat, "foo", "bar")
+	checkProject(t, cat, foo)
+	checkProject(t, cat, bar)
+
+	errFail := errors.New("fail")
+	err = catalog.Batch(cat, "fail", func(tx catalog.Catalog) error {
+		if err := tx.DelProject("foo"); err != nil {
+			return err
+		}
+		if err := tx.PutProject(newProject(3, "baz")); err != nil {
+			return err
+		}
+		return errFail
+	})
+	if err != errFail {
+		t.Errorf("failed Batch error = %v; want %v", err, errFail)
+	}
+	checkList(t, cat, "foo", "bar")
+	checkProject(t, cat, foo)
+	checkMissing(t, cat, "baz", newProject(3, "baz").ID)
+}
+
+func testSchema(t *testing.T, cat catalog.Catalog) {
+	sc, ok := cat.(catalog.Schemer)
+	if !ok {
+		t.Skip("catalog is not a Schemer")
+	}
+	if s, err := sc.Schema(); err != nil {
+		t.Fatal("Schema error:", err)
+	} else if len(s.Fields) != 0 {
+		t.Errorf("new catalog schema = %+v; want no fields", s)
+	}
+	schema := &catalog.Schema{Fields: []catalog.FieldDef{
+		{Name: "owner", Type: catalog.TextField, Required: true},
+		{Name: "lang", Type: catalog.TextField, Values: []string{"c", "go"}},
+	}}
+	if err := sc.PutSchema(schema); err != nil {
+		t.Fatal("PutSchema error:", err)
+	}
+	if s, err := sc.Schema(); err != nil {
+		t.Error("Schema error:", err)
+	} else if !reflect.DeepEqual(s, schema) {
+		t.Errorf("Schema() = %+v; want %+v", s, schema)
+	}
+
+	foo := newProject(1, "foo")
+	foo.Fields = map[string]string{"owner": "alice", "lang": "go"}
+	if err := cat.PutProject(foo); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	checkProject(t, cat, foo)
+
+	bad := []map[string]string{
+		nil,
+		{"lang": "go"},
+		{"owner": "bob", "lang": "rust"},
+		{"owner": "bob", "cost": "1"},
+	}
+	for _, fields := range bad {
+		bar := newProject(2, "bar")
+		bar.Fields = fields
+		var ferr *catalog.FieldError
+		if err := cat.PutProject(bar); !errors.As(err, &ferr) {
+			t.Errorf("PutProject with fields %v error = %v; want *FieldError", fields, err)
+		}
+	}
+	checkList(t, cat, "foo")
+}
+
+func testBadStatus(t *testing.T, cat catalog.Catalog) {
+	foo := newProject(1, "foo")
+	if err := cat.PutProject(foo); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+
+	bad := newProject(1, "foo")
+	bad.Status = "bogus"
+	var serr catalog.StatusError
+	if err := cat.PutProject(bad); !errors.As(err, &serr) {
+		t.Errorf("PutProject with status %q error = %v; want StatusError", bad.Status, err)
+	}
+	bad = newProject(2, "bar")
+	bad.Status = catalog.StatusArchived
+	bad.StatusHistory = []catalog.StatusChange{{Status: "bogus", Time: magicTime}, {Status: catalog.StatusArchived, Time: magicTime}}
+	if err := cat.PutProject(bad); !errors.As(err, &serr) {
+		t.Errorf("PutProject with status history %v error = %v; want StatusError", bad.StatusHistory, err)
+	}
+	checkList(t, cat, "foo")
+	checkProject(t, cat, foo)
+}
+
+func testConcurrent(t *testing.T, cat catalog.Catalog) {
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, 3*n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p := newProject(i, "p"+strconv.Itoa(i))
+			if err := cat.PutProject(p); err != nil {
+				errs <- err
+				return
+			}
+			if got, err := cat.GetProject(p.ShortName); err != nil {
+				errs <- err
+			} else if !projectEqual(got, p) {
+				errs <- errors.New("GetProject(" + p.ShortName + ") returned a different project")
+			}
+			if _, err := cat.List(); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if names := sortedList(t, cat); len(names) != n {
+		t.Errorf("len(List()) = %d; want %d", len(names), n)
+	}
+}
@@ -0,0 +1,40 @@
+package catalog_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bitbucket.org/zombiezen/blackforest/catalog"
+	"bitbucket.org/zombiezen/blackforest/catalog/catalogtest"
+)
+
+func TestLocalConformance(t *testing.T) {
+	catalogtest.Test(t, func() (catalog.Catalog, func(), error) {
+		dir, err := ioutil.TempDir("", "blackforest-conformance")
+		if err != nil {
+			return nil, nil, err
+		}
+		done := func() { os.RemoveAll(dir) }
+		cat, err := catalog.Create(filepath.Join(dir, "catalog"))
+		if err != nil {
+			done()
+			return nil, nil, err
+		}
+		return cat, done, nil
+	})
+}
+
+func TestMemoryConformance(t *testing.T) {
+	catalogtest.Test(t, func() (catalog.Catalog, func(), error) {
+		return catalog.NewMemory(), nil, nil
+	})
+}
+
+func TestCacheConformance(t *testing.T) {
+	catalogtest.Test(t, func() (catalog.Catalog, func(), error) {
+		cat, err := catalog.NewCache(catalog.NewMemory())
+		return cat, nil, err
+	})
+}
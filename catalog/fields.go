@@ -0,0 +1,300 @@
+package catalog
+
+import (
+	"errors"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A FieldType is the type of a custom project field.  Field values are always
+// stored as strings; the type determines which strings are valid.
+type FieldType string
+
+// Field types
+const (
+	TextField FieldType = "text"
+	IntField  FieldType = "int"
+	BoolField FieldType = "bool"
+	URLField  FieldType = "url"
+	DateField FieldType = "date" // formatted as YYYY-MM-DD
+)
+
+// FieldTypes returns every valid field type.
+func FieldTypes() []FieldType {
+	return []FieldType{TextField, IntField, BoolField, URLField, DateField}
+}
+
+// IsValid reports whether t is one of the defined field types.
+func (t FieldType) IsValid() bool {
+	for _, ft := range FieldTypes() {
+		if t == ft {
+			return true
+		}
+	}
+	return false
+}
+
+const dateLayout = "2006-01-02"
+
+// A FieldDef describes a custom project field.
+type FieldDef struct {
+	Name        string    `json:"name"`
+	Type        FieldType `json:"type"`
+	Description string    `json:"description,omitempty"`
+
+	// Values is the list of allowed values.  If empty, any value of the
+	// field's type is allowed.
+	Values []string `json:"values,omitempty"`
+
+	// Required is true if every project must have a value for the field.
+	Required bool `json:"required,omitempty"`
+}
+
+// Parse checks that s is a valid value for the field and returns it in
+// canonical form.
+func (def *FieldDef) Parse(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	switch def.Type {
+	case TextField:
+	case IntField:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return "", &FieldError{Field: def.Name, Value: s, Err: errors.New("not an integer")}
+		}
+		s = strconv.FormatInt(n, 10)
+	case BoolField:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return "", &FieldError{Field: def.Name, Value: s, Err: errors.New("not true or false")}
+		}
+		s = strconv.FormatBool(b)
+	case URLField:
+		u, err := url.Parse(s)
+		if err != nil || !u.IsAbs() {
+			return "", &FieldError{Field: def.Name, Value: s, Err: errors.New("not an absolute URL")}
+		}
+	case DateField:
+		if _, err := time.Parse(dateLayout, s); err != nil {
+			return "", &FieldError{Field: def.Name, Value: s, Err: errors.New("not a date (YYYY-MM-DD)")}
+		}
+	default:
+		return "", &FieldError{Field: def.Name, Err: errors.New("unknown type " + strconv.Quote(string(def.Type)))}
+	}
+	if len(def.Values) > 0 && !containsString(def.Values, s) {
+		return "", &FieldError{Field: def.Name, Value: s, Err: errors.New("must be one of " + strings.Join(def.Values, ", "))}
+	}
+	return s, nil
+}
+
+// A Schema is the set of custom fields that projects in a catalog may have.
+type Schema struct {
+	Fields []FieldDef `json:"fields"`
+}
+
+// Field returns the definition of the named field or nil if the schema does
+// not have the field.
+func (s *Schema) Field(name string) *FieldDef {
+	for i := range s.Fields {
+		if s.Fields[i].Name == name {
+			return &s.Fields[i]
+		}
+	}
+	return nil
+}
+
+// Check returns an error if the schema itself is malformed.
+func (s *Schema) Check() error {
+	seen := make(map[string]bool, len(s.Fields))
+	for i := range s.Fields {
+		def := &s.Fields[i]
+		if !IsValidFieldName(def.Name) {
+			return &FieldError{Field: def.Name, Err: errors.New("invalid field name")}
+		}
+		if seen[def.Name] {
+			return &FieldError{Field: def.Name, Err: errors.New("defined more than once")}
+		}
+		seen[def.Name] = true
+		if !def.Type.IsValid() {
+			return &FieldError{Field: def.Name, Err: errors.New("unknown type " + strconv.Quote(string(def.Type)))}
+		}
+		for _, v := range def.Values {
+			if _, err := (&FieldDef{Name: def.Name, Type: def.Type}).Parse(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Validate returns a *FieldError for the first of the project's fields that
+// does not conform to the schema, or nil if all of them do.  Values must be in
+// the canonical form returned by FieldDef.Parse.
+func (s *Schema) Validate(proj *Project) error {
+	return s.ValidateChange(nil, proj)
+}
+
+// ValidateChange is like Validate, but only checks the fields that differ
+// between old and proj, the stored and new versions of a project.  A project
+// that stopped conforming when the schema changed can then still be updated.
+// A required field is only reported missing if the change removes it.  A nil
+// old checks every field, as Validate does.
+func (s *Schema) ValidateChange(old, proj *Project) error {
+	var oldFields map[string]string
+	if old != nil {
+		oldFields = old.Fields
+	}
+	names := make([]string, 0, len(proj.Fields))
+	for name, v := range proj.Fields {
+		if ov, ok := oldFields[name]; old == nil || !ok || ov != v {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		def := s.Field(name)
+		if def == nil {
+			return &FieldError{Field: name, Err: ErrUnknownField}
+		}
+		v := proj.Fields[name]
+		if canon, err := def.Parse(v); err != nil {
+			return err
+		} else if canon != v {
+			return &FieldError{Field: name, Value: v, Err: errors.New("not in canonical form " + strconv.Quote(canon))}
+		}
+	}
+	for i := range s.Fields {
+		def := &s.Fields[i]
+		if !def.Required {
+			continue
+		}
+		_, had := oldFields[def.Name]
+		if _, ok := proj.Fields[def.Name]; !ok && (old == nil || had) {
+			return &FieldError{Field: def.Name, Err: ErrFieldRequired}
+		}
+	}
+	return nil
+}
+
+// Field name restrictions
+const maxFieldNameLen = 32
+
+// reservedFieldNames are names that conflict with search query prefixes.
+var reservedFieldNames = []string{"tag", "status"}
+
+// IsValidFieldName reports whether name can be used as a custom field name.
+// Field names are lowercase letters, digits, hyphens, and underscores,
+// starting with a letter.
+func IsValidFieldName(name string) bool {
+	if name == "" || len(name) > maxFieldNameLen || containsString(reservedFieldNames, name) {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z':
+		case i > 0 && (c >= '0' && c <= '9' || c == '-' || c == '_'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, t := range list {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Field errors
+var (
+	ErrUnknownField  = errors.New("not in the catalog's field schema")
+	ErrFieldRequired = errors.New("required")
+)
+
+// A FieldError is returned when a project field or field definition is invalid.
+type FieldError struct {
+	Field string
+	Value string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	if e.Value != "" {
+		return "field " + e.Field + ": " + strconv.Quote(e.Value) + " " + e.Err.Error()
+	}
+	return "field " + e.Field + ": " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// A Schemer is a Catalog that has a schema for custom project fields.
+// PutProject returns an error for new projects that do not conform to the
+// schema and for changes to fields that do not conform to it.
+type Schemer interface {
+	Catalog
+
+	// Schema returns the catalog's field schema.
+	Schema() (*Schema, error)
+
+	// PutSchema replaces the catalog's field schema.  Existing projects
+	// are not checked against the new schema, and they can still be
+	// changed without setting newly required fields.  Verify reports the
+	// projects that do not conform.
+	PutSchema(s *Schema) error
+}
+
+// GetSchema returns cat's field schema, or an empty schema if cat is not a
+// Schemer.
+func GetSchema(cat Catalog) (*Schema, error) {
+	if s, ok := cat.(Schemer); ok {
+		return s.Schema()
+	}
+	return new(Schema), nil
+}
+
+// Schema reads the catalog's fields.json.  A catalog without the file has
+// an empty schema.
+func (cat *localCatalog) Schema() (*Schema, error) {
+	s := new(Schema)
+	err := readJSON(cat.fs, filepath.Join(cat.root, fieldsFile), s)
+	if cat.fs.IsNotExist(err) {
+		return new(Schema), nil
+	} else if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// PutSchema writes the catalog's fields.json.
+func (cat *localCatalog) PutSchema(s *Schema) error {
+	if err := s.Check(); err != nil {
+		return err
+	}
+	if s.Fields == nil {
+		s = &Schema{Fields: []FieldDef{}}
+	}
+	return cat.doChange("change field schema", func() error {
+		path := filepath.Join(cat.root, fieldsFile)
+		_, err := readFile(cat.fs, path)
+		isNew := cat.fs.IsNotExist(err)
+		if err != nil && !isNew {
+			return err
+		}
+		if err := writeJSON(cat.fs, path, s, false); err != nil {
+			return err
+		}
+		if isNew && cat.wc != nil {
+			return cat.wc.Add([]string{fieldsFile})
+		}
+		return nil
+	})
+}
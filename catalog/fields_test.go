@@ -0,0 +1,180 @@
+package catalog
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestFieldDefParse(t *testing.T) {
+	tests := []struct {
+		def   FieldDef
+		value string
+		want  string
+		ok    bool
+	}{
+		{FieldDef{Type: TextField}, " hello ", "hello", true},
+		{FieldDef{Type: IntField}, "042", "42", true},
+		{FieldDef{Type: IntField}, "4.2", "", false},
+		{FieldDef{Type: BoolField}, "T", "true", true},
+		{FieldDef{Type: BoolField}, "yes", "", false},
+		{FieldDef{Type: URLField}, "https://ci.example.com/foo", "https://ci.example.com/foo", true},
+		{FieldDef{Type: URLField}, "ci.example.com/foo", "", false},
+		{FieldDef{Type: DateField}, "2013-02-07", "2013-02-07", true},
+		{FieldDef{Type: DateField}, "2013-2-7", "", false},
+		{FieldDef{Type: TextField, Values: []string{"c", "go"}}, "go", "go", true},
+		{FieldDef{Type: TextField, Values: []string{"c", "go"}}, "Go", "", false},
+		{FieldDef{Type: "money"}, "1", "", false},
+	}
+	for _, test := range tests {
+		test.def.Name = "f"
+		got, err := test.def.Parse(test.value)
+		switch {
+		case !test.ok && err == nil:
+			t.Errorf("%+v.Parse(%q) = %q; want error", test.def, test.value, got)
+		case test.ok && err != nil:
+			t.Errorf("%+v.Parse(%q) error: %v", test.def, test.value, err)
+		case test.ok && got != test.want:
+			t.Errorf("%+v.Parse(%q) = %q; want %q", test.def, test.value, got, test.want)
+		}
+	}
+}
+
+func TestSchemaCheck(t *testing.T) {
+	tests := []struct {
+		schema Schema
+		ok     bool
+	}{
+		{Schema{}, true},
+		{Schema{[]FieldDef{{Name: "owner", Type: TextField}, {Name: "cost-center", Type: IntField, Values: []string{"1", "2"}}}}, true},
+		{Schema{[]FieldDef{{Name: "Owner", Type: TextField}}}, false},
+		{Schema{[]FieldDef{{Name: "tag", Type: TextField}}}, false},
+		{Schema{[]FieldDef{{Name: "owner", Type: "person"}}}, false},
+		{Schema{[]FieldDef{{Name: "owner", Type: TextField}, {Name: "owner", Type: IntField}}}, false},
+		{Schema{[]FieldDef{{Name: "cost", Type: IntField, Values: []string{"cheap"}}}}, false},
+	}
+	for _, test := range tests {
+		err := test.schema.Check()
+		if test.ok && err != nil {
+			t.Errorf("%+v.Check() error: %v", test.schema, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("%+v.Check() = nil; want error", test.schema)
+		}
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	s := &Schema{[]FieldDef{
+		{Name: "owner", Type: TextField, Required: true},
+		{Name: "cost", Type: IntField},
+	}}
+	tests := []struct {
+		fields map[string]string
+		ok     bool
+		err    error // if not nil, the error must wrap err
+	}{
+		{map[string]string{"owner": "alice"}, true, nil},
+		{map[string]string{"owner": "alice", "cost": "12"}, true, nil},
+		{map[string]string{"cost": "12"}, false, ErrFieldRequired},
+		{map[string]string{"owner": "alice", "lang": "go"}, false, ErrUnknownField},
+		{map[string]string{"owner": "alice", "cost": "012"}, false, nil},
+	}
+	for _, test := range tests {
+		err := s.Validate(&Project{Fields: test.fields})
+		switch {
+		case test.ok && err != nil:
+			t.Errorf("Validate(%v) error: %v", test.fields, err)
+		case !test.ok && err == nil:
+			t.Errorf("Validate(%v) = nil; want error", test.fields)
+		case test.err != nil && !errors.Is(err, test.err):
+			t.Errorf("Validate(%v) error = %v; want %v", test.fields, err, test.err)
+		}
+	}
+}
+
+func TestLocalSchema(t *testing.T) {
+	cat, fs, wc := newTestCatalog()
+	if s, err := cat.Schema(); err != nil {
+		t.Fatal("Schema error:", err)
+	} else if len(s.Fields) != 0 {
+		t.Errorf("Schema() = %+v; want empty", s)
+	}
+	if err := cat.PutSchema(&Schema{[]FieldDef{{Name: "owner", Type: TextField}}}); err != nil {
+		t.Fatal("PutSchema error:", err)
+	}
+	if _, ok := fs.files[filepath.Join(cat.root, fieldsFile)]; !ok {
+		t.Error("fields.json not written")
+	}
+	if len(wc.added) != 1 || wc.added[0] != fieldsFile {
+		t.Errorf("added files = %q; want [%q]", wc.added, fieldsFile)
+	}
+	if !wc.committed {
+		t.Error("schema change not committed")
+	}
+	if err := cat.PutSchema(&Schema{[]FieldDef{{Name: "9lives", Type: TextField}}}); err == nil {
+		t.Error("PutSchema with bad field name succeeded")
+	}
+}
+
+func TestSchemaValidateChange(t *testing.T) {
+	s := &Schema{[]FieldDef{
+		{Name: "owner", Type: TextField, Required: true},
+		{Name: "cost", Type: IntField},
+	}}
+	tests := []struct {
+		old, new map[string]string
+		ok       bool
+	}{
+		{nil, map[string]string{"cost": "12"}, true},
+		{map[string]string{"cost": "012"}, map[string]string{"cost": "012"}, true},
+		{map[string]string{"cost": "12"}, map[string]string{"cost": "012"}, false},
+		{map[string]string{"owner": "alice"}, map[string]string{}, false},
+		{map[string]string{"owner": "alice"}, map[string]string{"owner": "bob"}, true},
+	}
+	for _, test := range tests {
+		err := s.ValidateChange(&Project{Fields: test.old}, &Project{Fields: test.new})
+		if test.ok && err != nil {
+			t.Errorf("ValidateChange(%v, %v) error: %v", test.old, test.new, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("ValidateChange(%v, %v) = nil; want error", test.old, test.new)
+		}
+	}
+}
+
+func TestLocalPutSchema_RequiredField(t *testing.T) {
+	m := NewMemory()
+	if err := m.PutProject(&Project{ID: ID{1}, ShortName: "foo", PerHost: map[string]*HostInfo{"laptop": {Path: "/src/foo"}}}); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	if err := m.PutSchema(&Schema{[]FieldDef{{Name: "owner", Type: TextField, Required: true}}}); err != nil {
+		t.Fatal("PutSchema error:", err)
+	}
+
+	// Changes that don't touch the new field still work.
+	if err := RemoveHost(m, "laptop"); err != nil {
+		t.Error("RemoveHost error:", err)
+	}
+	proj, err := m.GetProject("foo")
+	if err != nil {
+		t.Fatal("GetProject error:", err)
+	}
+	proj.Name = "Foo"
+	if err := m.PutProject(proj); err != nil {
+		t.Error("PutProject with unrelated change error:", err)
+	}
+
+	// Setting the field makes it stick.
+	proj.Fields = map[string]string{"owner": "alice"}
+	if err := m.PutProject(proj); err != nil {
+		t.Fatal("PutProject with owner error:", err)
+	}
+	proj.Fields = nil
+	if err := m.PutProject(proj); !errors.Is(err, ErrFieldRequired) {
+		t.Errorf("PutProject removing owner error = %v; want %v", err, ErrFieldRequired)
+	}
+
+	// New projects must have it.
+	if err := m.PutProject(&Project{ID: ID{2}, ShortName: "bar"}); !errors.Is(err, ErrFieldRequired) {
+		t.Errorf("PutProject(bar) error = %v; want %v", err, ErrFieldRequired)
+	}
+}
@@ -0,0 +1,111 @@
+package catalog
+
+import (
+	"sort"
+	"strings"
+)
+
+// MinIDPrefixLen is the shortest ID prefix that FindProject will match.
+const MinIDPrefixLen = 4
+
+// idLister is implemented by catalogs that can list their IDs without reading
+// every project.
+type idLister interface {
+	ids() ([]ID, error)
+}
+
+// formerNamer is implemented by catalogs that remember the short names that
+// projects were renamed from.  The map is from former short name to ID.
+type formerNamer interface {
+	formerNames() (map[string]ID, error)
+}
+
+// listIDs returns all of the IDs in a catalog.
+func listIDs(cat Catalog) ([]ID, error) {
+	if l, ok := cat.(idLister); ok {
+		return l.ids()
+	}
+	names, err := cat.List()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]ID, 0, len(names))
+	for _, sn := range names {
+		p, err := cat.GetProject(sn)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, p.ID)
+	}
+	return ids, nil
+}
+
+// LookupID finds the ID in the catalog that starts with prefix.  If more than
+// one ID matches, then an *AmbiguousIDError is returned.
+func LookupID(cat Catalog, prefix string) (ID, error) {
+	ids, err := listIDs(cat)
+	if err != nil {
+		return ID{}, err
+	}
+	var matches []ID
+	for _, id := range ids {
+		if strings.HasPrefix(id.String(), prefix) {
+			matches = append(matches, id)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return ID{}, &ProjectError{ShortName: prefix, Op: "get", Err: ErrNotFound}
+	case 1:
+		return matches[0], nil
+	default:
+		return ID{}, &AmbiguousIDError{Prefix: prefix, IDs: matches}
+	}
+}
+
+// FindProject fetches a project by its short name, its ID, or a unique prefix
+// of its ID at least MinIDPrefixLen characters long.  Short names (including
+// former short names, which produce a *RenamedError) take precedence over IDs.
+func FindProject(cat Catalog, name string) (*Project, error) {
+	var getErr error
+	if isValidShortName(name) {
+		proj, err := cat.GetProject(name)
+		if err == nil {
+			return proj, nil
+		} else if isRenamed(err) {
+			return nil, err
+		}
+		getErr = err
+	} else {
+		getErr = shortNameError(name)
+	}
+
+	if len(name) >= MinIDPrefixLen && len(name) <= IDEncodedLen {
+		id, err := LookupID(cat, name)
+		if err == nil {
+			return cat.GetProjectByID(id)
+		}
+		if _, ok := err.(*AmbiguousIDError); ok {
+			return nil, err
+		}
+	}
+	if getErr == nil {
+		getErr = &ProjectError{ShortName: name, Op: "get", Err: ErrNotFound}
+	}
+	return nil, getErr
+}
+
+// AmbiguousIDError is returned when an ID prefix matches more than one project.
+type AmbiguousIDError struct {
+	Prefix string
+	IDs    []ID
+}
+
+func (e *AmbiguousIDError) Error() string {
+	ids := make([]string, len(e.IDs))
+	for i := range e.IDs {
+		ids[i] = e.IDs[i].String()
+	}
+	sort.Strings(ids)
+	return `ambiguous ID prefix "` + e.Prefix + `" matches ` + strings.Join(ids, ", ")
+}
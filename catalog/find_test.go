@@ -0,0 +1,98 @@
+package catalog
+
+import (
+	"testing"
+)
+
+func TestParseID(t *testing.T) {
+	tests := []struct {
+		s  string
+		id ID
+		ok bool
+	}{
+		{"b11dzGs4SQid", ID{0x6f, 0x5d, 0x5d, 0xcc, 0x6b, 0x38, 0x49, 0x08, 0x9d}, true},
+		{"unu7bCtmYVT7", ID{0xba, 0x7b, 0xbb, 0x6c, 0x2b, 0x66, 0x61, 0x54, 0xfb}, true},
+		{"", ID{}, false},
+		{"b11dzGs4SQi", ID{}, false},
+		{"b11dzGs4SQid=", ID{}, false},
+		{"b11dzGs4SQ.d", ID{}, false},
+	}
+	for _, test := range tests {
+		id, err := ParseID(test.s)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("ParseID(%q) = %v; want error", test.s, id)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseID(%q) error: %v", test.s, err)
+		} else if id != test.id {
+			t.Errorf("ParseID(%q) = %v; want %v", test.s, id, test.id)
+		}
+	}
+}
+
+func TestFindProject(t *testing.T) {
+	cat, _, _ := newTestCatalog()
+	other := &Project{ID: ID{0x6f, 0x5d, 0x5d, 0xff}, ShortName: "b11d", Name: "Confusing"}
+	if err := cat.PutProject(other); err != nil {
+		t.Fatal("put error:", err)
+	}
+	cache, err := NewCache(cat)
+	if err != nil {
+		t.Fatal("NewCache error:", err)
+	}
+
+	tests := []struct {
+		name      string
+		shortName string
+	}{
+		{name: "blackforest", shortName: "blackforest"},
+		{name: "b11dzGs4SQid", shortName: "blackforest"},
+		{name: "b11dz", shortName: "blackforest"},
+		{name: "b11d", shortName: "b11d"},
+		{name: "b11", shortName: ""},
+		{name: "b11d_", shortName: "b11d"},
+		{name: "zzzz", shortName: ""},
+		{name: "nope.", shortName: ""},
+	}
+	for _, c := range []Catalog{cat, cache} {
+		for _, test := range tests {
+			proj, err := FindProject(c, test.name)
+			switch {
+			case test.shortName == "":
+				if err == nil {
+					t.Errorf("FindProject(%T, %q) = %v; want error", c, test.name, proj)
+				}
+			case err != nil:
+				t.Errorf("FindProject(%T, %q) error: %v", c, test.name, err)
+			case proj.ShortName != test.shortName:
+				t.Errorf("FindProject(%T, %q).ShortName = %q; want %q", c, test.name, proj.ShortName, test.shortName)
+			}
+		}
+	}
+}
+
+func TestLookupID_Ambiguous(t *testing.T) {
+	cat, _, _ := newTestCatalog()
+	other := &Project{ID: ID{0x6f, 0x5d, 0x5d, 0xff}, ShortName: "other", Name: "Other"}
+	if err := cat.PutProject(other); err != nil {
+		t.Fatal("put error:", err)
+	}
+	if id, err := LookupID(cat, "b11d"); err == nil {
+		t.Errorf("LookupID(cat, %q) = %v; want error", "b11d", id)
+	} else if _, ok := err.(*AmbiguousIDError); !ok {
+		t.Errorf("LookupID(cat, %q) error = %v; want *AmbiguousIDError", "b11d", err)
+	}
+	if _, err := FindProject(cat, "b11d"); err == nil {
+		t.Errorf("FindProject(cat, %q) = nil error; want *AmbiguousIDError", "b11d")
+	} else if _, ok := err.(*AmbiguousIDError); !ok {
+		t.Errorf("FindProject(cat, %q) error = %v; want *AmbiguousIDError", "b11d", err)
+	}
+	if id, err := LookupID(cat, "b11dz"); err != nil {
+		t.Errorf("LookupID(cat, %q) error: %v", "b11dz", err)
+	} else if want := (ID{0x6f, 0x5d, 0x5d, 0xcc, 0x6b, 0x38, 0x49, 0x08, 0x9d}); id != want {
+		t.Errorf("LookupID(cat, %q) = %v; want %v", "b11dz", id, want)
+	}
+}
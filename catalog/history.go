@@ -0,0 +1,304 @@
+package catalog
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"bitbucket.org/zombiezen/blackforest/vcs"
+)
+
+// A ProjectVersion is a project's record as it was after a changeset in the
+// catalog's working copy.
+type ProjectVersion struct {
+	vcs.Changeset
+
+	// Project is the project's record, or nil if the changeset purged the
+	// project from the catalog.
+	Project *Project
+
+	// Deleted is true if the project was in the trash.
+	Deleted bool
+
+	// Changes are the fields that differ from the previous version, sorted
+	// by field.
+	Changes []FieldChange
+}
+
+// A FieldChange is a difference in one field of a project's JSON record.
+// Field is the field's path in the record, like "remotes[0].url".  Old and
+// New are JSON values; Old is empty for an added field and New is empty for a
+// removed field.
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// History returns the versions of the project with the given ID in the
+// catalog at the root of wc, most recent first.  Only committed changesets
+// are read.  The project is followed across short name changes and through
+// the trash.  Versions from catalogs in older formats are upgraded before
+// being compared, so format changes do not show up as changes to the
+// project.
+func History(wc vcs.Logger, id ID) ([]*ProjectVersion, error) {
+	const op = "history"
+
+	log, names, err := projectLog(wc, id)
+	if err != nil {
+		return nil, &ProjectError{ShortName: id.String(), Op: op, Err: err}
+	}
+	if len(log) == 0 {
+		return nil, &ProjectError{ShortName: id.String(), Op: op, Err: ErrNotFound}
+	}
+	keep := func(path string) bool {
+		path = filepath.ToSlash(path)
+		return path == versionFile || path == catalogFile || names[path]
+	}
+
+	var versions []*ProjectVersion
+	var prev map[string]string
+	prevState := absentState
+	for i := len(log) - 1; i >= 0; i-- {
+		cat, err := openRev(wc, log[i].Rev, keep)
+		if err != nil {
+			return nil, &ProjectError{ShortName: id.String(), Op: op, Err: err}
+		}
+		v := &ProjectVersion{Changeset: log[i]}
+		v.Project, err = cat.GetProjectByID(id)
+		if IsNotFound(err) {
+			var tp *TrashedProject
+			tp, err = cat.readTrashed(trashPath(id))
+			if err == nil {
+				v.Project, v.Deleted = tp.Project, true
+			} else if cat.fs.IsNotExist(err) {
+				err = nil
+			}
+		}
+		if err != nil {
+			return nil, &ProjectError{ShortName: id.String(), Op: op, Err: err}
+		}
+
+		fields, err := flattenProject(v.Project)
+		if err != nil {
+			return nil, &ProjectError{ShortName: id.String(), Op: op, Err: err}
+		}
+		v.Changes = diffFields(prev, fields)
+		state := versionState(v)
+		if state == prevState && len(v.Changes) == 0 {
+			continue
+		}
+		versions = append(versions, v)
+		prev, prevState = fields, state
+	}
+
+	// Reverse to most recent first.
+	for i, j := 0, len(versions)-1; i < j; i, j = i+1, j-1 {
+		versions[i], versions[j] = versions[j], versions[i]
+	}
+	return versions, nil
+}
+
+// projectLog finds the changesets that touched the project with the given ID.
+// It returns the changesets, most recent first, along with the set of files
+// (slash-separated and relative to the working copy root) that held the
+// project at some point.  Short names are found from catalog.json in the
+// current changeset and each changeset in the log, until no new short names
+// turn up.
+func projectLog(wc vcs.Logger, id ID) ([]vcs.Changeset, map[string]bool, error) {
+	idString := id.String()
+	names := map[string]bool{
+		filepath.ToSlash(trashPath(id)): true,
+	}
+	addNames := func(rev vcs.Rev) (bool, error) {
+		data, err := wc.ReadFile(rev, catalogFile)
+		if err != nil {
+			// Changesets from before the catalog was added (or the
+			// working copy's first changeset) have no catalog.json.
+			return false, nil
+		}
+		meta := new(catalogMeta)
+		if err := json.Unmarshal(data, meta); err != nil {
+			return false, err
+		}
+		added := false
+		add := func(sn string) {
+			p := filepath.ToSlash(filepath.Join(projectsDir, sn+jsonExt))
+			if isValidShortName(sn) && !names[p] {
+				names[p] = true
+				added = true
+			}
+		}
+		add(meta.ShortNameMap[idString])
+		for former, formerID := range meta.FormerNames {
+			if formerID == idString {
+				add(former)
+			}
+		}
+		return added, nil
+	}
+
+	head, err := wc.Current()
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := addNames(head); err != nil {
+		return nil, nil, err
+	}
+	if data, err := wc.ReadFile(head, trashPath(id)); err == nil {
+		tp := new(TrashedProject)
+		if json.Unmarshal(data, tp) == nil && tp.Project != nil && isValidShortName(tp.Project.ShortName) {
+			names[filepath.ToSlash(filepath.Join(projectsDir, tp.Project.ShortName+jsonExt))] = true
+		}
+	}
+
+	read := make(map[string]bool)
+	for {
+		paths := make([]string, 0, len(names))
+		for p := range names {
+			paths = append(paths, filepath.FromSlash(p))
+		}
+		sort.Strings(paths)
+		log, err := wc.Log(paths)
+		if err != nil {
+			return nil, nil, err
+		}
+		grew := false
+		for _, c := range log {
+			if read[c.Rev.Rev()] {
+				continue
+			}
+			read[c.Rev.Rev()] = true
+			added, err := addNames(c.Rev)
+			if err != nil {
+				return nil, nil, err
+			}
+			grew = grew || added
+		}
+		if !grew {
+			return log, names, nil
+		}
+	}
+}
+
+// Project version states
+const (
+	absentState = iota
+	presentState
+	deletedState
+)
+
+func versionState(v *ProjectVersion) int {
+	switch {
+	case v.Project == nil:
+		return absentState
+	case v.Deleted:
+		return deletedState
+	default:
+		return presentState
+	}
+}
+
+// flattenProject returns the leaves of proj's JSON record, keyed by path.  A
+// nil proj has no fields.
+func flattenProject(proj *Project) (map[string]string, error) {
+	fields := make(map[string]string)
+	if proj == nil {
+		return fields, nil
+	}
+	data, err := json.Marshal(proj)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if err := flattenJSON(fields, "", v); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func flattenJSON(fields map[string]string, path string, v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			fields[path] = "{}"
+			return nil
+		}
+		for k, elem := range v {
+			if err := flattenJSON(fields, fieldPath(path, k), elem); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			fields[path] = "[]"
+			return nil
+		}
+		for i, elem := range v {
+			if err := flattenJSON(fields, path+"["+strconv.Itoa(i)+"]", elem); err != nil {
+				return err
+			}
+		}
+	default:
+		buf := new(bytes.Buffer)
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		fields[path] = string(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	}
+	return nil
+}
+
+// fieldPath appends the object key k to path.  Keys that are not made of
+// letters, digits, underscores, and hyphens (like host names) are quoted.
+func fieldPath(path, k string) string {
+	if k == "" || !isFieldPathKey(k) {
+		return path + "[" + strconv.Quote(k) + "]"
+	}
+	if path == "" {
+		return k
+	}
+	return path + "." + k
+}
+
+func isFieldPathKey(k string) bool {
+	for _, c := range k {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// diffFields returns the changes from old to new, sorted by field.
+func diffFields(old, new map[string]string) []FieldChange {
+	var changes []FieldChange
+	for f, nv := range new {
+		if ov, ok := old[f]; !ok || ov != nv {
+			changes = append(changes, FieldChange{Field: f, Old: ov, New: nv})
+		}
+	}
+	for f, ov := range old {
+		if _, ok := new[f]; !ok {
+			changes = append(changes, FieldChange{Field: f, Old: ov})
+		}
+	}
+	sort.Sort(byField(changes))
+	return changes
+}
+
+// byField sorts field changes by field.
+type byField []FieldChange
+
+func (a byField) Len() int           { return len(a) }
+func (a byField) Less(i, j int) bool { return a[i].Field < a[j].Field }
+func (a byField) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
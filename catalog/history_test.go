@@ -0,0 +1,160 @@
+package catalog
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"bitbucket.org/zombiezen/blackforest/vcs"
+)
+
+// mockLogger is a mockRevReader whose changesets were committed in order.
+type mockLogger struct {
+	*mockRevReader
+	order []string // oldest first
+}
+
+func (wc *mockLogger) Current() (vcs.Rev, error) {
+	return mockRev(wc.order[len(wc.order)-1]), nil
+}
+
+// Log returns the changesets that changed the contents of any of the paths.
+func (wc *mockLogger) Log(paths []string) ([]vcs.Changeset, error) {
+	var log []vcs.Changeset
+	for i := len(wc.order) - 1; i >= 0; i-- {
+		curr := wc.revs[wc.order[i]]
+		var prev map[string]string
+		if i > 0 {
+			prev = wc.revs[wc.order[i-1]]
+		}
+		for _, p := range paths {
+			p = filepath.ToSlash(p)
+			if curr[p] != prev[p] {
+				log = append(log, vcs.Changeset{
+					Rev:     mockRev(wc.order[i]),
+					Time:    time.Unix(int64(i), 0),
+					Message: "change " + wc.order[i],
+				})
+				break
+			}
+		}
+	}
+	return log, nil
+}
+
+func TestHistory(t *testing.T) {
+	const (
+		v2Foo   = `{"id": "b11dzGs4SQid", "shortname": "foo", "name": "Foo", "vcs": {"type": "git", "url": "https://example.com/foo.git"}}`
+		v3Foo   = `{"id": "b11dzGs4SQid", "shortname": "foo", "name": "Foo", "remotes": [{"name": "origin", "role": "primary", "type": "git", "url": "https://example.com/foo.git"}]}`
+		bar     = `{"id": "b11dzGs4SQid", "shortname": "bar", "name": "Bar", "remotes": [{"name": "origin", "role": "primary", "type": "git", "url": "https://example.com/foo.git"}]}`
+		barURL  = `{"id": "b11dzGs4SQid", "shortname": "bar", "name": "Bar", "remotes": [{"name": "origin", "role": "primary", "type": "git", "url": "https://example.com/bar.git"}]}`
+		newFoo  = `{"id": "AQAAAAAAAAAA", "shortname": "foo", "name": "New Foo"}`
+		renamed = `{"id_to_shortname": {"b11dzGs4SQid": "bar"}, "former_names": {"foo": "b11dzGs4SQid"}}`
+		reused  = `{"id_to_shortname": {"b11dzGs4SQid": "bar", "AQAAAAAAAAAA": "foo"}}`
+	)
+	wc := &mockLogger{
+		mockRevReader: &mockRevReader{revs: map[string]map[string]string{
+			"create": {
+				"version.json":      `{"version": 2}`,
+				"catalog.json":      `{"id_to_shortname": {"b11dzGs4SQid": "foo"}}`,
+				"projects/foo.json": v2Foo,
+			},
+			"upgrade": {
+				"version.json":      `{"version": 3}`,
+				"catalog.json":      `{"id_to_shortname": {"b11dzGs4SQid": "foo"}}`,
+				"projects/foo.json": v3Foo,
+			},
+			"rename": {
+				"version.json":      `{"version": 3}`,
+				"catalog.json":      renamed,
+				"projects/bar.json": bar,
+			},
+			"seturl": {
+				"version.json":      `{"version": 3}`,
+				"catalog.json":      renamed,
+				"projects/bar.json": barURL,
+			},
+			"reuse": {
+				"version.json":      `{"version": 3}`,
+				"catalog.json":      reused,
+				"projects/bar.json": barURL,
+				"projects/foo.json": newFoo,
+			},
+			"delete": {
+				"version.json":            `{"version": 3}`,
+				"catalog.json":            `{"id_to_shortname": {"AQAAAAAAAAAA": "foo"}}`,
+				"projects/foo.json":       newFoo,
+				"trash/b11dzGs4SQid.json": `{"delete_time": "2014-03-01T12:00:00Z", "project": ` + barURL + `}`,
+			},
+		}},
+		order: []string{"create", "upgrade", "rename", "seturl", "reuse", "delete"},
+	}
+	id, _ := ParseID("b11dzGs4SQid")
+	versions, err := History(wc, id)
+	if err != nil {
+		t.Fatal("History error:", err)
+	}
+
+	var revs []string
+	for _, v := range versions {
+		revs = append(revs, v.Rev.Rev())
+	}
+	if want := []string{"delete", "seturl", "rename", "create"}; !reflect.DeepEqual(revs, want) {
+		t.Fatalf("History revs = %q; want %q", revs, want)
+	}
+	if v := versions[0]; !v.Deleted || v.Project == nil || v.Project.ShortName != "bar" || len(v.Changes) != 0 {
+		t.Errorf("versions[0] = %+v; want deleted bar with no changes", v)
+	}
+	if want := []FieldChange{{Field: "remotes[0].url", Old: `"https://example.com/foo.git"`, New: `"https://example.com/bar.git"`}}; !reflect.DeepEqual(versions[1].Changes, want) {
+		t.Errorf("versions[1].Changes = %+v; want %+v", versions[1].Changes, want)
+	}
+	want := []FieldChange{
+		{Field: "name", Old: `"Foo"`, New: `"Bar"`},
+		{Field: "shortname", Old: `"foo"`, New: `"bar"`},
+	}
+	if !reflect.DeepEqual(versions[2].Changes, want) {
+		t.Errorf("versions[2].Changes = %+v; want %+v", versions[2].Changes, want)
+	}
+	if v := versions[3]; v.Deleted || v.Project == nil || v.Project.ShortName != "foo" {
+		t.Errorf("versions[3] = %+v; want foo", v)
+	}
+	for _, c := range versions[3].Changes {
+		if c.Old != "" {
+			t.Errorf("versions[3] change %+v; want only added fields", c)
+		}
+	}
+}
+
+func TestHistory_NotFound(t *testing.T) {
+	wc := &mockLogger{mockRevReader: newMockRevReader(), order: []string{"1", "2"}}
+	if _, err := History(wc, ID{42}); !IsNotFound(err) {
+		t.Errorf("History(%v) error = %v; want not found", ID{42}, err)
+	}
+}
+
+func TestFlattenProject(t *testing.T) {
+	proj := &Project{
+		ID:        ID{1},
+		ShortName: "foo",
+		Tags:      TagSet{"go", "web"},
+		Fields:    map[string]string{"owner": "alice"},
+		PerHost:   map[string]*HostInfo{"laptop.local": {Path: "/src/foo"}},
+	}
+	fields, err := flattenProject(proj)
+	if err != nil {
+		t.Fatal("flattenProject error:", err)
+	}
+	want := map[string]string{
+		`tags[0]`:                       `"go"`,
+		`tags[1]`:                       `"web"`,
+		`fields.owner`:                  `"alice"`,
+		`per_host["laptop.local"].path`: `"/src/foo"`,
+		`name`:                          `""`,
+	}
+	for f, v := range want {
+		if fields[f] != v {
+			t.Errorf("fields[%q] = %q; want %q", f, fields[f], v)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package catalog
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// A Host is a machine that keeps working copies of projects.  A host's name
+// is the key used in Project.PerHost.
+type Host struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	OS          string `json:"os,omitempty"`
+
+	// CheckoutRoot is the directory that projects are checked out into when
+	// no other path is given.
+	CheckoutRoot string `json:"checkout_root,omitempty"`
+}
+
+// A HostRegistry is the set of hosts that projects in a catalog may have
+// information for.  An empty registry allows any host.
+type HostRegistry struct {
+	Hosts []Host `json:"hosts"`
+}
+
+// Host returns the named host or nil if the registry does not have it.
+func (r *HostRegistry) Host(name string) *Host {
+	for i := range r.Hosts {
+		if r.Hosts[i].Name == name {
+			return &r.Hosts[i]
+		}
+	}
+	return nil
+}
+
+// Remove removes the named host from the registry, reporting whether the
+// registry had it.
+func (r *HostRegistry) Remove(name string) bool {
+	for i := range r.Hosts {
+		if r.Hosts[i].Name == name {
+			r.Hosts = append(r.Hosts[:i], r.Hosts[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns an error if the registry itself is malformed.
+func (r *HostRegistry) Check() error {
+	seen := make(map[string]bool, len(r.Hosts))
+	for i := range r.Hosts {
+		name := r.Hosts[i].Name
+		if !IsValidHostName(name) {
+			return &HostError{Name: name, Err: errInvalidHostName}
+		}
+		if seen[name] {
+			return &HostError{Name: name, Err: errors.New("defined more than once")}
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// Validate returns a *HostError for the first of the project's hosts that is
+// not in the registry.  Any host is valid if the registry is empty.
+func (r *HostRegistry) Validate(proj *Project) error {
+	return r.ValidateChange(nil, proj)
+}
+
+// ValidateChange is like Validate, but only checks the hosts that proj has
+// and old, the stored version of the project, does not.  A project with
+// information for a host that was never registered can then still be
+// updated.  A nil old checks every host, as Validate does.
+func (r *HostRegistry) ValidateChange(old, proj *Project) error {
+	if len(r.Hosts) == 0 {
+		return nil
+	}
+	for _, name := range projectHosts(proj) {
+		if old != nil {
+			if _, had := old.PerHost[name]; had {
+				continue
+			}
+		}
+		if r.Host(name) == nil {
+			return &HostError{Name: name, Err: ErrUnknownHost}
+		}
+	}
+	return nil
+}
+
+func (r *HostRegistry) clone() *HostRegistry {
+	return &HostRegistry{Hosts: append([]Host(nil), r.Hosts...)}
+}
+
+// projectHosts returns the sorted names of the hosts in proj.PerHost.
+func projectHosts(proj *Project) []string {
+	names := make([]string, 0, len(proj.PerHost))
+	for name := range proj.PerHost {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsValidHostName reports whether name can be used as a host name.  Host
+// names may not be empty or contain spaces or control characters.
+func IsValidHostName(name string) bool {
+	return name != "" && strings.IndexFunc(name, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}) == -1
+}
+
+// Host errors
+var (
+	ErrUnknownHost = errors.New("not in the catalog's host registry")
+	ErrHostExists  = errors.New("already in the catalog's host registry")
+
+	errInvalidHostName = errors.New("invalid host name")
+)
+
+// A HostError is returned when a host is invalid.
+type HostError struct {
+	Name string
+	Err  error
+}
+
+func (e *HostError) Error() string {
+	return "host " + e.Name + ": " + e.Err.Error()
+}
+
+func (e *HostError) Unwrap() error {
+	return e.Err
+}
+
+// A HostRegistrar is a Catalog that has a registry of hosts.  PutProject
+// returns an error for projects that gain information for an unregistered
+// host.
+type HostRegistrar interface {
+	Catalog
+
+	// Hosts returns the catalog's host registry.
+	Hosts() (*HostRegistry, error)
+
+	// PutHosts replaces the catalog's host registry.  Existing projects
+	// are not checked against the new registry; use RenameHost and
+	// RemoveHost to change hosts that projects refer to.
+	PutHosts(r *HostRegistry) error
+}
+
+// GetHosts returns cat's host registry, or an empty registry if cat is not a
+// HostRegistrar.
+func GetHosts(cat Catalog) (*HostRegistry, error) {
+	if hr, ok := cat.(HostRegistrar); ok {
+		return hr.Hosts()
+	}
+	return new(HostRegistry), nil
+}
+
+// errNoHosts is returned when changing the hosts of a catalog that is not a
+// HostRegistrar.
+var errNoHosts = errors.New("catalog: catalog does not have a host registry")
+
+// UsedHosts returns the sorted names of every host that a project in cat has
+// information for, registered or not.
+func UsedHosts(cat Catalog) ([]string, error) {
+	names, err := cat.List()
+	if err != nil {
+		return nil, err
+	}
+	used := make(stringSet)
+	for _, sn := range names {
+		proj, err := cat.GetProject(sn)
+		if err != nil {
+			return nil, err
+		}
+		for name := range proj.PerHost {
+			used.Add(name)
+		}
+	}
+	hosts := used.Slice()
+	sort.Strings(hosts)
+	return hosts, nil
+}
+
+// RenameHost moves every project's information for a host to a new name, as a
+// single change.  Like RemoveHost, the old host does not need to be
+// registered if some project refers to it, so RenameHost can fix a misspelled
+// host name.  If the new host already exists, then the old host is merged into
+// it, as long as no project has information for both.  The old host's
+// registry entry is renamed, or dropped in favor of the new host's entry.
+func RenameHost(cat Catalog, oldName, newName string) error {
+	if !IsValidHostName(newName) {
+		return &HostError{Name: newName, Err: errInvalidHostName}
+	}
+	if oldName == newName {
+		return nil
+	}
+	return Batch(cat, "rename host "+oldName+" to "+newName, func(tx Catalog) error {
+		found := false
+		if hr, ok := tx.(HostRegistrar); ok {
+			reg, err := hr.Hosts()
+			if err != nil {
+				return err
+			}
+			changed := true
+			switch h := reg.Host(oldName); {
+			case h != nil && reg.Host(newName) != nil:
+				reg.Remove(oldName)
+				found = true
+			case h != nil:
+				h.Name = newName
+				found = true
+			case len(reg.Hosts) > 0 && reg.Host(newName) == nil:
+				// Keep the projects valid.
+				reg.Hosts = append(reg.Hosts, Host{Name: newName})
+			default:
+				changed = false
+			}
+			if changed {
+				if err := hr.PutHosts(reg); err != nil {
+					return err
+				}
+			}
+		}
+		err := updateHostProjects(tx, oldName, func(proj *Project) error {
+			found = true
+			if _, ok := proj.PerHost[newName]; ok {
+				return &ProjectError{ShortName: proj.ShortName, Op: "rename host", Err: &HostError{Name: newName, Err: ErrHostExists}}
+			}
+			proj.PerHost[newName] = proj.PerHost[oldName]
+			delete(proj.PerHost, oldName)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if !found {
+			return &HostError{Name: oldName, Err: ErrUnknownHost}
+		}
+		return nil
+	})
+}
+
+// RemoveHost removes a host from the registry and deletes every project's
+// information for the host, as a single change.  The host does not need to
+// be registered if some project refers to it.
+func RemoveHost(cat Catalog, name string) error {
+	return Batch(cat, "remove host "+name, func(tx Catalog) error {
+		found := false
+		if hr, ok := tx.(HostRegistrar); ok {
+			reg, err := hr.Hosts()
+			if err != nil {
+				return err
+			}
+			if reg.Remove(name) {
+				found = true
+				if err := hr.PutHosts(reg); err != nil {
+					return err
+				}
+			}
+		}
+		err := updateHostProjects(tx, name, func(proj *Project) error {
+			found = true
+			delete(proj.PerHost, name)
+			if len(proj.PerHost) == 0 {
+				proj.PerHost = nil
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if !found {
+			return &HostError{Name: name, Err: ErrUnknownHost}
+		}
+		return nil
+	})
+}
+
+// updateHostProjects calls f on every project in cat that has information
+// for host and stores the result.
+func updateHostProjects(cat Catalog, host string, f func(*Project) error) error {
+	names, err := cat.List()
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, sn := range names {
+		proj, err := cat.GetProject(sn)
+		if err != nil {
+			return err
+		}
+		if _, ok := proj.PerHost[host]; !ok {
+			continue
+		}
+		if err := f(proj); err != nil {
+			return err
+		}
+		if err := cat.PutProject(proj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Hosts reads the catalog's hosts.json.  A catalog without the file has an
+// empty registry.
+func (cat *localCatalog) Hosts() (*HostRegistry, error) {
+	r := new(HostRegistry)
+	err := readJSON(cat.fs, filepath.Join(cat.root, hostsFile), r)
+	if cat.fs.IsNotExist(err) {
+		return new(HostRegistry), nil
+	} else if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// PutHosts writes the catalog's hosts.json.
+func (cat *localCatalog) PutHosts(r *HostRegistry) error {
+	if err := r.Check(); err != nil {
+		return err
+	}
+	return cat.Batch("change host registry", func(tx Catalog) error {
+		return tx.(*localTx).PutHosts(r)
+	})
+}
@@ -0,0 +1,259 @@
+package catalog
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHostRegistryCheck(t *testing.T) {
+	tests := []struct {
+		reg HostRegistry
+		ok  bool
+	}{
+		{HostRegistry{}, true},
+		{HostRegistry{[]Host{{Name: "laptop"}, {Name: "build.example.com", OS: "linux"}}}, true},
+		{HostRegistry{[]Host{{Name: ""}}}, false},
+		{HostRegistry{[]Host{{Name: "my laptop"}}}, false},
+		{HostRegistry{[]Host{{Name: "laptop"}, {Name: "laptop"}}}, false},
+	}
+	for _, test := range tests {
+		err := test.reg.Check()
+		if test.ok && err != nil {
+			t.Errorf("%+v.Check() error: %v", test.reg, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("%+v.Check() = nil; want error", test.reg)
+		}
+	}
+}
+
+func TestHostRegistryValidate(t *testing.T) {
+	proj := &Project{PerHost: map[string]*HostInfo{"laptop": {Path: "/src/foo"}}}
+	if err := new(HostRegistry).Validate(proj); err != nil {
+		t.Errorf("empty registry Validate error: %v", err)
+	}
+	reg := &HostRegistry{[]Host{{Name: "laptop"}}}
+	if err := reg.Validate(proj); err != nil {
+		t.Errorf("Validate error: %v", err)
+	}
+	old := &Project{PerHost: map[string]*HostInfo{"laptop": {Path: "/src/foo"}}}
+	proj.SetPath("lpatop", "/src/foo")
+	if err := reg.Validate(proj); !errors.Is(err, ErrUnknownHost) {
+		t.Errorf("Validate with typo = %v; want %v", err, ErrUnknownHost)
+	}
+	if err := reg.ValidateChange(old, proj); !errors.Is(err, ErrUnknownHost) {
+		t.Errorf("ValidateChange adding typo = %v; want %v", err, ErrUnknownHost)
+	}
+	if err := reg.ValidateChange(proj, proj); err != nil {
+		t.Errorf("ValidateChange keeping typo error: %v", err)
+	}
+}
+
+func newHostTestCatalog(t *testing.T) *Memory {
+	m := newMemoryWithProjects(t,
+		&Project{ID: ID{1}, ShortName: "foo", PerHost: map[string]*HostInfo{"laptop": {Path: "/src/foo"}, "desktop": {Path: "/home/foo"}}},
+		&Project{ID: ID{2}, ShortName: "bar", PerHost: map[string]*HostInfo{"laptop": {Path: "/src/bar"}}},
+		&Project{ID: ID{3}, ShortName: "baz"},
+	)
+	reg := &HostRegistry{[]Host{{Name: "laptop"}, {Name: "desktop", OS: "linux"}}}
+	if err := m.PutHosts(reg); err != nil {
+		t.Fatal("PutHosts error:", err)
+	}
+	return m
+}
+
+func TestLocalHosts(t *testing.T) {
+	m := newHostTestCatalog(t)
+	if reg, err := m.Hosts(); err != nil {
+		t.Fatal("Hosts error:", err)
+	} else if len(reg.Hosts) != 2 || reg.Host("desktop") == nil || reg.Host("desktop").OS != "linux" {
+		t.Errorf("Hosts() = %+v; want laptop and desktop", reg)
+	}
+	err := m.PutProject(&Project{ID: ID{4}, ShortName: "qux", PerHost: map[string]*HostInfo{"lpatop": {Path: "/src/qux"}}})
+	if !errors.Is(err, ErrUnknownHost) {
+		t.Errorf("PutProject with unknown host = %v; want %v", err, ErrUnknownHost)
+	}
+	if err := m.PutHosts(&HostRegistry{[]Host{{Name: "bad host"}}}); err == nil {
+		t.Error("PutHosts with bad host name succeeded")
+	}
+	if used, err := UsedHosts(m); err != nil {
+		t.Error("UsedHosts error:", err)
+	} else if want := []string{"desktop", "laptop"}; !reflect.DeepEqual(used, want) {
+		t.Errorf("UsedHosts() = %q; want %q", used, want)
+	}
+}
+
+func TestRenameHost(t *testing.T) {
+	m := newHostTestCatalog(t)
+	if err := RenameHost(m, "laptop", "notebook"); err != nil {
+		t.Fatal("RenameHost error:", err)
+	}
+	reg, err := m.Hosts()
+	if err != nil {
+		t.Fatal("Hosts error:", err)
+	}
+	if reg.Host("laptop") != nil || reg.Host("notebook") == nil {
+		t.Errorf("Hosts() after rename = %+v", reg)
+	}
+	for _, sn := range []string{"foo", "bar"} {
+		proj, err := m.GetProject(sn)
+		if err != nil {
+			t.Fatal("GetProject error:", err)
+		}
+		if _, ok := proj.PerHost["laptop"]; ok {
+			t.Errorf("%s still has laptop", sn)
+		}
+		if p := proj.Path("notebook"); p != "/src/"+sn {
+			t.Errorf("%s.Path(notebook) = %q; want %q", sn, p, "/src/"+sn)
+		}
+	}
+	if proj, err := m.GetProject("foo"); err != nil {
+		t.Fatal("GetProject error:", err)
+	} else if p := proj.Path("desktop"); p != "/home/foo" {
+		t.Errorf("foo.Path(desktop) = %q; want %q", p, "/home/foo")
+	}
+
+	if err := RenameHost(m, "laptop", "other"); !errors.Is(err, ErrUnknownHost) {
+		t.Errorf("RenameHost of unknown host = %v; want %v", err, ErrUnknownHost)
+	}
+	if err := RenameHost(m, "notebook", "desktop"); !errors.Is(err, ErrHostExists) {
+		t.Errorf("RenameHost to existing host = %v; want %v", err, ErrHostExists)
+	}
+}
+
+func TestRenameHost_Typo(t *testing.T) {
+	m := newMemoryWithProjects(t,
+		&Project{ID: ID{1}, ShortName: "foo", PerHost: map[string]*HostInfo{"laptop": {Path: "/src/foo"}}},
+		&Project{ID: ID{2}, ShortName: "bar", PerHost: map[string]*HostInfo{"lpatop": {Path: "/src/bar"}}},
+	)
+
+	// Without a registry, the typo is only in the project.
+	if err := RenameHost(m, "lpatop", "laptop"); err != nil {
+		t.Fatal("RenameHost with empty registry error:", err)
+	}
+	if used, err := UsedHosts(m); err != nil || !reflect.DeepEqual(used, []string{"laptop"}) {
+		t.Errorf("UsedHosts() after rename = %q, %v; want [laptop]", used, err)
+	}
+	if proj, err := m.GetProject("bar"); err != nil {
+		t.Fatal("GetProject error:", err)
+	} else if p := proj.Path("laptop"); p != "/src/bar" {
+		t.Errorf("bar.Path(laptop) = %q; want %q", p, "/src/bar")
+	}
+
+	// With both names registered, the typo is merged into the real host.
+	bar, err := m.GetProject("bar")
+	if err != nil {
+		t.Fatal("GetProject error:", err)
+	}
+	bar.PerHost = map[string]*HostInfo{"lpatop": {Path: "/src/bar"}}
+	if err := m.PutProject(bar); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	if err := m.PutHosts(&HostRegistry{[]Host{{Name: "laptop", OS: "darwin"}, {Name: "lpatop"}}}); err != nil {
+		t.Fatal("PutHosts error:", err)
+	}
+	if err := RenameHost(m, "lpatop", "laptop"); err != nil {
+		t.Fatal("RenameHost with registered hosts error:", err)
+	}
+	if reg, err := m.Hosts(); err != nil {
+		t.Fatal("Hosts error:", err)
+	} else if want := []Host{{Name: "laptop", OS: "darwin"}}; !reflect.DeepEqual(reg.Hosts, want) {
+		t.Errorf("Hosts() after merge = %+v; want %+v", reg.Hosts, want)
+	}
+	if used, err := UsedHosts(m); err != nil || !reflect.DeepEqual(used, []string{"laptop"}) {
+		t.Errorf("UsedHosts() after merge = %q, %v; want [laptop]", used, err)
+	}
+
+	if err := RenameHost(m, "lpatop", "laptop"); !errors.Is(err, ErrUnknownHost) {
+		t.Errorf("RenameHost of gone host = %v; want %v", err, ErrUnknownHost)
+	}
+}
+
+func TestRemoveHost(t *testing.T) {
+	m := newHostTestCatalog(t)
+	if err := RemoveHost(m, "laptop"); err != nil {
+		t.Fatal("RemoveHost error:", err)
+	}
+	if reg, err := m.Hosts(); err != nil {
+		t.Fatal("Hosts error:", err)
+	} else if reg.Host("laptop") != nil {
+		t.Errorf("Hosts() after remove = %+v", reg)
+	}
+	if proj, err := m.GetProject("foo"); err != nil {
+		t.Fatal("GetProject error:", err)
+	} else if want := map[string]*HostInfo{"desktop": {Path: "/home/foo"}}; !reflect.DeepEqual(proj.PerHost, want) {
+		t.Errorf("foo.PerHost = %v; want %v", proj.PerHost, want)
+	}
+	if proj, err := m.GetProject("bar"); err != nil {
+		t.Fatal("GetProject error:", err)
+	} else if proj.PerHost != nil {
+		t.Errorf("bar.PerHost = %v; want nil", proj.PerHost)
+	}
+	if err := RemoveHost(m, "laptop"); !errors.Is(err, ErrUnknownHost) {
+		t.Errorf("second RemoveHost = %v; want %v", err, ErrUnknownHost)
+	}
+}
+
+func TestRemoveHost_Unregistered(t *testing.T) {
+	m := NewMemory()
+	if err := m.PutProject(&Project{ID: ID{1}, ShortName: "foo", PerHost: map[string]*HostInfo{"old": {Path: "/src/foo"}}}); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	if err := RemoveHost(m, "old"); err != nil {
+		t.Fatal("RemoveHost error:", err)
+	}
+	if proj, err := m.GetProject("foo"); err != nil {
+		t.Fatal("GetProject error:", err)
+	} else if proj.PerHost != nil {
+		t.Errorf("foo.PerHost = %v; want nil", proj.PerHost)
+	}
+	if _, err := m.fs.Open(filepath.Join(m.root, hostsFile)); err == nil {
+		t.Error("RemoveHost of unregistered host created hosts.json")
+	}
+}
+
+func TestRemoveHost_SecondUnregistered(t *testing.T) {
+	m := NewMemory()
+	proj := &Project{ID: ID{1}, ShortName: "foo", PerHost: map[string]*HostInfo{"old": {Path: "/src/foo"}, "older": {Path: "/src/foo"}}}
+	if err := m.PutProject(proj); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	if err := m.PutHosts(&HostRegistry{[]Host{{Name: "laptop"}}}); err != nil {
+		t.Fatal("PutHosts error:", err)
+	}
+
+	// Projects with unregistered hosts can still be changed...
+	proj.Name = "Foo"
+	if err := m.PutProject(proj); err != nil {
+		t.Error("PutProject with unregistered hosts error:", err)
+	}
+	if err := RemoveHost(m, "old"); err != nil {
+		t.Error("RemoveHost error:", err)
+	}
+	// ...but can't gain new ones.
+	proj, err := m.GetProject("foo")
+	if err != nil {
+		t.Fatal("GetProject error:", err)
+	}
+	proj.SetPath("new", "/src/foo")
+	if err := m.PutProject(proj); !errors.Is(err, ErrUnknownHost) {
+		t.Errorf("PutProject adding unregistered host error = %v; want %v", err, ErrUnknownHost)
+	}
+}
+
+func TestRenameHost_Cache(t *testing.T) {
+	m := newHostTestCatalog(t)
+	c, err := NewCache(m)
+	if err != nil {
+		t.Fatal("NewCache error:", err)
+	}
+	if err := RenameHost(c, "laptop", "notebook"); err != nil {
+		t.Fatal("RenameHost error:", err)
+	}
+	if proj, err := c.GetProject("bar"); err != nil {
+		t.Fatal("GetProject error:", err)
+	} else if p := proj.Path("notebook"); p != "/src/bar" {
+		t.Errorf("cached bar.Path(notebook) = %q; want %q", p, "/src/bar")
+	}
+}
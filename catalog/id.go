@@ -24,6 +24,18 @@ func GenerateID() (ID, error) {
 	return id, err
 }
 
+// ParseID parses the string form of an ID.
+func ParseID(s string) (ID, error) {
+	var id ID
+	if len(s) != IDEncodedLen {
+		return id, idError(s)
+	}
+	if _, err := idEncoding.Decode(id[:], []byte(s)); err != nil {
+		return id, idError(s)
+	}
+	return id, nil
+}
+
 func (id ID) String() string {
 	return idEncoding.EncodeToString(id[:])
 }
@@ -45,3 +57,10 @@ func (id *ID) UnmarshalJSON(data []byte) error {
 	_, err := idEncoding.Decode((*id)[:], data[1:n-1])
 	return err
 }
+
+// idError is returned when a string is not a valid ID.
+type idError string
+
+func (e idError) Error() string {
+	return `bad project ID: "` + string(e) + `"`
+}
@@ -1,9 +1,16 @@
 package catalog
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
+	"io/ioutil"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
 )
 
 // filesystem is an abstraction for the operating system's filesystem interface.  Useful for mocking.
@@ -22,25 +29,53 @@ type filesystem interface {
 	// Mkdir creates a directory.
 	Mkdir(path string) error
 
+	// Rename moves a file, replacing newpath if it already exists.  The
+	// move is on stable storage by the time Rename returns.
+	Rename(oldpath, newpath string) error
+
+	// TempFile creates a new file for writing in dir with a name that begins
+	// with prefix.  The file's Name method returns its path.
+	TempFile(dir, prefix string) (file, error)
+
 	IsNotExist(e error) bool
 	IsExist(e error) bool
 }
 
+// A symlinkEvaler is a filesystem that has symbolic links.
+type symlinkEvaler interface {
+	// EvalSymlinks returns path with any symbolic links resolved.
+	EvalSymlinks(path string) (string, error)
+}
+
 type file interface {
 	io.Reader
 	io.Writer
 	io.Closer
+	Name() string
 	Readdir(n int) (fi []os.FileInfo, err error)
 	Stat() (os.FileInfo, error)
+
+	// Sync commits the file's contents to stable storage.
+	Sync() error
 }
 
 type realFilesystem struct{}
 
-func (realFilesystem) Open(path string) (file, error) { return os.Open(path) }
-func (realFilesystem) Remove(path string) error       { return os.Remove(path) }
-func (realFilesystem) Mkdir(path string) error        { return os.Mkdir(path, 0777) }
-func (realFilesystem) IsExist(e error) bool           { return os.IsExist(e) }
-func (realFilesystem) IsNotExist(e error) bool        { return os.IsNotExist(e) }
+func (realFilesystem) Open(path string) (file, error)           { return os.Open(path) }
+func (realFilesystem) Remove(path string) error                 { return os.Remove(path) }
+func (realFilesystem) Mkdir(path string) error                  { return os.Mkdir(path, 0777) }
+func (realFilesystem) IsExist(e error) bool                     { return os.IsExist(e) }
+func (realFilesystem) IsNotExist(e error) bool                  { return os.IsNotExist(e) }
+func (realFilesystem) EvalSymlinks(path string) (string, error) { return filepath.EvalSymlinks(path) }
+
+// Rename moves a file and then syncs newpath's directory, so the new directory
+// entry survives a crash.
+func (realFilesystem) Rename(oldpath, newpath string) error {
+	if err := os.Rename(oldpath, newpath); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(newpath))
+}
 
 func (realFilesystem) Create(path string, excl bool) (file, error) {
 	const permMask os.FileMode = 0666
@@ -51,6 +86,27 @@ func (realFilesystem) Create(path string, excl bool) (file, error) {
 	return os.OpenFile(path, flag, permMask)
 }
 
+func (realFilesystem) TempFile(dir, prefix string) (file, error) {
+	// ioutil.TempFile creates files that are only readable by their owner,
+	// which is not appropriate for a shared catalog.
+	const (
+		permMask os.FileMode = 0666
+		maxTries             = 10000
+	)
+	var err error
+	for i := 0; i < maxTries; i++ {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 36))
+		var f *os.File
+		f, err = os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, permMask)
+		if err == nil {
+			return f, nil
+		} else if !os.IsExist(err) {
+			break
+		}
+	}
+	return nil, err
+}
+
 func readJSON(fs filesystem, path string, v interface{}) error {
 	f, err := fs.Open(path)
 	if err != nil {
@@ -60,18 +116,324 @@ func readJSON(fs filesystem, path string, v interface{}) error {
 	return json.NewDecoder(f).Decode(v)
 }
 
-func writeJSON(fs filesystem, path string, v interface{}, excl bool) (retErr error) {
-	f, err := fs.Create(path, excl)
+func readFile(fs filesystem, path string) ([]byte, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+func writeJSON(fs filesystem, path string, v interface{}, excl bool) error {
+	data, err := marshalJSON(v)
+	if err != nil {
+		return err
+	}
+	return writeFile(fs, path, data, excl)
+}
+
+// marshalJSON encodes v in the canonical form for catalog files, which keeps
+// version control diffs small: one field per line, indented with tabs, with
+// map keys and project tags sorted and a trailing newline.
+func marshalJSON(v interface{}) ([]byte, error) {
+	if p, ok := v.(*Project); ok && !sort.StringsAreSorted(p.Tags) {
+		p = p.clone()
+		sort.Strings(p.Tags)
+		v = p
+	}
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeFile atomically replaces the file at path with data.  The data is
+// written to a temporary file in the same directory and synced to disk before
+// being renamed to path (which syncs the directory), so a crash leaves either
+// the old or the new content.  If path is a symbolic link, the file it points
+// to is replaced instead, and an existing file keeps its permissions.
+// If excl is true, then an error will be returned if the file already exists.
+// The existence check is not atomic with the rename, so the caller should hold
+// the catalog lock.
+func writeFile(fs filesystem, path string, data []byte, excl bool) (retErr error) {
+	if se, ok := fs.(symlinkEvaler); ok {
+		if resolved, err := se.EvalSymlinks(path); err == nil {
+			path = resolved
+		} else if !fs.IsNotExist(err) {
+			return err
+		}
+	}
+	var perm os.FileMode
+	if f, err := fs.Open(path); err == nil {
+		fi, err := f.Stat()
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if excl {
+			return &os.PathError{Op: "open", Path: path, Err: os.ErrExist}
+		}
+		perm = fi.Mode().Perm()
+	} else if !fs.IsNotExist(err) {
+		return err
+	}
+
+	f, err := fs.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
 	if err != nil {
 		return err
 	}
+	tmp := f.Name()
 	defer func() {
-		if err := f.Close(); err != nil && retErr == nil {
-			retErr = err
+		if retErr != nil {
+			// Error ignored, since the original error is more interesting.
+			fs.Remove(tmp)
 		}
 	}()
-	if err := json.NewEncoder(f).Encode(v); err != nil {
+	if c, ok := f.(interface {
+		Chmod(os.FileMode) error
+	}); ok && perm != 0 {
+		if err := c.Chmod(perm); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
 		return err
 	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return fs.Rename(tmp, path)
+}
+
+// overlayFilesystem is a filesystem that reads from an underlying filesystem,
+// but keeps any modifications in memory.  Directory listings always come from
+// the underlying filesystem.
+type overlayFilesystem struct {
+	fs      filesystem
+	files   map[string][]byte
+	dirs    map[string]struct{}
+	removed map[string]struct{}
+}
+
+func newOverlayFilesystem(fs filesystem) *overlayFilesystem {
+	return &overlayFilesystem{
+		fs:      fs,
+		files:   make(map[string][]byte),
+		dirs:    make(map[string]struct{}),
+		removed: make(map[string]struct{}),
+	}
+}
+
+// exists reports whether path exists in the overlay.
+func (ofs *overlayFilesystem) exists(path string) (bool, error) {
+	if _, ok := ofs.removed[path]; ok {
+		return false, nil
+	}
+	if _, ok := ofs.files[path]; ok {
+		return true, nil
+	}
+	if _, ok := ofs.dirs[path]; ok {
+		return true, nil
+	}
+	f, err := ofs.fs.Open(path)
+	if ofs.fs.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	f.Close()
+	return true, nil
+}
+
+func (ofs *overlayFilesystem) Open(path string) (file, error) {
+	if _, ok := ofs.removed[path]; ok {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+	if data, ok := ofs.files[path]; ok {
+		return &memFile{name: path, r: bytes.NewReader(data)}, nil
+	}
+	return ofs.fs.Open(path)
+}
+
+func (ofs *overlayFilesystem) Create(path string, excl bool) (file, error) {
+	if excl {
+		if ok, err := ofs.exists(path); err != nil {
+			return nil, err
+		} else if ok {
+			return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrExist}
+		}
+	}
+	return &memFile{
+		name: path,
+		onClose: func(data []byte) {
+			delete(ofs.removed, path)
+			ofs.files[path] = data
+		},
+	}, nil
+}
+
+func (ofs *overlayFilesystem) Remove(path string) error {
+	if ok, err := ofs.exists(path); err != nil {
+		return err
+	} else if !ok {
+		return &os.PathError{Op: "remove", Path: path, Err: os.ErrNotExist}
+	}
+	delete(ofs.files, path)
+	ofs.removed[path] = struct{}{}
 	return nil
 }
+
+func (ofs *overlayFilesystem) Mkdir(path string) error {
+	if ok, err := ofs.exists(path); err != nil {
+		return err
+	} else if ok {
+		return &os.PathError{Op: "mkdir", Path: path, Err: os.ErrExist}
+	}
+	delete(ofs.removed, path)
+	ofs.dirs[path] = struct{}{}
+	return nil
+}
+
+func (ofs *overlayFilesystem) Rename(oldpath, newpath string) error {
+	data, ok := ofs.files[oldpath]
+	if !ok {
+		if ok, err := ofs.exists(oldpath); err != nil {
+			return err
+		} else if !ok {
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+		}
+		f, err := ofs.fs.Open(oldpath)
+		if err != nil {
+			return err
+		}
+		data, err = ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	delete(ofs.files, oldpath)
+	ofs.removed[oldpath] = struct{}{}
+	delete(ofs.removed, newpath)
+	ofs.files[newpath] = data
+	return nil
+}
+
+func (ofs *overlayFilesystem) TempFile(dir, prefix string) (file, error) {
+	for i := 0; ; i++ {
+		path := filepath.Join(dir, prefix+strconv.Itoa(i))
+		if ok, err := ofs.exists(path); err != nil {
+			return nil, err
+		} else if !ok {
+			return ofs.Create(path, true)
+		}
+	}
+}
+
+func (ofs *overlayFilesystem) IsExist(e error) bool    { return os.IsExist(e) }
+func (ofs *overlayFilesystem) IsNotExist(e error) bool { return os.IsNotExist(e) }
+
+// memFile is an in-memory file.  A memFile is either opened for reading (r is
+// not nil), a directory (dir is not nil), or opened for writing, in which case
+// onClose is called with the written data.
+type memFile struct {
+	name    string
+	r       *bytes.Reader
+	w       bytes.Buffer
+	onClose func([]byte)
+	modTime time.Time
+	dir     []os.FileInfo
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	if f.r == nil {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: os.ErrInvalid}
+	}
+	return f.r.Read(p)
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if f.r != nil {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: os.ErrInvalid}
+	}
+	return f.w.Write(p)
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Sync() error {
+	return nil
+}
+
+func (f *memFile) Close() error {
+	if f.onClose != nil {
+		f.onClose(f.w.Bytes())
+		f.onClose = nil
+	}
+	return nil
+}
+
+func (f *memFile) Readdir(n int) ([]os.FileInfo, error) {
+	if f.dir == nil {
+		return nil, &os.PathError{Op: "readdir", Path: f.name, Err: os.ErrInvalid}
+	}
+	if n <= 0 {
+		fi := f.dir
+		f.dir = f.dir[len(f.dir):]
+		return fi, nil
+	}
+	if len(f.dir) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(f.dir) {
+		n = len(f.dir)
+	}
+	fi := f.dir[:n]
+	f.dir = f.dir[n:]
+	return fi, nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	if f.dir != nil {
+		return memFileInfo{name: filepath.Base(f.name), modTime: f.modTime, isDir: true}, nil
+	}
+	size := int64(f.w.Len())
+	if f.r != nil {
+		size = f.r.Size()
+	}
+	return memFileInfo{name: filepath.Base(f.name), size: size, modTime: f.modTime}, nil
+}
+
+// memFileInfo describes a memFile.
+type memFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+func (fi memFileInfo) Name() string       { return fi.name }
+func (fi memFileInfo) Size() int64        { return fi.size }
+func (fi memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi memFileInfo) IsDir() bool        { return fi.isDir }
+func (fi memFileInfo) Sys() interface{}   { return nil }
+
+func (fi memFileInfo) Mode() os.FileMode {
+	if fi.isDir {
+		return os.ModeDir | 0777
+	}
+	return 0666
+}
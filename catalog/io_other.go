@@ -0,0 +1,10 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package catalog
+
+// syncDir commits a directory's entries to stable storage.  Directories can't
+// be synced on this platform, so it does nothing.
+func syncDir(path string) error {
+	return nil
+}
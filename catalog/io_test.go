@@ -1,12 +1,15 @@
 package catalog
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -35,6 +38,19 @@ func TestIndir(t *testing.T) {
 type mockFilesystem struct {
 	files map[string][]byte
 	dirs  map[string]struct{}
+	ntemp int
+
+	// fail is called before each operation, if not nil.  If it returns an
+	// error, the operation fails with that error.  A failed write still writes
+	// half of its data, like a full disk would.
+	fail func(op, path string) error
+}
+
+func (fs *mockFilesystem) injectFailure(op, path string) error {
+	if fs.fail == nil {
+		return nil
+	}
+	return fs.fail(op, path)
 }
 
 func newMockFS() *mockFilesystem {
@@ -55,6 +71,9 @@ func (fs *mockFilesystem) find(path string) (isFile, ok bool) {
 }
 
 func (fs *mockFilesystem) Mkdir(path string) error {
+	if err := fs.injectFailure("mkdir", path); err != nil {
+		return err
+	}
 	if _, ok := fs.find(path); ok {
 		return &os.PathError{
 			Path: path,
@@ -72,6 +91,9 @@ func (fs *mockFilesystem) makeFile(path string, content string) {
 }
 
 func (fs *mockFilesystem) Open(path string) (file, error) {
+	if err := fs.injectFailure("open", path); err != nil {
+		return nil, err
+	}
 	if data, ok := fs.files[path]; ok {
 		return &mockFile{
 			fs:   fs,
@@ -105,6 +127,9 @@ func (fs *mockFilesystem) Open(path string) (file, error) {
 }
 
 func (fs *mockFilesystem) Create(path string, excl bool) (file, error) {
+	if err := fs.injectFailure("create", path); err != nil {
+		return nil, err
+	}
 	if isFile, ok := fs.find(path); ok && (excl || !isFile) {
 		return nil, &os.PathError{
 			Path: path,
@@ -119,6 +144,9 @@ func (fs *mockFilesystem) Create(path string, excl bool) (file, error) {
 }
 
 func (fs *mockFilesystem) Remove(path string) error {
+	if err := fs.injectFailure("remove", path); err != nil {
+		return err
+	}
 	if isFile, ok := fs.find(path); !ok {
 		return &os.PathError{
 			Path: path,
@@ -136,6 +164,42 @@ func (fs *mockFilesystem) Remove(path string) error {
 	return nil
 }
 
+func (fs *mockFilesystem) Rename(oldpath, newpath string) error {
+	if err := fs.injectFailure("rename", newpath); err != nil {
+		return err
+	}
+	data, ok := fs.files[oldpath]
+	if !ok {
+		return &os.LinkError{
+			Op:  "rename",
+			Old: oldpath,
+			New: newpath,
+			Err: os.ErrNotExist,
+		}
+	}
+	if _, isDir := fs.dirs[newpath]; isDir {
+		return &os.LinkError{
+			Op:  "rename",
+			Old: oldpath,
+			New: newpath,
+			Err: os.ErrExist,
+		}
+	}
+	delete(fs.files, oldpath)
+	fs.files[newpath] = data
+	return fs.injectFailure("syncdir", filepath.Dir(newpath))
+}
+
+func (fs *mockFilesystem) TempFile(dir, prefix string) (file, error) {
+	for {
+		fs.ntemp++
+		path := filepath.Join(dir, prefix+strconv.Itoa(fs.ntemp))
+		if _, ok := fs.find(path); !ok {
+			return fs.Create(path, true)
+		}
+	}
+}
+
 func (*mockFilesystem) IsExist(e error) bool {
 	return os.IsExist(e)
 }
@@ -185,6 +249,10 @@ func (mf *mockFile) Read(p []byte) (n int, err error) {
 }
 
 func (mf *mockFile) Write(p []byte) (n int, err error) {
+	if err := mf.fs.injectFailure("write", mf.name); err != nil {
+		mf.data = append(mf.data, p[:len(p)/2]...)
+		return len(p) / 2, err
+	}
 	if size := mf.pos + len(p); size < len(mf.data) {
 		copy(mf.data[mf.pos:], p)
 	} else {
@@ -193,7 +261,18 @@ func (mf *mockFile) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
+func (mf *mockFile) Name() string {
+	return mf.name
+}
+
+func (mf *mockFile) Sync() error {
+	return mf.fs.injectFailure("sync", mf.name)
+}
+
 func (mf *mockFile) Close() error {
+	if err := mf.fs.injectFailure("close", mf.name); err != nil {
+		return err
+	}
 	if mf.dir == nil {
 		mf.fs.files[mf.name] = mf.data
 	}
@@ -406,3 +485,151 @@ func TestMockFS_Remove(t *testing.T) {
 		t.Error("dir removed")
 	}
 }
+
+func TestWriteFile(t *testing.T) {
+	const path = "foo.txt"
+	fs := newMockFS()
+	fs.makeFile(path, "old")
+	if err := writeFile(fs, path, []byte("new"), false); err != nil {
+		t.Error("writeFile error:", err)
+	}
+	if data := string(fs.files[path]); data != "new" {
+		t.Errorf("%s contents = %q; want %q", path, data, "new")
+	}
+	if len(fs.files) != 1 {
+		t.Errorf("files = %v; want only %s", fs.files, path)
+	}
+}
+
+func TestWriteFile_Excl(t *testing.T) {
+	const path = "foo.txt"
+	fs := newMockFS()
+	fs.makeFile(path, "old")
+	if err := writeFile(fs, path, []byte("new"), true); !os.IsExist(err) {
+		t.Errorf("writeFile error = %v; want exists", err)
+	}
+	if data := string(fs.files[path]); data != "old" {
+		t.Errorf("%s contents = %q; want %q", path, data, "old")
+	}
+}
+
+func TestWriteFile_Symlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blackforest-io")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	target := filepath.Join(dir, "target.json")
+	link := filepath.Join(dir, "link.json")
+	if err := ioutil.WriteFile(target, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(target, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("target.json", link); err != nil {
+		t.Skip("can't create symlink:", err)
+	}
+
+	if err := writeFile(realFilesystem{}, link, []byte("new"), false); err != nil {
+		t.Fatal("writeFile error:", err)
+	}
+	if fi, err := os.Lstat(link); err != nil {
+		t.Error(err)
+	} else if fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("%s replaced with a file of mode %v", link, fi.Mode())
+	}
+	if data, err := ioutil.ReadFile(target); err != nil || string(data) != "new" {
+		t.Errorf("target contents = %q, %v; want %q", data, err, "new")
+	}
+	if fi, err := os.Stat(target); err != nil {
+		t.Error(err)
+	} else if fi.Mode().Perm() != 0640 {
+		t.Errorf("target mode = %v; want %v", fi.Mode().Perm(), os.FileMode(0640))
+	}
+}
+
+func TestWriteFile_Failure(t *testing.T) {
+	const path = "foo.txt"
+	errInjected := errors.New("injected failure")
+	for _, op := range []string{"create", "write", "sync", "close", "rename"} {
+		fs := newMockFS()
+		fs.makeFile(path, "old")
+		fs.fail = func(o, p string) error {
+			if o == op {
+				return errInjected
+			}
+			return nil
+		}
+		if err := writeFile(fs, path, []byte("new content"), false); err != errInjected {
+			t.Errorf("%s failure: writeFile error = %v; want %v", op, err, errInjected)
+		}
+		if data := string(fs.files[path]); data != "old" {
+			t.Errorf("%s failure: %s contents = %q; want %q", op, path, data, "old")
+		}
+		for name := range fs.files {
+			if strings.Contains(name, ".tmp") {
+				t.Errorf("%s failure: temporary file %s left behind", op, name)
+			}
+		}
+	}
+}
+
+func TestWriteFile_SyncDirFailure(t *testing.T) {
+	const path = "foo.txt"
+	errInjected := errors.New("injected failure")
+	fs := newMockFS()
+	fs.makeFile(path, "old")
+	fs.fail = func(op, p string) error {
+		if op == "syncdir" {
+			return errInjected
+		}
+		return nil
+	}
+	// The rename has already happened, but the caller must still hear that
+	// it might not survive a crash.
+	if err := writeFile(fs, path, []byte("new content"), false); err != errInjected {
+		t.Errorf("writeFile error = %v; want %v", err, errInjected)
+	}
+	for name := range fs.files {
+		if strings.Contains(name, ".tmp") {
+			t.Errorf("temporary file %s left behind", name)
+		}
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{
+			&catalogMeta{ShortNameMap: map[string]string{"xyz": "b", "abc": "a"}},
+			"{\n\t\"id_to_shortname\": {\n\t\t\"abc\": \"a\",\n\t\t\"xyz\": \"b\"\n\t}\n}\n",
+		},
+		{
+			&Project{ShortName: "foo", Name: "<Foo & Bar>", Tags: TagSet{"zeta", "alpha"}},
+			"{\n\t\"id\": \"AAAAAAAAAAAA\",\n\t\"shortname\": \"foo\",\n\t\"name\": \"<Foo & Bar>\",\n\t\"tags\": [\n\t\t\"alpha\",\n\t\t\"zeta\"\n\t],\n\t\"catalog_time\": \"0001-01-01T00:00:00Z\",\n\t\"create_time\": \"0001-01-01T00:00:00Z\"\n}\n",
+		},
+	}
+	for _, test := range tests {
+		data, err := marshalJSON(test.v)
+		if err != nil {
+			t.Errorf("marshalJSON(%+v) error: %v", test.v, err)
+			continue
+		}
+		if string(data) != test.want {
+			t.Errorf("marshalJSON(%+v) = %q; want %q", test.v, data, test.want)
+		}
+	}
+}
+
+func TestMarshalJSON_DoesNotModifyProject(t *testing.T) {
+	p := &Project{ShortName: "foo", Tags: TagSet{"b", "a"}}
+	if _, err := marshalJSON(p); err != nil {
+		t.Fatal("marshalJSON error:", err)
+	}
+	if want := (TagSet{"b", "a"}); !reflect.DeepEqual(p.Tags, want) {
+		t.Errorf("p.Tags = %v; want %v", p.Tags, want)
+	}
+}
@@ -0,0 +1,122 @@
+package catalog
+
+import (
+	"sort"
+	"strings"
+)
+
+// A LinkType is the kind of relationship that a link describes.  Links are
+// directed: a project links to its target.
+type LinkType string
+
+// Link types
+const (
+	// DependsOn is a link from a project to a project that it needs.
+	DependsOn LinkType = "depends-on"
+
+	// ForkedFrom is a link from a project to the project it was copied from.
+	ForkedFrom LinkType = "forked-from"
+
+	// SupersededBy is a link from a project to its replacement.
+	SupersededBy LinkType = "superseded-by"
+
+	// PartOf is a link from a project to a larger project that includes it.
+	PartOf LinkType = "part-of"
+)
+
+// LinkTypes returns every valid link type.
+func LinkTypes() []LinkType {
+	return []LinkType{DependsOn, ForkedFrom, SupersededBy, PartOf}
+}
+
+// ParseLinkType returns the link type named by s.
+func ParseLinkType(s string) (LinkType, error) {
+	for _, t := range LinkTypes() {
+		if string(t) == s {
+			return t, nil
+		}
+	}
+	return "", LinkTypeError(s)
+}
+
+// A LinkTypeError is returned when parsing an unknown link type.
+type LinkTypeError string
+
+func (e LinkTypeError) Error() string {
+	names := make([]string, 0, 4)
+	for _, t := range LinkTypes() {
+		names = append(names, string(t))
+	}
+	return string(e) + " is not a valid link type\nvalid choices are: " + strings.Join(names, ", ")
+}
+
+// A Link is a relationship from one project to another.  The target is
+// stored by ID so that links survive renames.
+type Link struct {
+	Type   LinkType `json:"type"`
+	Target ID       `json:"target"`
+}
+
+// AddLink adds a link to the project, reporting whether the project did not
+// already have it.
+func (proj *Project) AddLink(l Link) bool {
+	if proj.HasLink(l) {
+		return false
+	}
+	proj.Links = append(proj.Links, l)
+	return true
+}
+
+// RemoveLink removes a link from the project, reporting whether the project
+// had it.
+func (proj *Project) RemoveLink(l Link) bool {
+	for i := range proj.Links {
+		if proj.Links[i] == l {
+			proj.Links = append(proj.Links[:i], proj.Links[i+1:]...)
+			if len(proj.Links) == 0 {
+				proj.Links = nil
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// HasLink reports whether the project has the link.
+func (proj *Project) HasLink(l Link) bool {
+	for _, pl := range proj.Links {
+		if pl == l {
+			return true
+		}
+	}
+	return false
+}
+
+// An InboundLink is a link to a project from another project.
+type InboundLink struct {
+	Type   LinkType
+	Source ID
+}
+
+// LinksTo returns the links in cat whose target is id, ordered by the short
+// name of the source project.
+func LinksTo(cat Catalog, id ID) ([]InboundLink, error) {
+	names, err := cat.List()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	var links []InboundLink
+	for _, sn := range names {
+		proj, err := cat.GetProject(sn)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range proj.Links {
+			if l.Target == id {
+				links = append(links, InboundLink{Type: l.Type, Source: proj.ID})
+			}
+		}
+	}
+	return links, nil
+}
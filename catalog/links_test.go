@@ -0,0 +1,71 @@
+package catalog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLinkType(t *testing.T) {
+	for _, lt := range LinkTypes() {
+		if got, err := ParseLinkType(string(lt)); err != nil || got != lt {
+			t.Errorf("ParseLinkType(%q) = %q, %v; want %q, <nil>", lt, got, err, lt)
+		}
+	}
+	for _, s := range []string{"", "Depends-On", "blocks"} {
+		if got, err := ParseLinkType(s); err != LinkTypeError(s) {
+			t.Errorf("ParseLinkType(%q) = %q, %v; want error %v", s, got, err, LinkTypeError(s))
+		}
+	}
+}
+
+func TestProjectLinks(t *testing.T) {
+	a := Link{Type: DependsOn, Target: ID{2}}
+	b := Link{Type: ForkedFrom, Target: ID{2}}
+	proj := new(Project)
+	if !proj.AddLink(a) {
+		t.Error("first AddLink(a) = false")
+	}
+	if proj.AddLink(a) {
+		t.Error("second AddLink(a) = true")
+	}
+	if !proj.AddLink(b) {
+		t.Error("AddLink(b) = false")
+	}
+	if want := []Link{a, b}; !reflect.DeepEqual(proj.Links, want) {
+		t.Errorf("proj.Links = %v; want %v", proj.Links, want)
+	}
+	if !proj.RemoveLink(a) {
+		t.Error("RemoveLink(a) = false")
+	}
+	if proj.HasLink(a) {
+		t.Error("HasLink(a) after removing = true")
+	}
+	if !proj.RemoveLink(b) {
+		t.Error("RemoveLink(b) = false")
+	}
+	if proj.RemoveLink(b) {
+		t.Error("second RemoveLink(b) = true")
+	}
+	if proj.Links != nil {
+		t.Errorf("proj.Links = %v; want nil", proj.Links)
+	}
+}
+
+func TestLinksTo(t *testing.T) {
+	m := newMemoryWithProjects(t,
+		&Project{ID: ID{1}, ShortName: "lib"},
+		&Project{ID: ID{2}, ShortName: "app", Links: []Link{{DependsOn, ID{1}}}},
+		&Project{ID: ID{3}, ShortName: "fork", Links: []Link{{ForkedFrom, ID{1}}, {DependsOn, ID{2}}}},
+	)
+	links, err := LinksTo(m, ID{1})
+	if err != nil {
+		t.Fatal("LinksTo error:", err)
+	}
+	want := []InboundLink{{DependsOn, ID{2}}, {ForkedFrom, ID{3}}}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("LinksTo(m, lib) = %v; want %v", links, want)
+	}
+	if links, err := LinksTo(m, ID{3}); err != nil || len(links) != 0 {
+		t.Errorf("LinksTo(m, fork) = %v, %v; want [], <nil>", links, err)
+	}
+}
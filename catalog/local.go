@@ -1,11 +1,14 @@
 package catalog
 
 import (
-	"bitbucket.org/zombiezen/blackforest/vcs"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+
+	"bitbucket.org/zombiezen/blackforest/vcs"
 )
 
 // A localCatalog is a catalog that uses the filesystem as storage.
@@ -13,6 +16,19 @@ type localCatalog struct {
 	root string
 	fs   filesystem
 	wc   vcs.WorkingCopy
+	opts Options
+
+	// readOnly is set for catalogs that can't be changed, like those opened
+	// with OpenRev.
+	readOnly bool
+
+	// changes serializes changes made through this value.  The lock file
+	// serializes changes between processes.  Both are acquired with the
+	// same timeout (see lockChanges).  It is created on first use, so that
+	// a zero localCatalog can be changed.
+	changes     chan struct{}
+	changesOnce sync.Once
+	watches     watchSet
 }
 
 // Create creates a new catalog at the given directory.
@@ -21,14 +37,21 @@ func Create(root string) (Catalog, error) {
 }
 
 func create(fs filesystem, root string) (*localCatalog, error) {
+	cat := &localCatalog{root: root, fs: fs}
+	return cat, cat.init()
+}
+
+// init creates the catalog's directory and files.
+func (cat *localCatalog) init() error {
+	fs, root := cat.fs, cat.root
+
 	// Create root directory (must not exist)
 	if err := fs.Mkdir(root); err != nil {
-		return nil, err
+		return err
 	}
 
 	// Lock catalog
-	cat := &localCatalog{root: root, fs: fs}
-	err := cat.doChange("", func() error {
+	return cat.doChange("", func() error {
 		// Create projects directory
 		if err := fs.Mkdir(filepath.Join(root, projectsDir)); err != nil {
 			return err
@@ -43,34 +66,37 @@ func create(fs filesystem, root string) (*localCatalog, error) {
 		}
 
 		// Write out version file
-		var v struct {
-			Version int `json:"version"`
-		}
-		v.Version = 1
-		if err := writeJSON(fs, filepath.Join(root, versionFile), &v, true); err != nil {
+		if err := writeVersion(fs, root, Version, true); err != nil {
 			return err
 		}
 
 		return nil
 	})
-	return cat, err
 }
 
-// Open opens the catalog in a directory.
+// Open opens the catalog in a directory with the default options.
 // If vc is not nil, then a working copy will be opened at root and will be used to commit any
 // changes made to the catalog.
 func Open(root string, vc vcs.VCS) (Catalog, error) {
+	return OpenWithOptions(root, vc, nil)
+}
+
+// OpenWithOptions opens the catalog in a directory.  It behaves like Open,
+// but opts controls how the catalog is locked and watched.  A nil opts is the
+// same as the zero Options.
+func OpenWithOptions(root string, vc vcs.VCS, opts *Options) (Catalog, error) {
 	fs := realFilesystem{}
-	var v struct {
-		Version int `json:"version"`
-	}
-	if err := readJSON(fs, filepath.Join(root, versionFile), &v); err != nil {
+	v, err := readVersion(fs, root)
+	if err != nil {
 		return nil, err
 	}
-	if v.Version != 1 {
-		return nil, VersionError(v.Version)
+	if v != Version {
+		return nil, VersionError(v)
 	}
 	catalog := &localCatalog{root: root, fs: fs}
+	if opts != nil {
+		catalog.opts = *opts
+	}
 	if vc != nil {
 		wc, err := vc.WorkingCopy(root)
 		if err != nil {
@@ -108,6 +134,12 @@ func (cat *localCatalog) List() ([]string, error) {
 }
 
 func (cat *localCatalog) GetProject(shortName string) (*Project, error) {
+	return cat.getProject(shortName, nil)
+}
+
+// getProject reads a project file.  If the project does not exist, then meta
+// is checked for a former short name.  A nil meta is read from catalog.json.
+func (cat *localCatalog) getProject(shortName string, meta *catalogMeta) (*Project, error) {
 	const op = "get"
 
 	if !isValidShortName(shortName) {
@@ -116,90 +148,65 @@ func (cat *localCatalog) GetProject(shortName string) (*Project, error) {
 	proj := new(Project)
 	path := filepath.Join(cat.root, projectsDir, shortName+jsonExt)
 	if err := readJSON(cat.fs, path, proj); err != nil {
-		return proj, &projectError{ShortName: shortName, Op: op, Err: err}
+		if os.IsNotExist(err) {
+			if meta == nil {
+				meta, _ = cat.readCatalogMeta()
+			}
+			if rerr := meta.renamed(shortName); rerr != nil {
+				return nil, rerr
+			}
+			err = ErrNotFound
+		}
+		return nil, &ProjectError{ShortName: shortName, Op: op, Err: err}
 	}
 	return proj, nil
 }
 
-func (cat *localCatalog) PutProject(project *Project) (retErr error) {
-	const op = "put"
-
-	id, sn := project.ID, project.ShortName
-	idString := id.String()
-	if !isValidShortName(sn) {
-		return shortNameError(sn)
+func (cat *localCatalog) GetProjectByID(id ID) (*Project, error) {
+	meta, err := cat.readCatalogMeta()
+	if err != nil {
+		return nil, err
 	}
-	return cat.doChange("put project "+project.ShortName, func() error {
-		var old string
-		var isNewName bool
-		err := cat.rewriteCatalog(func(c *catalogMeta) error {
-			old, c.ShortNameMap[idString] = c.ShortNameMap[idString], sn
-			isNewName = old != project.ShortName
-			if err := writeJSON(cat.fs, cat.projectPath(sn), project, isNewName); err != nil {
-				return err
-			}
-			return nil
-		})
-		if err != nil {
-			return &projectError{ShortName: sn, Op: op, Err: err}
-		}
-		if isNewName && cat.wc != nil {
-			if err := cat.wc.Add([]string{cat.projectRelPath(sn)}); err != nil {
-				return &projectError{ShortName: sn, Op: op, Err: err}
-			}
-		}
-
-		// Delete old file (if necessary)
-		if old != "" && isNewName {
-			if err := cat.fs.Remove(cat.projectPath(old)); err != nil {
-				return &projectError{ShortName: sn, Op: op, Err: err}
-			}
-			if cat.wc != nil {
-				if err := cat.wc.Remove([]string{cat.projectRelPath(old)}); err != nil {
-					return &projectError{ShortName: sn, Op: op, Err: err}
-				}
-				if err := cat.wc.Rename(cat.projectRelPath(old), cat.projectRelPath(sn)); err != nil {
-					return &projectError{ShortName: sn, Op: op, Err: err}
-				}
-			}
-		}
+	sn := meta.ShortNameMap[id.String()]
+	if sn == "" {
+		return nil, &ProjectError{ShortName: id.String(), Op: "get", Err: ErrNotFound}
+	}
+	return cat.getProject(sn, meta)
+}
 
-		return nil
+func (cat *localCatalog) PutProject(project *Project) error {
+	if !isValidShortName(project.ShortName) {
+		return shortNameError(project.ShortName)
+	}
+	return cat.Batch("put project "+project.ShortName, func(tx Catalog) error {
+		return tx.PutProject(project)
 	})
 }
 
 func (cat *localCatalog) DelProject(shortName string) error {
-	const op = "del"
-
 	if !isValidShortName(shortName) {
 		return shortNameError(shortName)
 	}
-	return cat.doChange("delete project "+shortName, func() error {
-		// Rewrite catalog
-		err := cat.rewriteCatalog(func(c *catalogMeta) error {
-			m := c.ShortNameMap
-			for id, name := range m {
-				if name == shortName {
-					delete(m, id)
-				}
-			}
-			return nil
-		})
-		if err != nil {
-			return &projectError{ShortName: shortName, Op: op, Err: err}
-		}
+	return cat.Batch("delete project "+shortName, func(tx Catalog) error {
+		return tx.DelProject(shortName)
+	})
+}
 
-		// Delete file
-		if err := cat.fs.Remove(cat.projectPath(shortName)); err != nil {
-			return &projectError{ShortName: shortName, Op: op, Err: err}
+// Batch calls f with a transaction that applies its changes directly to the
+// project files, keeping a journal of their original contents.  catalog.json
+// is only rewritten, and the working copy only changed, once f succeeds.  If
+// f fails, the journal is used to restore the files.
+func (cat *localCatalog) Batch(message string, f func(tx Catalog) error) error {
+	return cat.doChange(message, func() error {
+		tx, err := cat.begin()
+		if err != nil {
+			return err
 		}
-		if cat.wc != nil {
-			if err := cat.wc.Remove([]string{cat.projectRelPath(shortName)}); err != nil {
-				return &projectError{ShortName: shortName, Op: op, Err: err}
-			}
+		defer tx.close()
+		if err := f(tx); err != nil {
+			return tx.rollback(err)
 		}
-
-		return nil
+		return tx.commit()
 	})
 }
 
@@ -212,28 +219,57 @@ func (cat *localCatalog) projectRelPath(shortName string) string {
 }
 
 func (cat *localCatalog) ShortName(id ID) (string, error) {
-	var c struct {
-		Map map[string]string `json:"id_to_shortname"`
-	}
-	if err := readJSON(cat.fs, filepath.Join(cat.root, catalogFile), &c); err != nil {
+	meta, err := cat.readCatalogMeta()
+	if err != nil {
 		return "", err
 	}
-	return c.Map[id.String()], nil
+	return meta.ShortNameMap[id.String()], nil
+}
+
+func (cat *localCatalog) formerNames() (map[string]ID, error) {
+	meta, err := cat.readCatalogMeta()
+	if err != nil {
+		return nil, err
+	}
+	return meta.formerNames(), nil
+}
+
+func (cat *localCatalog) ids() ([]ID, error) {
+	meta, err := cat.readCatalogMeta()
+	if err != nil {
+		return nil, err
+	}
+	return meta.ids(), nil
 }
 
 // doChange locks the catalog, calls f, and then unlocks the catalog.
 //
 // Any error returned by f is passed through.  It is the responsibility of the function called to
 // roll back any change on failure, if desired.  If f succeeds (i.e. returns nil) and the catalog
-// has an associated working copy, then doChange will commit the change.
+// has an associated working copy, then doChange will commit the change.  f may return errNoChange
+// to report that it did not modify the catalog, in which case doChange returns nil without
+// committing.  A read-only catalog returns ErrReadOnly without calling f.
 func (cat *localCatalog) doChange(message string, f func() error) error {
+	if cat.readOnly {
+		return ErrReadOnly
+	}
+	if err := cat.lockChanges(); err != nil {
+		return err
+	}
+	defer cat.unlockChanges()
 	if err := cat.lock(); err != nil {
 		return err
 	}
 	ferr := f()
-	if err := cat.unlock(); err != nil && ferr == nil {
+	if err := cat.unlock(); err != nil && (ferr == nil || ferr == errNoChange) {
 		return err
 	}
+	if ferr == errNoChange {
+		return nil
+	}
+	if ferr == nil {
+		cat.watches.poke()
+	}
 	if ferr == nil && cat.wc != nil {
 		if err := cat.wc.Commit(message, nil); err != nil {
 			return err
@@ -242,61 +278,105 @@ func (cat *localCatalog) doChange(message string, f func() error) error {
 	return ferr
 }
 
-// rewriteCatalog calls f with the unmarshalled contents of catalog.json and writes any changes.
-// This method does not lock the catalog; it should be used inside of a doChange.  If f returns an error, catalog.json will not be rewritten.
-func (cat *localCatalog) rewriteCatalog(f func(*catalogMeta) error) error {
-	var c catalogMeta
-	p := filepath.Join(cat.root, catalogFile)
-	if err := readJSON(cat.fs, p, &c); err != nil {
-		return err
-	}
-	if err := f(&c); err != nil {
-		return err
+// errNoChange is returned by a doChange function that did not modify the catalog.
+var errNoChange = errors.New("catalog: no change")
+
+// readCatalogMeta reads catalog.json.
+func (cat *localCatalog) readCatalogMeta() (*catalogMeta, error) {
+	meta := new(catalogMeta)
+	if err := readJSON(cat.fs, filepath.Join(cat.root, catalogFile), meta); err != nil {
+		return nil, err
 	}
-	if err := writeJSON(cat.fs, p, &c, false); err != nil {
-		return err
+	if meta.ShortNameMap == nil {
+		meta.ShortNameMap = make(map[string]string)
 	}
-	return nil
+	return meta, nil
 }
 
-func (cat *localCatalog) lockPath() string {
-	return filepath.Join(cat.root, lockFile)
+// readVersion returns the format version recorded in a catalog's version.json.
+func readVersion(fs filesystem, root string) (int, error) {
+	var v versionMeta
+	if err := readJSON(fs, filepath.Join(root, versionFile), &v); err != nil {
+		return 0, err
+	}
+	return v.Version, nil
 }
 
-func (cat *localCatalog) lock() error {
-	p := cat.lockPath()
-	f, err := cat.fs.Create(p, true)
-	if err != nil {
-		if cat.fs.IsExist(err) {
-			return ErrLocked
-		}
-		return err
-	}
-	err = f.Close()
-	if err != nil {
-		// Error ignored.
-		// If the remove fails, the lock is already in a weird state, so there's not too much we can do.
-		cat.fs.Remove(p)
-	}
-	return err
+// writeVersion replaces a catalog's version.json.
+func writeVersion(fs filesystem, root string, version int, excl bool) error {
+	return writeJSON(fs, filepath.Join(root, versionFile), &versionMeta{Version: version}, excl)
 }
 
-func (cat *localCatalog) unlock() error {
-	return cat.fs.Remove(cat.lockPath())
+// A versionMeta holds the schema for a version.json file.
+type versionMeta struct {
+	Version int `json:"version"`
 }
 
 // A catalogMeta holds the schema for a catalog.json file.
 type catalogMeta struct {
 	ShortNameMap map[string]string `json:"id_to_shortname"`
+
+	// FormerNames maps short names that projects no longer use to the ID of
+	// the project that last used them.
+	FormerNames map[string]string `json:"former_names,omitempty"`
+}
+
+// renamed returns a *RenamedError if shortName is a former short name of a
+// project still in the catalog, or nil otherwise.  renamed can be called on a
+// nil catalogMeta.
+func (meta *catalogMeta) renamed(shortName string) *RenamedError {
+	if meta == nil {
+		return nil
+	}
+	idString, ok := meta.FormerNames[shortName]
+	if !ok {
+		return nil
+	}
+	sn := meta.ShortNameMap[idString]
+	id, err := ParseID(idString)
+	if sn == "" || sn == shortName || err != nil {
+		return nil
+	}
+	return &RenamedError{Old: shortName, New: sn, ID: id}
+}
+
+// formerNames returns the former short names of projects still in the
+// catalog, mapped to the projects' IDs.  Entries whose values are not valid
+// IDs are skipped.
+func (meta *catalogMeta) formerNames() map[string]ID {
+	former := make(map[string]ID, len(meta.FormerNames))
+	for sn, s := range meta.FormerNames {
+		if id, err := ParseID(s); err == nil {
+			former[sn] = id
+		}
+	}
+	return former
+}
+
+// ids returns the IDs in the short name map.  Keys that are not valid IDs are
+// skipped.
+func (meta *catalogMeta) ids() []ID {
+	ids := make([]ID, 0, len(meta.ShortNameMap))
+	for s := range meta.ShortNameMap {
+		if id, err := ParseID(s); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
 }
 
 // Catalog paths
 const (
 	versionFile = "version.json"
 	catalogFile = "catalog.json"
+	fieldsFile  = "fields.json"
+	hostsFile   = "hosts.json"
 	lockFile    = "catalog.lock"
+	breakSuffix = ".break"
 
-	projectsDir = "projects"
+	projectsDir    = "projects"
+	attachmentsDir = "attachments"
+	trashDir       = "trash"
 
 	jsonExt = ".json"
 )
@@ -59,8 +59,8 @@ func TestLocalCreate(t *testing.T) {
 		FileName string
 		Content  string
 	}{
-		{"version.json", `{"version":1}` + "\n"},
-		{"catalog.json", `{"id_to_shortname":{}}` + "\n"},
+		{"version.json", "{\n\t\"version\": 3\n}\n"},
+		{"catalog.json", "{\n\t\"id_to_shortname\": {}\n}\n"},
 	}
 	for _, fc := range fileChecks {
 		name := filepath.Join(root, fc.FileName)
@@ -157,6 +157,22 @@ func TestLocalGetProject(t *testing.T) {
 	}
 }
 
+func TestLocalGetProjectByID(t *testing.T) {
+	cat, _, _ := newTestCatalog()
+	id := ID{0x6f, 0x5d, 0x5d, 0xcc, 0x6b, 0x38, 0x49, 0x08, 0x9d}
+	proj, err := cat.GetProjectByID(id)
+	if err != nil {
+		t.Errorf("cat.GetProjectByID(%v) error = %v", id, err)
+	} else if proj.ShortName != "blackforest" {
+		t.Errorf("cat.GetProjectByID(%v).ShortName = %q; want %q", id, proj.ShortName, "blackforest")
+	}
+
+	missing := ID{0xba, 0x7b, 0xbb, 0x6c, 0x2b, 0x66, 0x61, 0x54, 0xfb}
+	if proj, err := cat.GetProjectByID(missing); err == nil {
+		t.Errorf("cat.GetProjectByID(%v) = %v; want error", missing, proj)
+	}
+}
+
 func TestLocalPutProject_New(t *testing.T) {
 	const root = "foo"
 
@@ -180,7 +196,19 @@ func TestLocalPutProject_New(t *testing.T) {
 		FileName string
 		Content  string
 	}{
-		{"foo.json", `{"id":"unu7bCtmYVT7","shortname":"foo","name":"Teh Foo","description":"A junk project","tags":["foo","junk"],"homepage":"http://example.com/","catalog_time":"2013-02-07T10:51:13-08:00","create_time":"2013-02-07T10:51:13-08:00"}` + "\n"},
+		{"foo.json", `{
+	"id": "unu7bCtmYVT7",
+	"shortname": "foo",
+	"name": "Teh Foo",
+	"description": "A junk project",
+	"tags": [
+		"foo",
+		"junk"
+	],
+	"homepage": "http://example.com/",
+	"catalog_time": "2013-02-07T10:51:13-08:00",
+	"create_time": "2013-02-07T10:51:13-08:00"
+}` + "\n"},
 	}
 	for _, fc := range fileChecks {
 		name := filepath.Join(root, "projects", fc.FileName)
@@ -236,7 +264,19 @@ func TestLocalPutProject_Update(t *testing.T) {
 		FileName string
 		Content  string
 	}{
-		{"blackforest.json", `{"id":"b11dzGs4SQid","shortname":"blackforest","name":"Teh Foo","description":"A junk project","tags":["foo","junk"],"homepage":"http://example.com/","catalog_time":"2013-02-07T10:51:13-08:00","create_time":"2013-02-07T10:51:13-08:00"}` + "\n"},
+		{"blackforest.json", `{
+	"id": "b11dzGs4SQid",
+	"shortname": "blackforest",
+	"name": "Teh Foo",
+	"description": "A junk project",
+	"tags": [
+		"foo",
+		"junk"
+	],
+	"homepage": "http://example.com/",
+	"catalog_time": "2013-02-07T10:51:13-08:00",
+	"create_time": "2013-02-07T10:51:13-08:00"
+}` + "\n"},
 	}
 	for _, fc := range fileChecks {
 		name := filepath.Join(root, "projects", fc.FileName)
@@ -292,7 +332,19 @@ func TestLocalPutProject_Rename(t *testing.T) {
 		FileName string
 		Content  string
 	}{
-		{"foo.json", `{"id":"b11dzGs4SQid","shortname":"foo","name":"Teh Foo","description":"A junk project","tags":["foo","junk"],"homepage":"http://example.com/","catalog_time":"2013-02-07T10:51:13-08:00","create_time":"2013-02-07T10:51:13-08:00"}` + "\n"},
+		{"foo.json", `{
+	"id": "b11dzGs4SQid",
+	"shortname": "foo",
+	"name": "Teh Foo",
+	"description": "A junk project",
+	"tags": [
+		"foo",
+		"junk"
+	],
+	"homepage": "http://example.com/",
+	"catalog_time": "2013-02-07T10:51:13-08:00",
+	"create_time": "2013-02-07T10:51:13-08:00"
+}` + "\n"},
 	}
 	for _, fc := range fileChecks {
 		name := filepath.Join(root, "projects", fc.FileName)
@@ -392,7 +444,7 @@ func projectEqual(a, b *Project) bool {
 		a.Homepage == b.Homepage &&
 		a.CatalogTime.Equal(b.CatalogTime) &&
 		a.CreateTime.Equal(b.CreateTime) &&
-		reflect.DeepEqual(a.VCS, b.VCS) &&
+		reflect.DeepEqual(a.Remotes, b.Remotes) &&
 		reflect.DeepEqual(a.PerHost, b.PerHost)
 }
 
@@ -400,7 +452,12 @@ type mockWC struct {
 	added     []string
 	removed   []string
 	renamed   map[string]string
+	untracked []string
 	committed bool
+
+	// fail is called before each change, if not nil.  If it returns an
+	// error, the change fails with that error.
+	fail func(op string) error
 }
 
 func (wc *mockWC) VCS() vcs.VCS {
@@ -424,16 +481,31 @@ func (wc *mockWC) ParseRev(s string) (vcs.Rev, error) {
 }
 
 func (wc *mockWC) Add(paths []string) error {
+	if wc.fail != nil {
+		if err := wc.fail("add"); err != nil {
+			return err
+		}
+	}
 	wc.added = append(wc.added, paths...)
 	return nil
 }
 
 func (wc *mockWC) Remove(paths []string) error {
+	if wc.fail != nil {
+		if err := wc.fail("remove"); err != nil {
+			return err
+		}
+	}
 	wc.removed = append(wc.removed, paths...)
 	return nil
 }
 
 func (wc *mockWC) Rename(src, dst string) error {
+	if wc.fail != nil {
+		if err := wc.fail("rename"); err != nil {
+			return err
+		}
+	}
 	wc.renamed[src] = dst
 	return nil
 }
@@ -442,3 +514,354 @@ func (wc *mockWC) Commit(message string, files []string) error {
 	wc.committed = true
 	return nil
 }
+
+func (wc *mockWC) Untracked(paths []string) ([]string, error) {
+	return wc.untracked, nil
+}
+
+func TestLocalPutProject_WriteFailure(t *testing.T) {
+	const root = "foo"
+
+	id := ID{0x6f, 0x5d, 0x5d, 0xcc, 0x6b, 0x38, 0x49, 0x08, 0x9d}
+	cat, fs, wc := newTestCatalog()
+	catalogJSON := string(fs.files[filepath.Join(root, "catalog.json")])
+	errDiskFull := errors.New("disk full")
+	fs.fail = func(op, path string) error {
+		if op == "write" {
+			return errDiskFull
+		}
+		return nil
+	}
+	proj := &Project{
+		ID:          id,
+		ShortName:   "blackforest",
+		Name:        "Teh Foo",
+		CatalogTime: magicTime,
+		CreateTime:  magicTime,
+	}
+	if err := cat.PutProject(proj); err == nil {
+		t.Error("expected put error, got nil")
+	}
+
+	fileChecks := []struct {
+		FileName string
+		Content  string
+	}{
+		{"catalog.json", catalogJSON},
+		{filepath.Join("projects", "blackforest.json"), exampleProjectJSON},
+	}
+	for _, fc := range fileChecks {
+		name := filepath.Join(root, fc.FileName)
+		if data, ok := fs.files[name]; ok && string(data) != fc.Content {
+			t.Errorf("%v contents = %q; want %q", name, string(data), fc.Content)
+		} else if !ok {
+			t.Errorf("%q does not exist!", name)
+		}
+	}
+	if wc.committed {
+		t.Error("vcs committed")
+	}
+}
+
+func TestLocalPutProject_VCSFailure(t *testing.T) {
+	const root = "foo"
+	errVCS := errors.New("vcs failed")
+	cat, fs, wc := newTestCatalog()
+	wc.fail = func(op string) error {
+		if op == "rename" {
+			return errVCS
+		}
+		return nil
+	}
+	proj, err := cat.GetProject("blackforest")
+	if err != nil {
+		t.Fatal("GetProject error:", err)
+	}
+	proj.ShortName = "bf"
+	if err := cat.PutProject(proj); !errors.Is(err, errVCS) {
+		t.Fatalf("PutProject error = %v; want %v", err, errVCS)
+	}
+	if _, ok := fs.files[filepath.Join(root, "projects", "blackforest.json")]; !ok {
+		t.Error("blackforest.json not restored")
+	}
+	// The new file is staged and then removed again, and the old file is
+	// unstaged and then added back.
+	if want := []string{"projects/bf.json", "projects/blackforest.json"}; !reflect.DeepEqual(wc.added, want) {
+		t.Errorf("vcs added = %v; want %v", wc.added, want)
+	}
+	if want := []string{"projects/blackforest.json", "projects/bf.json"}; !reflect.DeepEqual(wc.removed, want) {
+		t.Errorf("vcs removed = %v; want %v", wc.removed, want)
+	}
+
+	// If the working copy can't be undone, the caller hears about it.
+	adds := 0
+	wc.fail = func(op string) error {
+		switch {
+		case op == "rename":
+			return errVCS
+		case op == "add":
+			if adds++; adds > 1 {
+				return errVCS
+			}
+		}
+		return nil
+	}
+	err = cat.PutProject(proj)
+	var rerr *RollbackError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("PutProject with failed undo error = %v; want *RollbackError", err)
+	}
+	if want := []string{"projects/blackforest.json"}; !reflect.DeepEqual(rerr.Files, want) {
+		t.Errorf("RollbackError.Files = %v; want %v", rerr.Files, want)
+	}
+}
+
+func TestLocalBatch_FailedRename(t *testing.T) {
+	const root = "foo"
+	errRemove := errors.New("remove failed")
+	cat, fs, _ := newTestCatalog()
+	oldPath := filepath.Join(root, "projects", "blackforest.json")
+	fs.fail = func(op, path string) error {
+		if op == "remove" && path == oldPath {
+			return errRemove
+		}
+		return nil
+	}
+	id := ID{0x6f, 0x5d, 0x5d, 0xcc, 0x6b, 0x38, 0x49, 0x08, 0x9d}
+	err := cat.Batch("test batch", func(tx Catalog) error {
+		proj, err := tx.GetProject("blackforest")
+		if err != nil {
+			return err
+		}
+		proj.ShortName = "bf"
+		if err := tx.PutProject(proj); !errors.Is(err, errRemove) {
+			t.Errorf("PutProject(bf) error = %v; want %v", err, errRemove)
+		}
+		return tx.PutProject(&Project{ID: ID{1}, ShortName: "foo"})
+	})
+	if err != nil {
+		t.Fatal("Batch error:", err)
+	}
+	if _, ok := fs.files[filepath.Join(root, "projects", "bf.json")]; ok {
+		t.Error("bf.json exists after failed rename")
+	}
+	if _, ok := fs.files[filepath.Join(root, "projects", "foo.json")]; !ok {
+		t.Error("foo.json does not exist")
+	}
+	if sn, err := cat.ShortName(id); err != nil || sn != "blackforest" {
+		t.Errorf("ShortName(%v) = %q, %v; want \"blackforest\"", id, sn, err)
+	}
+	if former, err := cat.formerNames(); err != nil || len(former) != 0 {
+		t.Errorf("formerNames() = %v, %v; want none", former, err)
+	}
+
+	// If the new file can't be removed either, the batch fails with the
+	// reason that it couldn't be removed.
+	errUndo := errors.New("undo failed")
+	newPath := filepath.Join(root, "projects", "forest.json")
+	fs.fail = func(op, path string) error {
+		switch {
+		case op == "remove" && path == newPath:
+			return errUndo
+		case op == "remove":
+			return errRemove
+		}
+		return nil
+	}
+	err = cat.Batch("test batch", func(tx Catalog) error {
+		proj, err := tx.GetProject("blackforest")
+		if err != nil {
+			return err
+		}
+		proj.ShortName = "forest"
+		tx.PutProject(proj)
+		return nil
+	})
+	// Rolling back can't remove forest.json either.
+	var rerr *RollbackError
+	if !errors.As(err, &rerr) {
+		t.Errorf("Batch with unremovable files error = %v; want *RollbackError", err)
+	} else if !errors.Is(rerr.Err, errUndo) {
+		t.Errorf("RollbackError.Err = %v; want %v", rerr.Err, errUndo)
+	}
+	if sn, err := cat.ShortName(id); err != nil || sn != "blackforest" {
+		t.Errorf("ShortName(%v) = %q, %v; want \"blackforest\"", id, sn, err)
+	}
+}
+
+func TestLocalBatch(t *testing.T) {
+	const root = "foo"
+
+	cat, fs, wc := newTestCatalog()
+	catalogWrites := 0
+	fs.fail = func(op, path string) error {
+		if op == "rename" && path == filepath.Join(root, "catalog.json") {
+			catalogWrites++
+		}
+		return nil
+	}
+	oldID := ID{0x6f, 0x5d, 0x5d, 0xcc, 0x6b, 0x38, 0x49, 0x08, 0x9d}
+	newID := ID{0xba, 0x7b, 0xbb, 0x6c, 0x2b, 0x66, 0x61, 0x54, 0xfb}
+	err := cat.Batch("test batch", func(tx Catalog) error {
+		if err := tx.PutProject(&Project{ID: newID, ShortName: "foo", Name: "Teh Foo"}); err != nil {
+			return err
+		}
+		proj, err := tx.GetProject("blackforest")
+		if err != nil {
+			return err
+		}
+		proj.ShortName = "bf"
+		if err := tx.PutProject(proj); err != nil {
+			return err
+		}
+		proj.ShortName = "forest"
+		return tx.PutProject(proj)
+	})
+	if err != nil {
+		t.Error("batch error:", err)
+	}
+
+	for _, name := range []string{"foo.json", "forest.json"} {
+		if _, ok := fs.files[filepath.Join(root, "projects", name)]; !ok {
+			t.Errorf("%s does not exist!", name)
+		}
+	}
+	for _, name := range []string{"blackforest.json", "bf.json"} {
+		if _, ok := fs.files[filepath.Join(root, "projects", name)]; ok {
+			t.Errorf("%s still exists", name)
+		}
+	}
+	for id, want := range map[ID]string{oldID: "forest", newID: "foo"} {
+		if sn, err := cat.ShortName(id); err != nil {
+			t.Errorf("cat.ShortName(%v) error = %v", id, err)
+		} else if sn != want {
+			t.Errorf("cat.ShortName(%v) = %q; want %q", id, sn, want)
+		}
+	}
+	if catalogWrites != 1 {
+		t.Errorf("catalog.json written %d times; want 1", catalogWrites)
+	}
+
+	if want := []string{"projects/foo.json", "projects/forest.json"}; !reflect.DeepEqual(wc.added, want) {
+		t.Errorf("vcs added = %v; want %v", wc.added, want)
+	}
+	if want := []string{"projects/blackforest.json"}; !reflect.DeepEqual(wc.removed, want) {
+		t.Errorf("vcs removed = %v; want %v", wc.removed, want)
+	}
+	if want := map[string]string{"projects/blackforest.json": "projects/forest.json"}; !reflect.DeepEqual(wc.renamed, want) {
+		t.Errorf("vcs renamed = %v; want %v", wc.renamed, want)
+	}
+	if !wc.committed {
+		t.Error("vcs not committed")
+	}
+}
+
+func TestLocalBatch_Rollback(t *testing.T) {
+	const root = "foo"
+
+	cat, fs, wc := newTestCatalog()
+	catalogJSON := string(fs.files[filepath.Join(root, "catalog.json")])
+	errAbort := errors.New("abort")
+	err := cat.Batch("test batch", func(tx Catalog) error {
+		newID := ID{0xba, 0x7b, 0xbb, 0x6c, 0x2b, 0x66, 0x61, 0x54, 0xfb}
+		if err := tx.PutProject(&Project{ID: newID, ShortName: "foo", Name: "Teh Foo"}); err != nil {
+			return err
+		}
+		if err := tx.DelProject("blackforest"); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if err != errAbort {
+		t.Errorf("batch error = %v; want %v", err, errAbort)
+	}
+
+	fileChecks := []struct {
+		FileName string
+		Content  string
+	}{
+		{"catalog.json", catalogJSON},
+		{filepath.Join("projects", "blackforest.json"), exampleProjectJSON},
+	}
+	for _, fc := range fileChecks {
+		name := filepath.Join(root, fc.FileName)
+		if data, ok := fs.files[name]; ok && string(data) != fc.Content {
+			t.Errorf("%v contents = %q; want %q", name, string(data), fc.Content)
+		} else if !ok {
+			t.Errorf("%q does not exist!", name)
+		}
+	}
+	if _, ok := fs.files[filepath.Join(root, "projects", "foo.json")]; ok {
+		t.Error("foo.json still exists")
+	}
+	if _, ok := fs.files[filepath.Join(root, lockFile)]; ok {
+		t.Error("catalog still locked")
+	}
+	if len(wc.added) != 0 {
+		t.Errorf("vcs added = %v; want []", wc.added)
+	}
+	if len(wc.removed) != 0 {
+		t.Errorf("vcs removed = %v; want []", wc.removed)
+	}
+	if wc.committed {
+		t.Error("vcs committed")
+	}
+}
+
+func TestLocalBatch_Empty(t *testing.T) {
+	cat, _, wc := newTestCatalog()
+	err := cat.Batch("test batch", func(tx Catalog) error {
+		_, err := tx.GetProject("blackforest")
+		return err
+	})
+	if err != nil {
+		t.Error("batch error:", err)
+	}
+	if wc.committed {
+		t.Error("vcs committed")
+	}
+}
+
+func TestLocalGetProject_Renamed(t *testing.T) {
+	id := ID{0x6f, 0x5d, 0x5d, 0xcc, 0x6b, 0x38, 0x49, 0x08, 0x9d}
+	cat, _, _ := newTestCatalog()
+	proj, err := cat.GetProject("blackforest")
+	if err != nil {
+		t.Fatal("get error:", err)
+	}
+	for _, sn := range []string{"foo", "bar"} {
+		proj.ShortName = sn
+		if err := cat.PutProject(proj); err != nil {
+			t.Fatalf("put %s error: %v", sn, err)
+		}
+	}
+
+	for _, old := range []string{"blackforest", "foo"} {
+		_, err := cat.GetProject(old)
+		want := &RenamedError{Old: old, New: "bar", ID: id}
+		if rerr, ok := err.(*RenamedError); !ok || *rerr != *want {
+			t.Errorf("cat.GetProject(%q) error = %v; want %v", old, err, want)
+		}
+	}
+
+	// Reusing a former name replaces the redirect.
+	other := &Project{ID: ID{0xba, 0x7b, 0xbb, 0x6c, 0x2b, 0x66, 0x61, 0x54, 0xfb}, ShortName: "foo", Name: "Teh Foo"}
+	if err := cat.PutProject(other); err != nil {
+		t.Fatal("put error:", err)
+	}
+	if p, err := cat.GetProject("foo"); err != nil {
+		t.Errorf("cat.GetProject(%q) error = %v", "foo", err)
+	} else if p.Name != "Teh Foo" {
+		t.Errorf("cat.GetProject(%q).Name = %q; want %q", "foo", p.Name, "Teh Foo")
+	}
+
+	// Deleting a project removes its former names.
+	if err := cat.DelProject("bar"); err != nil {
+		t.Fatal("delete error:", err)
+	}
+	if _, err := cat.GetProject("blackforest"); err == nil {
+		t.Errorf("cat.GetProject(%q) after delete = nil error", "blackforest")
+	} else if _, ok := err.(*RenamedError); ok {
+		t.Errorf("cat.GetProject(%q) after delete error = %v; want not found", "blackforest", err)
+	}
+}
@@ -0,0 +1,260 @@
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Options controls how a catalog is locked while it is being changed and how
+// it is watched for changes.
+type Options struct {
+	// LockTimeout is how long a change waits for another process to release
+	// the catalog lock before failing with ErrLocked.  If zero, the change
+	// fails immediately.
+	LockTimeout time.Duration
+
+	// BreakStaleLocks allows a change to remove a lock left behind by a
+	// process that is no longer running.
+	BreakStaleLocks bool
+
+	// StaleLockAge, if positive, is the age after which any lock is
+	// considered stale, even if its holder cannot be checked.  This only has
+	// an effect if BreakStaleLocks is true.
+	StaleLockAge time.Duration
+
+	// WatchPollInterval is how often Watch checks the catalog for changes
+	// when the operating system cannot report them.  If zero,
+	// DefaultWatchPollInterval is used.
+	WatchPollInterval time.Duration
+}
+
+// How often to check a held lock while waiting.
+const lockPollInterval = 50 * time.Millisecond
+
+// ErrLockChanged is returned by BreakLock when the lock is no longer held by
+// the expected process.
+var ErrLockChanged = errors.New("catalog lock changed hands")
+
+// LockInfo describes the process that holds a catalog lock.
+type LockInfo struct {
+	PID  int       `json:"pid"`
+	Host string    `json:"host"`
+	Time time.Time `json:"time"`
+}
+
+func (info *LockInfo) String() string {
+	pid, host := "unknown process", "unknown host"
+	if info.PID != 0 {
+		pid = "process " + strconv.Itoa(info.PID)
+	}
+	if info.Host != "" {
+		host = info.Host
+	}
+	return pid + " on " + host + " since " + info.Time.Format(time.RFC3339)
+}
+
+// Stale reports whether the lock holder is known to have exited.  Only
+// processes on the current host can be checked.
+func (info *LockInfo) Stale() bool {
+	if info.PID == 0 || info.Host == "" {
+		return false
+	}
+	if h, err := os.Hostname(); err != nil || h != info.Host {
+		return false
+	}
+	return !processExists(info.PID)
+}
+
+// ReadLock returns the holder of the lock on the catalog at root, or nil with
+// no error if the catalog is not locked.
+func ReadLock(root string) (*LockInfo, error) {
+	info, err := readLock(realFilesystem{}, filepath.Join(root, lockFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return info, err
+}
+
+// BreakLock removes the lock on the catalog at root, as long as it is still
+// held by the process described by info.  This should only be used when the
+// holder is known to be gone.
+func BreakLock(root string, info *LockInfo) error {
+	return breakLock(realFilesystem{}, filepath.Join(root, lockFile), info)
+}
+
+// readLock reads a lock file.  Locks created by older versions of Black Forest
+// are empty, so their time is taken from the file's modification time.  A
+// lock that can't be parsed, like one from a process that crashed while
+// writing it, is treated the same way.
+func readLock(fs filesystem, path string) (*LockInfo, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	info := new(LockInfo)
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, info); err != nil {
+			info = new(LockInfo)
+		}
+	}
+	if info.Time.IsZero() {
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		info.Time = fi.ModTime()
+	}
+	return info, nil
+}
+
+// breakLock removes the lock file at path if it is still held by info.  The
+// read, compare, and remove happen while holding a second lock file (path with
+// breakSuffix), so that two processes breaking the same lock can't remove a
+// new lock taken in between.  If another process is already breaking the
+// lock, breakLock returns ErrLockChanged.
+func breakLock(fs filesystem, path string, info *LockInfo) error {
+	mark := path + breakSuffix
+	if err := createLock(fs, mark); fs.IsExist(err) {
+		return ErrLockChanged
+	} else if err != nil {
+		return err
+	}
+	// Error ignored.
+	// A leftover marker only stops other breaks, and verify reports it.
+	defer fs.Remove(mark)
+
+	curr, err := readLock(fs, path)
+	if err != nil {
+		return err
+	}
+	if curr.PID != info.PID || curr.Host != info.Host || !curr.Time.Equal(info.Time) {
+		return ErrLockChanged
+	}
+	return fs.Remove(path)
+}
+
+func (cat *localCatalog) lockPath() string {
+	return filepath.Join(cat.root, lockFile)
+}
+
+// lock acquires the catalog lock, waiting and breaking stale locks as
+// permitted by the catalog's options.
+func (cat *localCatalog) lock() error {
+	deadline := time.Now().Add(cat.opts.LockTimeout)
+	for {
+		err := cat.tryLock()
+		if err != ErrLocked {
+			return err
+		}
+		if cat.opts.BreakStaleLocks {
+			p := cat.lockPath()
+			if info, err := readLock(cat.fs, p); err == nil && cat.isStale(info) {
+				if breakLock(cat.fs, p, info) == nil {
+					continue
+				}
+			}
+		}
+		if !time.Now().Before(deadline) {
+			return ErrLocked
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// minChangeWait is the least time that a change waits for other changes made
+// through the same catalog value, even if LockTimeout is shorter.  Those
+// changes are in this process and finish quickly, so only a change started
+// from inside another one should wait this long.
+var minChangeWait = 1 * time.Second
+
+// changeSem returns the semaphore that serializes changes made through cat.
+func (cat *localCatalog) changeSem() chan struct{} {
+	cat.changesOnce.Do(func() {
+		cat.changes = make(chan struct{}, 1)
+	})
+	return cat.changes
+}
+
+// lockChanges waits for other changes made through cat to finish, as long as
+// lock would wait for the lock file (but at least minChangeWait).  Waiting
+// changes go first come, first served.  The semaphore is not reentrant, so a
+// change started from inside another change on the same catalog (like a
+// PutProject in a Batch) fails with ErrLocked instead of waiting forever.
+func (cat *localCatalog) lockChanges() error {
+	sem := cat.changeSem()
+	select {
+	case sem <- struct{}{}:
+		return nil
+	default:
+	}
+	wait := cat.opts.LockTimeout
+	if wait < minChangeWait {
+		wait = minChangeWait
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case sem <- struct{}{}:
+		return nil
+	case <-t.C:
+		return ErrLocked
+	}
+}
+
+// unlockChanges lets the next change made through cat start.
+func (cat *localCatalog) unlockChanges() {
+	<-cat.changeSem()
+}
+
+func (cat *localCatalog) isStale(info *LockInfo) bool {
+	if age := cat.opts.StaleLockAge; age > 0 && time.Since(info.Time) > age {
+		return true
+	}
+	return info.Stale()
+}
+
+// tryLock creates the lock file or returns ErrLocked if it already exists.
+func (cat *localCatalog) tryLock() error {
+	err := createLock(cat.fs, cat.lockPath())
+	if cat.fs.IsExist(err) {
+		return ErrLocked
+	}
+	return err
+}
+
+// createLock creates a lock file at path that describes the current process.
+// It fails if the file already exists.
+func createLock(fs filesystem, path string) error {
+	f, err := fs.Create(path, true)
+	if err != nil {
+		return err
+	}
+	info := &LockInfo{PID: os.Getpid(), Time: time.Now()}
+	// If the hostname can't be determined, the lock will never be considered
+	// stale, which is safe.
+	info.Host, _ = os.Hostname()
+	err = json.NewEncoder(f).Encode(info)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		// Error ignored.
+		// If the remove fails, the lock is already in a weird state, so there's not too much we can do.
+		fs.Remove(path)
+	}
+	return err
+}
+
+func (cat *localCatalog) unlock() error {
+	return cat.fs.Remove(cat.lockPath())
+}
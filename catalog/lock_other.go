@@ -0,0 +1,19 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package catalog
+
+import (
+	"os"
+)
+
+// processExists reports whether a process with the given ID is running on
+// this host.
+func processExists(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -0,0 +1,205 @@
+package catalog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// deadPID is a process ID that is larger than any Linux or BSD allows.
+const deadPID = 1 << 30
+
+func writeTestLock(fs *mockFilesystem, root string, info *LockInfo) {
+	data, err := json.Marshal(info)
+	if err != nil {
+		panic(err)
+	}
+	fs.makeFile(filepath.Join(root, lockFile), string(data))
+}
+
+func TestLockInfo(t *testing.T) {
+	cat, fs, _ := newTestCatalog()
+	start := time.Now()
+	if err := cat.lock(); err != nil {
+		t.Fatal("lock error:", err)
+	}
+	info, err := readLock(fs, cat.lockPath())
+	if err != nil {
+		t.Fatal("readLock error:", err)
+	}
+	if info.PID != os.Getpid() {
+		t.Errorf("info.PID = %d; want %d", info.PID, os.Getpid())
+	}
+	if host, _ := os.Hostname(); info.Host != host {
+		t.Errorf("info.Host = %q; want %q", info.Host, host)
+	}
+	if info.Time.Before(start.Add(-time.Second)) || info.Time.After(time.Now().Add(time.Second)) {
+		t.Errorf("info.Time = %v; want around %v", info.Time, start)
+	}
+	if info.Stale() {
+		t.Error("lock held by this process is stale")
+	}
+	if err := cat.unlock(); err != nil {
+		t.Error("unlock error:", err)
+	}
+}
+
+func TestLockStale(t *testing.T) {
+	host, err := os.Hostname()
+	if err != nil {
+		t.Skip("no hostname:", err)
+	}
+	cat, fs, wc := newTestCatalog()
+	writeTestLock(fs, cat.root, &LockInfo{PID: deadPID, Host: host, Time: magicTime})
+
+	if err := cat.DelProject("blackforest"); err != ErrLocked {
+		t.Errorf("DelProject without BreakStaleLocks error = %v; want %v", err, ErrLocked)
+	}
+	cat.opts.BreakStaleLocks = true
+	if err := cat.DelProject("blackforest"); err != nil {
+		t.Error("DelProject error:", err)
+	}
+	if _, ok := fs.files[cat.lockPath()]; ok {
+		t.Error("catalog still locked")
+	}
+	if !wc.committed {
+		t.Error("vcs not committed")
+	}
+}
+
+func TestLockStaleAge(t *testing.T) {
+	cat, fs, _ := newTestCatalog()
+	cat.opts = Options{BreakStaleLocks: true, StaleLockAge: time.Hour}
+	writeTestLock(fs, cat.root, &LockInfo{PID: os.Getpid(), Host: "elsewhere", Time: time.Now().Add(-2 * time.Hour)})
+	if err := cat.DelProject("blackforest"); err != nil {
+		t.Error("DelProject error:", err)
+	}
+
+	writeTestLock(fs, cat.root, &LockInfo{PID: os.Getpid(), Host: "elsewhere", Time: time.Now()})
+	if err := cat.PutProject(&Project{ShortName: "foo"}); err != ErrLocked {
+		t.Errorf("PutProject error = %v; want %v", err, ErrLocked)
+	}
+}
+
+func TestLockTimeout(t *testing.T) {
+	const timeout = 2 * lockPollInterval
+	cat, fs, _ := newTestCatalog()
+	cat.opts = Options{LockTimeout: timeout, BreakStaleLocks: true}
+	writeTestLock(fs, cat.root, &LockInfo{PID: os.Getpid(), Host: "elsewhere", Time: time.Now()})
+
+	start := time.Now()
+	if err := cat.DelProject("blackforest"); err != ErrLocked {
+		t.Errorf("DelProject error = %v; want %v", err, ErrLocked)
+	}
+	if d := time.Since(start); d < timeout {
+		t.Errorf("DelProject returned after %v; want at least %v", d, timeout)
+	}
+}
+
+func TestLockNested(t *testing.T) {
+	defer func(d time.Duration) { minChangeWait = d }(minChangeWait)
+	minChangeWait = 2 * lockPollInterval
+	m := NewMemory()
+	done := make(chan error, 1)
+	go func() {
+		done <- m.Batch("nested", func(tx Catalog) error {
+			return m.PutProject(&Project{ID: ID{1}, ShortName: "foo"})
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != ErrLocked {
+			t.Errorf("PutProject inside Batch error = %v; want %v", err, ErrLocked)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("PutProject inside Batch did not return")
+	}
+	if err := m.PutProject(&Project{ID: ID{1}, ShortName: "foo"}); err != nil {
+		t.Error("PutProject after nested call error:", err)
+	}
+}
+
+func TestLockEmpty(t *testing.T) {
+	cat, fs, _ := newTestCatalog()
+	fs.makeFile(cat.lockPath(), "")
+	info, err := readLock(fs, cat.lockPath())
+	if err != nil {
+		t.Fatal("readLock error:", err)
+	}
+	if info.PID != 0 || info.Host != "" {
+		t.Errorf("readLock = %v; want unknown holder", info)
+	}
+	if info.Stale() {
+		t.Error("lock with unknown holder is stale")
+	}
+}
+
+func TestLockMalformed(t *testing.T) {
+	cat, fs, _ := newTestCatalog()
+	fs.makeFile(cat.lockPath(), `{"pid": 12`)
+	info, err := readLock(fs, cat.lockPath())
+	if err != nil {
+		t.Fatal("readLock error:", err)
+	}
+	if info.PID != 0 || info.Host != "" {
+		t.Errorf("readLock = %v; want unknown holder", info)
+	}
+
+	// The mock filesystem's files have a zero modification time, so the
+	// lock is older than StaleLockAge.
+	cat.opts = Options{BreakStaleLocks: true, StaleLockAge: time.Hour}
+	if err := cat.PutProject(&Project{ID: ID{1}, ShortName: "foo"}); err != nil {
+		t.Error("PutProject with old malformed lock error:", err)
+	}
+}
+
+func TestBreakLock(t *testing.T) {
+	cat, fs, _ := newTestCatalog()
+	held := &LockInfo{PID: 42, Host: "elsewhere", Time: magicTime}
+	writeTestLock(fs, cat.root, held)
+
+	other := &LockInfo{PID: 43, Host: "elsewhere", Time: magicTime}
+	if err := breakLock(fs, cat.lockPath(), other); err != ErrLockChanged {
+		t.Errorf("breakLock(%v) error = %v; want %v", other, err, ErrLockChanged)
+	}
+	if _, ok := fs.files[cat.lockPath()]; !ok {
+		t.Fatal("lock removed by wrong holder")
+	}
+	if err := breakLock(fs, cat.lockPath(), held); err != nil {
+		t.Errorf("breakLock(%v) error: %v", held, err)
+	}
+	if _, ok := fs.files[cat.lockPath()]; ok {
+		t.Error("lock not removed")
+	}
+}
+
+func TestBreakLock_Breaking(t *testing.T) {
+	cat, fs, _ := newTestCatalog()
+	held := &LockInfo{PID: 42, Host: "elsewhere", Time: magicTime}
+	writeTestLock(fs, cat.root, held)
+	mark := cat.lockPath() + breakSuffix
+	fs.makeFile(mark, `{"pid": 43, "host": "elsewhere"}`)
+
+	if err := breakLock(fs, cat.lockPath(), held); err != ErrLockChanged {
+		t.Errorf("breakLock(%v) while another break is running error = %v; want %v", held, err, ErrLockChanged)
+	}
+	if _, ok := fs.files[cat.lockPath()]; !ok {
+		t.Error("lock removed during another break")
+	}
+	if _, ok := fs.files[mark]; !ok {
+		t.Error("other break's marker removed")
+	}
+
+	delete(fs.files, mark)
+	if err := breakLock(fs, cat.lockPath(), held); err != nil {
+		t.Errorf("breakLock(%v) error: %v", held, err)
+	}
+	for path := range fs.files {
+		if strings.HasPrefix(filepath.Base(path), lockFile) {
+			t.Errorf("left %s behind", path)
+		}
+	}
+}
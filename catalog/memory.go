@@ -0,0 +1,395 @@
+package catalog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is a catalog that is stored in memory.  It behaves exactly like a
+// catalog created with Create: short names are validated, IDs are mapped to
+// short names, and renames are remembered the same way.  Memory is
+// intended for tests and tools that need a scratch catalog.
+type Memory struct {
+	localCatalog
+}
+
+// memoryRoot is the root directory of a Memory catalog's filesystem.
+const memoryRoot = "."
+
+// NewMemory returns a new, empty in-memory catalog.
+func NewMemory() *Memory {
+	m := &Memory{localCatalog{root: memoryRoot, fs: newMemFilesystem()}}
+	if err := m.init(); err != nil {
+		// Only possible if the filesystem is broken.
+		panic(err)
+	}
+	return m
+}
+
+// A memorySnapshot holds the schema for a Memory snapshot.
+type memorySnapshot struct {
+	Version int `json:"version"`
+
+	// Files maps the slash-separated path of every file in the catalog,
+	// relative to its root, to the file's contents.  The version file and
+	// the lock are not included.
+	Files map[string][]byte `json:"files,omitempty"`
+
+	// Catalog and Projects hold the catalog in snapshots written before
+	// Files was added, which only had catalog.json and the project files.
+	Catalog  json.RawMessage            `json:"catalog,omitempty"`
+	Projects map[string]json.RawMessage `json:"projects,omitempty"`
+}
+
+// WriteSnapshot writes the catalog's contents to w as JSON.  The snapshot
+// can be read with LoadMemory.
+func (m *Memory) WriteSnapshot(w io.Writer) error {
+	snap := memorySnapshot{Version: Version, Files: make(map[string][]byte)}
+	err := m.doChange("", func() error {
+		err := walkFiles(m.fs, m.root, func(path string) error {
+			rel, err := filepath.Rel(m.root, path)
+			if err != nil {
+				return err
+			}
+			if !isSnapshotPath(rel) {
+				return nil
+			}
+			data, err := readFile(m.fs, path)
+			if err != nil {
+				return err
+			}
+			snap.Files[filepath.ToSlash(rel)] = data
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return errNoChange
+	})
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(&snap)
+}
+
+// LoadMemory reads a snapshot written by Memory.WriteSnapshot into a new
+// in-memory catalog.  Snapshots of older catalog versions are upgraded.
+func LoadMemory(r io.Reader) (*Memory, error) {
+	var snap memorySnapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return nil, err
+	}
+	if snap.Version < 1 || snap.Version > Version {
+		return nil, VersionError(snap.Version)
+	}
+	files := snap.Files
+	if files == nil {
+		files = make(map[string][]byte, len(snap.Projects)+1)
+		if snap.Catalog != nil {
+			files[catalogFile] = snap.Catalog
+		}
+		for sn, data := range snap.Projects {
+			if !isValidShortName(sn) {
+				return nil, shortNameError(sn)
+			}
+			files[projectsDir+"/"+sn+jsonExt] = data
+		}
+	}
+
+	m := NewMemory()
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		rel := filepath.FromSlash(path)
+		if !isSnapshotPath(rel) || filepath.IsAbs(rel) || rel != filepath.Clean(rel) || strings.HasPrefix(rel, "..") {
+			return nil, errors.New("catalog: snapshot has bad path " + strconv.Quote(path))
+		}
+		data := files[path]
+		if err := checkSnapshotFile(rel, data); err != nil {
+			return nil, err
+		}
+		if err := mkdirAll(m.fs, filepath.Join(m.root, filepath.Dir(rel))); err != nil {
+			return nil, err
+		}
+		if err := writeFile(m.fs, filepath.Join(m.root, rel), data, false); err != nil {
+			return nil, err
+		}
+	}
+	if snap.Version < Version {
+		if err := writeVersion(m.fs, m.root, snap.Version, false); err != nil {
+			return nil, err
+		}
+		if _, err := upgrade(&m.localCatalog, migrations, false); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// isSnapshotPath reports whether the file at rel, relative to the catalog
+// root, belongs in a snapshot.
+func isSnapshotPath(rel string) bool {
+	switch rel {
+	case versionFile, lockFile, lockFile + breakSuffix:
+		return false
+	}
+	return !strings.HasPrefix(filepath.Base(rel), ".")
+}
+
+// checkSnapshotFile returns an error if a file read from a snapshot is
+// malformed.
+func checkSnapshotFile(rel string, data []byte) error {
+	switch {
+	case rel == catalogFile:
+		return json.Unmarshal(data, new(catalogMeta))
+	case filepath.Dir(rel) == projectsDir && strings.HasSuffix(rel, jsonExt):
+		sn := strings.TrimSuffix(filepath.Base(rel), jsonExt)
+		if !isValidShortName(sn) {
+			return shortNameError(sn)
+		}
+		proj := new(Project)
+		if err := json.Unmarshal(data, proj); err != nil {
+			return &ProjectError{ShortName: sn, Op: "load", Err: err}
+		}
+		if err := checkStatus(proj); err != nil {
+			return &ProjectError{ShortName: sn, Op: "load", Err: err}
+		}
+	}
+	return nil
+}
+
+// walkFiles calls f with the path of every regular file under dir.
+func walkFiles(fs filesystem, dir string, f func(path string) error) error {
+	d, err := fs.Open(dir)
+	if err != nil {
+		return err
+	}
+	entries, err := d.Readdir(-1)
+	d.Close()
+	if err != nil {
+		return err
+	}
+	for _, ent := range entries {
+		path := filepath.Join(dir, ent.Name())
+		if ent.IsDir() {
+			err = walkFiles(fs, path, f)
+		} else {
+			err = f(path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mkdirAll creates dir and any of its parents that do not exist.
+func mkdirAll(fs filesystem, dir string) error {
+	if parent := filepath.Dir(dir); parent != dir {
+		if err := mkdirAll(fs, parent); err != nil {
+			return err
+		}
+	}
+	if err := fs.Mkdir(dir); err != nil && !fs.IsExist(err) {
+		return err
+	}
+	return nil
+}
+
+// memFilesystem is a filesystem stored in memory.  It is safe to use from
+// multiple goroutines.
+type memFilesystem struct {
+	mu    sync.Mutex
+	files map[string]memFileData
+	dirs  map[string]time.Time
+	ntemp int
+}
+
+type memFileData struct {
+	data    []byte
+	modTime time.Time
+}
+
+func newMemFilesystem() *memFilesystem {
+	return &memFilesystem{
+		files: make(map[string]memFileData),
+		dirs:  make(map[string]time.Time),
+	}
+}
+
+// checkParent returns an error if the directory containing path does not
+// exist.  The caller must hold fs.mu.
+func (fs *memFilesystem) checkParent(op, path string) error {
+	dir := filepath.Dir(path)
+	if dir == path {
+		return nil
+	}
+	if _, ok := fs.dirs[dir]; !ok {
+		return &os.PathError{Op: op, Path: path, Err: os.ErrNotExist}
+	}
+	return nil
+}
+
+func (fs *memFilesystem) Open(path string) (file, error) {
+	path = filepath.Clean(path)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if f, ok := fs.files[path]; ok {
+		return &memFile{name: path, r: bytes.NewReader(f.data), modTime: f.modTime}, nil
+	}
+	modTime, ok := fs.dirs[path]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+	var entries []os.FileInfo
+	for name, f := range fs.files {
+		if filepath.Dir(name) == path {
+			entries = append(entries, memFileInfo{name: filepath.Base(name), size: int64(len(f.data)), modTime: f.modTime})
+		}
+	}
+	for name, t := range fs.dirs {
+		if name != path && filepath.Dir(name) == path {
+			entries = append(entries, memFileInfo{name: filepath.Base(name), modTime: t, isDir: true})
+		}
+	}
+	sort.Sort(byFileName(entries))
+	if entries == nil {
+		entries = []os.FileInfo{}
+	}
+	return &memFile{name: path, modTime: modTime, dir: entries}, nil
+}
+
+func (fs *memFilesystem) Create(path string, excl bool) (file, error) {
+	path = filepath.Clean(path)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.create(path, excl); err != nil {
+		return nil, err
+	}
+	return fs.newWriter(path), nil
+}
+
+// create checks whether path can be created and, if so, creates it as an
+// empty file.  The caller must hold fs.mu.
+func (fs *memFilesystem) create(path string, excl bool) error {
+	if err := fs.checkParent("open", path); err != nil {
+		return err
+	}
+	if _, ok := fs.dirs[path]; ok {
+		return &os.PathError{Op: "open", Path: path, Err: os.ErrExist}
+	}
+	if _, ok := fs.files[path]; ok && excl {
+		return &os.PathError{Op: "open", Path: path, Err: os.ErrExist}
+	}
+	fs.files[path] = memFileData{modTime: time.Now()}
+	return nil
+}
+
+func (fs *memFilesystem) newWriter(path string) *memFile {
+	return &memFile{
+		name: path,
+		onClose: func(data []byte) {
+			fs.mu.Lock()
+			fs.files[path] = memFileData{data: append([]byte(nil), data...), modTime: time.Now()}
+			fs.mu.Unlock()
+		},
+	}
+}
+
+func (fs *memFilesystem) Remove(path string) error {
+	path = filepath.Clean(path)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, ok := fs.files[path]; ok {
+		delete(fs.files, path)
+		return nil
+	}
+	if _, ok := fs.dirs[path]; !ok {
+		return &os.PathError{Op: "remove", Path: path, Err: os.ErrNotExist}
+	}
+	for name := range fs.files {
+		if filepath.Dir(name) == path {
+			return &os.PathError{Op: "remove", Path: path, Err: os.ErrExist}
+		}
+	}
+	for name := range fs.dirs {
+		if name != path && filepath.Dir(name) == path {
+			return &os.PathError{Op: "remove", Path: path, Err: os.ErrExist}
+		}
+	}
+	delete(fs.dirs, path)
+	return nil
+}
+
+func (fs *memFilesystem) Mkdir(path string) error {
+	path = filepath.Clean(path)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.checkParent("mkdir", path); err != nil {
+		return err
+	}
+	_, isFile := fs.files[path]
+	_, isDir := fs.dirs[path]
+	if isFile || isDir {
+		return &os.PathError{Op: "mkdir", Path: path, Err: os.ErrExist}
+	}
+	fs.dirs[path] = time.Now()
+	return nil
+}
+
+func (fs *memFilesystem) Rename(oldpath, newpath string) error {
+	oldpath, newpath = filepath.Clean(oldpath), filepath.Clean(newpath)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f, ok := fs.files[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	if err := fs.checkParent("rename", newpath); err != nil {
+		return err
+	}
+	if _, ok := fs.dirs[newpath]; ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrExist}
+	}
+	delete(fs.files, oldpath)
+	f.modTime = time.Now()
+	fs.files[newpath] = f
+	return nil
+}
+
+func (fs *memFilesystem) TempFile(dir, prefix string) (file, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for {
+		fs.ntemp++
+		path := filepath.Join(dir, prefix+strconv.Itoa(fs.ntemp))
+		if _, ok := fs.files[path]; ok {
+			continue
+		}
+		if err := fs.create(path, true); err != nil {
+			return nil, err
+		}
+		return fs.newWriter(path), nil
+	}
+}
+
+func (fs *memFilesystem) IsExist(e error) bool    { return os.IsExist(e) }
+func (fs *memFilesystem) IsNotExist(e error) bool { return os.IsNotExist(e) }
+
+type byFileName []os.FileInfo
+
+func (a byFileName) Len() int           { return len(a) }
+func (a byFileName) Less(i, j int) bool { return a[i].Name() < a[j].Name() }
+func (a byFileName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
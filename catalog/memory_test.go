@@ -0,0 +1,264 @@
+package catalog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// newMemoryWithProjects returns an in-memory catalog holding projects.
+func newMemoryWithProjects(t *testing.T, projects ...*Project) *Memory {
+	m := NewMemory()
+	for _, proj := range projects {
+		if err := m.PutProject(proj); err != nil {
+			t.Fatal("PutProject error:", err)
+		}
+	}
+	return m
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	id := ID{0x6f, 0x5d, 0x5d, 0xcc, 0x6b, 0x38, 0x49, 0x08, 0x9d}
+	if err := m.PutProject(&Project{ID: id, ShortName: "bad name"}); err == nil {
+		t.Error("put with bad short name succeeded")
+	}
+	if err := m.PutProject(&Project{ID: id, ShortName: "blackforest", Name: "Black Forest"}); err != nil {
+		t.Fatal("put error:", err)
+	}
+	if err := m.PutProject(&Project{ID: ID{1}, ShortName: "blackforest", Name: "Impostor"}); err == nil {
+		t.Error("put of second project with same short name succeeded")
+	}
+	if err := m.PutProject(&Project{ID: id, ShortName: "bf", Name: "Black Forest"}); err != nil {
+		t.Fatal("rename error:", err)
+	}
+
+	if list, err := m.List(); err != nil {
+		t.Error("list error:", err)
+	} else if len(list) != 1 || list[0] != "bf" {
+		t.Errorf("m.List() = %v; want [bf]", list)
+	}
+	if sn, err := m.ShortName(id); err != nil || sn != "bf" {
+		t.Errorf("m.ShortName(%v) = %q, %v; want %q, <nil>", id, sn, err, "bf")
+	}
+	if p, err := m.GetProjectByID(id); err != nil || p.ShortName != "bf" {
+		t.Errorf("m.GetProjectByID(%v) = %v, %v; want bf", id, p, err)
+	}
+	if _, err := m.GetProject("blackforest"); !isRenamed(err) {
+		t.Errorf("m.GetProject(%q) error = %v; want *RenamedError", "blackforest", err)
+	}
+	if err := m.DelProject("bf"); err != nil {
+		t.Error("delete error:", err)
+	}
+	if _, err := m.GetProject("bf"); err == nil {
+		t.Errorf("m.GetProject(%q) after delete succeeded", "bf")
+	}
+}
+
+func TestMemory_Concurrent(t *testing.T) {
+	m := NewMemory()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := ID{byte(i)}
+			sn := "p" + id.String()[:2]
+			if err := m.PutProject(&Project{ID: id, ShortName: sn}); err != nil {
+				t.Errorf("put %s error: %v", sn, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if list, _ := m.List(); len(list) != 20 {
+		t.Errorf("len(m.List()) = %d; want 20", len(list))
+	}
+}
+
+func TestMemorySnapshot(t *testing.T) {
+	m := NewMemory()
+	id := ID{0x6f, 0x5d, 0x5d, 0xcc, 0x6b, 0x38, 0x49, 0x08, 0x9d}
+	if err := m.PutProject(&Project{ID: id, ShortName: "blackforest", Name: "Black Forest", Tags: TagSet{"go"}}); err != nil {
+		t.Fatal("put error:", err)
+	}
+	if err := m.PutProject(&Project{ID: id, ShortName: "bf", Name: "Black Forest", Tags: TagSet{"go"}}); err != nil {
+		t.Fatal("put error:", err)
+	}
+
+	var buf bytes.Buffer
+	if err := m.WriteSnapshot(&buf); err != nil {
+		t.Fatal("WriteSnapshot error:", err)
+	}
+	m2, err := LoadMemory(&buf)
+	if err != nil {
+		t.Fatal("LoadMemory error:", err)
+	}
+	p, err := m2.GetProject("bf")
+	if want := (&Project{ID: id, ShortName: "bf", Name: "Black Forest", Tags: TagSet{"go"}}); err != nil || !projectEqual(p, want) {
+		t.Errorf("loaded GetProject(%q) = %v, %v; want %v", "bf", p, err, want)
+	}
+	if _, err := m2.GetProject("blackforest"); !isRenamed(err) {
+		t.Errorf("loaded GetProject(%q) error = %v; want *RenamedError", "blackforest", err)
+	}
+}
+
+func TestMemorySnapshot_Everything(t *testing.T) {
+	m := NewMemory()
+	schema := &Schema{[]FieldDef{{Name: "owner", Type: TextField, Required: true}}}
+	if err := m.PutSchema(schema); err != nil {
+		t.Fatal("PutSchema error:", err)
+	}
+	hosts := &HostRegistry{[]Host{{Name: "laptop"}}}
+	if err := m.PutHosts(hosts); err != nil {
+		t.Fatal("PutHosts error:", err)
+	}
+	foo := &Project{ID: ID{1}, ShortName: "foo", Fields: map[string]string{"owner": "alice"}, PerHost: map[string]*HostInfo{"laptop": {Path: "/src/foo"}}}
+	if err := m.PutProject(foo); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	if err := m.PutProject(&Project{ID: ID{2}, ShortName: "bar", Fields: map[string]string{"owner": "bob"}}); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	if err := m.PutAttachment(ID{1}, "notes.txt", []byte("hello")); err != nil {
+		t.Fatal("PutAttachment error:", err)
+	}
+	if err := m.PutAttachment(ID{2}, "logo.png", []byte{0x89, 'P', 'N', 'G', 0}); err != nil {
+		t.Fatal("PutAttachment error:", err)
+	}
+	if err := m.DelProject("bar"); err != nil {
+		t.Fatal("DelProject error:", err)
+	}
+
+	var buf bytes.Buffer
+	if err := m.WriteSnapshot(&buf); err != nil {
+		t.Fatal("WriteSnapshot error:", err)
+	}
+	m2, err := LoadMemory(&buf)
+	if err != nil {
+		t.Fatal("LoadMemory error:", err)
+	}
+	if s, err := m2.Schema(); err != nil || !reflect.DeepEqual(s, schema) {
+		t.Errorf("loaded Schema() = %+v, %v; want %+v, <nil>", s, err, schema)
+	}
+	if r, err := m2.Hosts(); err != nil || !reflect.DeepEqual(r, hosts) {
+		t.Errorf("loaded Hosts() = %+v, %v; want %+v, <nil>", r, err, hosts)
+	}
+	if p, err := m2.GetProject("foo"); err != nil || !projectEqual(p, foo) {
+		t.Errorf("loaded GetProject(%q) = %+v, %v; want %+v", "foo", p, err, foo)
+	}
+	if data, err := m2.ReadAttachment(ID{1}, "notes.txt"); err != nil || string(data) != "hello" {
+		t.Errorf("loaded ReadAttachment(%v, %q) = %q, %v; want %q, <nil>", ID{1}, "notes.txt", data, err, "hello")
+	}
+	if data, err := m2.ReadAttachment(ID{2}, "logo.png"); err != nil || !bytes.Equal(data, []byte{0x89, 'P', 'N', 'G', 0}) {
+		t.Errorf("loaded ReadAttachment(%v, %q) = %q, %v", ID{2}, "logo.png", data, err)
+	}
+	trash, err := m2.Trash()
+	if err != nil {
+		t.Fatal("loaded Trash error:", err)
+	}
+	if len(trash) != 1 || trash[0].Project.ShortName != "bar" {
+		t.Errorf("loaded Trash() = %+v; want [bar]", trash)
+	}
+
+	// The loaded catalog still enforces the schema and host registry.
+	if err := m2.PutProject(&Project{ID: ID{3}, ShortName: "baz"}); err == nil {
+		t.Error("loaded PutProject without required field succeeded")
+	}
+	if err := m2.PutProject(&Project{ID: ID{3}, ShortName: "baz", Fields: map[string]string{"owner": "carol"}, PerHost: map[string]*HostInfo{"lpatop": {}}}); err == nil {
+		t.Error("loaded PutProject with unregistered host succeeded")
+	}
+	if problems, err := Verify(m2); err != nil || len(problems) != 0 {
+		t.Errorf("Verify(loaded) = %v, %v; want [], <nil>", problems, err)
+	}
+}
+
+func TestLoadMemory_BadPath(t *testing.T) {
+	for _, path := range []string{"../evil.json", "/etc/passwd", "catalog.lock", "version.json", "projects/../../x"} {
+		snap := `{"version": 3, "files": {"` + path + `": ""}}`
+		if _, err := LoadMemory(bytes.NewBufferString(snap)); err == nil {
+			t.Errorf("LoadMemory with file %q succeeded", path)
+		}
+	}
+}
+
+func TestLoadMemory_OldVersion(t *testing.T) {
+	const snap = `{
+		"version": 2,
+		"catalog": {"id_to_shortname": {"b11dzGs4SQid": "blackforest"}},
+		"projects": {"blackforest": {"id": "b11dzGs4SQid", "shortname": "blackforest", "vcs": {"type": "git", "url": "https://example.com/bf.git"}}}
+	}`
+	m, err := LoadMemory(bytes.NewBufferString(snap))
+	if err != nil {
+		t.Fatal("LoadMemory error:", err)
+	}
+	if v, err := readVersion(m.fs, m.root); err != nil || v != Version {
+		t.Errorf("loaded version = %d, %v; want %d, <nil>", v, err, Version)
+	}
+	p, err := m.GetProject("blackforest")
+	if err != nil {
+		t.Fatal("GetProject error:", err)
+	}
+	want := []Remote{{Name: DefaultRemoteName, Role: RolePrimary, Type: "git", URL: "https://example.com/bf.git"}}
+	if !reflect.DeepEqual(p.Remotes, want) {
+		t.Errorf("p.Remotes = %+v; want %+v", p.Remotes, want)
+	}
+}
+
+func TestLoadMemory_BadVersion(t *testing.T) {
+	_, err := LoadMemory(bytes.NewBufferString(`{"version": 9999, "catalog": {}, "projects": {}}`))
+	if err != VersionError(9999) {
+		t.Errorf("LoadMemory error = %v; want %v", err, VersionError(9999))
+	}
+}
+
+func TestMemFilesystem(t *testing.T) {
+	fs := newMemFilesystem()
+	if err := fs.Mkdir(memoryRoot); err != nil {
+		t.Fatal("mkdir root error:", err)
+	}
+	if err := fs.Mkdir("a"); err != nil {
+		t.Fatal("mkdir error:", err)
+	}
+	if err := fs.Mkdir(filepath.Join("b", "c")); !os.IsNotExist(err) {
+		t.Errorf("mkdir without parent error = %v; want not exist", err)
+	}
+	path := filepath.Join("a", "f")
+	if err := writeFile(fs, path, []byte("hello"), true); err != nil {
+		t.Fatal("writeFile error:", err)
+	}
+	if err := writeFile(fs, path, []byte("again"), true); !os.IsExist(err) {
+		t.Errorf("exclusive writeFile error = %v; want exists", err)
+	}
+	if data, err := readFile(fs, path); err != nil || string(data) != "hello" {
+		t.Errorf("readFile(%q) = %q, %v; want %q", path, data, err, "hello")
+	}
+
+	dir, err := fs.Open("a")
+	if err != nil {
+		t.Fatal("open dir error:", err)
+	}
+	infos, err := dir.Readdir(-1)
+	dir.Close()
+	var names []string
+	for _, fi := range infos {
+		names = append(names, fi.Name())
+	}
+	sort.Strings(names)
+	if err != nil || len(names) != 1 || names[0] != "f" {
+		t.Errorf("Readdir = %v, %v; want [f]", names, err)
+	}
+
+	if err := fs.Remove("a"); err == nil {
+		t.Error("removing non-empty directory succeeded")
+	}
+	if err := fs.Remove(path); err != nil {
+		t.Error("remove error:", err)
+	}
+	if err := fs.Remove("a"); err != nil {
+		t.Error("remove dir error:", err)
+	}
+}
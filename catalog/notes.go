@@ -0,0 +1,41 @@
+package catalog
+
+import (
+	"errors"
+	"time"
+)
+
+// A Note is a dated entry in a project's journal.
+type Note struct {
+	Time time.Time `json:"time"`
+
+	// Host is the host that the note was written on, if known.
+	Host string `json:"host,omitempty"`
+
+	Text string `json:"text"`
+}
+
+// AddNote appends a note to the project's journal.  Notes cannot be changed
+// or removed once they are stored.
+func (proj *Project) AddNote(t time.Time, host, text string) {
+	proj.Notes = append(proj.Notes, Note{Time: t, Host: host, Text: text})
+}
+
+// errNotesChanged is returned when putting a project whose stored notes were
+// changed or removed.
+var errNotesChanged = errors.New("notes can only be added, not changed or removed")
+
+// checkNotes returns errNotesChanged if notes does not start with every note
+// in old.
+func checkNotes(notes, old []Note) error {
+	if len(notes) < len(old) {
+		return errNotesChanged
+	}
+	for i := range old {
+		n, o := &notes[i], &old[i]
+		if !n.Time.Equal(o.Time) || n.Host != o.Host || n.Text != o.Text {
+			return errNotesChanged
+		}
+	}
+	return nil
+}
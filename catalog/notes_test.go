@@ -0,0 +1,69 @@
+package catalog
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckNotes(t *testing.T) {
+	t1 := time.Date(2014, time.March, 1, 12, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	a := Note{Time: t1, Host: "laptop", Text: "started"}
+	b := Note{Time: t2, Text: "blocked on upstream"}
+	tests := []struct {
+		notes, old []Note
+		err        error
+	}{
+		{nil, nil, nil},
+		{[]Note{a}, nil, nil},
+		{[]Note{a, b}, []Note{a}, nil},
+		{[]Note{a}, []Note{a}, nil},
+		{[]Note{{Time: t1.In(time.FixedZone("EST", -5*60*60)), Host: "laptop", Text: "started"}}, []Note{a}, nil},
+		{nil, []Note{a}, errNotesChanged},
+		{[]Note{b}, []Note{a}, errNotesChanged},
+		{[]Note{b, a}, []Note{a, b}, errNotesChanged},
+		{[]Note{{Time: t1, Host: "laptop", Text: "Started"}}, []Note{a}, errNotesChanged},
+	}
+	for _, test := range tests {
+		if err := checkNotes(test.notes, test.old); err != test.err {
+			t.Errorf("checkNotes(%v, %v) = %v; want %v", test.notes, test.old, err, test.err)
+		}
+	}
+}
+
+func TestPutProject_Notes(t *testing.T) {
+	m := NewMemory()
+	proj := &Project{ID: ID{1}, ShortName: "foo"}
+	proj.AddNote(time.Date(2014, time.March, 1, 12, 0, 0, 0, time.UTC), "laptop", "started")
+	if err := m.PutProject(proj); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+
+	proj.AddNote(time.Date(2014, time.March, 2, 12, 0, 0, 0, time.UTC), "", "blocked on upstream")
+	if err := m.PutProject(proj); err != nil {
+		t.Fatal("PutProject with new note error:", err)
+	}
+	if got, err := m.GetProject("foo"); err != nil {
+		t.Fatal("GetProject error:", err)
+	} else if len(got.Notes) != 2 || got.Notes[1].Text != "blocked on upstream" {
+		t.Errorf("GetProject(foo).Notes = %v; want 2 notes", got.Notes)
+	}
+
+	edited := proj.clone()
+	edited.Notes[0].Text = "started over"
+	if err := m.PutProject(edited); !errors.Is(err, errNotesChanged) {
+		t.Errorf("PutProject with changed note = %v; want %v", err, errNotesChanged)
+	}
+	removed := proj.clone()
+	removed.Notes = removed.Notes[1:]
+	if err := m.PutProject(removed); !errors.Is(err, errNotesChanged) {
+		t.Errorf("PutProject with removed note = %v; want %v", err, errNotesChanged)
+	}
+	renamed := proj.clone()
+	renamed.ShortName = "bar"
+	renamed.Notes = nil
+	if err := m.PutProject(renamed); !errors.Is(err, errNotesChanged) {
+		t.Errorf("PutProject with renamed project and no notes = %v; want %v", err, errNotesChanged)
+	}
+}
@@ -0,0 +1,61 @@
+//go:build linux
+// +build linux
+
+package catalog
+
+import (
+	"os"
+	"syscall"
+)
+
+// inotifyNotifier is a notifier that uses Linux's inotify.
+type inotifyNotifier struct {
+	f *os.File
+	c chan struct{}
+}
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY |
+	syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// newSystemNotifier returns a notifier for changes to entries in dirs.
+func newSystemNotifier(dirs []string) (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	for _, dir := range dirs {
+		if _, err := syscall.InotifyAddWatch(fd, dir, inotifyMask); err != nil {
+			syscall.Close(fd)
+			return nil, &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+		}
+	}
+	// The descriptor is non-blocking, so the runtime poller will wake up
+	// the read loop when the file is closed.
+	n := &inotifyNotifier{
+		f: os.NewFile(uintptr(fd), "inotify"),
+		c: make(chan struct{}, 1),
+	}
+	go n.read()
+	return n, nil
+}
+
+func (n *inotifyNotifier) read() {
+	defer close(n.c)
+	buf := make([]byte, 4096)
+	for {
+		// The events themselves are not needed: any change causes the
+		// catalog to be compared against its last known state.
+		if _, err := n.f.Read(buf); err != nil {
+			return
+		}
+		signal(n.c)
+	}
+}
+
+func (n *inotifyNotifier) C() <-chan struct{} {
+	return n.c
+}
+
+func (n *inotifyNotifier) Close() error {
+	return n.f.Close()
+}
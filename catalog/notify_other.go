@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package catalog
+
+import (
+	"errors"
+)
+
+// newSystemNotifier always fails, since there is no notification mechanism
+// for this operating system.  Watches fall back to polling.
+func newSystemNotifier(dirs []string) (notifier, error) {
+	return nil, errors.New("catalog: change notifications not supported")
+}
@@ -0,0 +1,114 @@
+package catalog
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Portable path variables.  A project path that starts with a variable,
+// followed by the end of the path or a slash, is stored relative to the
+// directory that the variable names on each host.  The rest of a portable
+// path always uses slashes as separators.
+const (
+	HomeVar = "~"     // the user's home directory
+	RootVar = "$root" // the host's checkout root (see Host.CheckoutRoot)
+)
+
+// A PathEnv holds the directories that portable paths are relative to on a
+// host.
+type PathEnv struct {
+	Home string
+	Root string
+}
+
+// IsPortablePath reports whether path starts with a path variable.
+func IsPortablePath(path string) bool {
+	v, _ := splitPathVar(path)
+	return v != ""
+}
+
+// splitPathVar splits a portable path into its variable and the rest of the
+// path.  If path is not portable, v is empty.
+func splitPathVar(path string) (v, rest string) {
+	for _, v := range []string{HomeVar, RootVar} {
+		if path == v {
+			return v, ""
+		}
+		if strings.HasPrefix(path, v+"/") {
+			return v, path[len(v)+1:]
+		}
+	}
+	return "", path
+}
+
+// Expand returns path with its variable replaced.  Paths that are not
+// portable are returned unchanged.
+func (env *PathEnv) Expand(path string) (string, error) {
+	v, rest := splitPathVar(path)
+	var dir string
+	switch v {
+	case "":
+		return path, nil
+	case HomeVar:
+		dir = env.Home
+	case RootVar:
+		dir = env.Root
+	}
+	if dir == "" {
+		return "", PathVarError(v)
+	}
+	return filepath.Join(dir, filepath.FromSlash(rest)), nil
+}
+
+// Portable returns the portable form of an absolute path.  Paths inside the
+// checkout root are made relative to it, then paths inside the home
+// directory.  Other paths are returned unchanged.
+func (env *PathEnv) Portable(path string) string {
+	path = filepath.Clean(path)
+	for _, d := range []struct{ v, dir string }{{RootVar, env.Root}, {HomeVar, env.Home}} {
+		if rest, ok := trimPathPrefix(path, d.dir); ok {
+			if rest == "" {
+				return d.v
+			}
+			return d.v + "/" + filepath.ToSlash(rest)
+		}
+	}
+	return path
+}
+
+// trimPathPrefix returns path relative to dir, if path is dir or inside it.
+func trimPathPrefix(path, dir string) (string, bool) {
+	if dir == "" {
+		return "", false
+	}
+	dir = filepath.Clean(dir)
+	if path == dir {
+		return "", true
+	}
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	if strings.HasPrefix(path, dir) {
+		return path[len(dir):], true
+	}
+	return "", false
+}
+
+// RelocatePath replaces oldPrefix at the start of path with newPrefix,
+// reporting whether path is oldPrefix or inside it.  All three paths must be
+// clean.
+func RelocatePath(path, oldPrefix, newPrefix string) (string, bool) {
+	rest, ok := trimPathPrefix(path, oldPrefix)
+	if !ok {
+		return path, false
+	}
+	return filepath.Join(newPrefix, rest), true
+}
+
+// A PathVarError is returned when expanding a portable path whose variable
+// has no value on the host.
+type PathVarError string
+
+func (e PathVarError) Error() string {
+	return "path uses " + string(e) + ", which is not set for this host"
+}
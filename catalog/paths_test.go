@@ -0,0 +1,98 @@
+package catalog
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPathEnvExpand(t *testing.T) {
+	env := &PathEnv{Home: filepath.FromSlash("/home/alice"), Root: filepath.FromSlash("/work")}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/usr/src/foo", "/usr/src/foo"},
+		{"~", "/home/alice"},
+		{"~/src/foo", "/home/alice/src/foo"},
+		{"$root/foo", "/work/foo"},
+		{"$root", "/work"},
+		{"~alice/foo", "~alice/foo"},
+		{"$rootfoo", "$rootfoo"},
+	}
+	for _, test := range tests {
+		want := test.want
+		if IsPortablePath(test.path) {
+			want = filepath.FromSlash(want)
+		}
+		if got, err := env.Expand(test.path); err != nil || got != want {
+			t.Errorf("Expand(%q) = %q, %v; want %q, <nil>", test.path, got, err, want)
+		}
+	}
+
+	if _, err := new(PathEnv).Expand("$root/foo"); err != PathVarError(RootVar) {
+		t.Errorf("Expand with no root = %v; want %v", err, PathVarError(RootVar))
+	}
+}
+
+func TestPathEnvPortable(t *testing.T) {
+	env := &PathEnv{Home: filepath.FromSlash("/home/alice"), Root: filepath.FromSlash("/home/alice/src")}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/home/alice/src/foo/bar", "$root/foo/bar"},
+		{"/home/alice/src", "$root"},
+		{"/home/alice/notes", "~/notes"},
+		{"/home/alice", "~"},
+		{"/home/alicesrc", "/home/alicesrc"},
+		{"/opt/foo", "/opt/foo"},
+	}
+	for _, test := range tests {
+		path := filepath.FromSlash(test.path)
+		want := test.want
+		if !IsPortablePath(want) {
+			want = filepath.FromSlash(want)
+		}
+		if got := env.Portable(path); got != want {
+			t.Errorf("Portable(%q) = %q; want %q", path, got, want)
+		}
+		if got, err := env.Expand(env.Portable(path)); err != nil || got != path {
+			t.Errorf("Expand(Portable(%q)) = %q, %v; want %q, <nil>", path, got, err, path)
+		}
+	}
+}
+
+func TestRelocatePath(t *testing.T) {
+	tests := []struct {
+		path, oldPrefix, newPrefix string
+		want                       string
+		ok                         bool
+	}{
+		{"/home/alice/src/foo", "/home/alice/src", "/work", "/work/foo", true},
+		{"/home/alice/src", "/home/alice/src", "/work", "/work", true},
+		{"/home/alice/srcfoo", "/home/alice/src", "/work", "/home/alice/srcfoo", false},
+		{"/opt/foo", "/home/alice/src", "/work", "/opt/foo", false},
+	}
+	for _, test := range tests {
+		path := filepath.FromSlash(test.path)
+		oldPrefix, newPrefix := filepath.FromSlash(test.oldPrefix), filepath.FromSlash(test.newPrefix)
+		want := filepath.FromSlash(test.want)
+		if got, ok := RelocatePath(path, oldPrefix, newPrefix); got != want || ok != test.ok {
+			t.Errorf("RelocatePath(%q, %q, %q) = %q, %t; want %q, %t", path, oldPrefix, newPrefix, got, ok, want, test.ok)
+		}
+	}
+}
+
+func TestProjectExpandPath(t *testing.T) {
+	proj := &Project{PerHost: map[string]*HostInfo{"laptop": {Path: "$root/foo"}}}
+	env := &PathEnv{Home: "/home/alice", Root: "/home/alice/src"}
+	if p := proj.Path("laptop"); p != "$root/foo" {
+		t.Errorf("Path(laptop) = %q; want %q", p, "$root/foo")
+	}
+	if p, err := proj.ExpandPath("laptop", env); err != nil || p != "/home/alice/src/foo" {
+		t.Errorf("ExpandPath(laptop) = %q, %v; want %q", p, err, "/home/alice/src/foo")
+	}
+	if p, err := proj.ExpandPath("desktop", env); err != nil || p != "" {
+		t.Errorf("ExpandPath(desktop) = %q, %v; want empty", p, err)
+	}
+}
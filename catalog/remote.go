@@ -0,0 +1,140 @@
+package catalog
+
+import (
+	"errors"
+	"strings"
+)
+
+// A RemoteRole describes what a project's remote is used for.
+type RemoteRole string
+
+// Remote roles
+const (
+	// RolePrimary is the repository where development happens.  A project
+	// has at most one primary remote.
+	RolePrimary RemoteRole = "primary"
+
+	// RoleMirror is a copy of the primary repository.
+	RoleMirror RemoteRole = "mirror"
+
+	// RoleHistorical is a repository that is no longer updated, like the
+	// Subversion repository that a project was converted from.
+	RoleHistorical RemoteRole = "historical"
+)
+
+// RemoteRoles returns every valid remote role.
+func RemoteRoles() []RemoteRole {
+	return []RemoteRole{RolePrimary, RoleMirror, RoleHistorical}
+}
+
+// ParseRemoteRole returns the remote role named by s.
+func ParseRemoteRole(s string) (RemoteRole, error) {
+	for _, r := range RemoteRoles() {
+		if string(r) == s {
+			return r, nil
+		}
+	}
+	return "", RemoteRoleError(s)
+}
+
+// A RemoteRoleError is returned when parsing an unknown remote role.
+type RemoteRoleError string
+
+func (e RemoteRoleError) Error() string {
+	names := make([]string, 0, 3)
+	for _, r := range RemoteRoles() {
+		names = append(names, string(r))
+	}
+	return string(e) + " is not a valid remote role\nvalid choices are: " + strings.Join(names, ", ")
+}
+
+// DefaultRemoteName is the name of a primary remote that was not given one,
+// such as a remote converted from a version 2 catalog.
+const DefaultRemoteName = "origin"
+
+// A Remote is a version control repository that holds a project's source.
+type Remote struct {
+	Name string     `json:"name"`
+	Role RemoteRole `json:"role"`
+	Type string     `json:"type"`
+	URL  string     `json:"url,omitempty"`
+}
+
+// Remote returns the project's remote with the given name or nil if the
+// project does not have one.
+func (proj *Project) Remote(name string) *Remote {
+	for i := range proj.Remotes {
+		if proj.Remotes[i].Name == name {
+			return &proj.Remotes[i]
+		}
+	}
+	return nil
+}
+
+// PrimaryRemote returns the project's primary remote or nil if the project
+// does not have one.
+func (proj *Project) PrimaryRemote() *Remote {
+	for i := range proj.Remotes {
+		if proj.Remotes[i].Role == RolePrimary {
+			return &proj.Remotes[i]
+		}
+	}
+	return nil
+}
+
+// RemoveRemote removes the named remote from the project, reporting
+// whether the project had it.
+func (proj *Project) RemoveRemote(name string) bool {
+	for i := range proj.Remotes {
+		if proj.Remotes[i].Name == name {
+			proj.Remotes = append(proj.Remotes[:i], proj.Remotes[i+1:]...)
+			if len(proj.Remotes) == 0 {
+				proj.Remotes = nil
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// checkRemotes returns a *RemoteError for the first of the remotes that is
+// malformed.
+func checkRemotes(remotes []Remote) error {
+	seen := make(map[string]bool, len(remotes))
+	hasPrimary := false
+	for _, r := range remotes {
+		switch {
+		case !isValidShortName(r.Name):
+			return &RemoteError{Name: r.Name, Err: errors.New("invalid remote name")}
+		case seen[r.Name]:
+			return &RemoteError{Name: r.Name, Err: errors.New("defined more than once")}
+		case r.Type == "":
+			return &RemoteError{Name: r.Name, Err: errors.New("missing VCS type")}
+		}
+		if _, err := ParseRemoteRole(string(r.Role)); err != nil {
+			return &RemoteError{Name: r.Name, Err: err}
+		}
+		if r.Role == RolePrimary {
+			if hasPrimary {
+				return &RemoteError{Name: r.Name, Err: errors.New("project already has a primary remote")}
+			}
+			hasPrimary = true
+		}
+		seen[r.Name] = true
+	}
+	return nil
+}
+
+// A RemoteError is returned when a project's remote is invalid.
+type RemoteError struct {
+	Name string
+	Err  error
+}
+
+func (e *RemoteError) Error() string {
+	return "remote " + e.Name + ": " + e.Err.Error()
+}
+
+func (e *RemoteError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,75 @@
+package catalog
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRemoteRole(t *testing.T) {
+	for _, r := range RemoteRoles() {
+		if got, err := ParseRemoteRole(string(r)); err != nil || got != r {
+			t.Errorf("ParseRemoteRole(%q) = %q, %v; want %q, <nil>", r, got, err, r)
+		}
+	}
+	for _, s := range []string{"", "Primary", "backup"} {
+		if got, err := ParseRemoteRole(s); err != RemoteRoleError(s) {
+			t.Errorf("ParseRemoteRole(%q) = %q, %v; want error %v", s, got, err, RemoteRoleError(s))
+		}
+	}
+}
+
+func TestProjectRemotes(t *testing.T) {
+	proj := &Project{Remotes: []Remote{
+		{Name: "github", Role: RoleMirror, Type: Git, URL: "https://github.com/example/foo.git"},
+		{Name: "origin", Role: RolePrimary, Type: Git, URL: "https://example.com/foo.git"},
+		{Name: "svn", Role: RoleHistorical, Type: Subversion, URL: "https://example.com/svn/foo"},
+	}}
+	if r := proj.PrimaryRemote(); r == nil || r.Name != "origin" {
+		t.Errorf("PrimaryRemote() = %+v; want origin", r)
+	}
+	if r := proj.Remote("svn"); r == nil || r.Type != Subversion {
+		t.Errorf("Remote(%q) = %+v; want svn remote", "svn", r)
+	}
+	if r := proj.Remote("backup"); r != nil {
+		t.Errorf("Remote(%q) = %+v; want nil", "backup", r)
+	}
+	if !proj.RemoveRemote("origin") {
+		t.Error("RemoveRemote(origin) = false")
+	}
+	if proj.RemoveRemote("origin") {
+		t.Error("second RemoveRemote(origin) = true")
+	}
+	if r := proj.PrimaryRemote(); r != nil {
+		t.Errorf("PrimaryRemote() after removing origin = %+v; want nil", r)
+	}
+	if len(proj.Remotes) != 2 {
+		t.Errorf("len(proj.Remotes) = %d; want 2", len(proj.Remotes))
+	}
+}
+
+func TestCheckRemotes(t *testing.T) {
+	tests := []struct {
+		remotes []Remote
+		ok      bool
+	}{
+		{nil, true},
+		{[]Remote{{Name: "origin", Role: RolePrimary, Type: Git}, {Name: "mirror", Role: RoleMirror, Type: Git}}, true},
+		{[]Remote{{Name: "", Role: RolePrimary, Type: Git}}, false},
+		{[]Remote{{Name: "my remote", Role: RolePrimary, Type: Git}}, false},
+		{[]Remote{{Name: "origin", Role: "backup", Type: Git}}, false},
+		{[]Remote{{Name: "origin", Role: RolePrimary}}, false},
+		{[]Remote{{Name: "a", Role: RoleMirror, Type: Git}, {Name: "a", Role: RoleMirror, Type: Git}}, false},
+		{[]Remote{{Name: "a", Role: RolePrimary, Type: Git}, {Name: "b", Role: RolePrimary, Type: Git}}, false},
+	}
+	for _, test := range tests {
+		err := checkRemotes(test.remotes)
+		if test.ok && err != nil {
+			t.Errorf("checkRemotes(%+v) error: %v", test.remotes, err)
+		} else if !test.ok {
+			var rerr *RemoteError
+			if !errors.As(err, &rerr) {
+				t.Errorf("checkRemotes(%+v) = %v; want *RemoteError", test.remotes, err)
+			}
+		}
+	}
+}
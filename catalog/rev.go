@@ -0,0 +1,200 @@
+package catalog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"bitbucket.org/zombiezen/blackforest/vcs"
+)
+
+// OpenRev opens the catalog at the root of wc as it was in rev.  The catalog
+// is read-only: changes fail with ErrReadOnly.  A catalog that was in an older
+// format at rev is upgraded in memory.
+func OpenRev(wc vcs.RevReader, rev vcs.Rev) (Catalog, error) {
+	return openRev(wc, rev, nil)
+}
+
+// openRev is OpenRev with a filter on the files in rev.  If keep is not nil,
+// then only files (relative to the working copy root) for which keep returns
+// true are in the catalog.
+func openRev(wc vcs.RevReader, rev vcs.Rev, keep func(path string) bool) (*localCatalog, error) {
+	rfs, err := newRevFilesystem(wc, rev, keep)
+	if err != nil {
+		return nil, err
+	}
+	root := wc.Path()
+	var fs filesystem = rfs
+	v, err := readVersion(fs, root)
+	if err != nil {
+		return nil, err
+	}
+	if v > Version {
+		return nil, VersionError(v)
+	}
+	if v < Version {
+		ofs := newOverlayFilesystem(fs)
+		if _, err := upgrade(&localCatalog{root: root, fs: ofs}, migrations, false); err != nil {
+			return nil, err
+		}
+		fs = ofs
+	}
+	return &localCatalog{root: root, fs: fs, readOnly: true}, nil
+}
+
+// revFilesystem is a read-only filesystem that holds a working copy's files
+// as they were in a past changeset.  The list of files is read when the
+// filesystem is created, but a file's contents are only read from the VCS the
+// first time that the file is opened.
+type revFilesystem struct {
+	wc  vcs.RevReader
+	rev vcs.Rev
+
+	mu    sync.Mutex
+	files map[string]bool
+	data  map[string][]byte
+	dirs  map[string][]string // sorted entry names
+}
+
+func newRevFilesystem(wc vcs.RevReader, rev vcs.Rev, keep func(path string) bool) (*revFilesystem, error) {
+	paths, err := wc.Files(rev)
+	if err != nil {
+		return nil, err
+	}
+	root := wc.Path()
+	fs := &revFilesystem{
+		wc:    wc,
+		rev:   rev,
+		files: make(map[string]bool, len(paths)),
+		data:  make(map[string][]byte),
+		dirs:  map[string][]string{root: {}},
+	}
+	for _, p := range paths {
+		path := filepath.Join(root, p)
+		if keep != nil && !keep(p) {
+			// Leave the file out, but not its directory.
+			path = filepath.Dir(path)
+			if _, seen := fs.dirs[path]; seen {
+				continue
+			}
+			fs.dirs[path] = []string{}
+		} else {
+			fs.files[path] = true
+		}
+		// Add the path to its directory, and each new directory to its
+		// parent, until reaching a directory that has already been seen.
+		for {
+			dir := filepath.Dir(path)
+			_, seen := fs.dirs[dir]
+			fs.dirs[dir] = append(fs.dirs[dir], filepath.Base(path))
+			if seen || dir == path {
+				break
+			}
+			path = dir
+		}
+	}
+	for _, names := range fs.dirs {
+		sort.Strings(names)
+	}
+	return fs, nil
+}
+
+func (fs *revFilesystem) Open(path string) (file, error) {
+	path = filepath.Clean(path)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if names, ok := fs.dirs[path]; ok {
+		entries := make([]os.FileInfo, len(names))
+		for i, name := range names {
+			p := filepath.Join(path, name)
+			_, isDir := fs.dirs[p]
+			entries[i] = revFileInfo{fs: fs, path: p, isDir: isDir}
+		}
+		return &memFile{name: path, dir: entries}, nil
+	}
+	data, err := fs.read(path)
+	if err != nil {
+		return nil, err
+	}
+	return &memFile{name: path, r: bytes.NewReader(data)}, nil
+}
+
+// read returns the contents of the file at path, reading it from the VCS if
+// it has not been read before.  The caller must hold fs.mu.
+func (fs *revFilesystem) read(path string) ([]byte, error) {
+	if data, ok := fs.data[path]; ok {
+		return data, nil
+	}
+	if !fs.files[path] {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+	rel, err := filepath.Rel(fs.wc.Path(), path)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	data, err := fs.wc.ReadFile(fs.rev, rel)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	fs.data[path] = data
+	return data, nil
+}
+
+func (fs *revFilesystem) Create(path string, excl bool) (file, error) {
+	return nil, &os.PathError{Op: "open", Path: path, Err: ErrReadOnly}
+}
+
+func (fs *revFilesystem) Remove(path string) error {
+	return &os.PathError{Op: "remove", Path: path, Err: ErrReadOnly}
+}
+
+func (fs *revFilesystem) Mkdir(path string) error {
+	return &os.PathError{Op: "mkdir", Path: path, Err: ErrReadOnly}
+}
+
+func (fs *revFilesystem) Rename(oldpath, newpath string) error {
+	return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: ErrReadOnly}
+}
+
+func (fs *revFilesystem) TempFile(dir, prefix string) (file, error) {
+	return nil, &os.PathError{Op: "open", Path: filepath.Join(dir, prefix), Err: ErrReadOnly}
+}
+
+func (fs *revFilesystem) IsExist(e error) bool    { return os.IsExist(e) }
+func (fs *revFilesystem) IsNotExist(e error) bool { return os.IsNotExist(e) }
+
+// revFileInfo describes an entry in a revFilesystem directory.  The size of a
+// file is only found (by reading the file) when Size is called.
+type revFileInfo struct {
+	fs    *revFilesystem
+	path  string
+	isDir bool
+}
+
+func (fi revFileInfo) Name() string       { return filepath.Base(fi.path) }
+func (fi revFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi revFileInfo) IsDir() bool        { return fi.isDir }
+func (fi revFileInfo) Sys() interface{}   { return nil }
+
+func (fi revFileInfo) Size() int64 {
+	if fi.isDir {
+		return 0
+	}
+	fi.fs.mu.Lock()
+	defer fi.fs.mu.Unlock()
+	data, err := fi.fs.read(fi.path)
+	if err != nil {
+		return 0
+	}
+	return int64(len(data))
+}
+
+func (fi revFileInfo) Mode() os.FileMode {
+	if fi.isDir {
+		return os.ModeDir | 0555
+	}
+	return 0444
+}
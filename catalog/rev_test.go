@@ -0,0 +1,123 @@
+package catalog
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"bitbucket.org/zombiezen/blackforest/vcs"
+)
+
+// mockRevReader is a working copy with a fixed set of changesets, keyed by
+// revision string.
+type mockRevReader struct {
+	mockWC
+	revs map[string]map[string]string
+}
+
+type mockRev string
+
+func (r mockRev) Rev() string    { return string(r) }
+func (r mockRev) String() string { return string(r) }
+
+func (wc *mockRevReader) Files(rev vcs.Rev) ([]string, error) {
+	files, ok := wc.revs[rev.Rev()]
+	if !ok {
+		return nil, errors.New("unknown revision")
+	}
+	var paths []string
+	for p := range files {
+		paths = append(paths, filepath.FromSlash(p))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (wc *mockRevReader) ReadFile(rev vcs.Rev, path string) ([]byte, error) {
+	data, ok := wc.revs[rev.Rev()][filepath.ToSlash(path)]
+	if !ok {
+		return nil, errors.New("no such file")
+	}
+	return []byte(data), nil
+}
+
+func (wc *mockRevReader) RevAt(t time.Time) (vcs.Rev, error) {
+	return nil, errors.New("mocked")
+}
+
+func newMockRevReader() *mockRevReader {
+	return &mockRevReader{revs: map[string]map[string]string{
+		"1": {
+			"version.json":      `{"version": 2}`,
+			"catalog.json":      `{"id_to_shortname": {"b11dzGs4SQid": "foo"}}`,
+			"projects/foo.json": `{"id": "b11dzGs4SQid", "shortname": "foo", "name": "Foo", "vcs": {"type": "git", "url": "https://example.com/foo.git"}}`,
+		},
+		"2": {
+			"version.json":                          `{"version": 3}`,
+			"catalog.json":                          `{"id_to_shortname": {"b11dzGs4SQid": "bar"}, "former_names": {"foo": "b11dzGs4SQid"}}`,
+			"projects/bar.json":                     `{"id": "b11dzGs4SQid", "shortname": "bar", "name": "Bar"}`,
+			"attachments/b11dzGs4SQid/notes.txt":    "hello",
+			"attachments/b11dzGs4SQid/design.pdf":   "%PDF-1.4",
+			"trash/AQAAAAAAAAAA.json":               `{"delete_time": "2014-03-01T12:00:00Z", "project": {"id": "AQAAAAAAAAAA", "shortname": "old"}}`,
+			"projects/.hidden/should-not-list.json": `{}`,
+		},
+	}}
+}
+
+func TestOpenRev(t *testing.T) {
+	wc := newMockRevReader()
+	cat, err := OpenRev(wc, mockRev("2"))
+	if err != nil {
+		t.Fatal("OpenRev error:", err)
+	}
+	if list, err := cat.List(); err != nil {
+		t.Error("List error:", err)
+	} else if want := []string{"bar"}; !reflect.DeepEqual(list, want) {
+		t.Errorf("List() = %q; want %q", list, want)
+	}
+	id, _ := ParseID("b11dzGs4SQid")
+	if proj, err := cat.GetProjectByID(id); err != nil {
+		t.Error("GetProjectByID error:", err)
+	} else if proj.ShortName != "bar" || proj.Name != "Bar" {
+		t.Errorf("GetProjectByID(%v) = %+v; want bar", id, proj)
+	}
+	if _, err := cat.GetProject("foo"); !isRenamed(err) {
+		t.Errorf("GetProject(foo) error = %v; want renamed", err)
+	}
+	want := []Attachment{{Name: "design.pdf", Size: 8}, {Name: "notes.txt", Size: 5}}
+	if list, err := GetAttachments(cat, id); err != nil || !reflect.DeepEqual(list, want) {
+		t.Errorf("GetAttachments(%v) = %v, %v; want %v", id, list, err, want)
+	}
+	if trash, err := GetTrash(cat); err != nil || len(trash) != 1 || trash[0].Project.ShortName != "old" {
+		t.Errorf("GetTrash() = %v, %v; want old", trash, err)
+	}
+
+	if err := cat.PutProject(&Project{ID: id, ShortName: "bar"}); err != ErrReadOnly {
+		t.Errorf("PutProject error = %v; want %v", err, ErrReadOnly)
+	}
+	if err := cat.DelProject("bar"); err != ErrReadOnly {
+		t.Errorf("DelProject error = %v; want %v", err, ErrReadOnly)
+	}
+	if err := cat.(Attacher).PutAttachment(id, "new.txt", []byte("new")); err != ErrReadOnly {
+		t.Errorf("PutAttachment error = %v; want %v", err, ErrReadOnly)
+	}
+}
+
+func TestOpenRev_Upgrade(t *testing.T) {
+	wc := newMockRevReader()
+	cat, err := OpenRev(wc, mockRev("1"))
+	if err != nil {
+		t.Fatal("OpenRev error:", err)
+	}
+	proj, err := cat.GetProject("foo")
+	if err != nil {
+		t.Fatal("GetProject error:", err)
+	}
+	want := []Remote{{Name: DefaultRemoteName, Role: RolePrimary, Type: Git, URL: "https://example.com/foo.git"}}
+	if !reflect.DeepEqual(proj.Remotes, want) {
+		t.Errorf("GetProject(foo).Remotes = %+v; want %+v", proj.Remotes, want)
+	}
+}
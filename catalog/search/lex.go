@@ -4,6 +4,8 @@ import (
 	"strings"
 	"unicode"
 	"unicode/utf8"
+
+	"bitbucket.org/zombiezen/blackforest/catalog"
 )
 
 // Inspired by the text/template/parse lexer
@@ -19,6 +21,8 @@ const (
 	orItem
 	notItem
 	tagItem
+	statusItem
+	fieldItem
 	lparenItem
 	rparenItem
 )
@@ -102,8 +106,9 @@ func (l *queryLexer) nextItem() item {
 }
 
 const (
-	tagPrefix  = "tag:"
-	orOperator = "OR"
+	tagPrefix    = "tag:"
+	statusPrefix = "status:"
+	orOperator   = "OR"
 )
 
 func lexDefault(l *queryLexer) stateFn {
@@ -132,6 +137,28 @@ func lexDefault(l *queryLexer) stateFn {
 	return lexTerm
 }
 
+// fieldPrefix returns the "name:" prefix of a term that searches a custom
+// field, or the empty string if the term is not a field search.  The lexer
+// doesn't know the catalog's fields, so the searcher treats a field search
+// for a field that no project has as a plain term.
+func fieldPrefix(t string) string {
+	i := strings.IndexRune(t, ':')
+	if i == -1 || i == len(t)-1 || !catalog.IsValidFieldName(t[:i]) {
+		return ""
+	}
+	return t[:i+1]
+}
+
+// emitPrefixed emits the current term as an item of kind k for prefix,
+// followed by a termItem for the rest of the term.
+func (l *queryLexer) emitPrefixed(k itemKind, prefix string) {
+	end := l.pos
+	l.pos = l.start + len(prefix)
+	l.emit(k)
+	l.pos = end
+	l.emit(termItem)
+}
+
 func lexTerm(l *queryLexer) stateFn {
 	for {
 		r := l.next()
@@ -142,11 +169,11 @@ func lexTerm(l *queryLexer) stateFn {
 	l.backup()
 
 	if strings.HasPrefix(l.input[l.start:], tagPrefix) {
-		end := l.pos
-		l.pos = l.start + len(tagPrefix)
-		l.emit(tagItem)
-		l.pos = end
-		l.emit(termItem)
+		l.emitPrefixed(tagItem, tagPrefix)
+	} else if strings.HasPrefix(l.input[l.start:], statusPrefix) {
+		l.emitPrefixed(statusItem, statusPrefix)
+	} else if prefix := fieldPrefix(l.input[l.start:l.pos]); prefix != "" {
+		l.emitPrefixed(fieldItem, prefix)
 	} else if l.input[l.start:l.pos] == orOperator {
 		l.emit(orItem)
 	} else {
@@ -13,6 +13,10 @@ func TestLexQuery(t *testing.T) {
 		{" ", []item{{eofItem, ""}}},
 		{"hello", []item{{termItem, "hello"}, {eofItem, ""}}},
 		{"tag:hello", []item{{tagItem, "tag:"}, {termItem, "hello"}, {eofItem, ""}}},
+		{"status:archived", []item{{statusItem, "status:"}, {termItem, "archived"}, {eofItem, ""}}},
+		{"owner:alice", []item{{fieldItem, "owner:"}, {termItem, "alice"}, {eofItem, ""}}},
+		{"owner:", []item{{termItem, "owner:"}, {eofItem, ""}}},
+		{"Owner:alice", []item{{termItem, "Owner:alice"}, {eofItem, ""}}},
 		{"-hello", []item{{notItem, "-"}, {termItem, "hello"}, {eofItem, ""}}},
 		{"hello world", []item{{termItem, "hello"}, {termItem, "world"}, {eofItem, ""}}},
 		{"hello OR world", []item{{termItem, "hello"}, {orItem, "OR"}, {termItem, "world"}, {eofItem, ""}}},
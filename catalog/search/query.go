@@ -181,6 +181,19 @@ func (p *queryParser) parseAtom() queryAST {
 			return nil
 		}
 		return tagAtom(item.value)
+	case statusItem:
+		item = p.next()
+		if item.kind != termItem {
+			return nil
+		}
+		return statusAtom(item.value)
+	case fieldItem:
+		name := strings.TrimSuffix(item.value, ":")
+		item = p.next()
+		if item.kind != termItem {
+			return nil
+		}
+		return fieldAtom{name, item.value}
 	case lparenItem:
 		q := p.parseQuery()
 		if q == nil {
@@ -252,6 +265,29 @@ func (t tagAtom) GoString() string {
 	return "search.tagAtom(" + strconv.Quote(string(t)) + ")"
 }
 
+type statusAtom string
+
+func (statusAtom) isQueryAST() {}
+
+func (s statusAtom) String() string {
+	return statusPrefix + string(s)
+}
+
+func (s statusAtom) GoString() string {
+	return "search.statusAtom(" + strconv.Quote(string(s)) + ")"
+}
+
+type fieldAtom struct {
+	Name  string
+	Value string
+}
+
+func (fieldAtom) isQueryAST() {}
+
+func (f fieldAtom) String() string {
+	return f.Name + ":" + f.Value
+}
+
 type parseError struct {
 	Input string
 	Pos   int
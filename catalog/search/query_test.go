@@ -13,6 +13,9 @@ func TestParseQuery(t *testing.T) {
 		{"", nil},
 		{"hello", term("hello")},
 		{"tag:hello", tagAtom("hello")},
+		{"status:archived", statusAtom("archived")},
+		{"-status:archived", queryNot{statusAtom("archived")}},
+		{"owner:alice", fieldAtom{"owner", "alice"}},
 		{"-hello", queryNot{term("hello")}},
 		{"hello world", queryAnd{term("hello"), term("world")}},
 		{"hello OR world", queryOr{term("hello"), term("world")}},
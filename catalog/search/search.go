@@ -3,6 +3,7 @@ package search
 
 import (
 	"sort"
+	"strings"
 
 	"bitbucket.org/zombiezen/blackforest/catalog"
 )
@@ -12,6 +13,14 @@ type Searcher interface {
 	Search(query string) ([]Result, error)
 }
 
+// An Index is a Searcher whose index can be updated as its catalog changes.
+type Index interface {
+	Searcher
+
+	// Apply updates the index for a change in cat.
+	Apply(cat catalog.Catalog, ev catalog.Event) error
+}
+
 // Result stores a search result for a project.
 type Result struct {
 	ShortName string
@@ -20,24 +29,30 @@ type Result struct {
 
 // textSearch is a Searcher that can perform a full text search.
 type textSearch struct {
-	i    map[string][]indexEntry
-	tags map[string][]string
-	list []string
+	i        map[string][]indexEntry
+	tags     map[string][]string
+	statuses map[catalog.Status][]string
+	fields   map[string]map[string][]string // name -> folded value -> short names
+	list     []string
 }
 
 // NewTextSearch returns a Searcher that performs full text search over the
-// short name, name, tags, and description fields of all projects in a catalog.
-// The Searcher maintains its own in-memory index of the catalog.  You must
-// create a new index if the underlying catalog is modified.
+// short name, name, tags, description, notes, status, and custom fields of
+// all projects in a catalog.
+// The Searcher maintains its own in-memory index of the catalog.  If the
+// underlying catalog is modified, you must either create a new index or pass
+// the catalog's events to the Searcher's Apply method (it implements Index).
 func NewTextSearch(cat catalog.Catalog) (Searcher, error) {
 	names, err := cat.List()
 	if err != nil {
 		return nil, err
 	}
 	ts := &textSearch{
-		i:    make(map[string][]indexEntry),
-		tags: make(map[string][]string),
-		list: names,
+		i:        make(map[string][]indexEntry),
+		tags:     make(map[string][]string),
+		statuses: make(map[catalog.Status][]string),
+		fields:   make(map[string]map[string][]string),
+		list:     names,
 	}
 	for _, sn := range names {
 		p, err := cat.GetProject(sn)
@@ -82,6 +97,10 @@ func (ts *textSearch) search(q queryAST, results resultMap) {
 		ts.searchToken(q, results)
 	case tagAtom:
 		ts.searchTagAtom(q, results)
+	case statusAtom:
+		ts.searchStatusAtom(q, results)
+	case fieldAtom:
+		ts.searchFieldAtom(q, results)
 	default:
 		panic("unknown queryAST type")
 	}
@@ -193,18 +212,129 @@ func (ts *textSearch) searchTagAtom(q tagAtom, results resultMap) {
 	}
 }
 
+func (ts *textSearch) searchStatusAtom(q statusAtom, results resultMap) {
+	status := catalog.Status(strings.ToLower(string(q)))
+	if status == "" {
+		status = catalog.StatusActive
+	}
+	for _, sn := range ts.statuses[status] {
+		results.Put(&Result{ShortName: sn, Relevance: 1.0})
+	}
+}
+
+func (ts *textSearch) searchFieldAtom(q fieldAtom, results resultMap) {
+	if ts.fields[q.Name] == nil {
+		// Not a field that any project has, so search for the whole
+		// term (like a URL or a tag with a colon).
+		ts.searchToken(term(q.Name+":"+q.Value), results)
+		return
+	}
+	for _, sn := range ts.fields[q.Name][foldString(q.Value)] {
+		results.Put(&Result{ShortName: sn, Relevance: 1.0})
+	}
+}
+
+// Apply updates the index for an event.
+func (ts *textSearch) Apply(cat catalog.Catalog, ev catalog.Event) error {
+	switch ev.Op {
+	case catalog.DeleteEvent:
+		ts.remove(ev.ShortName)
+	case catalog.RenameEvent, catalog.PutEvent:
+		p, err := cat.GetProjectByID(ev.ID)
+		if err != nil && !catalog.IsNotFound(err) {
+			return err
+		}
+		if ev.Op == catalog.RenameEvent {
+			ts.remove(ev.OldShortName)
+		}
+		ts.remove(ev.ShortName)
+		if p != nil {
+			ts.remove(p.ShortName)
+			ts.build(p)
+			ts.list = append(ts.list, p.ShortName)
+		}
+	}
+	return nil
+}
+
+// remove deletes a short name from the index.
+func (ts *textSearch) remove(sn string) {
+	for w, entries := range ts.i {
+		kept := entries[:0]
+		for _, ent := range entries {
+			if ent.shortName != sn {
+				kept = append(kept, ent)
+			}
+		}
+		if len(kept) == 0 {
+			delete(ts.i, w)
+		} else {
+			ts.i[w] = kept
+		}
+	}
+	for tag, names := range ts.tags {
+		ts.tags[tag] = removeString(names, sn)
+		if len(ts.tags[tag]) == 0 {
+			delete(ts.tags, tag)
+		}
+	}
+	for name, values := range ts.fields {
+		for v, names := range values {
+			values[v] = removeString(names, sn)
+			if len(values[v]) == 0 {
+				delete(values, v)
+			}
+		}
+		if len(values) == 0 {
+			delete(ts.fields, name)
+		}
+	}
+	for status, names := range ts.statuses {
+		ts.statuses[status] = removeString(names, sn)
+		if len(ts.statuses[status]) == 0 {
+			delete(ts.statuses, status)
+		}
+	}
+	ts.list = removeString(ts.list, sn)
+}
+
+// removeString removes every occurrence of s from slice, modifying it in place.
+func removeString(slice []string, s string) []string {
+	kept := slice[:0]
+	for _, t := range slice {
+		if t != s {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
 // build adds the project to the index.
 func (ts *textSearch) build(p *catalog.Project) {
 	sn := p.ShortName
 	ts.index(sn, kindShortName, [][]rune{fold([]rune(sn))})
 	ts.index(sn, kindName, tokenize(fold([]rune(p.Name))))
 	ts.index(sn, kindDescription, tokenize(fold([]rune(p.Description))))
+	for _, n := range p.Notes {
+		ts.index(sn, kindNote, tokenize(fold([]rune(n.Text))))
+	}
 	for _, tag := range p.Tags {
 		t := fold([]rune(tag))
 		ts.indexTag(sn, t)
 		ts.index(sn, kindTag, [][]rune{t})
 		ts.index(sn, kindTagPart, tokenize(t))
 	}
+	status := p.CurrentStatus()
+	ts.statuses[status] = append(ts.statuses[status], sn)
+	for name, v := range p.Fields {
+		values := ts.fields[name]
+		if values == nil {
+			values = make(map[string][]string)
+			ts.fields[name] = values
+		}
+		fv := foldString(v)
+		values[fv] = append(values[fv], sn)
+	}
 }
 
 // indexTag associates a tag with a short name.
@@ -239,7 +369,8 @@ type entryKind int
 
 // Index entry kinds
 const (
-	kindDescription entryKind = iota
+	kindNote entryKind = iota
+	kindDescription
 	kindTagPart
 	kindTag
 	kindName
@@ -247,6 +378,7 @@ const (
 )
 
 var kindWeights = [...]float32{
+	kindNote:        0.005,
 	kindDescription: 0.01,
 	kindTagPart:     0.7,
 	kindTag:         0.8,
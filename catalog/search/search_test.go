@@ -1,6 +1,7 @@
 package search
 
 import (
+	"reflect"
 	"strconv"
 	"testing"
 
@@ -245,6 +246,55 @@ func TestTextSearch(t *testing.T) {
 			},
 			[]string{"go", "aaaa"},
 		},
+		{
+			"status:archived",
+			mockCatalog{
+				"go":     &catalog.Project{ShortName: "go", Name: "Go"},
+				"python": &catalog.Project{ShortName: "python", Name: "Python", Status: catalog.StatusArchived},
+			},
+			[]string{"python"},
+		},
+		{
+			"status:Active",
+			mockCatalog{
+				"go":     &catalog.Project{ShortName: "go", Name: "Go"},
+				"python": &catalog.Project{ShortName: "python", Name: "Python", Status: catalog.StatusArchived},
+			},
+			[]string{"go"},
+		},
+		{
+			"owner:Alice",
+			mockCatalog{
+				"go":     &catalog.Project{ShortName: "go", Name: "Go", Fields: map[string]string{"owner": "alice"}},
+				"python": &catalog.Project{ShortName: "python", Name: "Python", Fields: map[string]string{"owner": "bob"}},
+				"bacon":  &catalog.Project{ShortName: "bacon", Name: "Bacon"},
+			},
+			[]string{"go"},
+		},
+		{
+			"lang:go",
+			mockCatalog{
+				"go":     &catalog.Project{ShortName: "go", Name: "Go", Tags: catalog.TagSet{"lang:go"}, Fields: map[string]string{"owner": "alice"}},
+				"python": &catalog.Project{ShortName: "python", Name: "Python", Tags: catalog.TagSet{"lang:python"}},
+			},
+			[]string{"go"},
+		},
+		{
+			"lang -status:archived",
+			mockCatalog{
+				"go":     &catalog.Project{ShortName: "go", Name: "Go", Tags: catalog.TagSet{"lang"}, Status: catalog.StatusMaintained},
+				"python": &catalog.Project{ShortName: "python", Name: "Python", Tags: catalog.TagSet{"lang"}, Status: catalog.StatusArchived},
+			},
+			[]string{"go"},
+		},
+		{
+			"blocked",
+			mockCatalog{
+				"go":     &catalog.Project{ShortName: "go", Name: "Go", Notes: []catalog.Note{{Text: "blocked on upstream"}}},
+				"python": &catalog.Project{ShortName: "python", Name: "Python"},
+			},
+			[]string{"go"},
+		},
 	}
 	for _, test := range tests {
 		ts, err := NewTextSearch(test.Catalog)
@@ -273,6 +323,61 @@ func TestTextSearch(t *testing.T) {
 	}
 }
 
+func TestTextSearchApply(t *testing.T) {
+	id := catalog.ID{1}
+	cat := mockCatalog{
+		"go": &catalog.Project{ID: id, ShortName: "go", Name: "Go", Tags: catalog.TagSet{"compiler"}, Fields: map[string]string{"owner": "alice"}},
+	}
+	s, err := NewTextSearch(cat)
+	if err != nil {
+		t.Fatal("NewTextSearch error:", err)
+	}
+	idx := s.(Index)
+
+	delete(cat, "go")
+	cat["golang"] = &catalog.Project{ID: id, ShortName: "golang", Name: "Go", Tags: catalog.TagSet{"language"}, Status: catalog.StatusMaintained, Fields: map[string]string{"owner": "bob"}}
+	err = idx.Apply(cat, catalog.Event{Op: catalog.RenameEvent, ID: id, ShortName: "golang", OldShortName: "go"})
+	if err != nil {
+		t.Error("Apply error:", err)
+	}
+	checks := []struct {
+		Query   string
+		Results []string
+	}{
+		{"go", []string{"golang"}},
+		{"golang", []string{"golang"}},
+		{"tag:compiler", []string{}},
+		{"tag:language", []string{"golang"}},
+		{"-python", []string{"golang"}},
+		{"status:active", []string{}},
+		{"status:maintained", []string{"golang"}},
+		{"owner:alice", []string{}},
+		{"owner:bob", []string{"golang"}},
+	}
+	for _, c := range checks {
+		results, err := s.Search(c.Query)
+		if err != nil {
+			t.Errorf("Search(%q) error: %v", c.Query, err)
+			continue
+		}
+		names := make([]string, len(results))
+		for i := range results {
+			names[i] = results[i].ShortName
+		}
+		if !reflect.DeepEqual(names, c.Results) {
+			t.Errorf("after rename, Search(%q) = %v; want %v", c.Query, names, c.Results)
+		}
+	}
+
+	delete(cat, "golang")
+	if err := idx.Apply(cat, catalog.Event{Op: catalog.DeleteEvent, ID: id, ShortName: "golang"}); err != nil {
+		t.Error("Apply error:", err)
+	}
+	if results, _ := s.Search("go"); len(results) != 0 {
+		t.Errorf("after delete, Search(%q) = %v; want []", "go", results)
+	}
+}
+
 func newTestCatalog() catalog.Catalog {
 	cat := mockCatalog{
 		"go": &catalog.Project{
@@ -357,6 +462,11 @@ func (mc mockCatalog) GetProject(shortName string) (*catalog.Project, error) {
 	return mc[shortName], nil
 }
 
+func (mc mockCatalog) GetProjectByID(id catalog.ID) (*catalog.Project, error) {
+	sn, _ := mc.ShortName(id)
+	return mc[sn], nil
+}
+
 func (mc mockCatalog) PutProject(project *catalog.Project) error {
 	if sn, _ := mc.ShortName(project.ID); sn != "" {
 		delete(mc, sn)
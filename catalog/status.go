@@ -0,0 +1,113 @@
+package catalog
+
+import (
+	"strings"
+	"time"
+)
+
+// Status is the lifecycle state of a project.  The empty status is treated
+// as StatusActive, so records written before statuses existed are active.
+type Status string
+
+// Project statuses
+const (
+	// StatusActive is a project that is being worked on.
+	StatusActive Status = "active"
+
+	// StatusMaintained is a project that is finished but still receives
+	// fixes.
+	StatusMaintained Status = "maintained"
+
+	// StatusAbandoned is a project that was stopped before it was finished.
+	StatusAbandoned Status = "abandoned"
+
+	// StatusArchived is a project that is only kept for reference.
+	StatusArchived Status = "archived"
+)
+
+// Statuses returns every valid status, in lifecycle order.
+func Statuses() []Status {
+	return []Status{StatusActive, StatusMaintained, StatusAbandoned, StatusArchived}
+}
+
+// ParseStatus returns the status named by s.  The empty string is StatusActive.
+func ParseStatus(s string) (Status, error) {
+	if s == "" {
+		return StatusActive, nil
+	}
+	for _, st := range Statuses() {
+		if string(st) == s {
+			return st, nil
+		}
+	}
+	return "", StatusError(s)
+}
+
+// IsValid reports whether s is one of the defined statuses or empty.
+func (s Status) IsValid() bool {
+	_, err := ParseStatus(string(s))
+	return err == nil
+}
+
+// A StatusError is returned when parsing an unknown status.
+type StatusError string
+
+func (e StatusError) Error() string {
+	names := make([]string, 0, 4)
+	for _, st := range Statuses() {
+		names = append(names, string(st))
+	}
+	return string(e) + " is not a valid status\nvalid choices are: " + strings.Join(names, ", ")
+}
+
+// A StatusChange records a project's transition into a status.
+type StatusChange struct {
+	Status Status    `json:"status"`
+	Time   time.Time `json:"time"`
+}
+
+// CurrentStatus returns the project's status, substituting StatusActive for
+// an empty status.
+func (proj *Project) CurrentStatus() Status {
+	if proj.Status == "" {
+		return StatusActive
+	}
+	return proj.Status
+}
+
+// SetStatus changes the project's status and records the transition at time
+// t.  It reports whether the status changed.
+func (proj *Project) SetStatus(s Status, t time.Time) bool {
+	if s == "" {
+		s = StatusActive
+	}
+	if s == proj.CurrentStatus() {
+		return false
+	}
+	proj.Status = s
+	proj.StatusHistory = append(proj.StatusHistory, StatusChange{Status: s, Time: t})
+	return true
+}
+
+// StatusTime returns the time that the project entered its current status.
+// Projects that have never changed status report their creation time.
+func (proj *Project) StatusTime() time.Time {
+	if n := len(proj.StatusHistory); n > 0 {
+		return proj.StatusHistory[n-1].Time
+	}
+	return proj.CreateTime
+}
+
+// checkStatus returns a StatusError if the project's status or any status in
+// its history is not valid.
+func checkStatus(proj *Project) error {
+	if !proj.Status.IsValid() {
+		return StatusError(proj.Status)
+	}
+	for _, c := range proj.StatusHistory {
+		if !c.Status.IsValid() {
+			return StatusError(c.Status)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package catalog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseStatus(t *testing.T) {
+	tests := []struct {
+		s      string
+		status Status
+		ok     bool
+	}{
+		{"", StatusActive, true},
+		{"active", StatusActive, true},
+		{"maintained", StatusMaintained, true},
+		{"abandoned", StatusAbandoned, true},
+		{"archived", StatusArchived, true},
+		{"Archived", "", false},
+		{"dead", "", false},
+	}
+	for _, test := range tests {
+		status, err := ParseStatus(test.s)
+		if !test.ok {
+			if err != StatusError(test.s) {
+				t.Errorf("ParseStatus(%q) error = %v; want %v", test.s, err, StatusError(test.s))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseStatus(%q) error: %v", test.s, err)
+		} else if status != test.status {
+			t.Errorf("ParseStatus(%q) = %q; want %q", test.s, status, test.status)
+		}
+	}
+}
+
+func TestProjectSetStatus(t *testing.T) {
+	t1 := magicTime.Add(1 * time.Hour)
+	t2 := magicTime.Add(2 * time.Hour)
+	proj := &Project{CreateTime: magicTime}
+	if s := proj.CurrentStatus(); s != StatusActive {
+		t.Errorf("new project status = %q; want %q", s, StatusActive)
+	}
+	if st := proj.StatusTime(); !st.Equal(magicTime) {
+		t.Errorf("new project StatusTime() = %v; want %v", st, magicTime)
+	}
+
+	if proj.SetStatus(StatusActive, t1) {
+		t.Error("SetStatus(active) on active project reported a change")
+	}
+	if !proj.SetStatus(StatusArchived, t1) {
+		t.Error("SetStatus(archived) reported no change")
+	}
+	if proj.SetStatus(StatusArchived, t2) {
+		t.Error("second SetStatus(archived) reported a change")
+	}
+	if !proj.SetStatus("", t2) {
+		t.Error("SetStatus(\"\") on archived project reported no change")
+	}
+
+	if proj.Status != StatusActive {
+		t.Errorf("proj.Status = %q; want %q", proj.Status, StatusActive)
+	}
+	want := []StatusChange{{StatusArchived, t1}, {StatusActive, t2}}
+	if len(proj.StatusHistory) != len(want) {
+		t.Fatalf("proj.StatusHistory = %v; want %v", proj.StatusHistory, want)
+	}
+	for i := range want {
+		if c := proj.StatusHistory[i]; c.Status != want[i].Status || !c.Time.Equal(want[i].Time) {
+			t.Errorf("proj.StatusHistory[%d] = %v; want %v", i, c, want[i])
+		}
+	}
+	if st := proj.StatusTime(); !st.Equal(t2) {
+		t.Errorf("StatusTime() = %v; want %v", st, t2)
+	}
+}
@@ -0,0 +1,143 @@
+package catalog
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A ParentRef places a project in a subdirectory of another project's
+// repository.  A project with a parent is called a subproject: it has no
+// remotes or paths of its own, and instead uses those of its root project
+// (see Root).
+type ParentRef struct {
+	ID ID `json:"id"`
+
+	// Subdir is the slash-separated path of the subproject, relative to
+	// the parent's working copy.
+	Subdir string `json:"subdir"`
+}
+
+// IsValidSubdir reports whether dir can be used as a subproject's
+// subdirectory: a clean, relative, slash-separated path that stays inside
+// the parent.
+func IsValidSubdir(dir string) bool {
+	return dir != "" && dir != "." && path.Clean(dir) == dir && !path.IsAbs(dir) &&
+		dir != ".." && !strings.HasPrefix(dir, "../") && !strings.Contains(dir, `\`)
+}
+
+// Subproject errors
+var (
+	errParentCycle  = errors.New("project is its own ancestor")
+	errNoParent     = errors.New("parent is not in the catalog")
+	errBadSubdir    = errors.New("invalid subproject subdirectory")
+	errChildRemotes = errors.New("subproject cannot have its own remotes")
+	errChildPath    = errors.New("subproject cannot have its own path")
+)
+
+// maxParentDepth bounds the search for a project's root, in case the
+// catalog has a cycle that was not caught when the projects were stored.
+const maxParentDepth = 100
+
+// checkParent returns an error if proj's parent is malformed.  get looks up a
+// project by ID.
+func checkParent(proj *Project, get func(ID) (*Project, error)) error {
+	if proj.Parent == nil {
+		return nil
+	}
+	if !IsValidSubdir(proj.Parent.Subdir) {
+		return errBadSubdir
+	}
+	if len(proj.Remotes) > 0 {
+		return errChildRemotes
+	}
+	for _, info := range proj.PerHost {
+		if info != nil && info.Path != "" {
+			return errChildPath
+		}
+	}
+	id := proj.Parent.ID
+	for i := 0; i < maxParentDepth; i++ {
+		if id == proj.ID {
+			return errParentCycle
+		}
+		p, err := get(id)
+		if IsNotFound(err) && i == 0 {
+			return errNoParent
+		} else if IsNotFound(err) {
+			// A missing ancestor is reported by Verify.
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if p.Parent == nil {
+			return nil
+		}
+		id = p.Parent.ID
+	}
+	return errParentCycle
+}
+
+// Root follows proj's parents to the project whose repository holds proj.
+// It returns that project along with proj's slash-separated subdirectory
+// inside of it.  For a project without a parent, Root returns proj and "".
+func Root(cat Catalog, proj *Project) (root *Project, subdir string, err error) {
+	var dirs []string
+	for i := 0; proj.Parent != nil; i++ {
+		if i == maxParentDepth {
+			return nil, "", &ProjectError{ShortName: proj.ShortName, Op: "find root of", Err: errParentCycle}
+		}
+		dirs = append(dirs, proj.Parent.Subdir)
+		parent, err := cat.GetProjectByID(proj.Parent.ID)
+		if err != nil {
+			return nil, "", err
+		}
+		proj = parent
+	}
+	for i, j := 0, len(dirs)-1; i < j; i, j = i+1, j-1 {
+		dirs[i], dirs[j] = dirs[j], dirs[i]
+	}
+	return proj, path.Join(dirs...), nil
+}
+
+// ResolvePath returns the path of proj's working copy on host, expanded with
+// env (see Project.Path).  A subproject's path is its root project's path
+// joined with its subdirectory.  If the project (or its root) has no path on
+// the host, ResolvePath returns an empty string.
+func ResolvePath(cat Catalog, proj *Project, host string, env *PathEnv) (string, error) {
+	root, subdir, err := Root(cat, proj)
+	if err != nil {
+		return "", err
+	}
+	p, err := root.ExpandPath(host, env)
+	if p == "" || err != nil || subdir == "" {
+		return p, err
+	}
+	if IsPortablePath(p) {
+		return p + "/" + subdir, nil
+	}
+	return filepath.Join(p, filepath.FromSlash(subdir)), nil
+}
+
+// Subprojects returns the short names of the projects in cat whose parent is
+// id, sorted.
+func Subprojects(cat Catalog, id ID) ([]string, error) {
+	names, err := cat.List()
+	if err != nil {
+		return nil, err
+	}
+	var children []string
+	for _, sn := range names {
+		proj, err := cat.GetProject(sn)
+		if err != nil {
+			return nil, err
+		}
+		if proj.Parent != nil && proj.Parent.ID == id {
+			children = append(children, sn)
+		}
+	}
+	sort.Strings(children)
+	return children, nil
+}
@@ -0,0 +1,157 @@
+package catalog
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIsValidSubdir(t *testing.T) {
+	tests := []struct {
+		dir string
+		ok  bool
+	}{
+		{"cmd/foo", true},
+		{"foo", true},
+		{".hidden/foo", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"../foo", false},
+		{"foo/../../bar", false},
+		{"/foo", false},
+		{"foo/", false},
+		{`foo\bar`, false},
+	}
+	for _, test := range tests {
+		if ok := IsValidSubdir(test.dir); ok != test.ok {
+			t.Errorf("IsValidSubdir(%q) = %t; want %t", test.dir, ok, test.ok)
+		}
+	}
+}
+
+// newSubprojectCatalog returns a catalog where mono holds lib at "lib" and
+// lib holds tool at "cmd/tool".
+func newSubprojectCatalog(t *testing.T) *Memory {
+	mono := &Project{
+		ID:        ID{1},
+		ShortName: "mono",
+		Remotes:   []Remote{{Name: DefaultRemoteName, Role: RolePrimary, Type: Git, URL: "https://example.com/mono.git"}},
+		PerHost:   map[string]*HostInfo{"laptop": {Path: "~/src/mono"}},
+	}
+	return newMemoryWithProjects(t,
+		mono,
+		&Project{ID: ID{2}, ShortName: "lib", Parent: &ParentRef{ID: ID{1}, Subdir: "lib"}},
+		&Project{ID: ID{3}, ShortName: "tool", Parent: &ParentRef{ID: ID{2}, Subdir: "cmd/tool"}},
+	)
+}
+
+func TestPutSubproject(t *testing.T) {
+	m := newSubprojectCatalog(t)
+	tests := []struct {
+		proj *Project
+		err  error
+	}{
+		{&Project{ID: ID{4}, ShortName: "orphan", Parent: &ParentRef{ID: ID{9}, Subdir: "x"}}, errNoParent},
+		{&Project{ID: ID{4}, ShortName: "bad", Parent: &ParentRef{ID: ID{1}, Subdir: "../x"}}, errBadSubdir},
+		{&Project{ID: ID{1}, ShortName: "mono", Parent: &ParentRef{ID: ID{3}, Subdir: "x"}}, errParentCycle},
+		{&Project{ID: ID{4}, ShortName: "self", Parent: &ParentRef{ID: ID{4}, Subdir: "x"}}, errParentCycle},
+		{
+			&Project{
+				ID:        ID{4},
+				ShortName: "dup",
+				Parent:    &ParentRef{ID: ID{1}, Subdir: "dup"},
+				Remotes:   []Remote{{Name: DefaultRemoteName, Role: RolePrimary, Type: Git}},
+			},
+			errChildRemotes,
+		},
+		{
+			&Project{
+				ID:        ID{4},
+				ShortName: "pathy",
+				Parent:    &ParentRef{ID: ID{1}, Subdir: "pathy"},
+				PerHost:   map[string]*HostInfo{"laptop": {Path: "/src/pathy"}},
+			},
+			errChildPath,
+		},
+	}
+	for _, test := range tests {
+		if err := m.PutProject(test.proj); !errors.Is(err, test.err) {
+			t.Errorf("PutProject(%s) = %v; want %v", test.proj.ShortName, err, test.err)
+		}
+	}
+}
+
+func TestRoot(t *testing.T) {
+	m := newSubprojectCatalog(t)
+	tests := []struct {
+		sn     string
+		root   string
+		subdir string
+	}{
+		{"mono", "mono", ""},
+		{"lib", "mono", "lib"},
+		{"tool", "mono", "lib/cmd/tool"},
+	}
+	for _, test := range tests {
+		proj, err := m.GetProject(test.sn)
+		if err != nil {
+			t.Fatal("GetProject error:", err)
+		}
+		root, subdir, err := Root(m, proj)
+		if err != nil {
+			t.Errorf("Root(%s) error: %v", test.sn, err)
+		} else if root.ShortName != test.root || subdir != test.subdir {
+			t.Errorf("Root(%s) = %s, %q; want %s, %q", test.sn, root.ShortName, subdir, test.root, test.subdir)
+		}
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	m := newSubprojectCatalog(t)
+	env := &PathEnv{Home: filepath.FromSlash("/home/alice")}
+	proj, err := m.GetProject("tool")
+	if err != nil {
+		t.Fatal("GetProject error:", err)
+	}
+	if p, err := ResolvePath(m, proj, "laptop", env); err != nil {
+		t.Errorf("ResolvePath(tool, laptop) error: %v", err)
+	} else if want := filepath.FromSlash("/home/alice/src/mono/lib/cmd/tool"); p != want {
+		t.Errorf("ResolvePath(tool, laptop) = %q; want %q", p, want)
+	}
+	if p, err := ResolvePath(m, proj, "laptop", nil); err != nil {
+		t.Errorf("ResolvePath(tool, laptop, nil) error: %v", err)
+	} else if want := "~/src/mono/lib/cmd/tool"; p != want {
+		t.Errorf("ResolvePath(tool, laptop, nil) = %q; want %q", p, want)
+	}
+	if p, err := ResolvePath(m, proj, "desktop", env); err != nil || p != "" {
+		t.Errorf("ResolvePath(tool, desktop) = %q, %v; want \"\", <nil>", p, err)
+	}
+}
+
+func TestSubprojects(t *testing.T) {
+	m := newSubprojectCatalog(t)
+	if err := m.PutProject(&Project{ID: ID{4}, ShortName: "docs", Parent: &ParentRef{ID: ID{1}, Subdir: "docs"}}); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	if children, err := Subprojects(m, ID{1}); err != nil {
+		t.Error("Subprojects error:", err)
+	} else if want := []string{"docs", "lib"}; !reflect.DeepEqual(children, want) {
+		t.Errorf("Subprojects(mono) = %q; want %q", children, want)
+	}
+}
+
+func TestVerify_DanglingParent(t *testing.T) {
+	m := newSubprojectCatalog(t)
+	if err := m.DelProject("lib"); err != nil {
+		t.Fatal("DelProject error:", err)
+	}
+	problems, err := Verify(m)
+	if err != nil {
+		t.Fatal("Verify error:", err)
+	}
+	checkProblems(t, "Verify", problems, []problemCheck{
+		{DanglingLink, filepath.Join(projectsDir, "tool.json"), false},
+	})
+}
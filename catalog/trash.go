@@ -0,0 +1,224 @@
+package catalog
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A TrashedProject is a project that was deleted from a catalog that keeps
+// deleted projects in a trash area.
+type TrashedProject struct {
+	DeleteTime time.Time `json:"delete_time"`
+	Project    *Project  `json:"project"`
+}
+
+// A Trasher is a Catalog that moves deleted projects to a trash area instead
+// of removing them.
+type Trasher interface {
+	Catalog
+
+	// Trash returns the deleted projects, most recently deleted first.
+	// Trash files that cannot be read are left out for Verify to report.
+	Trash() ([]*TrashedProject, error)
+
+	// RestoreProject moves the project with the given ID out of the trash.
+	// If shortName is not empty, then the project is restored under that
+	// short name instead of the one it was deleted with.  The project is
+	// restored as it was deleted; problems like a removed host or parent
+	// are left for Verify to report.
+	RestoreProject(id ID, shortName string) error
+
+	// PurgeProject permanently removes the project with the given ID from
+	// the trash, along with its attachments.
+	PurgeProject(id ID) error
+}
+
+// GetTrash returns cat's deleted projects, or nil if cat is not a Trasher.
+func GetTrash(cat Catalog) ([]*TrashedProject, error) {
+	if t, ok := cat.(Trasher); ok {
+		return t.Trash()
+	}
+	return nil, nil
+}
+
+// Trash errors
+var (
+	errNoTrash         = errors.New("catalog: catalog does not have a trash")
+	errShortNameInUse  = errors.New("short name is used by another project")
+	errIDInUse         = errors.New("project with this ID is already in the catalog")
+	errTrashIDMismatch = errors.New("trashed project has a different ID than its file name")
+)
+
+// FindTrashed finds a project in trash by its short name, its ID, or a unique
+// prefix of its ID at least MinIDPrefixLen characters long.  If more than one
+// project was deleted with the short name, then the most recently deleted one
+// is returned.
+func FindTrashed(trash []*TrashedProject, name string) (*TrashedProject, error) {
+	var latest *TrashedProject
+	for _, tp := range trash {
+		if tp.Project.ShortName == name && (latest == nil || tp.DeleteTime.After(latest.DeleteTime)) {
+			latest = tp
+		}
+	}
+	if latest != nil {
+		return latest, nil
+	}
+	if len(name) >= MinIDPrefixLen && len(name) <= IDEncodedLen {
+		var matches []*TrashedProject
+		for _, tp := range trash {
+			if strings.HasPrefix(tp.Project.ID.String(), name) {
+				matches = append(matches, tp)
+			}
+		}
+		switch len(matches) {
+		case 1:
+			return matches[0], nil
+		case 0:
+		default:
+			ids := make([]ID, len(matches))
+			for i := range matches {
+				ids[i] = matches[i].Project.ID
+			}
+			return nil, &AmbiguousIDError{Prefix: name, IDs: ids}
+		}
+	}
+	return nil, &ProjectError{ShortName: name, Op: "find trashed", Err: ErrNotFound}
+}
+
+// PurgeTrash permanently removes every project in cat's trash that was
+// deleted before t, as a single change.  It returns the projects removed.
+func PurgeTrash(cat Catalog, t time.Time) ([]*TrashedProject, error) {
+	var purged []*TrashedProject
+	err := Batch(cat, "purge trash", func(tx Catalog) error {
+		purged = purged[:0]
+		trasher, ok := tx.(Trasher)
+		if !ok {
+			return errNoTrash
+		}
+		trash, err := trasher.Trash()
+		if err != nil {
+			return err
+		}
+		for _, tp := range trash {
+			if !tp.DeleteTime.Before(t) {
+				continue
+			}
+			if err := trasher.PurgeProject(tp.Project.ID); err != nil {
+				return err
+			}
+			purged = append(purged, tp)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return purged, nil
+}
+
+// trashPath returns the path of a deleted project's file, relative to the
+// catalog root.
+func trashPath(id ID) string {
+	return filepath.Join(trashDir, id.String()+jsonExt)
+}
+
+// Trash reads the files in the catalog's trash directory.  Files that can't
+// be parsed or that are named for another ID are skipped; check reports them.
+func (cat *localCatalog) Trash() ([]*TrashedProject, error) {
+	names, err := cat.trashFiles()
+	if err != nil {
+		return nil, err
+	}
+	trash := make([]*TrashedProject, 0, len(names))
+	for _, name := range names {
+		tp, err := cat.readTrashed(filepath.Join(trashDir, name))
+		if isJSONError(err) || err == errTrashIDMismatch {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		trash = append(trash, tp)
+	}
+	sort.Sort(byDeleteTime(trash))
+	return trash, nil
+}
+
+// trashFiles returns the names of the JSON files in the trash directory.  A
+// catalog without a trash directory has an empty trash.
+func (cat *localCatalog) trashFiles() ([]string, error) {
+	dir, err := cat.fs.Open(filepath.Join(cat.root, trashDir))
+	if cat.fs.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	var names []string
+	for {
+		entries, err := dir.Readdir(100)
+		for _, ent := range entries {
+			if name := ent.Name(); strings.HasSuffix(name, jsonExt) && !strings.HasPrefix(name, ".") && !ent.IsDir() {
+				names = append(names, name)
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// readTrashed reads a trash file.  path is relative to the catalog root.
+func (cat *localCatalog) readTrashed(path string) (*TrashedProject, error) {
+	tp := new(TrashedProject)
+	if err := readJSON(cat.fs, filepath.Join(cat.root, path), tp); err != nil {
+		return nil, err
+	}
+	if tp.Project == nil {
+		tp.Project = new(Project)
+	}
+	if name := filepath.Base(path); tp.Project.ID.String()+jsonExt != name {
+		return nil, errTrashIDMismatch
+	}
+	return tp, nil
+}
+
+// RestoreProject moves a project file out of the trash directory.
+func (cat *localCatalog) RestoreProject(id ID, shortName string) error {
+	message := "restore project " + id.String()
+	if tp, err := cat.readTrashed(trashPath(id)); err == nil {
+		message = "restore project " + tp.Project.ShortName
+	}
+	if shortName != "" {
+		message += " as " + shortName
+	}
+	return cat.Batch(message, func(tx Catalog) error {
+		return tx.(*localTx).RestoreProject(id, shortName)
+	})
+}
+
+// PurgeProject deletes a project file in the trash directory.
+func (cat *localCatalog) PurgeProject(id ID) error {
+	return cat.Batch("purge project "+id.String(), func(tx Catalog) error {
+		return tx.(*localTx).PurgeProject(id)
+	})
+}
+
+// byDeleteTime sorts trashed projects from most to least recently deleted.
+type byDeleteTime []*TrashedProject
+
+func (a byDeleteTime) Len() int      { return len(a) }
+func (a byDeleteTime) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byDeleteTime) Less(i, j int) bool {
+	if !a[i].DeleteTime.Equal(a[j].DeleteTime) {
+		return a[i].DeleteTime.After(a[j].DeleteTime)
+	}
+	return a[i].Project.ShortName < a[j].Project.ShortName
+}
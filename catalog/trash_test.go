@@ -0,0 +1,273 @@
+package catalog
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTrashTestCatalog(t *testing.T) *Memory {
+	return newMemoryWithProjects(t,
+		&Project{ID: ID{1}, ShortName: "foo", Name: "Foo"},
+		&Project{ID: ID{2}, ShortName: "bar", Name: "Bar"},
+	)
+}
+
+func TestLocalDelProject_Trash(t *testing.T) {
+	m := newTrashTestCatalog(t)
+	start := time.Now()
+	if err := m.DelProject("foo"); err != nil {
+		t.Fatal("DelProject error:", err)
+	}
+	if _, err := m.GetProject("foo"); !IsNotFound(err) {
+		t.Errorf("GetProject(foo) after delete error = %v; want not found", err)
+	}
+	trash, err := m.Trash()
+	if err != nil {
+		t.Fatal("Trash error:", err)
+	}
+	if len(trash) != 1 || trash[0].Project.ID != (ID{1}) || trash[0].Project.Name != "Foo" {
+		t.Fatalf("Trash() = %v; want foo", trash)
+	}
+	if trash[0].DeleteTime.Before(start.Add(-time.Second)) {
+		t.Errorf("trash[0].DeleteTime = %v; want after %v", trash[0].DeleteTime, start)
+	}
+	problems, err := Verify(m)
+	if err != nil {
+		t.Fatal("Verify error:", err)
+	}
+	checkProblems(t, "Verify", problems, nil)
+
+	if err := m.RestoreProject(ID{1}, ""); err != nil {
+		t.Fatal("RestoreProject error:", err)
+	}
+	if proj, err := m.GetProject("foo"); err != nil {
+		t.Error("GetProject(foo) after restore error:", err)
+	} else if proj.ID != (ID{1}) || proj.Name != "Foo" {
+		t.Errorf("GetProject(foo) after restore = %+v", proj)
+	}
+	if trash, err := m.Trash(); err != nil || len(trash) != 0 {
+		t.Errorf("Trash() after restore = %v, %v; want empty", trash, err)
+	}
+	if err := m.RestoreProject(ID{1}, ""); !IsNotFound(err) {
+		t.Errorf("second RestoreProject error = %v; want not found", err)
+	}
+}
+
+func TestLocalTrash_BadFile(t *testing.T) {
+	m := newTrashTestCatalog(t)
+	if err := m.DelProject("foo"); err != nil {
+		t.Fatal("DelProject error:", err)
+	}
+	if err := m.DelProject("bar"); err != nil {
+		t.Fatal("DelProject error:", err)
+	}
+	// Corrupt bar's trash file and copy foo's under another ID.
+	if err := writeFile(m.fs, filepath.Join(m.root, trashPath(ID{2})), []byte("<<<<<<< HEAD\n"), false); err != nil {
+		t.Fatal(err)
+	}
+	data, err := readFile(m.fs, filepath.Join(m.root, trashPath(ID{1})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(m.fs, filepath.Join(m.root, trashPath(ID{3})), data, false); err != nil {
+		t.Fatal(err)
+	}
+
+	trash, err := m.Trash()
+	if err != nil {
+		t.Fatal("Trash error:", err)
+	}
+	if len(trash) != 1 || trash[0].Project.ID != (ID{1}) {
+		t.Errorf("Trash() = %v; want foo", trash)
+	}
+	problems, err := Verify(m)
+	if err != nil {
+		t.Fatal("Verify error:", err)
+	}
+	checkProblems(t, "Verify", problems, []problemCheck{
+		{BadProject, trashPath(ID{2}), false},
+		{BadProject, trashPath(ID{3}), false},
+	})
+	if err := m.RestoreProject(ID{1}, ""); err != nil {
+		t.Error("RestoreProject error:", err)
+	}
+}
+
+func TestLocalDelProject_TrashVCS(t *testing.T) {
+	cat, fs, wc := newTestCatalog()
+	if err := cat.DelProject("blackforest"); err != nil {
+		t.Fatal("DelProject error:", err)
+	}
+	if _, ok := fs.files["foo/projects/blackforest.json"]; ok {
+		t.Error("blackforest.json still exists")
+	}
+	if want := []string{"trash/b11dzGs4SQid.json"}; !reflect.DeepEqual(wc.added, want) {
+		t.Errorf("vcs added = %v; want %v", wc.added, want)
+	}
+	if want := []string{"projects/blackforest.json"}; !reflect.DeepEqual(wc.removed, want) {
+		t.Errorf("vcs removed = %v; want %v", wc.removed, want)
+	}
+	if want := map[string]string{"projects/blackforest.json": "trash/b11dzGs4SQid.json"}; !reflect.DeepEqual(wc.renamed, want) {
+		t.Errorf("vcs renamed = %v; want %v", wc.renamed, want)
+	}
+}
+
+func TestLocalRestoreProject_NameInUse(t *testing.T) {
+	m := newTrashTestCatalog(t)
+	if err := m.DelProject("foo"); err != nil {
+		t.Fatal("DelProject error:", err)
+	}
+	if err := m.PutProject(&Project{ID: ID{3}, ShortName: "foo", Name: "New Foo"}); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	if err := m.RestoreProject(ID{1}, ""); !errors.Is(err, errShortNameInUse) {
+		t.Errorf("RestoreProject(foo) error = %v; want %v", err, errShortNameInUse)
+	}
+	if err := m.RestoreProject(ID{1}, "oldfoo"); err != nil {
+		t.Fatal("RestoreProject(oldfoo) error:", err)
+	}
+	if proj, err := m.GetProject("oldfoo"); err != nil || proj.ID != (ID{1}) {
+		t.Errorf("GetProject(oldfoo) = %v, %v; want ID %v", proj, err, ID{1})
+	}
+	if proj, err := m.GetProject("foo"); err != nil || proj.ID != (ID{3}) {
+		t.Errorf("GetProject(foo) = %v, %v; want ID %v", proj, err, ID{3})
+	}
+}
+
+func TestLocalRestoreProject_Unchecked(t *testing.T) {
+	m := newTrashTestCatalog(t)
+	sub := &Project{ID: ID{3}, ShortName: "sub", Parent: &ParentRef{ID: ID{2}, Subdir: "sub"}}
+	if err := m.PutProject(sub); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	if err := m.DelProject("sub"); err != nil {
+		t.Fatal("DelProject(sub) error:", err)
+	}
+	if err := m.DelProject("bar"); err != nil {
+		t.Fatal("DelProject(bar) error:", err)
+	}
+	if err := m.PurgeProject(ID{2}); err != nil {
+		t.Fatal("PurgeProject(bar) error:", err)
+	}
+	if err := m.PutSchema(&Schema{[]FieldDef{{Name: "owner", Type: TextField, Required: true}}}); err != nil {
+		t.Fatal("PutSchema error:", err)
+	}
+
+	if err := m.RestoreProject(ID{3}, ""); err != nil {
+		t.Fatal("RestoreProject(sub) error:", err)
+	}
+	if proj, err := m.GetProject("sub"); err != nil || proj.ID != (ID{3}) {
+		t.Errorf("GetProject(sub) = %v, %v; want ID %v", proj, err, ID{3})
+	}
+	problems, err := Verify(m)
+	if err != nil {
+		t.Fatal("Verify error:", err)
+	}
+	checkProblems(t, "Verify", problems, []problemCheck{
+		{Kind: InvalidFields, Path: "projects/foo.json"},
+		{Kind: InvalidFields, Path: "projects/sub.json"},
+		{Kind: DanglingLink, Path: "projects/sub.json"},
+	})
+}
+
+func TestLocalBatch_DeleteRollback(t *testing.T) {
+	m := newTrashTestCatalog(t)
+	errAbort := errors.New("abort")
+	err := m.Batch("delete and fail", func(tx Catalog) error {
+		if err := tx.DelProject("foo"); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if err != errAbort {
+		t.Fatalf("Batch error = %v; want %v", err, errAbort)
+	}
+	if _, err := m.GetProject("foo"); err != nil {
+		t.Error("GetProject(foo) after rollback error:", err)
+	}
+	if trash, err := m.Trash(); err != nil || len(trash) != 0 {
+		t.Errorf("Trash() after rollback = %v, %v; want empty", trash, err)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	m := newTrashTestCatalog(t)
+	if err := m.DelProject("foo"); err != nil {
+		t.Fatal("DelProject error:", err)
+	}
+	if purged, err := PurgeTrash(m, time.Now().Add(-time.Hour)); err != nil || len(purged) != 0 {
+		t.Errorf("PurgeTrash(an hour ago) = %v, %v; want none", purged, err)
+	}
+	if err := m.DelProject("bar"); err != nil {
+		t.Fatal("DelProject error:", err)
+	}
+	purged, err := PurgeTrash(m, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal("PurgeTrash error:", err)
+	}
+	if len(purged) != 2 {
+		t.Errorf("PurgeTrash(an hour from now) = %v; want foo and bar", purged)
+	}
+	if trash, err := m.Trash(); err != nil || len(trash) != 0 {
+		t.Errorf("Trash() after purge = %v, %v; want empty", trash, err)
+	}
+	if err := m.RestoreProject(ID{1}, ""); !IsNotFound(err) {
+		t.Errorf("RestoreProject after purge error = %v; want not found", err)
+	}
+}
+
+func TestFindTrashed(t *testing.T) {
+	t1 := time.Date(2014, time.March, 1, 12, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	id1, _ := ParseID("b11dzGs4SQid")
+	id2, _ := ParseID("b11dAAAAAAAA")
+	id3, _ := ParseID("xyzzyAAAAAAA")
+	trash := []*TrashedProject{
+		{DeleteTime: t1, Project: &Project{ID: id1, ShortName: "foo"}},
+		{DeleteTime: t2, Project: &Project{ID: id2, ShortName: "foo"}},
+		{DeleteTime: t1, Project: &Project{ID: id3, ShortName: "bar"}},
+	}
+	tests := []struct {
+		name string
+		id   ID
+		err  bool
+	}{
+		{"foo", id2, false},
+		{"bar", id3, false},
+		{"xyzz", id3, false},
+		{"b11dz", id1, false},
+		{"b11d", ID{}, true},
+		{"baz", ID{}, true},
+	}
+	for _, test := range tests {
+		tp, err := FindTrashed(trash, test.name)
+		switch {
+		case test.err && err == nil:
+			t.Errorf("FindTrashed(%q) = %v; want error", test.name, tp.Project.ID)
+		case !test.err && err != nil:
+			t.Errorf("FindTrashed(%q) error: %v", test.name, err)
+		case !test.err && tp.Project.ID != test.id:
+			t.Errorf("FindTrashed(%q) = %v; want %v", test.name, tp.Project.ID, test.id)
+		}
+	}
+}
+
+func TestCacheRestoreProject(t *testing.T) {
+	m := newTrashTestCatalog(t)
+	c, err := NewCache(m)
+	if err != nil {
+		t.Fatal("NewCache error:", err)
+	}
+	if err := c.DelProject("foo"); err != nil {
+		t.Fatal("DelProject error:", err)
+	}
+	if err := c.RestoreProject(ID{1}, ""); err != nil {
+		t.Fatal("RestoreProject error:", err)
+	}
+	if proj, err := c.GetProject("foo"); err != nil || proj.ID != (ID{1}) {
+		t.Errorf("cached GetProject(foo) = %v, %v; want ID %v", proj, err, ID{1})
+	}
+}
@@ -0,0 +1,661 @@
+package catalog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A localTx is a transaction on a local catalog.  Project files are changed
+// as the transaction goes, but the original contents of every file touched are
+// kept in a journal so that the transaction can be rolled back.
+type localTx struct {
+	cat    *localCatalog
+	meta   *catalogMeta
+	schema *Schema
+	hosts  *HostRegistry
+
+	mu      sync.Mutex
+	journal map[string]*journalEntry
+	order   []string
+	renames map[string]string // destination -> source, both relative paths
+	done    bool
+
+	// undoErr is set when a failed change could not be undone.  The
+	// transaction is rolled back instead of committed.
+	undoErr error
+}
+
+// A journalEntry records a file's state before a transaction modified it.
+type journalEntry struct {
+	data    []byte
+	existed bool
+	exists  bool
+}
+
+// errTxDone is returned when a transaction is used after its batch has finished.
+var errTxDone = errors.New("catalog: transaction has already finished")
+
+// begin starts a transaction.  The catalog must be locked.
+func (cat *localCatalog) begin() (*localTx, error) {
+	meta, err := cat.readCatalogMeta()
+	if err != nil {
+		return nil, err
+	}
+	schema, err := cat.Schema()
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := cat.Hosts()
+	if err != nil {
+		return nil, err
+	}
+	return &localTx{
+		cat:     cat,
+		meta:    meta,
+		schema:  schema,
+		hosts:   hosts,
+		journal: make(map[string]*journalEntry),
+		renames: make(map[string]string),
+	}, nil
+}
+
+// close prevents any further use of the transaction.
+func (tx *localTx) close() {
+	tx.mu.Lock()
+	tx.done = true
+	tx.mu.Unlock()
+}
+
+func (tx *localTx) List() ([]string, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return nil, errTxDone
+	}
+	return tx.cat.List()
+}
+
+func (tx *localTx) GetProject(shortName string) (*Project, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return nil, errTxDone
+	}
+	return tx.cat.getProject(shortName, tx.meta)
+}
+
+func (tx *localTx) GetProjectByID(id ID) (*Project, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return nil, errTxDone
+	}
+	return tx.getProjectByID(id)
+}
+
+// getProjectByID is GetProjectByID without locking.
+func (tx *localTx) getProjectByID(id ID) (*Project, error) {
+	sn := tx.meta.ShortNameMap[id.String()]
+	if sn == "" {
+		return nil, &ProjectError{ShortName: id.String(), Op: "get", Err: ErrNotFound}
+	}
+	return tx.cat.getProject(sn, tx.meta)
+}
+
+func (tx *localTx) ids() ([]ID, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return nil, errTxDone
+	}
+	return tx.meta.ids(), nil
+}
+
+func (tx *localTx) ShortName(id ID) (string, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return "", errTxDone
+	}
+	return tx.meta.ShortNameMap[id.String()], nil
+}
+
+func (tx *localTx) PutProject(project *Project) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return errTxDone
+	}
+	return tx.putProject(project)
+}
+
+// putProject is PutProject without locking.
+func (tx *localTx) putProject(project *Project) error {
+	const op = "put"
+
+	sn, idString := project.ShortName, project.ID.String()
+	if !isValidShortName(sn) {
+		return shortNameError(sn)
+	}
+	old := tx.meta.ShortNameMap[idString]
+	var prev *Project
+	if old != "" {
+		var err error
+		prev, err = tx.cat.getProject(old, tx.meta)
+		if IsNotFound(err) {
+			prev, err = nil, nil
+		}
+		if err != nil {
+			return &ProjectError{ShortName: sn, Op: op, Err: err}
+		}
+	}
+	if err := tx.schema.ValidateChange(prev, project); err != nil {
+		return &ProjectError{ShortName: sn, Op: op, Err: err}
+	}
+	if err := checkStatus(project); err != nil {
+		return &ProjectError{ShortName: sn, Op: op, Err: err}
+	}
+	if err := checkRemotes(project.Remotes); err != nil {
+		return &ProjectError{ShortName: sn, Op: op, Err: err}
+	}
+	if err := tx.hosts.ValidateChange(prev, project); err != nil {
+		return &ProjectError{ShortName: sn, Op: op, Err: err}
+	}
+	if err := checkParent(project, tx.getProjectByID); err != nil {
+		return &ProjectError{ShortName: sn, Op: op, Err: err}
+	}
+
+	if prev != nil {
+		if err := checkNotes(project.Notes, prev.Notes); err != nil {
+			return &ProjectError{ShortName: sn, Op: op, Err: err}
+		}
+	}
+	return tx.writeProject(project, op)
+}
+
+// writeProject writes a project's file and updates the catalog metadata,
+// removing the project's file under its old short name if it was renamed.  The
+// project is not checked.  If writeProject fails, it leaves the transaction as
+// it was, so a batch may carry on after a failed put.
+func (tx *localTx) writeProject(project *Project, op string) error {
+	sn, idString := project.ShortName, project.ID.String()
+	old := tx.meta.ShortNameMap[idString]
+	isNewName := old != sn
+	path := tx.cat.projectRelPath(sn)
+	if err := tx.save(path); err != nil {
+		return &ProjectError{ShortName: sn, Op: op, Err: err}
+	}
+	if err := writeJSON(tx.cat.fs, tx.cat.projectPath(sn), project, isNewName); err != nil {
+		return &ProjectError{ShortName: sn, Op: op, Err: err}
+	}
+	tx.journal[path].exists = true
+	formerID, wasFormer := tx.meta.FormerNames[sn]
+	tx.meta.ShortNameMap[idString] = sn
+	delete(tx.meta.FormerNames, sn)
+
+	// Delete old file (if necessary)
+	if old != "" && isNewName {
+		if tx.meta.FormerNames == nil {
+			tx.meta.FormerNames = make(map[string]string)
+		}
+		tx.meta.FormerNames[old] = idString
+		oldPath := tx.cat.projectRelPath(old)
+		if err := tx.remove(oldPath); err != nil {
+			// Undo the rename.  The new file was created by this put,
+			// so removing it restores the old state.
+			tx.meta.ShortNameMap[idString] = old
+			delete(tx.meta.FormerNames, old)
+			if wasFormer {
+				tx.meta.FormerNames[sn] = formerID
+			}
+			if uerr := tx.cat.fs.Remove(tx.cat.projectPath(sn)); uerr != nil {
+				tx.undoErr = &ProjectError{ShortName: sn, Op: op, Err: uerr}
+			} else {
+				tx.journal[path].exists = false
+			}
+			return &ProjectError{ShortName: sn, Op: op, Err: err}
+		}
+		tx.renamed(oldPath, path)
+	}
+	return nil
+}
+
+func (tx *localTx) DelProject(shortName string) error {
+	const op = "del"
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return errTxDone
+	}
+	if !isValidShortName(shortName) {
+		return shortNameError(shortName)
+	}
+	path := tx.cat.projectRelPath(shortName)
+	proj := new(Project)
+	if err := readJSON(tx.cat.fs, filepath.Join(tx.cat.root, path), proj); os.IsNotExist(err) {
+		return &ProjectError{ShortName: shortName, Op: op, Err: ErrNotFound}
+	} else if err != nil {
+		return &ProjectError{ShortName: shortName, Op: op, Err: err}
+	}
+
+	// Move the project to the trash.  Its attachments stay where they are
+	// until it is purged.
+	if err := tx.cat.fs.Mkdir(filepath.Join(tx.cat.root, trashDir)); err != nil && !tx.cat.fs.IsExist(err) {
+		return &ProjectError{ShortName: shortName, Op: op, Err: err}
+	}
+	tp := trashPath(proj.ID)
+	if err := tx.save(tp); err != nil {
+		return &ProjectError{ShortName: shortName, Op: op, Err: err}
+	}
+	trashed := &TrashedProject{DeleteTime: time.Now(), Project: proj}
+	if err := writeJSON(tx.cat.fs, filepath.Join(tx.cat.root, tp), trashed, false); err != nil {
+		return &ProjectError{ShortName: shortName, Op: op, Err: err}
+	}
+	tx.journal[tp].exists = true
+	if err := tx.remove(path); err != nil {
+		return &ProjectError{ShortName: shortName, Op: op, Err: err}
+	}
+	tx.renamed(path, tp)
+
+	m := tx.meta.ShortNameMap
+	for id, name := range m {
+		if name == shortName {
+			delete(m, id)
+			for former, formerID := range tx.meta.FormerNames {
+				if formerID == id {
+					delete(tx.meta.FormerNames, former)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Trash returns the deleted projects as changed by the transaction so far.
+func (tx *localTx) Trash() ([]*TrashedProject, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return nil, errTxDone
+	}
+	return tx.cat.Trash()
+}
+
+// RestoreProject moves a project from the trash back into the projects
+// directory.
+func (tx *localTx) RestoreProject(id ID, shortName string) error {
+	const op = "restore"
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return errTxDone
+	}
+	tp := trashPath(id)
+	trashed, err := tx.cat.readTrashed(tp)
+	if os.IsNotExist(err) {
+		return &ProjectError{ShortName: id.String(), Op: op, Err: ErrNotFound}
+	} else if err != nil {
+		return &ProjectError{ShortName: id.String(), Op: op, Err: err}
+	}
+	proj := trashed.Project
+	if shortName != "" {
+		proj.ShortName = shortName
+	}
+	if sn := tx.meta.ShortNameMap[id.String()]; sn != "" {
+		return &ProjectError{ShortName: sn, Op: op, Err: errIDInUse}
+	}
+	for _, sn := range tx.meta.ShortNameMap {
+		if sn == proj.ShortName {
+			return &ProjectError{ShortName: sn, Op: op, Err: errShortNameInUse}
+		}
+	}
+	if !isValidShortName(proj.ShortName) {
+		return shortNameError(proj.ShortName)
+	}
+	// The project is restored as it was deleted, even if it no longer
+	// passes the checks that PutProject makes.  Verify reports any
+	// problems, like a missing required field or a purged parent.
+	if err := tx.writeProject(proj, op); err != nil {
+		return err
+	}
+	if err := tx.remove(tp); err != nil {
+		return &ProjectError{ShortName: proj.ShortName, Op: op, Err: err}
+	}
+	tx.renamed(tp, tx.cat.projectRelPath(proj.ShortName))
+	return nil
+}
+
+// PurgeProject removes a project's trash file and attachments.
+func (tx *localTx) PurgeProject(id ID) error {
+	const op = "purge"
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return errTxDone
+	}
+	if err := tx.remove(trashPath(id)); os.IsNotExist(err) {
+		return &ProjectError{ShortName: id.String(), Op: op, Err: ErrNotFound}
+	} else if err != nil {
+		return &ProjectError{ShortName: id.String(), Op: op, Err: err}
+	}
+	if tx.meta.ShortNameMap[id.String()] != "" {
+		// Another copy of the project is in the catalog.
+		return nil
+	}
+	if err := tx.removeAttachments(id); err != nil {
+		return &ProjectError{ShortName: id.String(), Op: op, Err: err}
+	}
+	return nil
+}
+
+// removeAttachments removes every attachment of the project with the given
+// ID.
+func (tx *localTx) removeAttachments(id ID) error {
+	list, err := tx.cat.Attachments(id)
+	if err != nil {
+		return err
+	}
+	for _, a := range list {
+		if err := tx.remove(attachmentPath(id, a.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Hosts returns the host registry as changed by the transaction so far.
+func (tx *localTx) Hosts() (*HostRegistry, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return nil, errTxDone
+	}
+	return tx.hosts.clone(), nil
+}
+
+// PutHosts writes hosts.json.  Projects put later in the transaction are
+// validated against the new registry.
+func (tx *localTx) PutHosts(r *HostRegistry) error {
+	if err := r.Check(); err != nil {
+		return err
+	}
+	r = r.clone()
+	if r.Hosts == nil {
+		r.Hosts = []Host{}
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return errTxDone
+	}
+	if err := tx.save(hostsFile); err != nil {
+		return err
+	}
+	if err := writeJSON(tx.cat.fs, filepath.Join(tx.cat.root, hostsFile), r, false); err != nil {
+		return err
+	}
+	tx.journal[hostsFile].exists = true
+	tx.hosts = r
+	return nil
+}
+
+// Attachments lists the project's attachments as changed by the transaction
+// so far.
+func (tx *localTx) Attachments(id ID) ([]Attachment, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return nil, errTxDone
+	}
+	return tx.cat.Attachments(id)
+}
+
+func (tx *localTx) ReadAttachment(id ID, name string) ([]byte, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return nil, errTxDone
+	}
+	return tx.cat.ReadAttachment(id, name)
+}
+
+// PutAttachment writes an attachment file.  The project must be in the
+// catalog.
+func (tx *localTx) PutAttachment(id ID, name string, data []byte) error {
+	if !IsValidAttachmentName(name) {
+		return &AttachmentError{Name: name, Err: errBadAttachmentName}
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return errTxDone
+	}
+	if tx.meta.ShortNameMap[id.String()] == "" {
+		return &ProjectError{ShortName: id.String(), Op: "attach to", Err: ErrNotFound}
+	}
+	// Directories are not journaled: an empty directory left behind by a
+	// rollback is harmless.
+	for _, dir := range []string{attachmentsDir, attachmentDir(id)} {
+		if err := tx.cat.fs.Mkdir(filepath.Join(tx.cat.root, dir)); err != nil && !tx.cat.fs.IsExist(err) {
+			return &AttachmentError{Name: name, Err: err}
+		}
+	}
+	path := attachmentPath(id, name)
+	if err := tx.save(path); err != nil {
+		return &AttachmentError{Name: name, Err: err}
+	}
+	if err := writeFile(tx.cat.fs, filepath.Join(tx.cat.root, path), data, false); err != nil {
+		return &AttachmentError{Name: name, Err: err}
+	}
+	tx.journal[path].exists = true
+	return nil
+}
+
+// DelAttachment removes an attachment file.
+func (tx *localTx) DelAttachment(id ID, name string) error {
+	if !IsValidAttachmentName(name) {
+		return &AttachmentError{Name: name, Err: errBadAttachmentName}
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return errTxDone
+	}
+	if err := tx.remove(attachmentPath(id, name)); os.IsNotExist(err) {
+		return &AttachmentError{Name: name, Err: ErrNotFound}
+	} else if err != nil {
+		return &AttachmentError{Name: name, Err: err}
+	}
+	return nil
+}
+
+// renamed records that the file at src (relative to the catalog root) was
+// moved to dst, so that commit can tell the working copy.
+func (tx *localTx) renamed(src, dst string) {
+	if s, ok := tx.renames[src]; ok {
+		delete(tx.renames, src)
+		src = s
+	}
+	if src != dst {
+		tx.renames[dst] = src
+	}
+}
+
+// save records the current contents of the file at path (relative to the
+// catalog root) in the journal, unless it has already been saved.
+func (tx *localTx) save(path string) error {
+	if tx.journal[path] != nil {
+		return nil
+	}
+	data, err := readFile(tx.cat.fs, filepath.Join(tx.cat.root, path))
+	if os.IsNotExist(err) {
+		tx.journal[path] = &journalEntry{}
+	} else if err != nil {
+		return err
+	} else {
+		tx.journal[path] = &journalEntry{data: data, existed: true, exists: true}
+	}
+	tx.order = append(tx.order, path)
+	return nil
+}
+
+// remove deletes the file at path (relative to the catalog root).
+func (tx *localTx) remove(path string) error {
+	if err := tx.save(path); err != nil {
+		return err
+	}
+	if err := tx.cat.fs.Remove(filepath.Join(tx.cat.root, path)); err != nil {
+		return err
+	}
+	tx.journal[path].exists = false
+	return nil
+}
+
+// commit writes catalog.json and informs the working copy of any added,
+// removed, or renamed files.  If the transaction did not change anything, then
+// commit returns errNoChange.  On failure, the transaction is rolled back,
+// including any changes already made to the working copy.
+func (tx *localTx) commit() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.undoErr != nil {
+		return tx.rollbackLocked(tx.undoErr)
+	}
+	if len(tx.journal) == 0 {
+		return errNoChange
+	}
+	if err := tx.save(catalogFile); err != nil {
+		return tx.rollbackLocked(err)
+	}
+	if err := writeJSON(tx.cat.fs, filepath.Join(tx.cat.root, catalogFile), tx.meta, false); err != nil {
+		return tx.rollbackLocked(err)
+	}
+	if tx.cat.wc == nil {
+		return nil
+	}
+
+	var added, removed []string
+	for _, path := range tx.order {
+		switch e := tx.journal[path]; {
+		case !e.existed && e.exists:
+			added = append(added, path)
+		case e.existed && !e.exists:
+			removed = append(removed, path)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	var staged, unstaged []string
+	fail := func(err error) error {
+		return tx.unstage(tx.rollbackLocked(err), staged, unstaged)
+	}
+	if len(added) > 0 {
+		if err := tx.cat.wc.Add(added); err != nil {
+			return tx.rollbackLocked(err)
+		}
+		staged = added
+	}
+	if len(removed) > 0 {
+		if err := tx.cat.wc.Remove(removed); err != nil {
+			return fail(err)
+		}
+		unstaged = removed
+	}
+	for _, dst := range added {
+		src, ok := tx.renames[dst]
+		if !ok {
+			continue
+		}
+		if e := tx.journal[src]; e.existed && !e.exists {
+			if err := tx.cat.wc.Rename(src, dst); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	return nil
+}
+
+// unstage undoes the working copy changes of a commit that was rolled back:
+// added files are removed again and removed files are added back.  err is
+// the rollback's result, and paths that can't be undone are added to it as a
+// *RollbackError.
+func (tx *localTx) unstage(err error, added, removed []string) error {
+	var failed []string
+	if len(added) > 0 && tx.cat.wc.Remove(added) != nil {
+		failed = append(failed, added...)
+	}
+	if len(removed) > 0 && tx.cat.wc.Add(removed) != nil {
+		failed = append(failed, removed...)
+	}
+	if len(failed) == 0 {
+		return err
+	}
+	rerr, ok := err.(*RollbackError)
+	if !ok {
+		rerr = &RollbackError{Err: err}
+	}
+	rerr.Files = append(rerr.Files, failed...)
+	sort.Strings(rerr.Files)
+	return rerr
+}
+
+// rollback restores every file in the journal to its original contents and
+// returns err.  If a file cannot be restored, a *RollbackError is returned.
+func (tx *localTx) rollback(err error) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	return tx.rollbackLocked(err)
+}
+
+func (tx *localTx) rollbackLocked(err error) error {
+	tx.done = true
+	var failed []string
+	for i := len(tx.order) - 1; i >= 0; i-- {
+		path := tx.order[i]
+		e := tx.journal[path]
+		fullPath := filepath.Join(tx.cat.root, path)
+		var rerr error
+		if e.existed {
+			rerr = writeFile(tx.cat.fs, fullPath, e.data, false)
+		} else if e.exists {
+			rerr = tx.cat.fs.Remove(fullPath)
+		}
+		if rerr != nil {
+			failed = append(failed, path)
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return &RollbackError{Err: err, Files: failed}
+	}
+	return err
+}
+
+// A RollbackError is returned from a batch when the batch failed and some
+// files could not be restored to their original contents or version control
+// state.  The catalog should be checked with verify.
+type RollbackError struct {
+	Err error
+
+	// Files is the list of paths (relative to the catalog root) that could
+	// not be restored.
+	Files []string
+}
+
+func (e *RollbackError) Error() string {
+	msg := e.Err.Error() + " (rollback failed for"
+	for _, f := range e.Files {
+		msg += " " + f
+	}
+	return msg + ")"
+}
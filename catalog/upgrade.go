@@ -0,0 +1,269 @@
+package catalog
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"bitbucket.org/zombiezen/blackforest/vcs"
+)
+
+// Version is the catalog format version that this package reads and writes.
+const Version = 3
+
+// A migration upgrades a catalog from one format version to the next.
+type migration struct {
+	// Description is a short summary of the change.  It is used in the
+	// commit message for the step.
+	Description string
+
+	// Func rewrites the catalog's files.  It is called with the catalog
+	// locked, and it must not change version.json.
+	Func func(cat *localCatalog) error
+}
+
+// migrations is the registry of upgrade steps.  migrations[i] upgrades a
+// catalog from version i+1 to version i+2, so len(migrations) must always be
+// Version-1.
+var migrations = []migration{
+	{
+		Description: "reformat files as indented JSON",
+		Func:        reformatFiles,
+	},
+	{
+		Description: "move VCS information into remotes",
+		Func:        convertVCSToRemotes,
+	},
+}
+
+// reformatFiles rewrites catalog.json and the project files in the canonical
+// format written by marshalJSON.
+func reformatFiles(cat *localCatalog) error {
+	meta, err := cat.readCatalogMeta()
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(cat.fs, filepath.Join(cat.root, catalogFile), meta, false); err != nil {
+		return err
+	}
+	names, err := cat.projectFiles()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		path := filepath.Join(cat.root, projectsDir, name)
+		proj := &v2Project{Project: new(Project)}
+		if err := readJSON(cat.fs, path, proj); err != nil {
+			return &ProjectError{ShortName: name[:len(name)-len(jsonExt)], Op: "reformat", Err: err}
+		}
+		sort.Strings(proj.Tags)
+		if err := writeJSON(cat.fs, path, proj, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// v2Project is a project file from a catalog before version 3, which had a
+// single "vcs" object instead of a list of remotes.  Migrations to versions
+// before 3 must read project files as v2Project so that they keep it.
+type v2Project struct {
+	*Project
+	VCS *struct {
+		Type string `json:"type"`
+		URL  string `json:"url,omitempty"`
+	} `json:"vcs,omitempty"`
+}
+
+// convert returns the project with its "vcs" object, if any, replaced by a
+// primary remote named DefaultRemoteName.
+func (old *v2Project) convert() *Project {
+	proj := old.Project
+	if old.VCS != nil {
+		primary := Remote{Name: DefaultRemoteName, Role: RolePrimary, Type: old.VCS.Type, URL: old.VCS.URL}
+		proj.Remotes = append([]Remote{primary}, proj.Remotes...)
+	}
+	return proj
+}
+
+// convertVCSToRemotes replaces the single "vcs" object of each project with a
+// primary remote named DefaultRemoteName.
+func convertVCSToRemotes(cat *localCatalog) error {
+	names, err := cat.projectFiles()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		path := filepath.Join(cat.root, projectsDir, name)
+		old := &v2Project{Project: new(Project)}
+		if err := readJSON(cat.fs, path, old); err != nil {
+			return &ProjectError{ShortName: name[:len(name)-len(jsonExt)], Op: "convert", Err: err}
+		}
+		if old.VCS == nil {
+			continue
+		}
+		if err := writeJSON(cat.fs, path, old.convert(), false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecodeProject reads a project record, like one written by an export, from
+// r.  Records from before catalog version 3 have their "vcs" object converted
+// to a primary remote, the same way that Upgrade converts a catalog.
+func DecodeProject(r io.Reader) (*Project, error) {
+	old := &v2Project{Project: new(Project)}
+	if err := json.NewDecoder(r).Decode(old); err != nil {
+		return nil, err
+	}
+	return old.convert(), nil
+}
+
+// An UpgradeStep describes a single version change made by Upgrade.
+type UpgradeStep struct {
+	From        int
+	To          int
+	Description string
+
+	// Files is the sorted list of paths (relative to the catalog root) that
+	// the step created, modified, or removed.
+	Files []string
+}
+
+// Upgrade migrates the catalog at root to the current Version, one version at
+// a time.  If vc is not nil, then each step is committed to the catalog's
+// working copy as a separate changeset.  If dryRun is true, then the steps are
+// computed without modifying the catalog.  The steps that were (or would be)
+// performed are returned, even if an error occurs.
+func Upgrade(root string, vc vcs.VCS, dryRun bool) ([]UpgradeStep, error) {
+	return UpgradeWithOptions(root, vc, dryRun, nil)
+}
+
+// UpgradeWithOptions migrates the catalog at root like Upgrade, but opts
+// controls how the catalog is locked during each step.  A nil opts is the
+// same as the zero Options.
+func UpgradeWithOptions(root string, vc vcs.VCS, dryRun bool, opts *Options) ([]UpgradeStep, error) {
+	cat := &localCatalog{root: root, fs: realFilesystem{}}
+	if opts != nil {
+		cat.opts = *opts
+	}
+	if vc != nil && !dryRun {
+		wc, err := vc.WorkingCopy(root)
+		if err != nil {
+			return nil, err
+		}
+		cat.wc = wc
+	}
+	return upgrade(cat, migrations, dryRun)
+}
+
+func upgrade(cat *localCatalog, steps []migration, dryRun bool) ([]UpgradeStep, error) {
+	v, err := readVersion(cat.fs, cat.root)
+	if err != nil {
+		return nil, err
+	}
+	target := len(steps) + 1
+	if v < 1 || v > target {
+		return nil, VersionError(v)
+	}
+
+	fs, wc := cat.fs, cat.wc
+	if dryRun {
+		fs, wc = newOverlayFilesystem(fs), nil
+	}
+	var done []UpgradeStep
+	for ; v < target; v++ {
+		m := steps[v-1]
+		rec := &recordingFilesystem{filesystem: fs, root: cat.root, changed: make(map[string]struct{})}
+		c := &localCatalog{root: cat.root, fs: rec, wc: wc, opts: cat.opts}
+		message := "upgrade catalog to version " + strconv.Itoa(v+1) + ": " + m.Description
+		err := c.doChange(message, func() error {
+			if err := m.Func(c); err != nil {
+				return err
+			}
+			return writeVersion(c.fs, c.root, v+1, false)
+		})
+		done = append(done, UpgradeStep{
+			From:        v,
+			To:          v + 1,
+			Description: m.Description,
+			Files:       rec.Changed(),
+		})
+		if err != nil {
+			return done, &upgradeError{From: v, To: v + 1, Err: err}
+		}
+	}
+	return done, nil
+}
+
+// upgradeError is returned when a step of an upgrade fails.
+type upgradeError struct {
+	From int
+	To   int
+	Err  error
+}
+
+func (e *upgradeError) Error() string {
+	return "catalog: upgrade from version " + strconv.Itoa(e.From) + " to " + strconv.Itoa(e.To) + ": " + e.Err.Error()
+}
+
+// recordingFilesystem is a filesystem that keeps track of the paths that have
+// been modified, excluding the catalog lock and its break marker.
+type recordingFilesystem struct {
+	filesystem
+	root    string
+	changed map[string]struct{}
+}
+
+func (rfs *recordingFilesystem) record(path string) {
+	rel, err := filepath.Rel(rfs.root, path)
+	if err != nil || rel == lockFile || rel == lockFile+breakSuffix {
+		return
+	}
+	rfs.changed[filepath.ToSlash(rel)] = struct{}{}
+}
+
+func (rfs *recordingFilesystem) Create(path string, excl bool) (file, error) {
+	f, err := rfs.filesystem.Create(path, excl)
+	if err == nil {
+		rfs.record(path)
+	}
+	return f, err
+}
+
+func (rfs *recordingFilesystem) Remove(path string) error {
+	err := rfs.filesystem.Remove(path)
+	if err == nil {
+		rfs.record(path)
+	}
+	return err
+}
+
+func (rfs *recordingFilesystem) Rename(oldpath, newpath string) error {
+	err := rfs.filesystem.Rename(oldpath, newpath)
+	if err == nil {
+		rfs.record(newpath)
+	}
+	return err
+}
+
+func (rfs *recordingFilesystem) Mkdir(path string) error {
+	err := rfs.filesystem.Mkdir(path)
+	if err == nil {
+		rfs.record(path)
+	}
+	return err
+}
+
+// Changed returns the sorted list of changed paths, relative to the root.
+func (rfs *recordingFilesystem) Changed() []string {
+	paths := make([]string, 0, len(rfs.changed))
+	for p := range rfs.changed {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
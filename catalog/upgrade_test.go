@@ -0,0 +1,237 @@
+package catalog
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMigrationRegistry(t *testing.T) {
+	if n := len(migrations); n != Version-1 {
+		t.Errorf("len(migrations) = %d; want %d", n, Version-1)
+	}
+}
+
+var testMigrations = []migration{
+	{
+		Description: "add notes",
+		Func: func(cat *localCatalog) error {
+			return writeJSON(cat.fs, filepath.Join(cat.root, "notes.json"), []string{}, true)
+		},
+	},
+	{
+		Description: "remove notes",
+		Func: func(cat *localCatalog) error {
+			return cat.fs.Remove(filepath.Join(cat.root, "notes.json"))
+		},
+	},
+}
+
+func TestUpgrade(t *testing.T) {
+	cat, fs, wc := newTestCatalog()
+	steps, err := upgrade(cat, testMigrations, false)
+	if err != nil {
+		t.Error("upgrade error:", err)
+	}
+	want := []UpgradeStep{
+		{From: 1, To: 2, Description: "add notes", Files: []string{"notes.json", "version.json"}},
+		{From: 2, To: 3, Description: "remove notes", Files: []string{"notes.json", "version.json"}},
+	}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("upgrade steps = %+v; want %+v", steps, want)
+	}
+	if v, err := readVersion(fs, cat.root); err != nil {
+		t.Error("readVersion error:", err)
+	} else if v != 3 {
+		t.Errorf("version = %d; want 3", v)
+	}
+	if _, ok := fs.files[filepath.Join(cat.root, "notes.json")]; ok {
+		t.Error("notes.json still exists")
+	}
+	if _, ok := fs.files[filepath.Join(cat.root, lockFile)]; ok {
+		t.Error("catalog still locked")
+	}
+	if !wc.committed {
+		t.Error("vcs not committed")
+	}
+}
+
+func TestUpgrade_StaleLock(t *testing.T) {
+	cat, fs, _ := newTestCatalog()
+	// An empty lock, like one left by an older version, dated by the mock
+	// filesystem's zero modification time.
+	fs.makeFile(cat.lockPath(), "")
+	_, err := upgrade(cat, testMigrations, false)
+	if uerr, ok := err.(*upgradeError); !ok || uerr.Err != ErrLocked {
+		t.Fatalf("upgrade with stale lock error = %v; want %v", err, ErrLocked)
+	}
+
+	cat.opts = Options{BreakStaleLocks: true, StaleLockAge: time.Hour}
+	if _, err := upgrade(cat, testMigrations, false); err != nil {
+		t.Error("upgrade breaking stale lock error:", err)
+	}
+	if v, err := readVersion(fs, cat.root); err != nil || v != 3 {
+		t.Errorf("version = %d, %v; want 3, <nil>", v, err)
+	}
+}
+
+func TestUpgradeDryRun(t *testing.T) {
+	cat, fs, wc := newTestCatalog()
+	steps, err := upgrade(cat, testMigrations[:1], true)
+	if err != nil {
+		t.Error("upgrade error:", err)
+	}
+	want := []UpgradeStep{
+		{From: 1, To: 2, Description: "add notes", Files: []string{"notes.json", "version.json"}},
+	}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("upgrade steps = %+v; want %+v", steps, want)
+	}
+	if v, err := readVersion(fs, cat.root); err != nil {
+		t.Error("readVersion error:", err)
+	} else if v != 1 {
+		t.Errorf("version = %d; want 1", v)
+	}
+	if _, ok := fs.files[filepath.Join(cat.root, "notes.json")]; ok {
+		t.Error("notes.json created during dry run")
+	}
+	if wc.committed {
+		t.Error("vcs committed during dry run")
+	}
+}
+
+func TestUpgradeCurrent(t *testing.T) {
+	cat, _, wc := newTestCatalog()
+	steps, err := upgrade(cat, nil, false)
+	if err != nil {
+		t.Error("upgrade error:", err)
+	}
+	if len(steps) != 0 {
+		t.Errorf("upgrade steps = %+v; want []", steps)
+	}
+	if wc.committed {
+		t.Error("vcs committed")
+	}
+}
+
+func TestUpgradeTooNew(t *testing.T) {
+	cat, fs, _ := newTestCatalog()
+	fs.makeFile(filepath.Join(cat.root, versionFile), `{"version": 5}`)
+	_, err := upgrade(cat, testMigrations, false)
+	if err != VersionError(5) {
+		t.Errorf("upgrade error = %v; want %v", err, VersionError(5))
+	}
+}
+
+func TestReformatFiles(t *testing.T) {
+	cat, fs, _ := newTestCatalog()
+	if err := reformatFiles(cat); err != nil {
+		t.Fatal("reformatFiles error:", err)
+	}
+	for _, path := range []string{catalogFile, filepath.Join(projectsDir, "blackforest.json")} {
+		data := fs.files[filepath.Join(cat.root, path)]
+		var v interface{}
+		if path == catalogFile {
+			v = new(catalogMeta)
+		} else {
+			v = new(Project)
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		want, _ := marshalJSON(v)
+		if string(data) != string(want) {
+			t.Errorf("%s contents = %q; want %q", path, data, want)
+		}
+	}
+}
+
+func TestReformatFiles_BadProject(t *testing.T) {
+	cat, fs, _ := newTestCatalog()
+	fs.makeFile(filepath.Join(cat.root, projectsDir, "bad.json"), "{")
+	if err := reformatFiles(cat); err == nil {
+		t.Error("reformatFiles succeeded on malformed project file")
+	}
+}
+
+func TestReformatFiles_KeepsVCS(t *testing.T) {
+	cat, fs, _ := newTestCatalog()
+	path := filepath.Join(cat.root, projectsDir, "blackforest.json")
+	fs.makeFile(path, `{"id": "b11dzGs4SQid", "shortname": "blackforest", "vcs": {"type": "hg", "url": "https://example.com/hg"}}`)
+	if err := reformatFiles(cat); err != nil {
+		t.Fatal("reformatFiles error:", err)
+	}
+	var v struct {
+		VCS map[string]string `json:"vcs"`
+	}
+	if err := json.Unmarshal(fs.files[path], &v); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"type": "hg", "url": "https://example.com/hg"}; !reflect.DeepEqual(v.VCS, want) {
+		t.Errorf("vcs after reformat = %v; want %v", v.VCS, want)
+	}
+}
+
+func TestConvertVCSToRemotes(t *testing.T) {
+	cat, fs, _ := newTestCatalog()
+	path := filepath.Join(cat.root, projectsDir, "blackforest.json")
+	fs.makeFile(path, `{"id": "b11dzGs4SQid", "shortname": "blackforest", "vcs": {"type": "hg", "url": "https://example.com/hg"}}`)
+	fs.makeFile(filepath.Join(cat.root, projectsDir, "novcs.json"), `{"id": "AQAAAAAAAAAA", "shortname": "novcs"}`)
+	if err := convertVCSToRemotes(cat); err != nil {
+		t.Fatal("convertVCSToRemotes error:", err)
+	}
+
+	data := fs.files[path]
+	var v map[string]interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v["vcs"]; ok {
+		t.Error("vcs key still in project file")
+	}
+	proj := new(Project)
+	if err := json.Unmarshal(data, proj); err != nil {
+		t.Fatal(err)
+	}
+	want := []Remote{{Name: DefaultRemoteName, Role: RolePrimary, Type: "hg", URL: "https://example.com/hg"}}
+	if !reflect.DeepEqual(proj.Remotes, want) {
+		t.Errorf("proj.Remotes = %+v; want %+v", proj.Remotes, want)
+	}
+	if got := string(fs.files[filepath.Join(cat.root, projectsDir, "novcs.json")]); got != `{"id": "AQAAAAAAAAAA", "shortname": "novcs"}` {
+		t.Errorf("novcs.json = %q; want unchanged", got)
+	}
+}
+
+func TestDecodeProject(t *testing.T) {
+	tests := []struct {
+		record  string
+		remotes []Remote
+	}{
+		{
+			`{"id": "b11dzGs4SQid", "shortname": "blackforest", "vcs": {"type": "hg", "url": "https://example.com/hg"}}`,
+			[]Remote{{Name: DefaultRemoteName, Role: RolePrimary, Type: "hg", URL: "https://example.com/hg"}},
+		},
+		{
+			`{"id": "b11dzGs4SQid", "shortname": "blackforest", "remotes": [{"name": "gh", "role": "mirror", "type": "git", "url": "https://example.com/git"}]}`,
+			[]Remote{{Name: "gh", Role: RoleMirror, Type: "git", URL: "https://example.com/git"}},
+		},
+		{
+			`{"id": "b11dzGs4SQid", "shortname": "blackforest"}`,
+			nil,
+		},
+	}
+	for _, test := range tests {
+		proj, err := DecodeProject(strings.NewReader(test.record))
+		if err != nil {
+			t.Errorf("DecodeProject(%s) error: %v", test.record, err)
+			continue
+		}
+		if proj.ShortName != "blackforest" || !reflect.DeepEqual(proj.Remotes, test.remotes) {
+			t.Errorf("DecodeProject(%s) = %+v; want short name blackforest with remotes %+v", test.record, proj, test.remotes)
+		}
+	}
+}
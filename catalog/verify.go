@@ -0,0 +1,637 @@
+package catalog
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"bitbucket.org/zombiezen/blackforest/vcs"
+)
+
+// A ProblemKind identifies the sort of inconsistency described by a Problem.
+type ProblemKind int
+
+// Problem kinds
+const (
+	// IDConflict is reported when more than one project has the same ID.
+	IDConflict ProblemKind = iota + 1
+
+	// MissingIDMapping is reported when a project's ID is not in catalog.json.
+	MissingIDMapping
+
+	// WrongIDMapping is reported when catalog.json maps a project's ID to
+	// another short name.
+	WrongIDMapping
+
+	// ExtraIDMapping is reported when catalog.json has an ID that no project
+	// uses.
+	ExtraIDMapping
+
+	// StaleFormerName is reported when catalog.json remembers a former short
+	// name that is in use again or that belongs to a deleted project.
+	StaleFormerName
+
+	// BadCatalogFile is reported when catalog.json cannot be parsed.
+	BadCatalogFile
+
+	// OrphanedLock is reported when the catalog is locked by a process that
+	// is no longer running.
+	OrphanedLock
+
+	// BadFileName is reported when a project file's name is not a valid short
+	// name.
+	BadFileName
+
+	// BadProject is reported when a project file cannot be parsed.
+	BadProject
+
+	// ShortNameMismatch is reported when a project's ShortName does not match
+	// its file name.
+	ShortNameMismatch
+
+	// UntrackedFile is reported when a catalog file is not tracked by the
+	// catalog's working copy.
+	UntrackedFile
+
+	// InvalidFields is reported when a project's custom fields do not
+	// conform to the catalog's field schema.
+	InvalidFields
+
+	// DanglingLink is reported when a project links to an ID that no
+	// project uses, or when a subproject's parent is not in the catalog.
+	DanglingLink
+
+	// UnknownHost is reported when a project has information for a host
+	// that is not in the catalog's host registry.
+	UnknownHost
+
+	// OrphanedAttachments is reported when the catalog has attachments for
+	// an ID that no project, in the catalog or in the trash, uses.
+	OrphanedAttachments
+
+	// InvalidStatus is reported when a project's status, or a status in
+	// its history, is not one of the defined statuses.
+	InvalidStatus
+)
+
+var problemKindNames = [...]string{
+	IDConflict:          "ID conflict",
+	MissingIDMapping:    "missing ID mapping",
+	WrongIDMapping:      "wrong ID mapping",
+	ExtraIDMapping:      "extra ID mapping",
+	StaleFormerName:     "stale former name",
+	BadCatalogFile:      "bad catalog file",
+	OrphanedLock:        "orphaned lock",
+	BadFileName:         "bad file name",
+	BadProject:          "bad project",
+	ShortNameMismatch:   "short name mismatch",
+	UntrackedFile:       "untracked file",
+	InvalidFields:       "invalid fields",
+	DanglingLink:        "dangling link",
+	UnknownHost:         "unknown host",
+	OrphanedAttachments: "orphaned attachments",
+	InvalidStatus:       "invalid status",
+}
+
+func (k ProblemKind) String() string {
+	if k > 0 && int(k) < len(problemKindNames) {
+		return problemKindNames[k]
+	}
+	return "ProblemKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// A Problem is an inconsistency found in a catalog.
+type Problem struct {
+	Kind ProblemKind
+
+	// Path is the file with the problem, relative to the catalog root.  It
+	// is empty if the problem is not with a particular file.
+	Path string
+
+	// Message describes the problem.
+	Message string
+
+	// Fixed is set by Repair if the problem was corrected.
+	Fixed bool
+}
+
+func (p Problem) String() string {
+	s := p.Kind.String() + ": " + p.Message
+	if p.Path != "" {
+		s = p.Path + ": " + s
+	}
+	if p.Fixed {
+		s += " (fixed)"
+	}
+	return s
+}
+
+// A verifier is a catalog that can check and repair its storage.
+type verifier interface {
+	verify(fix bool) ([]Problem, error)
+}
+
+// Verify checks a catalog for problems.  Catalogs created with Open, Create
+// or NewMemory are checked thoroughly; other catalogs are only checked for
+// problems that are visible through the Catalog interface.
+func Verify(cat Catalog) ([]Problem, error) {
+	if v, ok := cat.(verifier); ok {
+		return v.verify(false)
+	}
+	return verifyCatalog(cat)
+}
+
+// Repair checks a catalog for problems like Verify and fixes the problems
+// that it can, as a single change.  id_to_shortname is rebuilt from the
+// project files, stale former names and orphaned locks are removed, project
+// short names are made to match their file names, and untracked files are
+// added to the catalog's working copy.  The problems found are returned with
+// Fixed set on those that were corrected.  Only catalogs created with Open,
+// Create or NewMemory can be repaired.
+func Repair(cat Catalog) ([]Problem, error) {
+	if v, ok := cat.(verifier); ok {
+		return v.verify(true)
+	}
+	return verifyCatalog(cat)
+}
+
+// verifyCatalog checks a catalog through the Catalog interface.
+func verifyCatalog(cat Catalog) ([]Problem, error) {
+	names, err := cat.List()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	hosts, err := GetHosts(cat)
+	if err != nil {
+		return nil, err
+	}
+	var problems []Problem
+	byID := make(map[ID]string, len(names))
+	var linked []*Project
+	for _, sn := range names {
+		p, err := cat.GetProject(sn)
+		if err != nil {
+			problems = append(problems, Problem{Kind: BadProject, Message: err.Error()})
+			continue
+		}
+		if len(p.Links) > 0 || p.Parent != nil {
+			linked = append(linked, p)
+		}
+		if err := checkStatus(p); err != nil {
+			problems = append(problems, Problem{Kind: InvalidStatus, Message: sn + ": " + err.Error()})
+		}
+		if err := hosts.Validate(p); err != nil {
+			problems = append(problems, Problem{Kind: UnknownHost, Message: sn + ": " + err.Error()})
+		}
+		if p.ShortName != sn {
+			problems = append(problems, Problem{
+				Kind:    ShortNameMismatch,
+				Message: "project listed as " + sn + " has short name " + p.ShortName,
+			})
+		}
+		if other, ok := byID[p.ID]; ok {
+			problems = append(problems, Problem{
+				Kind:    IDConflict,
+				Message: "ID " + p.ID.String() + " used for " + other + " and " + sn,
+			})
+			continue
+		}
+		byID[p.ID] = sn
+		if actual, err := cat.ShortName(p.ID); err != nil {
+			return nil, err
+		} else if actual != sn {
+			problems = append(problems, Problem{
+				Kind:    WrongIDMapping,
+				Message: "expected ID " + p.ID.String() + " -> " + sn + ", but found " + strconv.Quote(actual),
+			})
+		}
+	}
+	for _, p := range linked {
+		for _, l := range p.Links {
+			if _, ok := byID[l.Target]; !ok {
+				problems = append(problems, Problem{Kind: DanglingLink, Message: danglingLinkMessage(p.ShortName, l)})
+			}
+		}
+		if p.Parent != nil {
+			if _, ok := byID[p.Parent.ID]; !ok {
+				problems = append(problems, Problem{Kind: DanglingLink, Message: danglingParentMessage(p.ShortName, p.Parent.ID)})
+			}
+		}
+	}
+	return problems, nil
+}
+
+func danglingLinkMessage(shortName string, l Link) string {
+	return shortName + " " + string(l.Type) + " " + l.Target.String() + ", which is not in the catalog"
+}
+
+func danglingParentMessage(shortName string, parent ID) string {
+	return shortName + " is a subproject of " + parent.String() + ", which is not in the catalog"
+}
+
+func (cat *localCatalog) verify(fix bool) ([]Problem, error) {
+	var problems []Problem
+	if info, err := readLock(cat.fs, cat.lockPath()); err == nil && cat.isStale(info) {
+		p := Problem{
+			Kind:    OrphanedLock,
+			Path:    lockFile,
+			Message: "locked by " + info.String() + ", which is no longer running",
+		}
+		if fix {
+			if err := breakLock(cat.fs, cat.lockPath(), info); err != nil {
+				return nil, err
+			}
+			p.Fixed = true
+		}
+		problems = append(problems, p)
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	mark := cat.lockPath() + breakSuffix
+	if info, err := readLock(cat.fs, mark); err == nil && cat.isStale(info) {
+		p := Problem{
+			Kind:    OrphanedLock,
+			Path:    lockFile + breakSuffix,
+			Message: "lock being broken by " + info.String() + ", which is no longer running",
+		}
+		if fix {
+			if err := cat.fs.Remove(mark); err != nil {
+				return nil, err
+			}
+			p.Fixed = true
+		}
+		problems = append(problems, p)
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var found []Problem
+	if !fix {
+		var err error
+		found, err = cat.check(false)
+		if err != nil {
+			return nil, err
+		}
+		return append(problems, found...), nil
+	}
+	err := cat.doChange("repair catalog", func() error {
+		var err error
+		found, err = cat.check(true)
+		if err != nil {
+			return err
+		}
+		for _, p := range found {
+			if p.Fixed {
+				return nil
+			}
+		}
+		return errNoChange
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(problems, found...), nil
+}
+
+// check looks for problems in the catalog's files.  If fix is true, the
+// catalog must be locked.
+func (cat *localCatalog) check(fix bool) ([]Problem, error) {
+	var problems []Problem
+	metaChanged := false
+	meta, err := cat.readCatalogMeta()
+	if isJSONError(err) {
+		problems = append(problems, Problem{Kind: BadCatalogFile, Path: catalogFile, Message: err.Error(), Fixed: fix})
+		meta = &catalogMeta{ShortNameMap: make(map[string]string)}
+		metaChanged = true
+	} else if err != nil {
+		return nil, err
+	}
+
+	schema, err := cat.Schema()
+	if isJSONError(err) {
+		problems = append(problems, Problem{Kind: BadCatalogFile, Path: fieldsFile, Message: err.Error()})
+		schema = nil
+	} else if err != nil {
+		return nil, err
+	}
+	hosts, err := cat.Hosts()
+	if isJSONError(err) {
+		problems = append(problems, Problem{Kind: BadCatalogFile, Path: hostsFile, Message: err.Error()})
+		hosts = new(HostRegistry)
+	} else if err != nil {
+		return nil, err
+	}
+
+	files, err := cat.projectFiles()
+	if err != nil {
+		return nil, err
+	}
+	ideal := make(map[string][]string) // ID -> short names
+	links := make(map[string][]Link)   // path -> links
+	parents := make(map[string]ID)     // path -> parent
+	unreadable := make(map[string]bool)
+	for _, name := range files {
+		path := filepath.Join(projectsDir, name)
+		sn := name[:len(name)-len(jsonExt)]
+		if !isValidShortName(sn) {
+			problems = append(problems, Problem{Kind: BadFileName, Path: path, Message: strconv.Quote(sn) + " is not a valid short name"})
+			unreadable[sn] = true
+			continue
+		}
+		proj := new(Project)
+		if err := readJSON(cat.fs, filepath.Join(cat.root, path), proj); isJSONError(err) {
+			problems = append(problems, Problem{Kind: BadProject, Path: path, Message: err.Error()})
+			unreadable[sn] = true
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if proj.ShortName != sn {
+			p := Problem{Kind: ShortNameMismatch, Path: path, Message: "project has short name " + strconv.Quote(proj.ShortName)}
+			if fix {
+				proj.ShortName = sn
+				if err := writeJSON(cat.fs, filepath.Join(cat.root, path), proj, false); err != nil {
+					return nil, err
+				}
+				p.Fixed = true
+			}
+			problems = append(problems, p)
+		}
+		if schema != nil {
+			if err := schema.Validate(proj); err != nil {
+				problems = append(problems, Problem{Kind: InvalidFields, Path: path, Message: err.Error()})
+			}
+		}
+		if err := checkStatus(proj); err != nil {
+			problems = append(problems, Problem{Kind: InvalidStatus, Path: path, Message: err.Error()})
+		}
+		if err := hosts.Validate(proj); err != nil {
+			problems = append(problems, Problem{Kind: UnknownHost, Path: path, Message: err.Error()})
+		}
+		if len(proj.Links) > 0 {
+			links[path] = proj.Links
+		}
+		if proj.Parent != nil {
+			parents[path] = proj.Parent.ID
+		}
+		idString := proj.ID.String()
+		ideal[idString] = append(ideal[idString], sn)
+	}
+	// A project whose file can't be read (like one with merge conflict
+	// markers) keeps its ID mapping, so that fixing the rest of the catalog
+	// doesn't drop it.
+	kept := make(map[string]string) // ID -> short name
+	for idString, sn := range meta.ShortNameMap {
+		if _, ok := ideal[idString]; !ok && unreadable[sn] {
+			kept[idString] = sn
+		}
+	}
+	known := func(idString string) bool {
+		_, inIdeal := ideal[idString]
+		_, inKept := kept[idString]
+		return inIdeal || inKept
+	}
+	for path, ls := range links {
+		sn := filepath.Base(path)
+		sn = sn[:len(sn)-len(jsonExt)]
+		for _, l := range ls {
+			if !known(l.Target.String()) {
+				problems = append(problems, Problem{Kind: DanglingLink, Path: path, Message: danglingLinkMessage(sn, l)})
+			}
+		}
+	}
+	for path, id := range parents {
+		if !known(id.String()) {
+			sn := filepath.Base(path)
+			sn = sn[:len(sn)-len(jsonExt)]
+			problems = append(problems, Problem{Kind: DanglingLink, Path: path, Message: danglingParentMessage(sn, id)})
+		}
+	}
+
+	trashFiles, err := cat.trashFiles()
+	if err != nil {
+		return nil, err
+	}
+	trashed := make(map[string]bool, len(trashFiles))
+	for _, name := range trashFiles {
+		path := filepath.Join(trashDir, name)
+		tp, err := cat.readTrashed(path)
+		if isJSONError(err) || err == errTrashIDMismatch {
+			problems = append(problems, Problem{Kind: BadProject, Path: path, Message: err.Error()})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		trashed[tp.Project.ID.String()] = true
+	}
+	orphans, err := cat.orphanedAttachments(func(idString string) bool {
+		return known(idString) || trashed[idString]
+	})
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, orphans...)
+
+	// Rebuild the ID map.
+	newMap := make(map[string]string, len(ideal)+len(kept))
+	for idString, sn := range kept {
+		newMap[idString] = sn
+	}
+	for idString, names := range ideal {
+		if len(names) > 1 {
+			problems = append(problems, Problem{
+				Kind:    IDConflict,
+				Message: "ID " + idString + " used for " + strings.Join(names, ", "),
+			})
+			// Keep the current mapping if it's one of the candidates.
+			newMap[idString] = names[0]
+			for _, sn := range names {
+				if sn == meta.ShortNameMap[idString] {
+					newMap[idString] = sn
+				}
+			}
+			continue
+		}
+		sn := names[0]
+		newMap[idString] = sn
+		actual, ok := meta.ShortNameMap[idString]
+		if !ok || actual != sn {
+			metaChanged = true
+		}
+		if !ok {
+			problems = append(problems, Problem{
+				Kind:    MissingIDMapping,
+				Path:    catalogFile,
+				Message: "expected ID " + idString + " -> " + sn + ", but no entry was found",
+				Fixed:   fix,
+			})
+		} else if actual != sn {
+			problems = append(problems, Problem{
+				Kind:    WrongIDMapping,
+				Path:    catalogFile,
+				Message: "expected ID " + idString + " -> " + sn + ", but found " + actual,
+				Fixed:   fix,
+			})
+		}
+	}
+	for idString, sn := range meta.ShortNameMap {
+		if !known(idString) {
+			metaChanged = true
+			problems = append(problems, Problem{
+				Kind:    ExtraIDMapping,
+				Path:    catalogFile,
+				Message: "found extra ID mapping " + idString + " -> " + sn,
+				Fixed:   fix,
+			})
+		}
+	}
+	current := make(map[string]bool, len(newMap))
+	for _, sn := range newMap {
+		current[sn] = true
+	}
+	for former, idString := range meta.FormerNames {
+		if _, ok := newMap[idString]; !ok || current[former] {
+			problems = append(problems, Problem{
+				Kind:    StaleFormerName,
+				Path:    catalogFile,
+				Message: "former name " + former + " -> " + idString + " no longer applies",
+				Fixed:   fix,
+			})
+			delete(meta.FormerNames, former)
+			metaChanged = true
+		}
+	}
+
+	if wc, ok := cat.wc.(vcs.UntrackedLister); ok {
+		paths := []string{versionFile, catalogFile, projectsDir}
+		for _, dir := range []string{attachmentsDir, trashDir} {
+			if f, err := cat.fs.Open(filepath.Join(cat.root, dir)); err == nil {
+				f.Close()
+				paths = append(paths, dir)
+			}
+		}
+		untracked, err := wc.Untracked(paths)
+		if err != nil {
+			return nil, err
+		}
+		var add []string
+		for _, path := range untracked {
+			isAttachment := strings.HasPrefix(path, attachmentsDir+string(filepath.Separator))
+			if !strings.HasSuffix(path, jsonExt) && !isAttachment || strings.HasPrefix(filepath.Base(path), ".") {
+				// Not a catalog file.
+				continue
+			}
+			add = append(add, path)
+			problems = append(problems, Problem{Kind: UntrackedFile, Path: path, Message: "not tracked by version control", Fixed: fix})
+		}
+		if fix && len(add) > 0 {
+			if err := wc.Add(add); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if fix && metaChanged {
+		meta.ShortNameMap = newMap
+		if err := writeJSON(cat.fs, filepath.Join(cat.root, catalogFile), meta, false); err != nil {
+			return nil, err
+		}
+	}
+	sort.Sort(byProblem(problems))
+	return problems, nil
+}
+
+// orphanedAttachments reports the attachment directories whose IDs are not
+// known.  Empty directories are ignored, since they are not tracked by
+// version control.
+func (cat *localCatalog) orphanedAttachments(known func(idString string) bool) ([]Problem, error) {
+	dir, err := cat.fs.Open(filepath.Join(cat.root, attachmentsDir))
+	if cat.fs.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	var problems []Problem
+	for {
+		entries, err := dir.Readdir(100)
+		for _, ent := range entries {
+			name := ent.Name()
+			if known(name) || !ent.IsDir() {
+				continue
+			}
+			path := filepath.Join(attachmentsDir, name)
+			list, lerr := readAttachments(cat.fs, filepath.Join(cat.root, path))
+			if lerr != nil {
+				return nil, lerr
+			}
+			if len(list) > 0 {
+				problems = append(problems, Problem{
+					Kind:    OrphanedAttachments,
+					Path:    path,
+					Message: strconv.Itoa(len(list)) + " attachment(s) for ID " + name + ", which no project uses",
+				})
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return problems, nil
+}
+
+// projectFiles returns the names of the JSON files in the projects directory,
+// whether or not they have valid short names.
+func (cat *localCatalog) projectFiles() ([]string, error) {
+	dir, err := cat.fs.Open(filepath.Join(cat.root, projectsDir))
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	var names []string
+	for {
+		entries, err := dir.Readdir(100)
+		for _, ent := range entries {
+			if name := ent.Name(); strings.HasSuffix(name, jsonExt) && !ent.IsDir() {
+				names = append(names, name)
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// isJSONError reports whether err is from a file that is not valid JSON.
+func isJSONError(err error) bool {
+	switch err.(type) {
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return true
+	}
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+type byProblem []Problem
+
+func (a byProblem) Len() int      { return len(a) }
+func (a byProblem) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byProblem) Less(i, j int) bool {
+	if a[i].Path != a[j].Path {
+		return a[i].Path < a[j].Path
+	}
+	if a[i].Kind != a[j].Kind {
+		return a[i].Kind < a[j].Kind
+	}
+	return a[i].Message < a[j].Message
+}
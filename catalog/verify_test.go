@@ -0,0 +1,362 @@
+package catalog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVerify_Clean(t *testing.T) {
+	m := NewMemory()
+	if err := m.PutProject(&Project{ID: ID{1}, ShortName: "foo"}); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	if err := m.PutProject(&Project{ID: ID{1}, ShortName: "bar"}); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	if problems, err := Verify(m); err != nil || len(problems) != 0 {
+		t.Errorf("Verify(m) = %v, %v; want [], <nil>", problems, err)
+	}
+	c, err := NewCache(m)
+	if err != nil {
+		t.Fatal("NewCache error:", err)
+	}
+	if problems, err := Verify(c); err != nil || len(problems) != 0 {
+		t.Errorf("Verify(cache) = %v, %v; want [], <nil>", problems, err)
+	}
+}
+
+type problemCheck struct {
+	Kind  ProblemKind
+	Path  string
+	Fixed bool
+}
+
+func checkProblems(t *testing.T, name string, problems []Problem, want []problemCheck) {
+	if len(problems) != len(want) {
+		t.Errorf("%s found %d problems; want %d", name, len(problems), len(want))
+		for _, p := range problems {
+			t.Log(p)
+		}
+		return
+	}
+	for i, p := range problems {
+		if got := (problemCheck{p.Kind, p.Path, p.Fixed}); got != want[i] {
+			t.Errorf("%s problem[%d] = %v; want %+v", name, i, p, want[i])
+		}
+	}
+}
+
+func TestRepair(t *testing.T) {
+	m := NewMemory()
+	if err := m.PutProject(&Project{ID: ID{1}, ShortName: "foo"}); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	if err := m.PutProject(&Project{ID: ID{1}, ShortName: "renamed"}); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	files := map[string]string{
+		"catalog.json":               `{"id_to_shortname": {"AQAAAAAAAAAA": "wrong", "AgAAAAAAAAAA": "gone", "BgAAAAAAAAAA": "wrong"}, "former_names": {"foo": "AQAAAAAAAAAA", "old": "AgAAAAAAAAAA"}}`,
+		"projects/baz.json":          `{"id": "BgAAAAAAAAAA", "shortname": "baz"}`,
+		"projects/bad name.json":     `{"id": "AwAAAAAAAAAA", "shortname": "bad name"}`,
+		"projects/broken.json":       `{"id": `,
+		"projects/dup.json":          `{"id": "AQAAAAAAAAAA", "shortname": "dup"}`,
+		"projects/foo.json":          `{"id": "BAAAAAAAAAAA", "shortname": "foo"}`,
+		"projects/mismatch.json":     `{"id": "BQAAAAAAAAAA", "shortname": "other"}`,
+		"projects/.temp.json.tmp123": `junk`,
+	}
+	for path, data := range files {
+		if err := writeFile(m.fs, filepath.Join(m.root, filepath.FromSlash(path)), []byte(data), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	problems, err := Verify(m)
+	if err != nil {
+		t.Fatal("Verify error:", err)
+	}
+	checkProblems(t, "Verify", problems, []problemCheck{
+		{IDConflict, "", false},
+		{MissingIDMapping, "catalog.json", false},
+		{MissingIDMapping, "catalog.json", false},
+		{WrongIDMapping, "catalog.json", false},
+		{ExtraIDMapping, "catalog.json", false},
+		{StaleFormerName, "catalog.json", false},
+		{StaleFormerName, "catalog.json", false},
+		{BadFileName, filepath.Join("projects", "bad name.json"), false},
+		{BadProject, filepath.Join("projects", "broken.json"), false},
+		{ShortNameMismatch, filepath.Join("projects", "mismatch.json"), false},
+	})
+
+	problems, err = Repair(m)
+	if err != nil {
+		t.Fatal("Repair error:", err)
+	}
+	checkProblems(t, "Repair", problems, []problemCheck{
+		{IDConflict, "", false},
+		{MissingIDMapping, "catalog.json", true},
+		{MissingIDMapping, "catalog.json", true},
+		{WrongIDMapping, "catalog.json", true},
+		{ExtraIDMapping, "catalog.json", true},
+		{StaleFormerName, "catalog.json", true},
+		{StaleFormerName, "catalog.json", true},
+		{BadFileName, filepath.Join("projects", "bad name.json"), false},
+		{BadProject, filepath.Join("projects", "broken.json"), false},
+		{ShortNameMismatch, filepath.Join("projects", "mismatch.json"), true},
+	})
+
+	problems, err = Verify(m)
+	if err != nil {
+		t.Fatal("Verify after repair error:", err)
+	}
+	checkProblems(t, "Verify after repair", problems, []problemCheck{
+		{IDConflict, "", false},
+		{BadFileName, filepath.Join("projects", "bad name.json"), false},
+		{BadProject, filepath.Join("projects", "broken.json"), false},
+	})
+	if p, err := m.GetProject("mismatch"); err != nil || p.ShortName != "mismatch" {
+		t.Errorf("m.GetProject(%q) = %v, %v; want short name %q", "mismatch", p, err, "mismatch")
+	}
+}
+
+func TestRepair_Untracked(t *testing.T) {
+	m := NewMemory()
+	if err := m.PutProject(&Project{ID: ID{1}, ShortName: "foo"}); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	wc := &mockWC{untracked: []string{filepath.Join("projects", "foo.json"), filepath.Join("projects", "notes.txt")}}
+	m.wc = wc
+
+	problems, err := Repair(m)
+	if err != nil {
+		t.Fatal("Repair error:", err)
+	}
+	checkProblems(t, "Repair", problems, []problemCheck{
+		{UntrackedFile, filepath.Join("projects", "foo.json"), true},
+	})
+	if want := []string{filepath.Join("projects", "foo.json")}; len(wc.added) != 1 || wc.added[0] != want[0] {
+		t.Errorf("added %q; want %q", wc.added, want)
+	}
+	if !wc.committed {
+		t.Error("repair not committed")
+	}
+}
+
+func TestRepair_Unreadable(t *testing.T) {
+	m := NewMemory()
+	if err := m.PutProject(&Project{ID: ID{1}, ShortName: "old"}); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	if err := m.PutProject(&Project{ID: ID{1}, ShortName: "foo"}); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	if err := m.PutProject(&Project{ID: ID{2}, ShortName: "app", Links: []Link{{DependsOn, ID{1}}}}); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	if err := m.PutAttachment(ID{1}, "notes.txt", []byte("hi")); err != nil {
+		t.Fatal("PutAttachment error:", err)
+	}
+	conflict := "<<<<<<< HEAD\n{\"id\": \"AQAAAAAAAAAA\", \"shortname\": \"foo\"}\n=======\n"
+	if err := writeFile(m.fs, m.projectPath("foo"), []byte(conflict), false); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := Repair(m)
+	if err != nil {
+		t.Fatal("Repair error:", err)
+	}
+	checkProblems(t, "Repair", problems, []problemCheck{
+		{BadProject, filepath.Join("projects", "foo.json"), false},
+	})
+	if sn, err := m.ShortName(ID{1}); err != nil || sn != "foo" {
+		t.Errorf("ShortName(%v) after repair = %q, %v; want \"foo\"", ID{1}, sn, err)
+	}
+	if former, err := m.formerNames(); err != nil || former["old"] != (ID{1}) {
+		t.Errorf("formerNames() after repair = %v, %v; want old -> %v", former, err, ID{1})
+	}
+	if _, err := m.ReadAttachment(ID{1}, "notes.txt"); err != nil {
+		t.Error("ReadAttachment after repair error:", err)
+	}
+}
+
+func TestRepair_OrphanedLock(t *testing.T) {
+	host, err := os.Hostname()
+	if err != nil {
+		t.Skip("no hostname:", err)
+	}
+	m := NewMemory()
+	info := &LockInfo{PID: 1 << 30, Host: host, Time: time.Now()}
+	if err := writeJSON(m.fs, m.lockPath(), info, true); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := Verify(m)
+	if err != nil {
+		t.Fatal("Verify error:", err)
+	}
+	checkProblems(t, "Verify", problems, []problemCheck{{OrphanedLock, lockFile, false}})
+
+	problems, err = Repair(m)
+	if err != nil {
+		t.Fatal("Repair error:", err)
+	}
+	checkProblems(t, "Repair", problems, []problemCheck{{OrphanedLock, lockFile, true}})
+	if f, err := m.fs.Open(m.lockPath()); err == nil {
+		f.Close()
+		t.Error("lock file still exists")
+	}
+}
+
+func TestRepair_MalformedLock(t *testing.T) {
+	m := NewMemory()
+	m.opts.StaleLockAge = time.Nanosecond
+	if err := writeFile(m.fs, m.lockPath(), []byte(`{"pid": 12`), true); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	problems, err := Verify(m)
+	if err != nil {
+		t.Fatal("Verify error:", err)
+	}
+	checkProblems(t, "Verify", problems, []problemCheck{{OrphanedLock, lockFile, false}})
+
+	problems, err = Repair(m)
+	if err != nil {
+		t.Fatal("Repair error:", err)
+	}
+	checkProblems(t, "Repair", problems, []problemCheck{{OrphanedLock, lockFile, true}})
+}
+
+func TestRepair_OrphanedBreakLock(t *testing.T) {
+	host, err := os.Hostname()
+	if err != nil {
+		t.Skip("no hostname:", err)
+	}
+	m := NewMemory()
+	info := &LockInfo{PID: 1 << 30, Host: host, Time: time.Now()}
+	if err := writeJSON(m.fs, m.lockPath()+breakSuffix, info, true); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := Repair(m)
+	if err != nil {
+		t.Fatal("Repair error:", err)
+	}
+	checkProblems(t, "Repair", problems, []problemCheck{{OrphanedLock, lockFile + breakSuffix, true}})
+	if f, err := m.fs.Open(m.lockPath() + breakSuffix); err == nil {
+		f.Close()
+		t.Error("break marker still exists")
+	}
+}
+
+func TestVerify_InvalidFields(t *testing.T) {
+	m := NewMemory()
+	if err := m.PutSchema(&Schema{[]FieldDef{{Name: "owner", Type: TextField}}}); err != nil {
+		t.Fatal("PutSchema error:", err)
+	}
+	if err := m.PutProject(&Project{ID: ID{1}, ShortName: "foo", Fields: map[string]string{"owner": "alice"}}); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	if err := m.PutSchema(&Schema{[]FieldDef{{Name: "lead", Type: TextField}}}); err != nil {
+		t.Fatal("PutSchema error:", err)
+	}
+
+	problems, err := Verify(m)
+	if err != nil {
+		t.Fatal("Verify error:", err)
+	}
+	checkProblems(t, "Verify", problems, []problemCheck{
+		{InvalidFields, filepath.Join(projectsDir, "foo.json"), false},
+	})
+}
+
+func TestVerify_InvalidStatus(t *testing.T) {
+	m := NewMemory()
+	if err := m.PutProject(&Project{ID: ID{1}, ShortName: "foo"}); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	bad := &Project{ID: ID{1}, ShortName: "foo", Status: "bogus"}
+	if err := writeJSON(m.fs, m.projectPath("foo"), bad, false); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := Verify(m)
+	if err != nil {
+		t.Fatal("Verify error:", err)
+	}
+	checkProblems(t, "Verify", problems, []problemCheck{
+		{InvalidStatus, filepath.Join(projectsDir, "foo.json"), false},
+	})
+
+	c, err := NewCache(m)
+	if err != nil {
+		t.Fatal("NewCache error:", err)
+	}
+	problems, err = Verify(c)
+	if err != nil {
+		t.Fatal("Verify(cache) error:", err)
+	}
+	checkProblems(t, "Verify(cache)", problems, []problemCheck{
+		{InvalidStatus, "", false},
+	})
+}
+
+func TestVerify_DanglingLink(t *testing.T) {
+	m := NewMemory()
+	if err := m.PutProject(&Project{ID: ID{1}, ShortName: "lib"}); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	links := []Link{{DependsOn, ID{1}}, {ForkedFrom, ID{9}}}
+	if err := m.PutProject(&Project{ID: ID{2}, ShortName: "app", Links: links}); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+
+	problems, err := Verify(m)
+	if err != nil {
+		t.Fatal("Verify error:", err)
+	}
+	checkProblems(t, "Verify", problems, []problemCheck{
+		{DanglingLink, filepath.Join(projectsDir, "app.json"), false},
+	})
+
+	c, err := NewCache(m)
+	if err != nil {
+		t.Fatal("NewCache error:", err)
+	}
+	problems, err = Verify(c)
+	if err != nil {
+		t.Fatal("Verify(cache) error:", err)
+	}
+	checkProblems(t, "Verify(cache)", problems, []problemCheck{
+		{DanglingLink, "", false},
+	})
+}
+
+func TestVerify_UnknownHost(t *testing.T) {
+	m := NewMemory()
+	if err := m.PutProject(&Project{ID: ID{1}, ShortName: "foo", PerHost: map[string]*HostInfo{"lpatop": {Path: "/src/foo"}}}); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	if err := m.PutHosts(&HostRegistry{[]Host{{Name: "laptop"}}}); err != nil {
+		t.Fatal("PutHosts error:", err)
+	}
+
+	problems, err := Verify(m)
+	if err != nil {
+		t.Fatal("Verify error:", err)
+	}
+	checkProblems(t, "Verify", problems, []problemCheck{
+		{UnknownHost, filepath.Join(projectsDir, "foo.json"), false},
+	})
+
+	c, err := NewCache(m)
+	if err != nil {
+		t.Fatal("NewCache error:", err)
+	}
+	problems, err = Verify(c)
+	if err != nil {
+		t.Fatal("Verify(cache) error:", err)
+	}
+	checkProblems(t, "Verify(cache)", problems, []problemCheck{
+		{UnknownHost, "", false},
+	})
+}
@@ -0,0 +1,392 @@
+package catalog
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Watcher is a Catalog that can report changes to its projects.
+type Watcher interface {
+	Catalog
+
+	// Watch starts watching the catalog for changes.  Events are delivered
+	// on the returned Watch's channel until it is closed.
+	Watch() (*Watch, error)
+}
+
+// An EventOp is the kind of change described by an Event.
+type EventOp int
+
+// Event operations
+const (
+	// PutEvent is sent when a project is added or its record is changed.
+	PutEvent EventOp = iota + 1
+
+	// DeleteEvent is sent when a project is removed.
+	DeleteEvent
+
+	// RenameEvent is sent when a project's short name changes.  The
+	// project's record may have changed as well.
+	RenameEvent
+)
+
+func (op EventOp) String() string {
+	switch op {
+	case PutEvent:
+		return "put"
+	case DeleteEvent:
+		return "delete"
+	case RenameEvent:
+		return "rename"
+	default:
+		return "EventOp(" + strconv.Itoa(int(op)) + ")"
+	}
+}
+
+// An Event describes a change to a project in a catalog.
+type Event struct {
+	Op EventOp
+	ID ID
+
+	// ShortName is the project's short name after the change, or the
+	// deleted project's short name for a DeleteEvent.
+	ShortName string
+
+	// OldShortName is the project's previous short name for a RenameEvent.
+	OldShortName string
+}
+
+func (ev Event) String() string {
+	s := ev.Op.String() + " " + ev.ID.String() + " " + ev.ShortName
+	if ev.Op == RenameEvent {
+		s += " (was " + ev.OldShortName + ")"
+	}
+	return s
+}
+
+// A Watch delivers catalog events.  Events are queued in memory, so a slow
+// receiver does not block changes to the catalog.
+type Watch struct {
+	// C is the channel on which events are delivered.  It is closed after
+	// the Watch is closed.
+	C <-chan Event
+
+	c     chan Event
+	ready chan struct{}
+	done  chan struct{}
+	poke  chan struct{}
+
+	mu      sync.Mutex
+	queue   []Event
+	once    sync.Once
+	onClose func()
+}
+
+func newWatch(onClose func()) *Watch {
+	c := make(chan Event)
+	w := &Watch{
+		C:       c,
+		c:       c,
+		ready:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		poke:    make(chan struct{}, 1),
+		onClose: onClose,
+	}
+	go w.pump()
+	return w
+}
+
+// Close stops the delivery of events.
+func (w *Watch) Close() error {
+	w.once.Do(func() {
+		close(w.done)
+		if w.onClose != nil {
+			w.onClose()
+		}
+	})
+	return nil
+}
+
+// post adds events to the queue.
+func (w *Watch) post(events ...Event) {
+	if len(events) == 0 {
+		return
+	}
+	w.mu.Lock()
+	w.queue = append(w.queue, events...)
+	w.mu.Unlock()
+	signal(w.ready)
+}
+
+// pump sends queued events on w.c until the watch is closed.
+func (w *Watch) pump() {
+	defer close(w.c)
+	for {
+		select {
+		case <-w.ready:
+		case <-w.done:
+			return
+		}
+		w.mu.Lock()
+		q := w.queue
+		w.queue = nil
+		w.mu.Unlock()
+		for _, ev := range q {
+			select {
+			case w.c <- ev:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// signal does a non-blocking send on a channel with a buffer of one.
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// A watchSet is a set of watches.  The zero value is an empty set.
+type watchSet struct {
+	mu sync.Mutex
+	m  map[*Watch]struct{}
+}
+
+// add creates a new watch in the set.  It is removed when it is closed.
+func (ws *watchSet) add() *Watch {
+	var w *Watch
+	w = newWatch(func() {
+		ws.mu.Lock()
+		delete(ws.m, w)
+		ws.mu.Unlock()
+	})
+	ws.mu.Lock()
+	if ws.m == nil {
+		ws.m = make(map[*Watch]struct{})
+	}
+	ws.m[w] = struct{}{}
+	ws.mu.Unlock()
+	return w
+}
+
+// post sends events to every watch in the set.
+func (ws *watchSet) post(events ...Event) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	for w := range ws.m {
+		w.post(events...)
+	}
+}
+
+// poke asks every watch in the set to check for changes.
+func (ws *watchSet) poke() {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	for w := range ws.m {
+		signal(w.poke)
+	}
+}
+
+// DefaultWatchPollInterval is how often a local catalog is checked for
+// changes when the operating system cannot notify Black Forest of changes.
+const DefaultWatchPollInterval = 2 * time.Second
+
+// Watch reports changes to the catalog, including those made by other
+// processes.  Changes are found by comparing catalog.json and the project
+// files' sizes and modification times against the last known state.  On Linux,
+// the catalog is checked whenever inotify reports a change; elsewhere, it is
+// polled.
+func (cat *localCatalog) Watch() (*Watch, error) {
+	snap, err := cat.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	var n notifier
+	if _, ok := cat.fs.(realFilesystem); ok {
+		n, _ = newSystemNotifier([]string{cat.root, filepath.Join(cat.root, projectsDir)})
+	}
+	if n == nil {
+		n = newPollNotifier(cat.watchPollInterval())
+	}
+	w := cat.watches.add()
+	go cat.watchLoop(w, n, snap)
+	return w, nil
+}
+
+// watchPollInterval returns how often Watch polls the catalog when it has to.
+func (cat *localCatalog) watchPollInterval() time.Duration {
+	if cat.opts.WatchPollInterval == 0 {
+		return DefaultWatchPollInterval
+	}
+	return cat.opts.WatchPollInterval
+}
+
+func (cat *localCatalog) watchLoop(w *Watch, n notifier, snap snapshot) {
+	defer func() { n.Close() }()
+	nc := n.C()
+	for {
+		select {
+		case _, ok := <-nc:
+			if !ok {
+				// Notifications failed; fall back to polling.
+				n.Close()
+				n = newPollNotifier(cat.watchPollInterval())
+				nc = n.C()
+				continue
+			}
+		case <-w.poke:
+		case <-w.done:
+			return
+		}
+		if f, err := cat.fs.Open(cat.lockPath()); err == nil {
+			// A change is in progress.  Removing the lock will produce
+			// another notification.
+			f.Close()
+			continue
+		}
+		newSnap, err := cat.snapshot()
+		if err != nil {
+			continue
+		}
+		w.post(diffSnapshots(snap, newSnap)...)
+		snap = newSnap
+	}
+}
+
+// A snapshot is the state of a local catalog used to detect changes.
+type snapshot map[ID]snapshotEntry
+
+type snapshotEntry struct {
+	shortName string
+	size      int64
+	modTime   time.Time
+}
+
+// snapshot reads the current state of the catalog.  Projects in catalog.json
+// without a project file are omitted.
+func (cat *localCatalog) snapshot() (snapshot, error) {
+	meta, err := cat.readCatalogMeta()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := cat.fs.Open(filepath.Join(cat.root, projectsDir))
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	infos := make(map[string]os.FileInfo)
+	for {
+		entries, err := dir.Readdir(100)
+		for _, ent := range entries {
+			if name := ent.Name(); strings.HasSuffix(name, jsonExt) {
+				infos[name[:len(name)-len(jsonExt)]] = ent
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	snap := make(snapshot, len(meta.ShortNameMap))
+	for idString, sn := range meta.ShortNameMap {
+		id, err := ParseID(idString)
+		if err != nil {
+			continue
+		}
+		info := infos[sn]
+		if info == nil {
+			continue
+		}
+		snap[id] = snapshotEntry{shortName: sn, size: info.Size(), modTime: info.ModTime()}
+	}
+	return snap, nil
+}
+
+// diffSnapshots returns the events that change old into new.  Deletes are
+// listed first, then renames, then puts, each sorted by short name.
+func diffSnapshots(old, new snapshot) []Event {
+	var dels, renames, puts []Event
+	for id, e := range old {
+		if _, ok := new[id]; !ok {
+			dels = append(dels, Event{Op: DeleteEvent, ID: id, ShortName: e.shortName})
+		}
+	}
+	for id, e := range new {
+		oe, ok := old[id]
+		switch {
+		case !ok:
+			puts = append(puts, Event{Op: PutEvent, ID: id, ShortName: e.shortName})
+		case oe.shortName != e.shortName:
+			renames = append(renames, Event{Op: RenameEvent, ID: id, ShortName: e.shortName, OldShortName: oe.shortName})
+		case oe.size != e.size || !oe.modTime.Equal(e.modTime):
+			puts = append(puts, Event{Op: PutEvent, ID: id, ShortName: e.shortName})
+		}
+	}
+	events := make([]Event, 0, len(dels)+len(renames)+len(puts))
+	for _, evs := range [][]Event{dels, renames, puts} {
+		sort.Sort(byShortName(evs))
+		events = append(events, evs...)
+	}
+	return events
+}
+
+type byShortName []Event
+
+func (e byShortName) Len() int           { return len(e) }
+func (e byShortName) Less(i, j int) bool { return e[i].ShortName < e[j].ShortName }
+func (e byShortName) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+
+// A notifier signals that a directory may have changed.
+type notifier interface {
+	// C returns a channel that receives a value after a change.  The channel
+	// is closed if the notifier fails.
+	C() <-chan struct{}
+	Close() error
+}
+
+// pollNotifier is a notifier that signals at a fixed interval.
+type pollNotifier struct {
+	t *time.Ticker
+	c chan struct{}
+	q chan struct{}
+}
+
+func newPollNotifier(interval time.Duration) *pollNotifier {
+	n := &pollNotifier{
+		t: time.NewTicker(interval),
+		c: make(chan struct{}, 1),
+		q: make(chan struct{}),
+	}
+	go func() {
+		for {
+			select {
+			case <-n.t.C:
+				signal(n.c)
+			case <-n.q:
+				return
+			}
+		}
+	}()
+	return n
+}
+
+func (n *pollNotifier) C() <-chan struct{} {
+	return n.c
+}
+
+func (n *pollNotifier) Close() error {
+	n.t.Stop()
+	close(n.q)
+	return nil
+}
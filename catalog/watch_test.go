@@ -0,0 +1,188 @@
+package catalog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// nextEvent waits for an event on w.
+func nextEvent(t *testing.T, w *Watch) (Event, bool) {
+	select {
+	case ev, ok := <-w.C:
+		if !ok {
+			t.Error("watch closed")
+		}
+		return ev, ok
+	case <-time.After(5 * time.Second):
+		t.Error("timed out waiting for event")
+		return Event{}, false
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	id1 := ID{1}
+	id2 := ID{2}
+	id3 := ID{3}
+	id4 := ID{4}
+	old := snapshot{
+		id1: {shortName: "a", size: 10},
+		id2: {shortName: "b", size: 10},
+		id3: {shortName: "c", size: 10},
+	}
+	new := snapshot{
+		id1: {shortName: "a", size: 10},
+		id2: {shortName: "bb", size: 10},
+		id3: {shortName: "c", size: 11},
+		id4: {shortName: "d", size: 10},
+	}
+	events := diffSnapshots(old, new)
+	want := []Event{
+		{Op: RenameEvent, ID: id2, ShortName: "bb", OldShortName: "b"},
+		{Op: PutEvent, ID: id3, ShortName: "c"},
+		{Op: PutEvent, ID: id4, ShortName: "d"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("diffSnapshots(old, new) = %v; want %v", events, want)
+	}
+
+	events = diffSnapshots(new, old)
+	want = []Event{
+		{Op: DeleteEvent, ID: id4, ShortName: "d"},
+		{Op: RenameEvent, ID: id2, ShortName: "b", OldShortName: "bb"},
+		{Op: PutEvent, ID: id3, ShortName: "c"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("diffSnapshots(new, old) = %v; want %v", events, want)
+	}
+}
+
+func TestLocalWatch(t *testing.T) {
+	cat, _, _ := newTestCatalog()
+	cat.opts.WatchPollInterval = time.Hour
+	w, err := cat.Watch()
+	if err != nil {
+		t.Fatal("watch error:", err)
+	}
+	defer w.Close()
+
+	oldID := ID{0x6f, 0x5d, 0x5d, 0xcc, 0x6b, 0x38, 0x49, 0x08, 0x9d}
+	newID := ID{0xba, 0x7b, 0xbb, 0x6c, 0x2b, 0x66, 0x61, 0x54, 0xfb}
+	steps := []struct {
+		change func() error
+		event  Event
+	}{
+		{
+			func() error { return cat.PutProject(&Project{ID: newID, ShortName: "foo", Name: "Teh Foo"}) },
+			Event{Op: PutEvent, ID: newID, ShortName: "foo"},
+		},
+		{
+			func() error { return cat.PutProject(&Project{ID: newID, ShortName: "foo", Name: "The Foo Project"}) },
+			Event{Op: PutEvent, ID: newID, ShortName: "foo"},
+		},
+		{
+			func() error {
+				p, err := cat.GetProject("blackforest")
+				if err != nil {
+					return err
+				}
+				p.ShortName = "bf"
+				return cat.PutProject(p)
+			},
+			Event{Op: RenameEvent, ID: oldID, ShortName: "bf", OldShortName: "blackforest"},
+		},
+		{
+			func() error { return cat.DelProject("foo") },
+			Event{Op: DeleteEvent, ID: newID, ShortName: "foo"},
+		},
+	}
+	for i, step := range steps {
+		if err := step.change(); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		ev, ok := nextEvent(t, w)
+		if !ok {
+			return
+		}
+		if ev != step.event {
+			t.Errorf("step %d: event = %v; want %v", i, ev, step.event)
+		}
+	}
+
+	w.Close()
+	if _, ok := <-w.C; ok {
+		t.Error("event received after close")
+	}
+}
+
+func TestLocalWatch_OtherProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blackforest-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "catalog")
+	if _, err := create(realFilesystem{}, root); err != nil {
+		t.Fatal("create error:", err)
+	}
+
+	watched := &localCatalog{root: root, fs: realFilesystem{}, opts: Options{WatchPollInterval: 10 * time.Millisecond}}
+	w, err := watched.Watch()
+	if err != nil {
+		t.Fatal("watch error:", err)
+	}
+	defer w.Close()
+
+	other := &localCatalog{root: root, fs: realFilesystem{}}
+	id := ID{0xba, 0x7b, 0xbb, 0x6c, 0x2b, 0x66, 0x61, 0x54, 0xfb}
+	if err := other.PutProject(&Project{ID: id, ShortName: "foo", Name: "Teh Foo"}); err != nil {
+		t.Fatal("put error:", err)
+	}
+	if ev, ok := nextEvent(t, w); ok {
+		if want := (Event{Op: PutEvent, ID: id, ShortName: "foo"}); ev != want {
+			t.Errorf("event = %v; want %v", ev, want)
+		}
+	}
+}
+
+// failedNotifier is a notifier that has already failed.
+type failedNotifier struct{}
+
+func (failedNotifier) C() <-chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}
+
+func (failedNotifier) Close() error { return nil }
+
+func TestLocalWatch_PollFallback(t *testing.T) {
+	m := NewMemory()
+	cat := &m.localCatalog
+	cat.opts.WatchPollInterval = 10 * time.Millisecond
+	snap, err := cat.snapshot()
+	if err != nil {
+		t.Fatal("snapshot error:", err)
+	}
+	w := cat.watches.add()
+	go cat.watchLoop(w, failedNotifier{}, snap)
+	defer w.Close()
+
+	// Changes through another catalog value are only found by polling.
+	other := &localCatalog{root: cat.root, fs: cat.fs}
+	id := ID{0xba, 0x7b, 0xbb, 0x6c, 0x2b, 0x66, 0x61, 0x54, 0xfb}
+	if err := other.PutProject(&Project{ID: id, ShortName: "foo", Name: "Teh Foo"}); err != nil {
+		t.Fatal("put error:", err)
+	}
+	select {
+	case ev := <-w.C:
+		if want := (Event{Op: PutEvent, ID: id, ShortName: "foo"}); ev != want {
+			t.Errorf("event = %v; want %v", ev, want)
+		}
+	case <-time.After(DefaultWatchPollInterval / 2):
+		t.Error("no event within a second; want polling at WatchPollInterval")
+	}
+}
@@ -1,17 +1,22 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	pathpkg "path"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"bitbucket.org/zombiezen/blackforest/catalog"
 	"bitbucket.org/zombiezen/blackforest/catalog/search"
+	"bitbucket.org/zombiezen/blackforest/vcs"
 	"bitbucket.org/zombiezen/subcmd"
 )
 
@@ -30,7 +35,7 @@ var commandSet = subcmd.Set{
 			Func:        cmdList,
 			Name:        "list",
 			Aliases:     []string{"ls"},
-			Synopsis:    "list",
+			Synopsis:    "list [-status=STATUS[,...]] [-at=REV|DATE]",
 			Description: "list project short names",
 		},
 		{
@@ -44,7 +49,7 @@ var commandSet = subcmd.Set{
 			Func:        cmdShow,
 			Name:        "show",
 			Aliases:     []string{"info"},
-			Synopsis:    "show PROJECT [...]",
+			Synopsis:    "show [-at=REV|DATE] PROJECT [...]",
 			Description: "print projects",
 		},
 		{
@@ -68,6 +73,41 @@ var commandSet = subcmd.Set{
 			Synopsis:    "describe PROJECT",
 			Description: "edit project description",
 		},
+		{
+			Func:        cmdNote,
+			Name:        "note",
+			Aliases:     []string{},
+			Synopsis:    "note [-m=TEXT] PROJECT",
+			Description: "add a note to a project's journal",
+		},
+		{
+			Func:        cmdNotes,
+			Name:        "notes",
+			Aliases:     []string{},
+			Synopsis:    "notes [-rfc3339] PROJECT",
+			Description: "print a project's journal",
+		},
+		{
+			Func:        cmdAttach,
+			Name:        "attach",
+			Aliases:     []string{},
+			Synopsis:    "attach [-name=NAME] PROJECT FILE [...]",
+			Description: "store files in the catalog with a project",
+		},
+		{
+			Func:        cmdDetach,
+			Name:        "detach",
+			Aliases:     []string{},
+			Synopsis:    "detach PROJECT NAME [...]",
+			Description: "remove a project's attachments",
+		},
+		{
+			Func:        cmdAttachments,
+			Name:        "attachments",
+			Aliases:     []string{},
+			Synopsis:    "attachments PROJECT",
+			Description: "list a project's attachments",
+		},
 		{
 			Func:        cmdRename,
 			Name:        "rename",
@@ -75,27 +115,104 @@ var commandSet = subcmd.Set{
 			Synopsis:    "rename SRC DST",
 			Description: "change a project's short name",
 		},
+		{
+			Func:        cmdRemote,
+			Name:        "remote",
+			Aliases:     []string{},
+			Synopsis:    "remote [-add=NAME -url=URL [options] | -remove=NAME] PROJECT",
+			Description: "show or change a project's VCS remotes",
+		},
+		{
+			Func:        cmdParent,
+			Name:        "parent",
+			Aliases:     []string{},
+			Synopsis:    "parent [PROJECT [PARENT SUBDIR] | -clear PROJECT]",
+			Description: "show or change the project that a subproject lives in",
+		},
+		{
+			Func:        cmdLink,
+			Name:        "link",
+			Aliases:     []string{},
+			Synopsis:    "link PROJECT TYPE TARGET",
+			Description: "add a link from one project to another",
+		},
+		{
+			Func:        cmdUnlink,
+			Name:        "unlink",
+			Aliases:     []string{},
+			Synopsis:    "unlink PROJECT TYPE TARGET",
+			Description: "remove a link from one project to another (TARGET may be the ID of a deleted project)",
+		},
+		{
+			Func:        cmdGraph,
+			Name:        "graph",
+			Aliases:     []string{},
+			Synopsis:    "graph [-type=TYPE[,...]] [PROJECT [...]]",
+			Description: "print project links in Graphviz DOT format",
+		},
 		{
 			Func:        cmdDelete,
 			Name:        "delete",
 			Aliases:     []string{"del", "rm"},
 			Synopsis:    "delete PROJECT [...]",
-			Description: "delete projects",
+			Description: "move projects to the trash",
+		},
+		{
+			Func:        cmdTrash,
+			Name:        "trash",
+			Aliases:     []string{},
+			Synopsis:    "trash [list [-rfc3339] | purge -older=AGE|-all [-dryrun]]",
+			Description: "show or empty the catalog's deleted projects",
+		},
+		{
+			Func:        cmdRestore,
+			Name:        "restore",
+			Aliases:     []string{},
+			Synopsis:    "restore [-name=NAME] PROJECT|ID",
+			Description: "move a project out of the trash",
+		},
+		{
+			Func:        cmdHistory,
+			Name:        "history",
+			Aliases:     []string{},
+			Synopsis:    "history [-rfc3339] PROJECT",
+			Description: "show the changes to a project's record",
 		},
 		{
 			Func:        cmdImport,
 			Name:        "import",
 			Aliases:     []string{},
 			Synopsis:    "import [PATH [...]]",
-			Description: "import project(s) from JSON",
+			Description: "import project(s) from JSON, skipping files that fail",
 		},
 		{
 			Func:        cmdCheckout,
 			Name:        "checkout",
 			Aliases:     []string{"co"},
-			Synopsis:    "checkout PROJECT [PATH]",
+			Synopsis:    "checkout [-remote=NAME] PROJECT [PATH]",
 			Description: "check out project from version control",
 		},
+		{
+			Func:        cmdHostSync,
+			Name:        "hostsync",
+			Aliases:     []string{},
+			Synopsis:    "hostsync [PROJECT [...]]",
+			Description: "record the state of this host's working copies",
+		},
+		{
+			Func:        cmdHost,
+			Name:        "host",
+			Aliases:     []string{},
+			Synopsis:    "host [list | add [options] NAME | rename OLD NEW | remove NAME]",
+			Description: "show or change the catalog's hosts",
+		},
+		{
+			Func:        cmdRelocate,
+			Name:        "relocate",
+			Aliases:     []string{},
+			Synopsis:    "relocate [-dryrun] OLDPREFIX NEWPREFIX",
+			Description: "move this host's project paths to a new directory",
+		},
 		{
 			Func:        cmdSearch,
 			Name:        "search",
@@ -114,9 +231,30 @@ var commandSet = subcmd.Set{
 			Func:        cmdVerify,
 			Name:        "verify",
 			Aliases:     []string{},
-			Synopsis:    "verify [-catalog=PATH]",
+			Synopsis:    "verify [-fix]",
 			Description: "check a catalog for consistency",
 		},
+		{
+			Func:        cmdSchema,
+			Name:        "schema",
+			Aliases:     []string{},
+			Synopsis:    "schema [-add=NAME -type=TYPE [options] | -remove=NAME]",
+			Description: "show or change the catalog's custom fields",
+		},
+		{
+			Func:        cmdUnlock,
+			Name:        "unlock",
+			Aliases:     []string{},
+			Synopsis:    "unlock [-force]",
+			Description: "show and break the catalog lock",
+		},
+		{
+			Func:        cmdUpgrade,
+			Name:        "upgrade",
+			Aliases:     []string{},
+			Synopsis:    "upgrade [-dryrun]",
+			Description: "migrate a catalog to the current format",
+		},
 	},
 }
 
@@ -161,12 +299,18 @@ func cmdInit(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
 
 func cmdList(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
 	fset := cmd.FlagSet(set)
+	statusList := fset.String("status", "", "only list projects with one of these comma-separated statuses ("+validStatusText+")")
+	at := fset.String("at", "", "list projects as of a catalog revision or date")
 	parseFlags(fset, args)
-	cat := requireCatalog()
+	cat := requireCatalogAt(*at)
 	if fset.NArg() != 0 {
 		cmd.PrintSynopsis(set)
 		return exitError(exitUsage)
 	}
+	statuses, err := parseStatusList(*statusList)
+	if err != nil {
+		return err
+	}
 
 	list, err := cat.List()
 	if err != nil {
@@ -174,11 +318,37 @@ func cmdList(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
 	}
 	sort.Strings(list)
 	for _, name := range list {
+		if statuses != nil {
+			proj, err := cat.GetProject(name)
+			if err != nil {
+				return err
+			}
+			if !statuses[proj.CurrentStatus()] {
+				continue
+			}
+		}
 		fmt.Println(name)
 	}
 	return nil
 }
 
+// parseStatusList parses a comma-separated list of statuses into a set.
+// An empty list returns a nil set.
+func parseStatusList(s string) (map[catalog.Status]bool, error) {
+	if s == "" {
+		return nil, nil
+	}
+	set := make(map[catalog.Status]bool)
+	for _, name := range strings.Split(s, ",") {
+		status, err := catalog.ParseStatus(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		set[status] = true
+	}
+	return set, nil
+}
+
 func cmdPath(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
 	fset := cmd.FlagSet(set)
 	parseFlags(fset, args)
@@ -191,11 +361,18 @@ func cmdPath(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
 	if host == "" {
 		return errHostNotSet
 	}
-	proj, err := cat.GetProject(fset.Arg(0))
+	proj, err := findProject(cat, fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	env, err := hostPathEnv(cat)
+	if err != nil {
+		return err
+	}
+	p, err := catalog.ResolvePath(cat, proj, host, env)
 	if err != nil {
 		return err
 	}
-	p := proj.Path(host)
 	if p == "" {
 		return errFailed
 	}
@@ -207,17 +384,18 @@ func cmdShow(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
 	fset := cmd.FlagSet(set)
 	jsonFormat := fset.Bool("json", false, "print project as JSON")
 	rfc3339Time := fset.Bool("rfc3339", false, "print dates as RFC3339")
+	at := fset.String("at", "", "show projects as of a catalog revision or date")
 	parseFlags(fset, args)
 	if fset.NArg() == 0 {
 		cmd.PrintSynopsis(set)
 		return exitError(exitUsage)
 	}
-	cat := requireCatalog()
+	cat := requireCatalogAt(*at)
 
 	if *jsonFormat {
 		projects := make([]*catalog.Project, 0, fset.NArg())
-		for _, shortName := range fset.Args() {
-			proj, err := cat.GetProject(shortName)
+		for _, name := range fset.Args() {
+			proj, err := findProject(cat, name)
 			if err != nil {
 				return err
 			}
@@ -231,50 +409,155 @@ func cmdShow(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
 		if *rfc3339Time {
 			fmtTime = fmtRFC3339Time
 		}
-		failed := false
-		for i, shortName := range fset.Args() {
+		code := exitSuccess
+		for i, name := range fset.Args() {
 			if i > 0 {
 				fmt.Println()
 			}
-			if proj, err := cat.GetProject(shortName); err == nil {
-				showProject(proj, fmtTime)
-			} else {
+			proj, err := findProject(cat, name)
+			if err == nil {
+				err = showProject(cat, proj, fmtTime)
+			}
+			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
-				failed = true
+				code = combineExit(code, err)
 			}
 		}
-		if failed {
-			return errFailed
+		if code != exitSuccess {
+			return exitError(code)
 		}
 	}
 	return nil
 }
 
-func showProject(proj *catalog.Project, fmtTime func(time.Time) string) {
+func showProject(cat catalog.Catalog, proj *catalog.Project, fmtTime func(time.Time) string) error {
 	fmt.Println(proj.Name)
 	showField("ID", proj.ID)
-	if p := proj.Path(host); p != "" {
-		showField("Path", p)
+	if proj.Parent != nil {
+		parent, err := linkName(cat, proj.Parent.ID)
+		if err != nil {
+			return err
+		}
+		showField("Parent", parent, proj.Parent.Subdir)
+	}
+	if host != "" {
+		env, err := hostPathEnv(cat)
+		if err != nil {
+			return err
+		}
+		p, err := catalog.ResolvePath(cat, proj, host, env)
+		if err != nil && !catalog.IsNotFound(err) {
+			return err
+		}
+		if p != "" {
+			showField("Path", p)
+		}
+	}
+	for _, h := range pathHosts(proj) {
+		info := proj.PerHost[h]
+		if info.WC != nil {
+			showField("Host", h, info.Path, "("+describeWC(info.WC, fmtTime)+")")
+		} else {
+			showField("Host", h, info.Path)
+		}
 	}
 	if len(proj.Tags) != 0 {
 		sort.Strings(proj.Tags)
 		showField("Tags", strings.Join(proj.Tags, ", "))
 	}
+	if len(proj.StatusHistory) > 0 {
+		showField("Status", proj.CurrentStatus(), "since", fmtTime(proj.StatusTime()))
+	} else {
+		showField("Status", proj.CurrentStatus())
+	}
 	showField("Created", fmtTime(proj.CreateTime))
 	showField("Added On", fmtTime(proj.CatalogTime))
 	if proj.Homepage != "" {
 		showField("URL", proj.Homepage)
 	}
-	if vcsInfo := proj.VCS; vcsInfo != nil {
-		if vcsInfo.URL != "" {
-			showField("VCS", vcsInfo.Type, vcsInfo.URL)
+	for _, r := range proj.Remotes {
+		if r.URL != "" {
+			showField("Remote", r.Name, "("+string(r.Role)+")", r.Type, r.URL)
 		} else {
-			showField("VCS", vcsInfo.Type)
+			showField("Remote", r.Name, "("+string(r.Role)+")", r.Type)
+		}
+	}
+	if len(proj.Fields) > 0 {
+		names := make([]string, 0, len(proj.Fields))
+		for name := range proj.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			showField(name, proj.Fields[name])
+		}
+	}
+	for _, l := range proj.Links {
+		target, err := linkName(cat, l.Target)
+		if err != nil {
+			return err
+		}
+		showField(string(l.Type), target)
+	}
+	inbound, err := catalog.LinksTo(cat, proj.ID)
+	if err != nil {
+		return err
+	}
+	for _, l := range inbound {
+		source, err := linkName(cat, l.Source)
+		if err != nil {
+			return err
 		}
+		showField("Linked From", source, "("+string(l.Type)+")")
+	}
+	children, err := catalog.Subprojects(cat, proj.ID)
+	if err != nil {
+		return err
+	}
+	if len(children) > 0 {
+		showField("Subprojects", strings.Join(children, ", "))
 	}
 	if proj.Description != "" {
 		fmt.Println("\n" + proj.Description)
 	}
+	return nil
+}
+
+// pathHosts returns the sorted names of the hosts that proj has a path on.
+func pathHosts(proj *catalog.Project) []string {
+	hosts := make([]string, 0, len(proj.PerHost))
+	for h := range proj.PerHost {
+		if proj.HasPath(h) {
+			hosts = append(hosts, h)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// linkName returns the short name of the project with the given ID, or the
+// ID itself if no project has it.
+func linkName(cat catalog.Catalog, id catalog.ID) (string, error) {
+	sn, err := cat.ShortName(id)
+	if err != nil {
+		return "", err
+	}
+	if sn == "" {
+		return id.String() + " (missing)", nil
+	}
+	return sn, nil
+}
+
+// describeWC formats a working copy status for show.
+func describeWC(st *catalog.WCStatus, fmtTime func(time.Time) string) string {
+	s := st.ShortRevision()
+	if st.Branch != "" {
+		s = st.Branch + "@" + s
+	}
+	if st.Dirty {
+		s += ", dirty"
+	}
+	return s + ", checked " + fmtTime(st.CheckTime)
 }
 
 func showField(label string, args ...interface{}) {
@@ -295,39 +578,71 @@ func cmdImport(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
 	parseFlags(fset, args)
 	cat := requireCatalog()
 
+	// Each file is imported on its own: a file that can't be read or whose
+	// project is rejected is reported and skipped, and the rest are
+	// imported as a single change.
+	var projects []*catalog.Project
+	failed := false
 	if fset.NArg() == 0 {
-		if err := importProject(cat, os.Stdin); err != nil {
+		proj, err := catalog.DecodeProject(os.Stdin)
+		if err != nil {
 			return err
 		}
+		projects = append(projects, proj)
 	} else {
-		failed := false
 		for _, path := range fset.Args() {
-			f, err := os.Open(path)
-			if err == nil {
-				err := importProject(cat, f)
-				f.Close()
-				if err != nil {
-					failed = true
-					fmt.Fprintln(os.Stderr, err)
-				}
-			} else {
+			proj, err := decodeProjectFile(path)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				failed = true
+				continue
+			}
+			projects = append(projects, proj)
+		}
+	}
+	if len(projects) == 0 {
+		return errFailed
+	}
+
+	message := "import " + strconv.Itoa(len(projects)) + " projects"
+	if len(projects) == 1 {
+		message = "import project " + projects[0].ShortName
+	}
+	err := catalog.Batch(cat, message, func(tx catalog.Catalog) error {
+		imported := 0
+		for _, proj := range projects {
+			if err := tx.PutProject(proj); err != nil {
 				fmt.Fprintln(os.Stderr, err)
 				failed = true
+				continue
 			}
+			imported++
 		}
-		if failed {
+		if imported == 0 {
 			return errFailed
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if failed {
+		return errFailed
 	}
 	return nil
 }
 
-func importProject(cat catalog.Catalog, r io.Reader) error {
-	var proj catalog.Project
-	if err := json.NewDecoder(r).Decode(&proj); err != nil {
-		return err
+func decodeProjectFile(path string) (*catalog.Project, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	proj, err := catalog.DecodeProject(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
 	}
-	return cat.PutProject(&proj)
+	return proj, nil
 }
 
 func cmdRename(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
@@ -340,7 +655,7 @@ func cmdRename(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
 	cat := requireCatalog()
 
 	src, dst := fset.Arg(0), fset.Arg(1)
-	proj, err := cat.GetProject(src)
+	proj, err := findProject(cat, src)
 	if err != nil {
 		return err
 	}
@@ -351,192 +666,1337 @@ func cmdRename(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
 	return nil
 }
 
-func cmdDelete(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+func cmdRemote(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
 	fset := cmd.FlagSet(set)
+	add := fset.String("add", "", "name of a remote to add")
+	remove := fset.String("remove", "", "name of a remote to remove")
+	remoteURL := fset.String("url", "", "URL of the new remote")
+	vcsType := fset.String("vcs", "", "type of VCS for the new remote (default is the primary remote's)")
+	role := fset.String("role", string(catalog.RoleMirror), "role of the new remote ("+validRemoteRoleText+")")
 	parseFlags(fset, args)
-	if fset.NArg() == 0 {
+	if fset.NArg() != 1 || *add != "" && *remove != "" {
 		cmd.PrintSynopsis(set)
 		return exitError(exitUsage)
 	}
 	cat := requireCatalog()
 
-	failed := false
-	for _, name := range fset.Args() {
-		if err := cat.DelProject(name); err != nil {
-			failed = true
-			fmt.Fprintln(os.Stderr, err)
+	proj, err := findProject(cat, fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	switch {
+	case *add != "":
+		if proj.Remote(*add) != nil {
+			return &remoteExistsError{ShortName: proj.ShortName, Remote: *add}
+		}
+		if *remoteURL == "" {
+			return errRemoteURLNotSet
+		}
+		r := catalog.Remote{Name: *add, Type: *vcsType, URL: *remoteURL}
+		if r.Role, err = catalog.ParseRemoteRole(*role); err != nil {
+			return err
 		}
+		if r.Type == "" {
+			primary := proj.PrimaryRemote()
+			if primary == nil {
+				return errRemoteVCSNotSet
+			}
+			r.Type = primary.Type
+		} else if !isValidVCSType(r.Type) {
+			return badVCSError(r.Type)
+		}
+		proj.Remotes = append(proj.Remotes, r)
+		return cat.PutProject(proj)
+	case *remove != "":
+		if !proj.RemoveRemote(*remove) {
+			return &noRemoteError{ShortName: proj.ShortName, Remote: *remove}
+		}
+		return cat.PutProject(proj)
 	}
-	if failed {
-		return errFailed
+	for _, r := range proj.Remotes {
+		fmt.Printf("%s\t%s\t%s\t%s\n", r.Name, r.Role, r.Type, r.URL)
 	}
 	return nil
 }
 
-func cmdCheckout(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+func cmdParent(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
 	fset := cmd.FlagSet(set)
-	setPath := fset.Bool("setpath", true, "update the project's path to the new checkout")
-	overwritePath := fset.Bool("overwritepath", false, "change the project's path, even if there already is one")
+	clear := fset.Bool("clear", false, "make the project stand alone again")
 	parseFlags(fset, args)
-	if n := fset.NArg(); n == 0 || n > 2 {
+	if n := fset.NArg(); n != 1 && (n != 3 || *clear) {
 		cmd.PrintSynopsis(set)
 		return exitError(exitUsage)
 	}
-	shortName := fset.Arg(0)
-	path := shortName
-	if fset.NArg() == 2 {
-		path = fset.Arg(1)
-	}
-	absPath, err := filepath.Abs(filepath.Clean(path))
-	if err != nil {
-		return err
-	}
-	if *setPath && host == "" {
-		return errHostNotSet
-	}
 	cat := requireCatalog()
 
-	proj, err := cat.GetProject(shortName)
+	proj, err := findProject(cat, fset.Arg(0))
 	if err != nil {
 		return err
 	}
-	if proj.VCS == nil || proj.VCS.URL == "" {
-		return noVCSURLError(shortName)
-	}
-	if p := proj.Path(host); *setPath && p != "" && !*overwritePath {
-		return &projectHasPathError{ShortName: proj.ShortName, Path: p}
+	switch {
+	case *clear:
+		if proj.Parent == nil {
+			return nil
+		}
+		proj.Parent = nil
+		return cat.PutProject(proj)
+	case fset.NArg() == 3:
+		parent, err := findProject(cat, fset.Arg(1))
+		if err != nil {
+			return err
+		}
+		subdir := pathpkg.Clean(filepath.ToSlash(fset.Arg(2)))
+		if err := makeSubproject(cat, proj, parent, subdir); err != nil {
+			return err
+		}
+		return cat.PutProject(proj)
 	}
 
-	vt := proj.VCS.Type
-	vc := vcsImpl(vt)
-	if vc == nil {
-		return badVCSError(vt)
+	if proj.Parent == nil {
+		return errFailed
 	}
-	if _, err := vc.Checkout(proj.VCS.URL, absPath); err != nil {
+	parent, err := linkName(cat, proj.Parent.ID)
+	if err != nil {
 		return err
 	}
-	if *setPath {
-		proj.SetPath(host, absPath)
-		if err := cat.PutProject(proj); err != nil {
+	fmt.Println(parent + "\t" + proj.Parent.Subdir)
+	return nil
+}
+
+// makeSubproject places proj in subdir of parent.  proj's remotes are removed
+// if they are all remotes of the parent's repository, since the subproject
+// will use those instead.  Any paths that proj had are forgotten.
+func makeSubproject(cat catalog.Catalog, proj, parent *catalog.Project, subdir string) error {
+	if len(proj.Remotes) > 0 {
+		root, _, err := catalog.Root(cat, parent)
+		if err != nil {
 			return err
 		}
+		for _, r := range proj.Remotes {
+			if !hasRemoteURL(root, r.URL) {
+				return &subprojectRemoteError{ShortName: proj.ShortName, Remote: r.Name}
+			}
+		}
+		proj.Remotes = nil
 	}
+	for _, h := range pathHosts(proj) {
+		fmt.Fprintf(os.Stderr, "note: forgetting %s's path on %s (%s)\n", proj.ShortName, h, proj.PerHost[h].Path)
+	}
+	proj.PerHost = nil
+	proj.Parent = &catalog.ParentRef{ID: parent.ID, Subdir: subdir}
 	return nil
 }
 
-func cmdDescribe(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+// hasRemoteURL reports whether proj has a remote with the given URL.
+func hasRemoteURL(proj *catalog.Project, url string) bool {
+	for _, r := range proj.Remotes {
+		if r.URL == url {
+			return true
+		}
+	}
+	return false
+}
+
+func cmdLink(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+	return changeLink(set, cmd, args, true)
+}
+
+func cmdUnlink(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+	return changeLink(set, cmd, args, false)
+}
+
+// changeLink adds or removes the link given on the command line.
+func changeLink(set *subcmd.Set, cmd *subcmd.Command, args []string, add bool) error {
 	fset := cmd.FlagSet(set)
 	parseFlags(fset, args)
-	if fset.NArg() != 1 {
+	if fset.NArg() != 3 {
 		cmd.PrintSynopsis(set)
 		return exitError(exitUsage)
 	}
-	shortName := fset.Arg(0)
 	cat := requireCatalog()
 
-	proj, err := cat.GetProject(shortName)
+	linkType, err := catalog.ParseLinkType(fset.Arg(1))
 	if err != nil {
 		return err
 	}
-	desc := proj.Description
-	if desc, err = runEditor(desc); err != nil {
+	proj, err := findProject(cat, fset.Arg(0))
+	if err != nil {
 		return err
 	}
-	if desc == proj.Description {
-		// no change
-		return nil
+	var l catalog.Link
+	var targetName string
+	target, err := findProject(cat, fset.Arg(2))
+	if err == nil {
+		l = catalog.Link{Type: linkType, Target: target.ID}
+		targetName = target.ShortName
+	} else if !add && catalog.IsNotFound(err) {
+		// The target may have been deleted, leaving a dangling link that
+		// can only be named by its ID.
+		id, lerr := danglingLinkTarget(proj, linkType, fset.Arg(2))
+		if lerr != nil {
+			return lerr
+		}
+		if id == (catalog.ID{}) {
+			return err
+		}
+		l = catalog.Link{Type: linkType, Target: id}
+		targetName = id.String()
+	} else {
+		return err
+	}
+	if add {
+		if l.Target == proj.ID {
+			return errSelfLink
+		}
+		if !proj.AddLink(l) {
+			return nil
+		}
+	} else if !proj.RemoveLink(l) {
+		return &noLinkError{ShortName: proj.ShortName, Link: string(linkType) + " " + targetName}
 	}
-	proj.Description = strings.TrimRight(desc, "\r\n")
 	return cat.PutProject(proj)
 }
 
-func cmdSearch(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+// danglingLinkTarget returns the target of proj's link of type t whose ID
+// starts with prefix, or the zero ID if there is no such link.
+func danglingLinkTarget(proj *catalog.Project, t catalog.LinkType, prefix string) (catalog.ID, error) {
+	if len(prefix) < catalog.MinIDPrefixLen {
+		return catalog.ID{}, nil
+	}
+	var matches []catalog.ID
+	for _, l := range proj.Links {
+		if l.Type == t && strings.HasPrefix(l.Target.String(), prefix) {
+			matches = append(matches, l.Target)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return catalog.ID{}, nil
+	case 1:
+		return matches[0], nil
+	default:
+		return catalog.ID{}, &catalog.AmbiguousIDError{Prefix: prefix, IDs: matches}
+	}
+}
+
+func cmdGraph(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
 	fset := cmd.FlagSet(set)
+	typeList := fset.String("type", "", "only follow links of these comma-separated types ("+validLinkTypeText+")")
 	parseFlags(fset, args)
-	if fset.NArg() == 0 {
-		cmd.PrintSynopsis(set)
-		return exitError(exitUsage)
-	}
-	query := strings.Join(fset.Args(), " ")
 	cat := requireCatalog()
 
-	s, err := search.NewTextSearch(cat)
-	if err != nil {
-		return err
-	}
-	results, err := s.Search(query)
+	types, err := parseLinkTypeList(*typeList)
 	if err != nil {
 		return err
 	}
-	for i := range results {
-		r := &results[i]
-		fmt.Println(r.ShortName)
+	var roots []catalog.ID
+	for _, name := range fset.Args() {
+		proj, err := findProject(cat, name)
+		if err != nil {
+			return err
+		}
+		roots = append(roots, proj.ID)
+	}
+	return writeGraph(os.Stdout, cat, roots, types)
+}
+
+// parseLinkTypeList parses a comma-separated list of link types into a set.
+// An empty list returns a nil set.
+func parseLinkTypeList(s string) (map[catalog.LinkType]bool, error) {
+	if s == "" {
+		return nil, nil
+	}
+	set := make(map[catalog.LinkType]bool)
+	for _, name := range strings.Split(s, ",") {
+		t, err := catalog.ParseLinkType(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		set[t] = true
+	}
+	return set, nil
+}
+
+// writeGraph writes the links between projects in cat as a Graphviz DOT
+// digraph.  If roots is not empty, then only the projects reachable from
+// roots are included; otherwise every project with a link is included.  If
+// types is not nil, then only links of those types are followed.
+func writeGraph(w io.Writer, cat catalog.Catalog, roots []catalog.ID, types map[catalog.LinkType]bool) error {
+	names, err := cat.List()
+	if err != nil {
+		return err
+	}
+	byID := make(map[catalog.ID]*catalog.Project, len(names))
+	for _, sn := range names {
+		proj, err := cat.GetProject(sn)
+		if err != nil {
+			return err
+		}
+		byID[proj.ID] = proj
+	}
+	follow := func(l catalog.Link) bool {
+		return types == nil || types[l.Type]
+	}
+
+	nodes := make(map[catalog.ID]bool)
+	if len(roots) > 0 {
+		queue := append([]catalog.ID(nil), roots...)
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			if nodes[id] {
+				continue
+			}
+			nodes[id] = true
+			if proj := byID[id]; proj != nil {
+				for _, l := range proj.Links {
+					if follow(l) {
+						queue = append(queue, l.Target)
+					}
+				}
+			}
+		}
+	} else {
+		for id, proj := range byID {
+			for _, l := range proj.Links {
+				if follow(l) {
+					nodes[id] = true
+					nodes[l.Target] = true
+				}
+			}
+		}
+	}
+
+	nodeName := func(id catalog.ID) string {
+		if proj := byID[id]; proj != nil {
+			return proj.ShortName
+		}
+		return id.String()
+	}
+	nodeIDs := make(map[string]catalog.ID, len(nodes))
+	sorted := make([]string, 0, len(nodes))
+	for id := range nodes {
+		name := nodeName(id)
+		nodeIDs[name] = id
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var buf bytes.Buffer
+	buf.WriteString("digraph projects {\n")
+	for _, name := range sorted {
+		if proj := byID[nodeIDs[name]]; proj != nil {
+			fmt.Fprintf(&buf, "\t%s [label=%s];\n", dotQuote(name), dotQuote(proj.Name))
+		} else {
+			fmt.Fprintf(&buf, "\t%s [style=dashed];\n", dotQuote(name))
+		}
+	}
+	for _, name := range sorted {
+		proj := byID[nodeIDs[name]]
+		if proj == nil {
+			continue
+		}
+		for _, l := range proj.Links {
+			if follow(l) && nodes[l.Target] {
+				fmt.Fprintf(&buf, "\t%s -> %s [label=%s];\n", dotQuote(proj.ShortName), dotQuote(nodeName(l.Target)), dotQuote(string(l.Type)))
+			}
+		}
+	}
+	buf.WriteString("}\n")
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// dotQuote returns s as a DOT quoted string.
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
+
+func cmdDelete(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+	fset := cmd.FlagSet(set)
+	parseFlags(fset, args)
+	if fset.NArg() == 0 {
+		cmd.PrintSynopsis(set)
+		return exitError(exitUsage)
+	}
+	cat := requireCatalog()
+
+	code := exitSuccess
+	for _, name := range fset.Args() {
+		// Don't follow renames: deleting by a former name is likely a mistake.
+		proj, err := catalog.FindProject(cat, name)
+		if err == nil {
+			err = cat.DelProject(proj.ShortName)
+		}
+		if err != nil {
+			code = combineExit(code, err)
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	if code != exitSuccess {
+		return exitError(code)
+	}
+	return nil
+}
+
+func cmdTrash(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+	fset := cmd.FlagSet(set)
+	older := fset.String("older", "", "only purge projects deleted at least this long ago (like 30d or 12h)")
+	all := fset.Bool("all", false, "purge every project in the trash")
+	dryRun := fset.Bool("dryrun", false, "show the projects to purge without purging them")
+	rfc3339Time := fset.Bool("rfc3339", false, "print dates as RFC3339")
+	parseFlags(fset, args)
+	verb := "list"
+	if fset.NArg() > 0 {
+		verb = fset.Arg(0)
+		// Allow flags after the verb.
+		parseFlags(fset, fset.Args())
+	}
+	if verb != "list" && verb != "purge" || fset.NArg() != 0 {
+		cmd.PrintSynopsis(set)
+		return exitError(exitUsage)
+	}
+	if verb == "purge" {
+		// Purging can't be undone, so emptying the whole trash must be
+		// asked for explicitly.
+		if *all && *older != "" {
+			return errPurgeMutexFlags
+		}
+		if !*all && *older == "" {
+			return errPurgeAgeNotSet
+		}
+	}
+	fmtTime := fmtSimpleTime
+	if *rfc3339Time {
+		fmtTime = fmtRFC3339Time
+	}
+	cat := requireCatalog()
+	if _, ok := cat.(catalog.Trasher); !ok {
+		return errNoTrash
+	}
+
+	trash, err := catalog.GetTrash(cat)
+	if err != nil {
+		return err
+	}
+	if verb == "list" {
+		for _, tp := range trash {
+			fmt.Printf("%s\t%v\t%s\n", tp.Project.ShortName, tp.Project.ID, fmtTime(tp.DeleteTime))
+		}
+		return nil
+	}
+
+	before := time.Now()
+	if *older != "" {
+		age, err := parseAge(*older)
+		if err != nil {
+			return err
+		}
+		before = before.Add(-age)
+	}
+	if *dryRun {
+		for _, tp := range trash {
+			if tp.DeleteTime.Before(before) {
+				fmt.Printf("%s\t%v\n", tp.Project.ShortName, tp.Project.ID)
+			}
+		}
+		return nil
+	}
+	purged, err := catalog.PurgeTrash(cat, before)
+	if err != nil {
+		return err
+	}
+	for _, tp := range purged {
+		fmt.Printf("%s\t%v\n", tp.Project.ShortName, tp.Project.ID)
+	}
+	return nil
+}
+
+// parseAge parses a duration like time.ParseDuration, but also accepts a
+// whole number of days, like "30d".
+func parseAge(s string) (time.Duration, error) {
+	if n := strings.TrimSuffix(s, "d"); n != s {
+		days, err := strconv.Atoi(n)
+		if err != nil || days < 0 {
+			return 0, usageError("invalid age " + strconv.Quote(s))
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, usageError("invalid age " + strconv.Quote(s))
+	}
+	return d, nil
+}
+
+func cmdRestore(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+	fset := cmd.FlagSet(set)
+	name := fset.String("name", "", "short name to restore the project as (default is the name it was deleted with)")
+	parseFlags(fset, args)
+	if fset.NArg() != 1 {
+		cmd.PrintSynopsis(set)
+		return exitError(exitUsage)
+	}
+	cat := requireCatalog()
+	trasher, ok := cat.(catalog.Trasher)
+	if !ok {
+		return errNoTrash
+	}
+
+	trash, err := trasher.Trash()
+	if err != nil {
+		return err
+	}
+	tp, err := catalog.FindTrashed(trash, fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	return trasher.RestoreProject(tp.Project.ID, *name)
+}
+
+func cmdHistory(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+	fset := cmd.FlagSet(set)
+	rfc3339Time := fset.Bool("rfc3339", false, "print dates as RFC3339")
+	parseFlags(fset, args)
+	if fset.NArg() != 1 {
+		cmd.PrintSynopsis(set)
+		return exitError(exitUsage)
+	}
+	fmtTime := fmtSimpleTime
+	if *rfc3339Time {
+		fmtTime = fmtRFC3339Time
+	}
+	cat := requireCatalog()
+
+	// Deleted projects have history too.
+	var id catalog.ID
+	if proj, err := findProject(cat, fset.Arg(0)); err == nil {
+		id = proj.ID
+	} else if catalog.IsNotFound(err) {
+		trash, terr := catalog.GetTrash(cat)
+		if terr != nil {
+			return terr
+		}
+		tp, terr := catalog.FindTrashed(trash, fset.Arg(0))
+		if terr != nil {
+			return err
+		}
+		id = tp.Project.ID
+	} else {
+		return err
+	}
+
+	wc, err := catalogLogger()
+	if err != nil {
+		return err
+	}
+	versions, err := catalog.History(wc, id)
+	if err != nil {
+		return err
+	}
+	writeHistory(os.Stdout, versions, fmtTime)
+	return nil
+}
+
+// writeHistory prints a project's versions, each as a changeset line followed
+// by its message and indented field changes.
+func writeHistory(w io.Writer, versions []*catalog.ProjectVersion, fmtTime func(time.Time) string) {
+	for i, v := range versions {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%v\t%s\t%s\n", v.Rev, fmtTime(v.Time), v.Author)
+		if v.Message != "" {
+			fmt.Fprintln(w, "\t"+v.Message)
+		}
+		var prev *catalog.ProjectVersion
+		if i+1 < len(versions) {
+			prev = versions[i+1]
+		}
+		switch {
+		case v.Project == nil:
+			fmt.Fprintln(w, "\tremoved from the catalog")
+		case v.Deleted && (prev == nil || !prev.Deleted):
+			fmt.Fprintln(w, "\tmoved to the trash")
+		case !v.Deleted && prev != nil && prev.Deleted:
+			fmt.Fprintln(w, "\trestored from the trash")
+		}
+		for _, c := range v.Changes {
+			switch {
+			case c.Old == "":
+				fmt.Fprintf(w, "\t+ %s: %s\n", c.Field, c.New)
+			case c.New == "":
+				fmt.Fprintf(w, "\t- %s: %s\n", c.Field, c.Old)
+			default:
+				fmt.Fprintf(w, "\t~ %s: %s -> %s\n", c.Field, c.Old, c.New)
+			}
+		}
+	}
+}
+
+func cmdCheckout(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+	fset := cmd.FlagSet(set)
+	setPath := fset.Bool("setpath", true, "update the project's path to the new checkout")
+	overwritePath := fset.Bool("overwritepath", false, "change the project's path, even if there already is one")
+	remoteName := fset.String("remote", "", "name of the remote to check out (default is the primary remote)")
+	parseFlags(fset, args)
+	if n := fset.NArg(); n == 0 || n > 2 {
+		cmd.PrintSynopsis(set)
+		return exitError(exitUsage)
+	}
+	if *setPath && host == "" {
+		return errHostNotSet
+	}
+	cat := requireCatalog()
+
+	proj, err := findProject(cat, fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	env, err := hostPathEnv(cat)
+	if err != nil {
+		return err
+	}
+	if proj.Parent != nil {
+		// Subprojects are checked out as part of their root project.
+		root, _, err := catalog.Root(cat, proj)
+		if err != nil {
+			return err
+		}
+		if rootPath, err := root.ExpandPath(host, env); err != nil {
+			return err
+		} else if rootPath != "" && isDir(rootPath) {
+			fmt.Fprintf(os.Stderr, "note: %s is already checked out at %s\n", root.ShortName, rootPath)
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "note: checking out %s, which contains %s\n", root.ShortName, proj.ShortName)
+		proj = root
+	}
+	path := proj.ShortName
+	if fset.NArg() == 2 {
+		path = fset.Arg(1)
+	} else if env.Root != "" {
+		path = filepath.Join(env.Root, proj.ShortName)
+	}
+	absPath, err := filepath.Abs(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	var remote *catalog.Remote
+	if *remoteName != "" {
+		remote = proj.Remote(*remoteName)
+		if remote == nil {
+			return &noRemoteError{ShortName: proj.ShortName, Remote: *remoteName}
+		}
+	} else {
+		remote = proj.PrimaryRemote()
+	}
+	if remote == nil || remote.URL == "" {
+		return noVCSURLError(proj.ShortName)
+	}
+	if *setPath && proj.HasPath(host) && !*overwritePath {
+		p := proj.Path(host)
+		return &projectHasPathError{ShortName: proj.ShortName, Path: p}
+	}
+
+	vt := remote.Type
+	vc := vcsImpl(vt)
+	if vc == nil {
+		return badVCSError(vt)
+	}
+	if _, err := vc.Checkout(remote.URL, absPath); err != nil {
+		return err
+	}
+	if *setPath {
+		proj.SetPath(host, env.Portable(absPath))
+		if err := cat.PutProject(proj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isDir reports whether path names an existing directory.
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+func cmdDescribe(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+	fset := cmd.FlagSet(set)
+	parseFlags(fset, args)
+	if fset.NArg() != 1 {
+		cmd.PrintSynopsis(set)
+		return exitError(exitUsage)
+	}
+	cat := requireCatalog()
+
+	proj, err := findProject(cat, fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	desc := proj.Description
+	if desc, err = runEditor(desc); err != nil {
+		return err
+	}
+	if desc == proj.Description {
+		// no change
+		return nil
+	}
+	proj.Description = strings.TrimRight(desc, "\r\n")
+	return cat.PutProject(proj)
+}
+
+func cmdNote(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+	fset := cmd.FlagSet(set)
+	message := fset.String("m", "", "text of the note (default is to open an editor)")
+	parseFlags(fset, args)
+	if fset.NArg() != 1 {
+		cmd.PrintSynopsis(set)
+		return exitError(exitUsage)
+	}
+	cat := requireCatalog()
+
+	proj, err := findProject(cat, fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	text := *message
+	if text == "" {
+		if text, err = runEditor(""); err != nil {
+			return err
+		}
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		// empty note
+		return nil
+	}
+	proj.AddNote(time.Now(), host, text)
+	return cat.PutProject(proj)
+}
+
+func cmdNotes(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+	fset := cmd.FlagSet(set)
+	rfc3339Time := fset.Bool("rfc3339", false, "print dates as RFC3339")
+	parseFlags(fset, args)
+	if fset.NArg() != 1 {
+		cmd.PrintSynopsis(set)
+		return exitError(exitUsage)
+	}
+	fmtTime := fmtSimpleTime
+	if *rfc3339Time {
+		fmtTime = fmtRFC3339Time
+	}
+	cat := requireCatalog()
+
+	proj, err := findProject(cat, fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	writeNotes(os.Stdout, proj.Notes, fmtTime)
+	return nil
+}
+
+// writeNotes prints a journal, with each note's text indented under its
+// date and host.
+func writeNotes(w io.Writer, notes []catalog.Note, fmtTime func(time.Time) string) {
+	for i, n := range notes {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if n.Host != "" {
+			fmt.Fprintln(w, fmtTime(n.Time), "on", n.Host)
+		} else {
+			fmt.Fprintln(w, fmtTime(n.Time))
+		}
+		for _, line := range strings.Split(n.Text, "\n") {
+			if line == "" {
+				fmt.Fprintln(w)
+			} else {
+				fmt.Fprintln(w, "\t"+line)
+			}
+		}
+	}
+}
+
+func cmdAttach(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+	fset := cmd.FlagSet(set)
+	name := fset.String("name", "", "name of the attachment (default is the file's name)")
+	parseFlags(fset, args)
+	if fset.NArg() < 2 {
+		cmd.PrintSynopsis(set)
+		return exitError(exitUsage)
+	}
+	files := fset.Args()[1:]
+	if *name != "" && len(files) > 1 {
+		return errAttachNameMultiple
+	}
+	cat := requireCatalog()
+	if _, ok := cat.(catalog.Attacher); !ok {
+		return errNoAttachments
+	}
+
+	proj, err := findProject(cat, fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(files))
+	for i, path := range files {
+		names[i] = filepath.Base(path)
+		if *name != "" {
+			names[i] = *name
+		}
+	}
+	message := "attach " + strings.Join(names, ", ") + " to " + proj.ShortName
+	return catalog.Batch(cat, message, func(tx catalog.Catalog) error {
+		for i, path := range files {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if err := tx.(catalog.Attacher).PutAttachment(proj.ID, names[i], data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func cmdDetach(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+	fset := cmd.FlagSet(set)
+	parseFlags(fset, args)
+	if fset.NArg() < 2 {
+		cmd.PrintSynopsis(set)
+		return exitError(exitUsage)
+	}
+	names := fset.Args()[1:]
+	cat := requireCatalog()
+	if _, ok := cat.(catalog.Attacher); !ok {
+		return errNoAttachments
+	}
+
+	proj, err := findProject(cat, fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	message := "detach " + strings.Join(names, ", ") + " from " + proj.ShortName
+	return catalog.Batch(cat, message, func(tx catalog.Catalog) error {
+		for _, name := range names {
+			if err := tx.(catalog.Attacher).DelAttachment(proj.ID, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func cmdAttachments(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+	fset := cmd.FlagSet(set)
+	parseFlags(fset, args)
+	if fset.NArg() != 1 {
+		cmd.PrintSynopsis(set)
+		return exitError(exitUsage)
+	}
+	cat := requireCatalog()
+
+	proj, err := findProject(cat, fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	list, err := catalog.GetAttachments(cat, proj.ID)
+	if err != nil {
+		return err
+	}
+	for _, a := range list {
+		fmt.Printf("%s\t%d\n", a.Name, a.Size)
 	}
 	return nil
 }
 
-func cmdVerify(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+func cmdHostSync(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+	fset := cmd.FlagSet(set)
+	parseFlags(fset, args)
+	if host == "" {
+		return errHostNotSet
+	}
+	cat := requireCatalog()
+
+	var projects []*catalog.Project
+	if fset.NArg() == 0 {
+		names, err := cat.List()
+		if err != nil {
+			return err
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			proj, err := cat.GetProject(name)
+			if err != nil {
+				return err
+			}
+			if proj.HasPath(host) {
+				projects = append(projects, proj)
+			}
+		}
+	} else {
+		for _, name := range fset.Args() {
+			proj, err := findProject(cat, name)
+			if err != nil {
+				return err
+			}
+			if !proj.HasPath(host) {
+				return noPathError(proj.ShortName)
+			}
+			projects = append(projects, proj)
+		}
+	}
+
+	env, err := hostPathEnv(cat)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	code := exitSuccess
+	type syncedWC struct {
+		id     catalog.ID
+		path   string // as stored in the catalog
+		status *catalog.WCStatus
+	}
+	synced := make([]syncedWC, 0, len(projects))
+	for _, proj := range projects {
+		path, err := proj.ExpandPath(host, env)
+		var st *catalog.WCStatus
+		if err == nil {
+			st, err = checkWorkingCopy(path, now)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", proj.ShortName, err)
+			code = combineExit(code, err)
+			continue
+		}
+		synced = append(synced, syncedWC{proj.ID, proj.Path(host), st})
+	}
+	if len(synced) > 0 {
+		// Checking the working copies can take a while, so the projects are
+		// read again to keep any changes made in the meantime.  Projects
+		// that were deleted or moved since are left alone.
+		err := catalog.Batch(cat, "sync working copies on "+host, func(tx catalog.Catalog) error {
+			for _, s := range synced {
+				proj, err := tx.GetProjectByID(s.id)
+				if catalog.IsNotFound(err) {
+					continue
+				} else if err != nil {
+					return err
+				}
+				info := proj.PerHost[host]
+				if info == nil || info.Path != s.path {
+					continue
+				}
+				info.WC = s.status
+				if err := tx.PutProject(proj); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if code != exitSuccess {
+		return exitError(code)
+	}
+	return nil
+}
+
+// checkWorkingCopy examines the working copy at path.
+func checkWorkingCopy(path string, now time.Time) (*catalog.WCStatus, error) {
+	wc, err := vcs.OpenWorkingCopy(path)
+	if err != nil {
+		return nil, err
+	} else if wc == nil {
+		return nil, notWorkingCopyError(path)
+	}
+	rev, err := wc.Current()
+	if err != nil {
+		return nil, err
+	}
+	st := &catalog.WCStatus{Revision: rev.Rev(), CheckTime: now}
+	if sr, ok := wc.(vcs.StatusReporter); ok {
+		if st.Branch, err = sr.Branch(); err != nil {
+			return nil, err
+		}
+		if st.Dirty, err = sr.IsDirty(); err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+func cmdHost(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
 	fset := cmd.FlagSet(set)
+	description := fset.String("description", "", "description of the new host")
+	hostOS := fset.String("os", "", "operating system of the new host")
+	root := fset.String("root", "", "directory that projects are checked out into on the new host")
 	parseFlags(fset, args)
+	verb := "list"
 	if fset.NArg() > 0 {
+		verb = fset.Arg(0)
+		// Allow flags after the verb.
+		parseFlags(fset, fset.Args())
+	}
+	var nargs int
+	switch verb {
+	case "list":
+		nargs = 0
+	case "add", "remove":
+		nargs = 1
+	case "rename":
+		nargs = 2
+	default:
+		cmd.PrintSynopsis(set)
+		return exitError(exitUsage)
+	}
+	if fset.NArg() != nargs {
 		cmd.PrintSynopsis(set)
 		return exitError(exitUsage)
 	}
 	cat := requireCatalog()
 
-	const catalogName = "catalog.json"
-	var c struct {
-		ShortNameMap map[string]string `json:"id_to_shortname"`
+	switch verb {
+	case "add":
+		return addHost(cat, catalog.Host{
+			Name:         fset.Arg(0),
+			Description:  *description,
+			OS:           *hostOS,
+			CheckoutRoot: *root,
+		})
+	case "rename":
+		return catalog.RenameHost(cat, fset.Arg(0), fset.Arg(1))
+	case "remove":
+		return catalog.RemoveHost(cat, fset.Arg(0))
 	}
-	if err := readJSON(filepath.Join(catalogPath, catalogName), &c); err != nil {
+
+	hosts, err := catalog.GetHosts(cat)
+	if err != nil {
+		return err
+	}
+	used, err := catalog.UsedHosts(cat)
+	if err != nil {
 		return err
 	}
+	for _, h := range hosts.Hosts {
+		fmt.Println(strings.TrimRight(h.Name+"\t"+h.OS+"\t"+h.CheckoutRoot, "\t"))
+		if h.Description != "" {
+			fmt.Println("\t" + h.Description)
+		}
+	}
+	for _, name := range used {
+		if hosts.Host(name) == nil {
+			fmt.Println(name + "\t(not registered)")
+		}
+	}
+	return nil
+}
 
-	failed := false
-	names, err := cat.List()
+// addHost adds h to the catalog's host registry.  When the registry is first
+// created, the hosts that projects already use are registered too, so that
+// existing projects stay valid.
+func addHost(cat catalog.Catalog, h catalog.Host) error {
+	hr, ok := cat.(catalog.HostRegistrar)
+	if !ok {
+		return errNoHosts
+	}
+	hosts, err := hr.Hosts()
 	if err != nil {
 		return err
 	}
-	idealMap := make(map[string]string, len(names))
-	for _, sn := range names {
-		p, err := cat.GetProject(sn)
+	if hosts.Host(h.Name) != nil {
+		return &catalog.HostError{Name: h.Name, Err: catalog.ErrHostExists}
+	}
+	if len(hosts.Hosts) == 0 {
+		used, err := catalog.UsedHosts(cat)
 		if err != nil {
 			return err
 		}
-		idstr := p.ID.String()
-		if other, ok := idealMap[idstr]; ok {
-			fmt.Printf("ID conflict: %s used for %s and %s\n", idstr, other, sn)
-			failed = true
+		for _, name := range used {
+			if name != h.Name {
+				fmt.Fprintln(os.Stderr, "note: registering existing host", name)
+				hosts.Hosts = append(hosts.Hosts, catalog.Host{Name: name})
+			}
 		}
-		idealMap[p.ID.String()] = sn
 	}
-	for k, ideal := range idealMap {
-		if actual, ok := c.ShortNameMap[k]; !ok {
-			fmt.Printf("Expected ID %s -> %s, but no entry was found\n", k, ideal)
-			failed = true
-		} else if actual != ideal {
-			fmt.Printf("Expected ID %s -> %s, but found %s\n", k, ideal, actual)
-			failed = true
+	hosts.Hosts = append(hosts.Hosts, h)
+	return hr.PutHosts(hosts)
+}
+
+func cmdRelocate(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+	fset := cmd.FlagSet(set)
+	dryRun := fset.Bool("dryrun", false, "show the changes without modifying the catalog")
+	parseFlags(fset, args)
+	if fset.NArg() != 2 {
+		cmd.PrintSynopsis(set)
+		return exitError(exitUsage)
+	}
+	if host == "" {
+		return errHostNotSet
+	}
+	cat := requireCatalog()
+	env, err := hostPathEnv(cat)
+	if err != nil {
+		return err
+	}
+	oldPrefix, err := expandPathArg(env, fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	newPrefix, err := expandPathArg(env, fset.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	message := "relocate projects on " + host + " from " + oldPrefix + " to " + newPrefix
+	err = catalog.Batch(cat, message, func(tx catalog.Catalog) error {
+		names, err := tx.List()
+		if err != nil {
+			return err
+		}
+		sort.Strings(names)
+		moved := 0
+		for _, name := range names {
+			proj, err := tx.GetProject(name)
+			if err != nil {
+				return err
+			}
+			if !proj.HasPath(host) {
+				continue
+			}
+			p, err := proj.ExpandPath(host, env)
+			if err != nil {
+				return &catalog.ProjectError{ShortName: proj.ShortName, Op: "relocate", Err: err}
+			}
+			newPath, ok := catalog.RelocatePath(p, oldPrefix, newPrefix)
+			if !ok {
+				continue
+			}
+			fmt.Printf("%s: %s -> %s\n", proj.ShortName, p, newPath)
+			moved++
+			if *dryRun {
+				continue
+			}
+			proj.SetPath(host, env.Portable(newPath))
+			if err := tx.PutProject(proj); err != nil {
+				return err
+			}
+		}
+		if *dryRun || moved == 0 {
+			return errNoChange
 		}
+		return nil
+	})
+	if err == errNoChange {
+		return nil
+	}
+	return err
+}
+
+// expandPathArg returns the absolute form of a path given on the command
+// line, which may be portable.
+func expandPathArg(env *catalog.PathEnv, arg string) (string, error) {
+	p, err := env.Expand(arg)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(p)
+}
+
+func cmdSearch(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+	fset := cmd.FlagSet(set)
+	parseFlags(fset, args)
+	if fset.NArg() == 0 {
+		cmd.PrintSynopsis(set)
+		return exitError(exitUsage)
+	}
+	query := strings.Join(fset.Args(), " ")
+	cat := requireCatalog()
+
+	s, err := search.NewTextSearch(cat)
+	if err != nil {
+		return err
+	}
+	results, err := s.Search(query)
+	if err != nil {
+		return err
+	}
+	for i := range results {
+		r := &results[i]
+		fmt.Println(r.ShortName)
+	}
+	return nil
+}
+
+func cmdVerify(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+	fset := cmd.FlagSet(set)
+	fix := fset.Bool("fix", false, "repair problems that can be fixed automatically and commit the repairs")
+	parseFlags(fset, args)
+	if fset.NArg() > 0 {
+		cmd.PrintSynopsis(set)
+		return exitError(exitUsage)
 	}
-	for k, actual := range c.ShortNameMap {
-		if _, ok := idealMap[k]; !ok {
-			fmt.Printf("Found extra ID mapping: %s -> %s\n", k, actual)
+	cat := requireCatalog()
+
+	var problems []catalog.Problem
+	var err error
+	if *fix {
+		problems, err = catalog.Repair(cat)
+	} else {
+		problems, err = catalog.Verify(cat)
+	}
+	if err != nil {
+		return err
+	}
+	failed := false
+	for _, p := range problems {
+		fmt.Println(p)
+		if !p.Fixed {
 			failed = true
 		}
 	}
-
 	if failed {
 		return errFailed
 	}
 	return nil
 }
 
-func readJSON(path string, v interface{}) error {
-	f, err := os.Open(path)
+func cmdSchema(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+	fset := cmd.FlagSet(set)
+	add := fset.String("add", "", "define a new field")
+	remove := fset.String("remove", "", "remove a field's definition")
+	fieldType := fset.String("type", string(catalog.TextField), "type of the new field ("+validFieldTypeText+")")
+	values := fset.String("values", "", "comma-separated list of the new field's allowed values")
+	required := fset.Bool("required", false, "require new projects to have the field (verify reports existing projects without it)")
+	description := fset.String("description", "", "description of the new field")
+	parseFlags(fset, args)
+	if fset.NArg() != 0 || *add != "" && *remove != "" {
+		cmd.PrintSynopsis(set)
+		return exitError(exitUsage)
+	}
+	cat := requireCatalog()
+	sc, ok := cat.(catalog.Schemer)
+	if !ok {
+		return errNoSchema
+	}
+	fieldSchema, err := sc.Schema()
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	return json.NewDecoder(f).Decode(v)
+
+	switch {
+	case *add != "":
+		if fieldSchema.Field(*add) != nil {
+			return fieldExistsError(*add)
+		}
+		def := catalog.FieldDef{
+			Name:        *add,
+			Type:        catalog.FieldType(*fieldType),
+			Description: *description,
+			Required:    *required,
+		}
+		if *values != "" {
+			def.Values = strings.Split(*values, ",")
+		}
+		fieldSchema.Fields = append(fieldSchema.Fields, def)
+		return sc.PutSchema(fieldSchema)
+	case *remove != "":
+		for i := range fieldSchema.Fields {
+			if fieldSchema.Fields[i].Name == *remove {
+				fieldSchema.Fields = append(fieldSchema.Fields[:i], fieldSchema.Fields[i+1:]...)
+				return sc.PutSchema(fieldSchema)
+			}
+		}
+		return &catalog.FieldError{Field: *remove, Err: catalog.ErrUnknownField}
+	}
+
+	for _, def := range fieldSchema.Fields {
+		line := def.Name + "\t" + string(def.Type)
+		if def.Required {
+			line += "\trequired"
+		}
+		if len(def.Values) > 0 {
+			line += "\tone of " + strings.Join(def.Values, ", ")
+		}
+		fmt.Println(line)
+		if def.Description != "" {
+			fmt.Println("\t" + def.Description)
+		}
+	}
+	return nil
+}
+
+func cmdUnlock(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+	fset := cmd.FlagSet(set)
+	force := fset.Bool("force", false, "break the lock even if its holder might still be running")
+	parseFlags(fset, args)
+	if fset.NArg() != 0 {
+		cmd.PrintSynopsis(set)
+		return exitError(exitUsage)
+	}
+	if catalogPath == "" {
+		return errCatalogPathNotSet
+	}
+
+	info, err := catalog.ReadLock(catalogPath)
+	if err != nil {
+		return err
+	}
+	if info == nil {
+		fmt.Println("catalog is not locked")
+		return nil
+	}
+	fmt.Println("catalog locked by", info)
+	if !info.Stale() && !*force {
+		return errLockHeld
+	}
+	if err := catalog.BreakLock(catalogPath, info); err != nil {
+		return err
+	}
+	fmt.Println("lock broken")
+	return nil
+}
+
+func cmdUpgrade(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
+	fset := cmd.FlagSet(set)
+	dryRun := fset.Bool("dryrun", false, "show the changes without modifying the catalog")
+	parseFlags(fset, args)
+	if fset.NArg() != 0 {
+		cmd.PrintSynopsis(set)
+		return exitError(exitUsage)
+	}
+	if catalogPath == "" {
+		return errCatalogPathNotSet
+	}
+
+	var v vcs.VCS
+	if !*dryRun {
+		v = catalogVCS()
+	}
+	steps, err := catalog.UpgradeWithOptions(catalogPath, v, *dryRun, &catalog.Options{
+		LockTimeout:     lockWait,
+		BreakStaleLocks: true,
+	})
+	for _, step := range steps {
+		fmt.Printf("version %d -> %d: %s\n", step.From, step.To, step.Description)
+		for _, f := range step.Files {
+			fmt.Println("\t" + f)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(steps) == 0 {
+		fmt.Printf("catalog is up to date (version %d)\n", catalog.Version)
+	}
+	return nil
 }
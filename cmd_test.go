@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"bitbucket.org/zombiezen/blackforest/catalog"
+	"bitbucket.org/zombiezen/blackforest/vcs"
+)
+
+func TestParseStatusList(t *testing.T) {
+	tests := []struct {
+		s    string
+		want map[catalog.Status]bool
+		ok   bool
+	}{
+		{"", nil, true},
+		{"archived", map[catalog.Status]bool{catalog.StatusArchived: true}, true},
+		{"active, maintained", map[catalog.Status]bool{catalog.StatusActive: true, catalog.StatusMaintained: true}, true},
+		{"active,dead", nil, false},
+	}
+	for _, test := range tests {
+		set, err := parseStatusList(test.s)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("parseStatusList(%q) = %v; want error", test.s, set)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseStatusList(%q) error: %v", test.s, err)
+		} else if !reflect.DeepEqual(set, test.want) {
+			t.Errorf("parseStatusList(%q) = %v; want %v", test.s, set, test.want)
+		}
+	}
+}
+
+func TestParseLinkTypeList(t *testing.T) {
+	tests := []struct {
+		s    string
+		want map[catalog.LinkType]bool
+		ok   bool
+	}{
+		{"", nil, true},
+		{"part-of", map[catalog.LinkType]bool{catalog.PartOf: true}, true},
+		{"depends-on, forked-from", map[catalog.LinkType]bool{catalog.DependsOn: true, catalog.ForkedFrom: true}, true},
+		{"depends-on,blocks", nil, false},
+	}
+	for _, test := range tests {
+		set, err := parseLinkTypeList(test.s)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("parseLinkTypeList(%q) = %v; want error", test.s, set)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseLinkTypeList(%q) error: %v", test.s, err)
+		} else if !reflect.DeepEqual(set, test.want) {
+			t.Errorf("parseLinkTypeList(%q) = %v; want %v", test.s, set, test.want)
+		}
+	}
+}
+
+func TestWriteGraph(t *testing.T) {
+	cat := catalog.NewMemory()
+	missing := catalog.ID{9}
+	projects := []*catalog.Project{
+		{ID: catalog.ID{1}, ShortName: "lib", Name: `The "lib"`},
+		{ID: catalog.ID{2}, ShortName: "app", Name: "App", Links: []catalog.Link{{Type: catalog.DependsOn, Target: catalog.ID{1}}}},
+		{ID: catalog.ID{3}, ShortName: "fork", Name: "Fork", Links: []catalog.Link{{Type: catalog.ForkedFrom, Target: catalog.ID{2}}, {Type: catalog.DependsOn, Target: missing}}},
+		{ID: catalog.ID{4}, ShortName: "alone", Name: "Alone"},
+	}
+	for _, p := range projects {
+		if err := cat.PutProject(p); err != nil {
+			t.Fatal("PutProject error:", err)
+		}
+	}
+	tests := []struct {
+		roots []catalog.ID
+		types map[catalog.LinkType]bool
+		want  string
+	}{
+		{
+			nil,
+			nil,
+			"digraph projects {\n" +
+				"\t\"" + missing.String() + "\" [style=dashed];\n" +
+				"\t\"app\" [label=\"App\"];\n" +
+				"\t\"fork\" [label=\"Fork\"];\n" +
+				"\t\"lib\" [label=\"The \\\"lib\\\"\"];\n" +
+				"\t\"app\" -> \"lib\" [label=\"depends-on\"];\n" +
+				"\t\"fork\" -> \"app\" [label=\"forked-from\"];\n" +
+				"\t\"fork\" -> \"" + missing.String() + "\" [label=\"depends-on\"];\n" +
+				"}\n",
+		},
+		{
+			[]catalog.ID{{2}},
+			nil,
+			"digraph projects {\n" +
+				"\t\"app\" [label=\"App\"];\n" +
+				"\t\"lib\" [label=\"The \\\"lib\\\"\"];\n" +
+				"\t\"app\" -> \"lib\" [label=\"depends-on\"];\n" +
+				"}\n",
+		},
+		{
+			[]catalog.ID{{3}},
+			map[catalog.LinkType]bool{catalog.ForkedFrom: true},
+			"digraph projects {\n" +
+				"\t\"app\" [label=\"App\"];\n" +
+				"\t\"fork\" [label=\"Fork\"];\n" +
+				"\t\"fork\" -> \"app\" [label=\"forked-from\"];\n" +
+				"}\n",
+		},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := writeGraph(&buf, cat, test.roots, test.types); err != nil {
+			t.Errorf("writeGraph(%v, %v) error: %v", test.roots, test.types, err)
+			continue
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("writeGraph(%v, %v) =\n%s\nwant\n%s", test.roots, test.types, got, test.want)
+		}
+	}
+}
+
+func TestDanglingLinkTarget(t *testing.T) {
+	gone1 := catalog.ID{1, 1, 1, 1}
+	gone2 := catalog.ID{1, 1, 1, 2}
+	proj := &catalog.Project{ID: catalog.ID{3}, ShortName: "app", Links: []catalog.Link{
+		{Type: catalog.DependsOn, Target: gone1},
+		{Type: catalog.DependsOn, Target: gone2},
+		{Type: catalog.ForkedFrom, Target: gone2},
+	}}
+	tests := []struct {
+		t      catalog.LinkType
+		prefix string
+		want   catalog.ID
+		ok     bool
+	}{
+		{catalog.DependsOn, gone1.String(), gone1, true},
+		{catalog.ForkedFrom, gone2.String()[:catalog.MinIDPrefixLen], gone2, true},
+		{catalog.DependsOn, gone2.String()[:1], catalog.ID{}, true},
+		{catalog.PartOf, gone1.String(), catalog.ID{}, true},
+		{catalog.DependsOn, gone1.String()[:catalog.MinIDPrefixLen], catalog.ID{}, false},
+	}
+	for _, test := range tests {
+		id, err := danglingLinkTarget(proj, test.t, test.prefix)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("danglingLinkTarget(%v, %q) = %v; want error", test.t, test.prefix, id)
+			}
+			continue
+		}
+		if err != nil || id != test.want {
+			t.Errorf("danglingLinkTarget(%v, %q) = %v, %v; want %v", test.t, test.prefix, id, err, test.want)
+		}
+	}
+}
+
+func TestAddHost(t *testing.T) {
+	cat := catalog.NewMemory()
+	proj := &catalog.Project{ID: catalog.ID{1}, ShortName: "foo"}
+	proj.SetPath("old", "/src/foo")
+	if err := cat.PutProject(proj); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+	if err := addHost(cat, catalog.Host{Name: "laptop", OS: "linux"}); err != nil {
+		t.Fatal("addHost error:", err)
+	}
+	hosts, err := cat.Hosts()
+	if err != nil {
+		t.Fatal("Hosts error:", err)
+	}
+	want := []catalog.Host{{Name: "old"}, {Name: "laptop", OS: "linux"}}
+	if !reflect.DeepEqual(hosts.Hosts, want) {
+		t.Errorf("hosts = %+v; want %+v", hosts.Hosts, want)
+	}
+	if err := addHost(cat, catalog.Host{Name: "laptop"}); err == nil {
+		t.Error("adding laptop twice succeeded")
+	}
+}
+
+func TestMakeSubproject(t *testing.T) {
+	cat := catalog.NewMemory()
+	mono := &catalog.Project{
+		ID:        catalog.ID{1},
+		ShortName: "mono",
+		Remotes:   []catalog.Remote{{Name: "origin", Role: catalog.RolePrimary, Type: catalog.Git, URL: "https://example.com/mono.git"}},
+	}
+	if err := cat.PutProject(mono); err != nil {
+		t.Fatal("PutProject error:", err)
+	}
+
+	lib := &catalog.Project{
+		ID:        catalog.ID{2},
+		ShortName: "lib",
+		Remotes:   []catalog.Remote{{Name: "origin", Role: catalog.RolePrimary, Type: catalog.Git, URL: "https://example.com/mono.git"}},
+		PerHost:   map[string]*catalog.HostInfo{"laptop": {Path: "/src/mono-lib"}},
+	}
+	if err := makeSubproject(cat, lib, mono, "lib"); err != nil {
+		t.Fatal("makeSubproject error:", err)
+	}
+	if lib.Remotes != nil || lib.PerHost != nil {
+		t.Errorf("after makeSubproject, lib.Remotes = %+v, lib.PerHost = %v; want nil", lib.Remotes, lib.PerHost)
+	}
+	if want := (&catalog.ParentRef{ID: mono.ID, Subdir: "lib"}); !reflect.DeepEqual(lib.Parent, want) {
+		t.Errorf("lib.Parent = %+v; want %+v", lib.Parent, want)
+	}
+	if err := cat.PutProject(lib); err != nil {
+		t.Error("PutProject(lib) error:", err)
+	}
+
+	other := &catalog.Project{
+		ID:        catalog.ID{3},
+		ShortName: "other",
+		Remotes:   []catalog.Remote{{Name: "origin", Role: catalog.RolePrimary, Type: catalog.Git, URL: "https://example.com/other.git"}},
+	}
+	if err := makeSubproject(cat, other, mono, "other"); err == nil {
+		t.Error("makeSubproject with a different remote succeeded")
+	}
+}
+
+func TestDecodeProjectFile_Legacy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blackforest-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "blackforest.json")
+	const record = `{"id": "b11dzGs4SQid", "shortname": "blackforest", "vcs": {"type": "git", "url": "https://example.com/bf.git"}}`
+	if err := ioutil.WriteFile(path, []byte(record), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	proj, err := decodeProjectFile(path)
+	if err != nil {
+		t.Fatal("decodeProjectFile error:", err)
+	}
+	want := []catalog.Remote{{Name: catalog.DefaultRemoteName, Role: catalog.RolePrimary, Type: "git", URL: "https://example.com/bf.git"}}
+	if !reflect.DeepEqual(proj.Remotes, want) {
+		t.Errorf("proj.Remotes = %+v; want %+v", proj.Remotes, want)
+	}
+}
+
+func TestCheckWorkingCopy(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found:", err)
+	}
+	dir, err := ioutil.TempDir("", "blackforest-wc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	git := func(args ...string) {
+		c := exec.Command("git", append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+		c.Dir = dir
+		if out, err := c.CombinedOutput(); err != nil {
+			t.Fatalf("git %q: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q", "-b", "main")
+	if err := ioutil.WriteFile(filepath.Join(dir, "README"), []byte("hello\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	git("add", "README")
+	git("commit", "-q", "-m", "initial")
+
+	now := time.Date(2013, 2, 7, 18, 51, 13, 0, time.UTC)
+	st, err := checkWorkingCopy(dir, now)
+	if err != nil {
+		t.Fatal("checkWorkingCopy error:", err)
+	}
+	if len(st.Revision) != 40 || st.Branch != "main" || st.Dirty || !st.CheckTime.Equal(now) {
+		t.Errorf("checkWorkingCopy(clean) = %+v; want 40-digit revision on main, not dirty, checked at %v", st, now)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "README"), []byte("changed\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := checkWorkingCopy(dir, now); err != nil {
+		t.Error("checkWorkingCopy(dirty) error:", err)
+	} else if !st.Dirty {
+		t.Errorf("checkWorkingCopy(dirty) = %+v; want Dirty", st)
+	}
+
+	if _, err := checkWorkingCopy(filepath.Join(dir, "nope"), now); err != notWorkingCopyError(filepath.Join(dir, "nope")) {
+		t.Errorf("checkWorkingCopy(missing) error = %v; want %v", err, notWorkingCopyError(filepath.Join(dir, "nope")))
+	}
+}
+
+func TestWriteNotes(t *testing.T) {
+	notes := []catalog.Note{
+		{Time: time.Date(2014, time.March, 1, 12, 0, 0, 0, time.UTC), Host: "laptop", Text: "started"},
+		{Time: time.Date(2014, time.March, 2, 9, 30, 0, 0, time.UTC), Text: "blocked on upstream\n\nsee bug 12"},
+	}
+	var buf bytes.Buffer
+	writeNotes(&buf, notes, fmtRFC3339Time)
+	want := "2014-03-01T12:00:00Z on laptop\n" +
+		"\tstarted\n" +
+		"\n" +
+		"2014-03-02T09:30:00Z\n" +
+		"\tblocked on upstream\n" +
+		"\n" +
+		"\tsee bug 12\n"
+	if got := buf.String(); got != want {
+		t.Errorf("writeNotes =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Duration
+		err  bool
+	}{
+		{"30d", 30 * 24 * time.Hour, false},
+		{"0d", 0, false},
+		{"12h", 12 * time.Hour, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"d", 0, true},
+		{"-1d", 0, true},
+		{"-5h", 0, true},
+		{"1.5d", 0, true},
+		{"soon", 0, true},
+	}
+	for _, test := range tests {
+		d, err := parseAge(test.s)
+		if test.err {
+			if err == nil {
+				t.Errorf("parseAge(%q) = %v; want error", test.s, d)
+			}
+			continue
+		}
+		if err != nil || d != test.want {
+			t.Errorf("parseAge(%q) = %v, %v; want %v, <nil>", test.s, d, err, test.want)
+		}
+	}
+}
+
+func TestWriteHistory(t *testing.T) {
+	t1 := time.Date(2014, time.March, 1, 12, 0, 0, 0, time.UTC)
+	foo := &catalog.Project{ShortName: "foo"}
+	versions := []*catalog.ProjectVersion{
+		{
+			Changeset: vcs.Changeset{Rev: historyRev("3"), Author: "Bob", Time: t1.Add(2 * time.Hour), Message: "delete project foo"},
+			Project:   foo,
+			Deleted:   true,
+		},
+		{
+			Changeset: vcs.Changeset{Rev: historyRev("2"), Author: "Alice", Time: t1.Add(time.Hour), Message: "put project foo"},
+			Project:   foo,
+			Changes: []catalog.FieldChange{
+				{Field: "homepage", Old: `"http://example.com/"`},
+				{Field: "remotes[0].url", Old: `"a.git"`, New: `"b.git"`},
+				{Field: "tags[0]", New: `"go"`},
+			},
+		},
+		{
+			Changeset: vcs.Changeset{Rev: historyRev("1"), Author: "Alice", Time: t1},
+			Project:   foo,
+			Changes:   []catalog.FieldChange{{Field: "shortname", New: `"foo"`}},
+		},
+	}
+	var buf bytes.Buffer
+	writeHistory(&buf, versions, fmtRFC3339Time)
+	want := "3\t2014-03-01T14:00:00Z\tBob\n" +
+		"\tdelete project foo\n" +
+		"\tmoved to the trash\n" +
+		"\n" +
+		"2\t2014-03-01T13:00:00Z\tAlice\n" +
+		"\tput project foo\n" +
+		"\t- homepage: \"http://example.com/\"\n" +
+		"\t~ remotes[0].url: \"a.git\" -> \"b.git\"\n" +
+		"\t+ tags[0]: \"go\"\n" +
+		"\n" +
+		"1\t2014-03-01T12:00:00Z\tAlice\n" +
+		"\t+ shortname: \"foo\"\n"
+	if got := buf.String(); got != want {
+		t.Errorf("writeHistory =\n%s\nwant\n%s", got, want)
+	}
+}
+
+type historyRev string
+
+func (r historyRev) Rev() string    { return string(r) }
+func (r historyRev) String() string { return string(r) }
@@ -47,6 +47,23 @@ func addFormFlag(fset *flag.FlagSet, form map[string][]string, key string, usage
 	fset.Var(&formFlag{form, key}, key, usage)
 }
 
+// formListFlag is a formFlag that can be given more than once.  Each use adds
+// another value for its key.
+type formListFlag formFlag
+
+func (f *formListFlag) String() string {
+	return (*formFlag)(f).String()
+}
+
+func (f *formListFlag) Set(s string) error {
+	f.Form[f.Key] = append(f.Form[f.Key], s)
+	return nil
+}
+
+func addFormListFlag(fset *flag.FlagSet, form map[string][]string, key string, usage string) {
+	fset.Var(&formListFlag{form, key}, key, usage)
+}
+
 func convertTime(s string) (reflect.Value, error) {
 	v, err := time.Parse(time.RFC3339, s)
 	if err != nil {
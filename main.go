@@ -6,7 +6,9 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"bitbucket.org/zombiezen/blackforest/catalog"
 	"bitbucket.org/zombiezen/blackforest/vcs"
@@ -27,6 +29,7 @@ var (
 	catalogPath string = os.Getenv(CatalogPathEnv)
 	host        string = os.Getenv(HostEnv)
 	editor      string = "vi"
+	lockWait           = 10 * time.Second
 )
 
 func init() {
@@ -50,6 +53,9 @@ func main() {
 	} else if _, ok := err.(usageError); ok {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(exitUsage)
+	} else if catalog.IsNotFound(err) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitNotFound)
 	} else {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(exitFailure)
@@ -61,6 +67,122 @@ func requireCatalog() catalog.Catalog {
 		panic(errCatalogPathNotSet)
 	}
 
+	cat, err := catalog.OpenWithOptions(catalogPath, catalogVCS(), &catalog.Options{
+		LockTimeout:     lockWait,
+		BreakStaleLocks: true,
+	})
+	if v, ok := err.(catalog.VersionError); ok && int(v) < catalog.Version {
+		panic(outdatedCatalogError(v))
+	} else if err != nil {
+		panic(err)
+	}
+	return cat
+}
+
+// requireCatalogAt returns the catalog as it was at a revision or date (see
+// catalogAt), or the current catalog if at is empty.
+func requireCatalogAt(at string) catalog.Catalog {
+	if at == "" {
+		return requireCatalog()
+	}
+	if catalogPath == "" {
+		panic(errCatalogPathNotSet)
+	}
+	cat, err := catalogAt(at)
+	if err != nil {
+		panic(err)
+	}
+	return cat
+}
+
+// catalogAt opens a read-only copy of the catalog as it was at a revision of
+// its working copy.  at is either a revision or a date, in which case the last
+// revision committed at or before the date is used.
+func catalogAt(at string) (catalog.Catalog, error) {
+	wc, err := vcs.OpenWorkingCopy(catalogPath)
+	if err != nil {
+		return nil, err
+	}
+	rr, ok := wc.(vcs.RevReader)
+	if !ok {
+		return nil, errNoHistory
+	}
+	rev, err := parseAt(rr, at)
+	if err != nil {
+		return nil, err
+	}
+	return catalog.OpenRev(rr, rev)
+}
+
+// catalogLogger opens the working copy that the catalog is in for reading
+// its log.
+func catalogLogger() (vcs.Logger, error) {
+	wc, err := vcs.OpenWorkingCopy(catalogPath)
+	if err != nil {
+		return nil, err
+	}
+	l, ok := wc.(vcs.Logger)
+	if !ok {
+		return nil, errNoHistory
+	}
+	return l, nil
+}
+
+// atTimeLayouts are the date formats accepted by parseAt.  Dates without a
+// time zone are in local time.
+var atTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseAt returns the revision of wc named by at, which is either a date in
+// one of atTimeLayouts or a revision that wc can parse.
+func parseAt(wc vcs.RevReader, at string) (vcs.Rev, error) {
+	for _, layout := range atTimeLayouts {
+		if t, err := time.ParseInLocation(layout, at, time.Local); err == nil {
+			return wc.RevAt(t)
+		}
+	}
+	return wc.ParseRev(at)
+}
+
+// findProject looks up a project by short name or ID.  If the name is a
+// former short name, a notice is printed and the renamed project is returned.
+func findProject(cat catalog.Catalog, name string) (*catalog.Project, error) {
+	proj, err := catalog.FindProject(cat, name)
+	if rerr, ok := err.(*catalog.RenamedError); ok {
+		fmt.Fprintf(os.Stderr, "note: %s was renamed to %s\n", rerr.Old, rerr.New)
+		return cat.GetProjectByID(rerr.ID)
+	}
+	return proj, err
+}
+
+// hostPathEnv returns the directories that portable paths are relative to on
+// this host.  The checkout root may itself start with "~".
+func hostPathEnv(cat catalog.Catalog) (*catalog.PathEnv, error) {
+	env := new(catalog.PathEnv)
+	if home, err := os.UserHomeDir(); err == nil {
+		env.Home = home
+	}
+	hosts, err := catalog.GetHosts(cat)
+	if err != nil {
+		return nil, err
+	}
+	if h := hosts.Host(host); h != nil && h.CheckoutRoot != "" {
+		root, err := env.Expand(h.CheckoutRoot)
+		if err != nil {
+			return nil, err
+		}
+		env.Root = root
+	}
+	return env, nil
+}
+
+// catalogVCS returns the version control system used by the catalog, or nil
+// if the catalog is not in a working copy.
+func catalogVCS() vcs.VCS {
 	var v vcs.VCS
 	wc, err := vcs.OpenWorkingCopy(catalogPath)
 	if wc != nil {
@@ -69,12 +191,7 @@ func requireCatalog() catalog.Catalog {
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "catalog VCS warning:", err)
 	}
-
-	cat, err := catalog.Open(catalogPath, v)
-	if err != nil {
-		panic(err)
-	}
-	return cat
+	return v
 }
 
 var (
@@ -83,9 +200,26 @@ var (
 	errCatalogPathNotSet   = errors.New(CatalogPathEnv + " not set")
 	errHostNotSet          = errors.New(HostEnv + " not set")
 	errHostNotSetPathGiven = errors.New("-path given and " + HostEnv + " not set")
+	errCatalogNotWatchable = errors.New("catalog does not report changes")
+	errLockHeld            = errors.New("lock holder may still be running\n(use -force to break the lock anyway)")
+	errNoSchema            = errors.New("catalog does not support custom fields")
+	errNoHosts             = errors.New("catalog does not have a host registry")
+	errNoAttachments       = errors.New("catalog does not support attachments")
+	errNoTrash             = errors.New("catalog does not have a trash")
+	errNoHistory           = errors.New("catalog is not in a working copy that can read past revisions")
+	errSelfLink            = errors.New("a project cannot link to itself")
+	errRemoteURLNotSet     = errors.New("-url not given")
+	errRemoteVCSNotSet     = errors.New("-vcs not given and project has no primary remote")
 
-	errFailed         error = exitError(exitFailure)
-	errTagsMutexFlags error = usageError("cannot use -tags flag with -addtags/-deltags")
+	// errNoChange is returned from a batch to discard it without reporting
+	// an error, like for -dryrun.
+	errNoChange = errors.New("no change")
+
+	errFailed             error = exitError(exitFailure)
+	errTagsMutexFlags     error = usageError("cannot use -tags flag with -addtags/-deltags")
+	errAttachNameMultiple error = usageError("cannot use -name flag with more than one file")
+	errPurgeAgeNotSet     error = usageError("purge requires -older or -all")
+	errPurgeMutexFlags    error = usageError("cannot use -older flag with -all")
 )
 
 type projectHasPathError struct {
@@ -97,18 +231,84 @@ func (e *projectHasPathError) Error() string {
 	return string(e.ShortName) + " already has path: " + e.Path + "\n(use -overwritepath to force)"
 }
 
+type outdatedCatalogError int
+
+func (e outdatedCatalogError) Error() string {
+	return fmt.Sprintf("catalog is version %d, but this program requires version %d\n(use upgrade to migrate the catalog)", int(e), catalog.Version)
+}
+
 type noVCSURLError string
 
 func (e noVCSURLError) Error() string {
 	return "project " + string(e) + " has no VCS URL"
 }
 
+type notWorkingCopyError string
+
+func (e notWorkingCopyError) Error() string {
+	return string(e) + " is not a working copy"
+}
+
+type noPathError string
+
+func (e noPathError) Error() string {
+	return "project " + string(e) + " has no path on this host"
+}
+
+type noRemoteError struct {
+	ShortName string
+	Remote    string
+}
+
+func (e *noRemoteError) Error() string {
+	return "project " + e.ShortName + " has no remote " + e.Remote
+}
+
+type subprojectRemoteError struct {
+	ShortName string
+	Remote    string
+}
+
+func (e *subprojectRemoteError) Error() string {
+	return e.ShortName + " has remote " + e.Remote + ", which is not a remote of its new parent\n(remove it with remote -remove first)"
+}
+
+type remoteExistsError struct {
+	ShortName string
+	Remote    string
+}
+
+func (e *remoteExistsError) Error() string {
+	return "project " + e.ShortName + " already has a remote " + e.Remote
+}
+
 type badVCSError string
 
 func (e badVCSError) Error() string {
 	return string(e) + " is not a valid VCS name\nvalid choices are: " + validVCSText
 }
 
+type badFieldError string
+
+func (e badFieldError) Error() string {
+	return strconv.Quote(string(e)) + " is not formatted as NAME=VALUE"
+}
+
+type fieldExistsError string
+
+func (e fieldExistsError) Error() string {
+	return "field " + string(e) + " already exists"
+}
+
+type noLinkError struct {
+	ShortName string
+	Link      string
+}
+
+func (e *noLinkError) Error() string {
+	return e.ShortName + " has no " + e.Link + " link"
+}
+
 type exitError int
 
 func (e exitError) Error() string {
@@ -123,15 +323,27 @@ func (e usageError) Error() string {
 
 // exit codes
 const (
-	exitSuccess = 0
-	exitFailure = 1
-	exitUsage   = 64
+	exitSuccess  = 0
+	exitFailure  = 1
+	exitUsage    = 64
+	exitNotFound = 66
 )
 
+// combineExit returns the exit code for a command that has already decided on
+// code and then encountered err.  Projects that could not be found produce
+// exitNotFound, unless some other error occurred.
+func combineExit(code int, err error) int {
+	if catalog.IsNotFound(err) && code != exitFailure {
+		return exitNotFound
+	}
+	return exitFailure
+}
+
 func globalFlags(fset *flag.FlagSet) {
 	fset.StringVar(&catalogPath, "catalog", catalogPath, "path to catalog directory (overrides the "+CatalogPathEnv+" environment variable)")
 	fset.StringVar(&host, "host", host, "key for this host (overrides the "+HostEnv+" environment variable)")
 	fset.StringVar(&editor, "editor", editor, "text editor (overrides the "+EditorEnv+" environment variable)")
+	fset.DurationVar(&lockWait, "lockwait", lockWait, "how long to wait for another process to unlock the catalog")
 }
 
 func parseFlags(fset *flag.FlagSet, args []string) {
@@ -154,7 +366,7 @@ var knownVCS = []struct {
 	{catalog.Darcs, nil},
 }
 
-var validVCSText string
+var validVCSText, validStatusText, validFieldTypeText, validLinkTypeText, validRemoteRoleText string
 
 func init() {
 	names := make([]string, len(knownVCS))
@@ -162,6 +374,30 @@ func init() {
 		names[i] = knownVCS[i].Name
 	}
 	validVCSText = strings.Join(names, ", ")
+
+	names = names[:0]
+	for _, s := range catalog.Statuses() {
+		names = append(names, string(s))
+	}
+	validStatusText = strings.Join(names, ", ")
+
+	names = names[:0]
+	for _, t := range catalog.FieldTypes() {
+		names = append(names, string(t))
+	}
+	validFieldTypeText = strings.Join(names, ", ")
+
+	names = names[:0]
+	for _, t := range catalog.LinkTypes() {
+		names = append(names, string(t))
+	}
+	validLinkTypeText = strings.Join(names, ", ")
+
+	names = names[:0]
+	for _, r := range catalog.RemoteRoles() {
+		names = append(names, string(r))
+	}
+	validRemoteRoleText = strings.Join(names, ", ")
 }
 
 func vcsImpl(t string) vcs.VCS {
@@ -1,8 +1,12 @@
 package main
 
 import (
-	"bitbucket.org/zombiezen/blackforest/vcs"
+	"errors"
 	"testing"
+	"time"
+
+	"bitbucket.org/zombiezen/blackforest/catalog"
+	"bitbucket.org/zombiezen/blackforest/vcs"
 )
 
 func TestVCSImpl(t *testing.T) {
@@ -57,3 +61,65 @@ func TestValidVCSType(t *testing.T) {
 		}
 	}
 }
+
+func TestCombineExit(t *testing.T) {
+	notFound := &catalog.ProjectError{ShortName: "foo", Op: "get", Err: catalog.ErrNotFound}
+	other := errors.New("bad things happened")
+	tests := []struct {
+		Code int
+		Err  error
+		Want int
+	}{
+		{exitSuccess, notFound, exitNotFound},
+		{exitSuccess, other, exitFailure},
+		{exitNotFound, notFound, exitNotFound},
+		{exitNotFound, other, exitFailure},
+		{exitFailure, notFound, exitFailure},
+	}
+	for _, test := range tests {
+		if code := combineExit(test.Code, test.Err); code != test.Want {
+			t.Errorf("combineExit(%d, %v) = %d; want %d", test.Code, test.Err, code, test.Want)
+		}
+	}
+}
+
+// atRevReader records the calls that parseAt makes.
+type atRevReader struct {
+	vcs.RevReader
+	at  time.Time
+	rev string
+}
+
+func (wc *atRevReader) RevAt(t time.Time) (vcs.Rev, error) {
+	wc.at = t
+	return nil, nil
+}
+
+func (wc *atRevReader) ParseRev(s string) (vcs.Rev, error) {
+	wc.rev = s
+	return nil, nil
+}
+
+func TestParseAt(t *testing.T) {
+	tests := []struct {
+		at   string
+		time time.Time
+		rev  string
+	}{
+		{"2019-01-01", time.Date(2019, time.January, 1, 0, 0, 0, 0, time.Local), ""},
+		{"2019-01-01T15:04", time.Date(2019, time.January, 1, 15, 4, 0, 0, time.Local), ""},
+		{"2019-01-01T15:04:05Z", time.Date(2019, time.January, 1, 15, 4, 5, 0, time.UTC), ""},
+		{"0d9c2b3", time.Time{}, "0d9c2b3"},
+		{"tip", time.Time{}, "tip"},
+	}
+	for _, test := range tests {
+		wc := new(atRevReader)
+		if _, err := parseAt(wc, test.at); err != nil {
+			t.Errorf("parseAt(%q) error: %v", test.at, err)
+			continue
+		}
+		if !wc.at.Equal(test.time) || wc.rev != test.rev {
+			t.Errorf("parseAt(%q) called RevAt(%v), ParseRev(%q); want RevAt(%v), ParseRev(%q)", test.at, wc.at, wc.rev, test.time, test.rev)
+		}
+	}
+}
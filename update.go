@@ -17,18 +17,24 @@ func cmdCreate(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
 	fset := cmd.FlagSet(set)
 	addFormFlag(fset, form, projectFormShortNameKey, "identifier for project (default is lowercased full name)")
 	addFormFlag(fset, form, projectFormTagsKey, "comma-separated tags to assign to the new project")
-	addFormFlag(fset, form, projectFormPathKey, "path of working copy")
+	addFormFlag(fset, form, projectFormPathKey, "path of working copy (may start with ~/ or $root/ to be portable)")
 	addFormFlag(fset, form, projectFormCreateTimeKey, "project creation date, formatted as RFC3339 ("+rfc3339example+")")
 	addFormFlag(fset, form, projectFormHomepageKey, "project homepage")
-	addFormFlag(fset, form, projectFormVCSTypeKey, "type of VCS for project")
-	addFormFlag(fset, form, projectFormVCSURLKey, "project VCS URL")
+	addFormFlag(fset, form, projectFormVCSTypeKey, "type of VCS for project's primary remote")
+	addFormFlag(fset, form, projectFormVCSURLKey, "URL of project's primary remote")
 	addFormFlag(fset, form, projectFormDescriptionKey, "human-readable project description")
+	addFormFlag(fset, form, projectFormStatusKey, "project status ("+validStatusText+"; default is active)")
+	addFormListFlag(fset, form, projectFormFieldKey, "set a custom field, formatted as NAME=VALUE (can be repeated)")
 	parseFlags(fset, args)
 	if fset.NArg() != 1 {
 		cmd.PrintSynopsis(set)
 		return exitError(exitUsage)
 	}
 	cat := requireCatalog()
+	fieldSchema, err := catalog.GetSchema(cat)
+	if err != nil {
+		return err
+	}
 
 	name := strings.TrimSpace(fset.Arg(0))
 	if len(name) == 0 {
@@ -39,7 +45,7 @@ func cmdCreate(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
 		form[projectFormShortNameKey] = []string{sanitizeName(name)}
 	}
 
-	proj, err := createProjectForm(form, host)
+	proj, err := createProjectForm(form, host, fieldSchema)
 	if err != nil {
 		return err
 	}
@@ -53,25 +59,30 @@ func cmdUpdate(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
 	addFormFlag(fset, form, projectFormTagsKey, "set the project's tags, separated by commas. Can't be used with -addtags or -deltags.")
 	addFormFlag(fset, form, projectFormAddTagsKey, "add tags to the project, separated by commas. Can't be used with -tags.")
 	addFormFlag(fset, form, projectFormDelTagsKey, "delete tags from the project, separated by commas. Can't be used with -tags.")
-	addFormFlag(fset, form, projectFormPathKey, "path of working copy")
+	addFormFlag(fset, form, projectFormPathKey, "path of working copy (may start with ~/ or $root/ to be portable)")
 	addFormFlag(fset, form, projectFormCreateTimeKey, "project creation date, formatted as RFC3339 ("+rfc3339example+")")
 	addFormFlag(fset, form, projectFormHomepageKey, "project homepage")
-	addFormFlag(fset, form, projectFormVCSTypeKey, "type of VCS for project")
-	addFormFlag(fset, form, projectFormVCSURLKey, "project VCS URL")
+	addFormFlag(fset, form, projectFormVCSTypeKey, "type of VCS for project's primary remote")
+	addFormFlag(fset, form, projectFormVCSURLKey, "URL of project's primary remote")
 	addFormFlag(fset, form, projectFormDescriptionKey, "human-readable project description")
+	addFormFlag(fset, form, projectFormStatusKey, "project status ("+validStatusText+")")
+	addFormListFlag(fset, form, projectFormFieldKey, "set a custom field, formatted as NAME=VALUE; an empty VALUE removes the field (can be repeated)")
 	parseFlags(fset, args)
 	if fset.NArg() != 1 {
 		cmd.PrintSynopsis(set)
 		return exitError(exitUsage)
 	}
 	cat := requireCatalog()
+	fieldSchema, err := catalog.GetSchema(cat)
+	if err != nil {
+		return err
+	}
 
-	shortName := fset.Arg(0)
-	proj, err := cat.GetProject(shortName)
+	proj, err := findProject(cat, fset.Arg(0))
 	if err != nil {
 		return err
 	}
-	if err := updateProjectForm(proj, form, host); err != nil {
+	if err := updateProjectForm(proj, form, host, fieldSchema); err != nil {
 		return err
 	}
 	if err := cat.PutProject(proj); err != nil {
@@ -92,6 +103,8 @@ const (
 	projectFormHomepageKey    = "url"
 	projectFormVCSTypeKey     = "vcs"
 	projectFormVCSURLKey      = "vcsurl"
+	projectFormStatusKey      = "status"
+	projectFormFieldKey       = "field"
 )
 
 type projectForm struct {
@@ -106,9 +119,14 @@ type projectForm struct {
 	Homepage    nullString     `schema:"url"`
 	VCSType     nullString     `schema:"vcs"`
 	VCSURL      nullString     `schema:"vcsurl"`
+	Status      nullString     `schema:"status"`
+
+	// Fields holds the values of the field key, each formatted as
+	// NAME=VALUE.  They are copied from the form by updateProjectForm.
+	Fields []string `schema:"-"`
 }
 
-func (f *projectForm) Update(proj *catalog.Project, host string) error {
+func (f *projectForm) Update(proj *catalog.Project, host string, fieldSchema *catalog.Schema) error {
 	if f.Tags != nil && (f.AddTags != nil || f.DelTags != nil) {
 		return schema.MultiError{projectFormTagsKey: errTagsMutexFlags}
 	}
@@ -139,6 +157,8 @@ func (f *projectForm) Update(proj *catalog.Project, host string) error {
 			ferr[projectFormPathKey] = errHostNotSetPathGiven
 		} else if path == "" {
 			proj.SetPath(host, "")
+		} else if catalog.IsPortablePath(path) {
+			proj.SetPath(host, filepath.ToSlash(path))
 		} else if p, err := filepath.Abs(filepath.Clean(path)); err == nil {
 			proj.SetPath(host, p)
 		} else {
@@ -151,25 +171,41 @@ func (f *projectForm) Update(proj *catalog.Project, host string) error {
 	if f.Homepage.Valid {
 		proj.Homepage = f.Homepage.String
 	}
+	// The VCS fields edit the primary remote.
 	if f.VCSType.Valid {
 		vt := f.VCSType.String
 		switch {
 		case vt == "":
-			proj.VCS = nil
+			if r := proj.PrimaryRemote(); r != nil {
+				proj.RemoveRemote(r.Name)
+			}
 		case isValidVCSType(vt):
-			if proj.VCS == nil {
-				proj.VCS = new(catalog.VCSInfo)
+			if r := proj.PrimaryRemote(); r != nil {
+				r.Type = vt
+			} else {
+				proj.Remotes = append(proj.Remotes, catalog.Remote{Name: catalog.DefaultRemoteName, Role: catalog.RolePrimary, Type: vt})
 			}
-			proj.VCS.Type = vt
 		default:
 			ferr[projectFormVCSTypeKey] = badVCSError(vt)
 		}
 	}
 	if f.VCSURL.Valid {
-		if proj.VCS == nil {
+		if r := proj.PrimaryRemote(); r == nil {
 			ferr[projectFormVCSURLKey] = errDanglingVCSURL
 		} else {
-			proj.VCS.URL = f.VCSURL.String
+			r.URL = f.VCSURL.String
+		}
+	}
+	if f.Status.Valid {
+		if s, err := catalog.ParseStatus(f.Status.String); err == nil {
+			proj.SetStatus(s, time.Now())
+		} else {
+			ferr[projectFormStatusKey] = err
+		}
+	}
+	for _, kv := range f.Fields {
+		if err := setField(proj, fieldSchema, kv); err != nil {
+			ferr[projectFormFieldKey] = err
 		}
 	}
 	if len(ferr) > 0 {
@@ -178,7 +214,35 @@ func (f *projectForm) Update(proj *catalog.Project, host string) error {
 	return nil
 }
 
-func createProjectForm(form map[string][]string, host string) (*catalog.Project, error) {
+// setField sets a custom field from a NAME=VALUE string.  An empty value
+// removes the field.
+func setField(proj *catalog.Project, fieldSchema *catalog.Schema, kv string) error {
+	i := strings.IndexRune(kv, '=')
+	if i == -1 {
+		return badFieldError(kv)
+	}
+	name, value := kv[:i], kv[i+1:]
+	if value == "" {
+		// Fields that were removed from the schema can still be cleared.
+		delete(proj.Fields, name)
+		return nil
+	}
+	def := fieldSchema.Field(name)
+	if def == nil {
+		return &catalog.FieldError{Field: name, Err: catalog.ErrUnknownField}
+	}
+	value, err := def.Parse(value)
+	if err != nil {
+		return err
+	}
+	if proj.Fields == nil {
+		proj.Fields = make(map[string]string)
+	}
+	proj.Fields[name] = value
+	return nil
+}
+
+func createProjectForm(form map[string][]string, host string, fieldSchema *catalog.Schema) (*catalog.Project, error) {
 	now := time.Now()
 	id, err := catalog.GenerateID()
 	if err != nil {
@@ -203,16 +267,17 @@ func createProjectForm(form map[string][]string, host string) (*catalog.Project,
 
 	delete(form, projectFormAddTagsKey)
 	delete(form, projectFormDelTagsKey)
-	err = updateProjectForm(proj, form, host)
+	err = updateProjectForm(proj, form, host, fieldSchema)
 	return proj, err
 }
 
-func updateProjectForm(proj *catalog.Project, form map[string][]string, host string) error {
+func updateProjectForm(proj *catalog.Project, form map[string][]string, host string, fieldSchema *catalog.Schema) error {
 	var f projectForm
 	if err := decoder.Decode(&f, form); err != nil {
 		return err
 	}
-	return f.Update(proj, host)
+	f.Fields = form[projectFormFieldKey]
+	return f.Update(proj, host, fieldSchema)
 }
 
 func sanitizeName(name string) string {
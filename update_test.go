@@ -25,6 +25,7 @@ func TestProjectFormConstants(t *testing.T) {
 		{"projectFormHomepageKey", projectFormHomepageKey, "Homepage"},
 		{"projectFormVCSTypeKey", projectFormVCSTypeKey, "VCSType"},
 		{"projectFormVCSURLKey", projectFormVCSURLKey, "VCSURL"},
+		{"projectFormStatusKey", projectFormStatusKey, "Status"},
 	}
 	tp := reflect.TypeOf(projectForm{})
 	for _, test := range tests {
@@ -51,7 +52,12 @@ func TestUpdateForm(t *testing.T) {
 		"url":         {"http://example.com/"},
 		"vcs":         {"svn"},
 		"vcsurl":      {"http://example.com/svn/trunk/"},
-	}, "foo")
+		"status":      {"maintained"},
+		"field":       {"owner=alice", "cost=007"},
+	}, "foo", &catalog.Schema{Fields: []catalog.FieldDef{
+		{Name: "owner", Type: catalog.TextField},
+		{Name: "cost", Type: catalog.IntField},
+	}})
 	if err != nil {
 		t.Error("error:", err)
 	}
@@ -68,8 +74,8 @@ func TestUpdateForm(t *testing.T) {
 	if want := "Greetings, Program!"; proj.Description != want {
 		t.Errorf("proj.Description = %q; want %q", proj.Description, want)
 	}
-	if host, want := "foo", "/usr/src/hello"; proj.Path(host) != want {
-		t.Errorf("proj.Path(%q) = %q; want %q", host, proj.Path(host), want)
+	if host, want := "foo", "/usr/src/hello"; proj.PerHost[host] == nil || proj.PerHost[host].Path != want {
+		t.Errorf("proj.PerHost[%q] = %+v; want path %q", host, proj.PerHost[host], want)
 	}
 	if !proj.CreateTime.Equal(magicTime) {
 		t.Errorf("proj.CreateTime = %v; want %v", proj.CreateTime, magicTime)
@@ -77,16 +83,113 @@ func TestUpdateForm(t *testing.T) {
 	if want := "http://example.com/"; proj.Homepage != want {
 		t.Errorf("proj.Homepage = %q; want %q", proj.Homepage, want)
 	}
-	if proj.VCS == nil {
-		t.Error("proj.VCS == nil")
+	if r := proj.PrimaryRemote(); r == nil {
+		t.Error("proj.PrimaryRemote() == nil")
 	} else {
-		if want := "svn"; proj.VCS.Type != want {
-			t.Errorf("proj.VCS.Type = %q; want %q", proj.VCS.Type, want)
+		if want := "svn"; r.Type != want {
+			t.Errorf("primary remote type = %q; want %q", r.Type, want)
 		}
-		if want := "http://example.com/svn/trunk/"; proj.VCS.URL != want {
-			t.Errorf("proj.VCS.URL = %q; want %q", proj.VCS.URL, want)
+		if want := "http://example.com/svn/trunk/"; r.URL != want {
+			t.Errorf("primary remote URL = %q; want %q", r.URL, want)
 		}
 	}
+	if want := catalog.StatusMaintained; proj.Status != want {
+		t.Errorf("proj.Status = %q; want %q", proj.Status, want)
+	}
+	if len(proj.StatusHistory) != 1 {
+		t.Errorf("len(proj.StatusHistory) = %d; want 1", len(proj.StatusHistory))
+	}
+	if want := map[string]string{"owner": "alice", "cost": "7"}; !reflect.DeepEqual(proj.Fields, want) {
+		t.Errorf("proj.Fields = %v; want %v", proj.Fields, want)
+	}
+}
+
+func TestUpdateForm_Fields(t *testing.T) {
+	fieldSchema := &catalog.Schema{Fields: []catalog.FieldDef{
+		{Name: "owner", Type: catalog.TextField},
+		{Name: "cost", Type: catalog.IntField},
+	}}
+	tests := []struct {
+		field []string
+		want  map[string]string
+		ok    bool
+	}{
+		{[]string{"owner=bob"}, map[string]string{"owner": "bob", "cost": "7"}, true},
+		{[]string{"owner="}, map[string]string{"cost": "7"}, true},
+		{[]string{"owner=a=b"}, map[string]string{"owner": "a=b", "cost": "7"}, true},
+		{[]string{"owner"}, nil, false},
+		{[]string{"lang=go"}, nil, false},
+		{[]string{"lang="}, map[string]string{"owner": "alice", "cost": "7"}, true},
+		{[]string{"cost=lots"}, nil, false},
+	}
+	for _, test := range tests {
+		proj := &catalog.Project{Fields: map[string]string{"owner": "alice", "cost": "7"}}
+		err := updateProjectForm(proj, map[string][]string{"field": test.field}, "", fieldSchema)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("field %q: updateProjectForm succeeded", test.field)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("field %q: updateProjectForm error: %v", test.field, err)
+		} else if !reflect.DeepEqual(proj.Fields, test.want) {
+			t.Errorf("field %q: proj.Fields = %v; want %v", test.field, proj.Fields, test.want)
+		}
+	}
+}
+
+func TestUpdateForm_PrimaryRemote(t *testing.T) {
+	mirror := catalog.Remote{Name: "backup", Role: catalog.RoleMirror, Type: catalog.Git, URL: "https://mirror.example.com/foo.git"}
+	tests := []struct {
+		form map[string][]string
+		want []catalog.Remote
+		ok   bool
+	}{
+		{
+			map[string][]string{"vcs": {"git"}, "vcsurl": {"https://example.com/foo.git"}},
+			[]catalog.Remote{mirror, {Name: catalog.DefaultRemoteName, Role: catalog.RolePrimary, Type: catalog.Git, URL: "https://example.com/foo.git"}},
+			true,
+		},
+		{
+			map[string][]string{"vcsurl": {"https://example.com/foo.git"}},
+			nil,
+			false,
+		},
+	}
+	for _, test := range tests {
+		proj := &catalog.Project{Remotes: []catalog.Remote{mirror}}
+		err := updateProjectForm(proj, test.form, "", new(catalog.Schema))
+		if !test.ok {
+			if err == nil {
+				t.Errorf("updateProjectForm(%v) succeeded", test.form)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("updateProjectForm(%v) error: %v", test.form, err)
+		} else if !reflect.DeepEqual(proj.Remotes, test.want) {
+			t.Errorf("updateProjectForm(%v) remotes = %+v; want %+v", test.form, proj.Remotes, test.want)
+		}
+	}
+
+	proj := &catalog.Project{Remotes: []catalog.Remote{{Name: "origin", Role: catalog.RolePrimary, Type: catalog.Subversion}, mirror}}
+	if err := updateProjectForm(proj, map[string][]string{"vcs": {""}}, "", new(catalog.Schema)); err != nil {
+		t.Errorf("updateProjectForm(vcs=\"\") error: %v", err)
+	} else if want := []catalog.Remote{mirror}; !reflect.DeepEqual(proj.Remotes, want) {
+		t.Errorf("updateProjectForm(vcs=\"\") remotes = %+v; want %+v", proj.Remotes, want)
+	}
+}
+
+func TestUpdateForm_BadStatus(t *testing.T) {
+	proj := &catalog.Project{Status: catalog.StatusArchived}
+	err := updateProjectForm(proj, map[string][]string{"status": {"dead"}}, "", new(catalog.Schema))
+	if err == nil {
+		t.Error("updateProjectForm succeeded with bad status")
+	}
+	if proj.Status != catalog.StatusArchived {
+		t.Errorf("proj.Status = %q; want %q", proj.Status, catalog.StatusArchived)
+	}
 }
 
 func TestSanitizeName(t *testing.T) {
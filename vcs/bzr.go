@@ -29,6 +29,26 @@ func (bzr *Bazaar) init() {
 		parseRev: func(wc *commandWC, s string) (Rev, error) {
 			return bzrVersionInfo(wc, "-r", s)
 		},
+		untracked: func(wc *commandWC, paths []string) ([]string, error) {
+			// bzr ls only accepts one path, so list everything and filter.
+			out, err := wc.cmd("ls", "--recursive", "--unknown", "--null").Output()
+			if err != nil {
+				return nil, err
+			}
+			var files []string
+			for _, f := range splitNul(out) {
+				if inPaths(f, paths) {
+					files = append(files, f)
+				}
+			}
+			return files, nil
+		},
+		branch: func(wc *commandWC) (string, error) {
+			return wc.outputLine("nick")
+		},
+		dirty: func(wc *commandWC) (bool, error) {
+			return wc.hasOutput("status", "--short", "--versioned")
+		},
 	}
 	bzr.c.init(bzr.Program)
 }
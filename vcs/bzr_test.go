@@ -2,6 +2,7 @@ package vcs
 
 import (
 	"bytes"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -76,3 +77,58 @@ func TestParseBzrVersionInfo(t *testing.T) {
 		}
 	}
 }
+
+func TestBazaarUntracked(t *testing.T) {
+	mc := mockCommander{
+		{
+			Out:        *bytes.NewBufferString("junk.txt\x00projects/foo.json\x00projectsfoo.json\x00"),
+			ExpectDir:  desiredBzrPath,
+			ExpectArgs: []string{"bzr", "ls", "--recursive", "--unknown", "--null"},
+		},
+	}
+	wc := newIsolatedBazaarWC(desiredBzrPath, mc)
+	files, err := wc.Untracked([]string{"catalog.json", "projects"})
+	mc.check(t)
+	if err != nil {
+		t.Errorf("wc.Untracked(...) error: %v", err)
+	}
+	if want := []string{filepath.Join("projects", "foo.json")}; !reflect.DeepEqual(files, want) {
+		t.Errorf("wc.Untracked(...) = %q; want %q", files, want)
+	}
+}
+
+func TestBazaarBranch(t *testing.T) {
+	mc := mockCommander{
+		{
+			Out:        *bytes.NewBufferString("trunk\n"),
+			ExpectDir:  desiredBzrPath,
+			ExpectArgs: []string{"bzr", "nick"},
+		},
+	}
+	var wc StatusReporter = newIsolatedBazaarWC(desiredBzrPath, mc)
+	b, err := wc.Branch()
+	mc.check(t)
+	if err != nil {
+		t.Errorf("wc.Branch() error: %v", err)
+	} else if want := "trunk"; b != want {
+		t.Errorf("wc.Branch() = %q; want %q", b, want)
+	}
+}
+
+func TestBazaarIsDirty(t *testing.T) {
+	mc := mockCommander{
+		{
+			Out:        *bytes.NewBufferString(" M  foo.go\n"),
+			ExpectDir:  desiredBzrPath,
+			ExpectArgs: []string{"bzr", "status", "--short", "--versioned"},
+		},
+	}
+	wc := newIsolatedBazaarWC(desiredBzrPath, mc)
+	dirty, err := wc.IsDirty()
+	mc.check(t)
+	if err != nil {
+		t.Errorf("wc.IsDirty() error: %v", err)
+	} else if !dirty {
+		t.Error("wc.IsDirty() = false; want true")
+	}
+}
@@ -1,11 +1,15 @@
 package vcs
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type commander interface {
@@ -52,8 +56,11 @@ type commandVCS struct {
 	rename      string
 	renameFlags []string
 
-	current  func(*commandWC) (Rev, error)
-	parseRev func(*commandWC, string) (Rev, error)
+	current   func(*commandWC) (Rev, error)
+	parseRev  func(*commandWC, string) (Rev, error)
+	untracked func(*commandWC, []string) ([]string, error)
+	branch    func(*commandWC) (string, error)
+	dirty     func(*commandWC) (bool, error)
 }
 
 func (c *commandVCS) init(program string) {
@@ -206,6 +213,115 @@ func (wc *commandWC) ParseRev(s string) (Rev, error) {
 	return wc.c.parseRev(wc, s)
 }
 
+func (wc *commandWC) Untracked(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	files, err := wc.c.untracked(wc, paths)
+	if err != nil {
+		return nil, &vcsError{Name: wc.c.name, Op: "status", Path: wc.path, Err: err}
+	}
+	return files, nil
+}
+
+func (wc *commandWC) Branch() (string, error) {
+	b, err := wc.c.branch(wc)
+	if _, ok := err.(*vcsError); ok {
+		return "", err
+	} else if err != nil {
+		return "", &vcsError{Name: wc.c.name, Op: "branch", Path: wc.path, Err: err}
+	}
+	return b, nil
+}
+
+func (wc *commandWC) IsDirty() (bool, error) {
+	dirty, err := wc.c.dirty(wc)
+	if err != nil {
+		return false, &vcsError{Name: wc.c.name, Op: "status", Path: wc.path, Err: err}
+	}
+	return dirty, nil
+}
+
+// outputLine runs a command and returns the first line of its output.
+func (wc *commandWC) outputLine(args ...string) (string, error) {
+	out, err := wc.cmd(args...).Output()
+	if err != nil {
+		return "", err
+	}
+	if i := bytes.IndexByte(out, '\n'); i != -1 {
+		out = out[:i]
+	}
+	return strings.TrimRight(string(out), "\r"), nil
+}
+
+// hasOutput runs a command and reports whether it printed anything other
+// than whitespace.
+func (wc *commandWC) hasOutput(args ...string) (bool, error) {
+	out, err := wc.cmd(args...).Output()
+	if err != nil {
+		return false, err
+	}
+	return len(bytes.TrimSpace(out)) > 0, nil
+}
+
+// splitNul splits NUL-terminated output into filesystem paths.
+func splitNul(out []byte) []string {
+	var files []string
+	for _, f := range bytes.Split(out, []byte{0}) {
+		if len(f) > 0 {
+			files = append(files, filepath.FromSlash(string(f)))
+		}
+	}
+	return files
+}
+
+// parseLog parses log output that has four lines for each changeset: the
+// full revision, the commit time in seconds since the Unix epoch, the author,
+// and the first line of the commit message.
+func parseLog(out []byte, parseRev func([]byte) (Rev, error)) ([]Changeset, error) {
+	if len(out) == 0 {
+		return nil, nil
+	}
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	if len(lines)%4 != 0 {
+		return nil, errors.New("malformed log")
+	}
+	log := make([]Changeset, 0, len(lines)/4)
+	for i := 0; i < len(lines); i += 4 {
+		rev, err := parseRev([]byte(lines[i]))
+		if err != nil {
+			return nil, err
+		}
+		// Mercurial follows the time with the commit's time zone offset.
+		secText := lines[i+1]
+		if j := strings.IndexByte(secText, ' '); j != -1 {
+			secText = secText[:j]
+		}
+		sec, err := strconv.ParseInt(secText, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		log = append(log, Changeset{
+			Rev:     rev,
+			Time:    time.Unix(sec, 0),
+			Author:  lines[i+2],
+			Message: lines[i+3],
+		})
+	}
+	return log, nil
+}
+
+// inPaths reports whether path is one of paths or inside one of them.
+func inPaths(path string, paths []string) bool {
+	for _, p := range paths {
+		p = filepath.Clean(p)
+		if path == p || strings.HasPrefix(path, p+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
 type vcsError struct {
 	Name string
 	Op   string
@@ -3,6 +3,9 @@ package vcs
 import (
 	"encoding/hex"
 	"errors"
+	"path/filepath"
+	"strconv"
+	"time"
 )
 
 // Git implements the VCS interface for interacting with Git.
@@ -33,6 +36,25 @@ func (git *Git) init() {
 			}
 			return gitCommitHash(wc, s)
 		},
+		untracked: func(wc *commandWC, paths []string) ([]string, error) {
+			args := append([]string{"ls-files", "-z", "--others", "--exclude-standard", "--"}, paths...)
+			out, err := wc.cmd(args...).Output()
+			if err != nil {
+				return nil, err
+			}
+			return splitNul(out), nil
+		},
+		branch: func(wc *commandWC) (string, error) {
+			b, err := wc.outputLine("rev-parse", "--abbrev-ref", "HEAD")
+			if b == "HEAD" {
+				// Detached HEAD
+				b = ""
+			}
+			return b, err
+		},
+		dirty: func(wc *commandWC) (bool, error) {
+			return wc.hasOutput("status", "--porcelain", "--untracked-files=no")
+		},
 	}
 	git.c.init(git.Program)
 }
@@ -83,8 +105,9 @@ func (wc gitWC) Rename(src, dst string) error {
 	if err := wc.Add([]string{dst}); err != nil {
 		return err
 	}
-	if err := wc.Remove([]string{src}); err != nil {
-		return err
+	// src may already have been removed from the index.
+	if err := wc.cmd([]string{"rm", "--ignore-unmatch", "--", src}...).Run(); err != nil {
+		return &vcsError{Name: wc.c.name, Op: wc.c.remove, Path: wc.path, Err: err}
 	}
 	return nil
 }
@@ -116,6 +139,57 @@ func (wc gitWC) Update(rev Rev) error {
 	return nil
 }
 
+func (wc gitWC) Files(rev Rev) ([]string, error) {
+	out, err := wc.cmd("ls-tree", "-r", "-z", "--name-only", "--full-tree", rev.Rev()).Output()
+	if err != nil {
+		return nil, &vcsError{Name: wc.c.name, Op: "ls-tree", Path: wc.path, Err: err}
+	}
+	return splitNul(out), nil
+}
+
+func (wc gitWC) ReadFile(rev Rev, path string) ([]byte, error) {
+	out, err := wc.cmd("cat-file", "blob", rev.Rev()+":"+filepath.ToSlash(path)).Output()
+	if err != nil {
+		return nil, &vcsError{Name: wc.c.name, Op: "cat-file", Path: wc.path, Err: err}
+	}
+	return out, nil
+}
+
+func (wc gitWC) RevAt(t time.Time) (Rev, error) {
+	const op = "rev-list"
+	out, err := wc.cmd("rev-list", "-1", "--before=@"+strconv.FormatInt(t.Unix(), 10), "HEAD").Output()
+	if err != nil {
+		return nil, &vcsError{Name: wc.c.name, Op: op, Path: wc.path, Err: err}
+	}
+	if len(out) == 0 {
+		return nil, &vcsError{Name: wc.c.name, Op: op, Path: wc.path, Err: errNoRev}
+	}
+	rev, err := parseGitRevParseOutput(out)
+	if err != nil {
+		return nil, &vcsError{Name: wc.c.name, Op: op, Path: wc.path, Err: err}
+	}
+	return rev, nil
+}
+
+func (wc gitWC) Log(paths []string) ([]Changeset, error) {
+	const op = "log"
+	args := []string{"log", "--format=%H%n%at%n%an%n%s", "--"}
+	for _, p := range paths {
+		args = append(args, filepath.ToSlash(p))
+	}
+	out, err := wc.cmd(args...).Output()
+	if err != nil {
+		return nil, &vcsError{Name: wc.c.name, Op: op, Path: wc.path, Err: err}
+	}
+	log, err := parseLog(out, func(b []byte) (Rev, error) {
+		return parseGitRevParseOutput(b)
+	})
+	if err != nil {
+		return nil, &vcsError{Name: wc.c.name, Op: op, Path: wc.path, Err: err}
+	}
+	return log, nil
+}
+
 const gitRevSize = 20
 
 type gitRev [gitRevSize]byte
@@ -2,7 +2,10 @@ package vcs
 
 import (
 	"bytes"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 )
 
 const desiredGitPath = "/wc"
@@ -128,7 +131,7 @@ func TestGitRename(t *testing.T) {
 		{
 			Out:        *bytes.NewBuffer([]byte{}),
 			ExpectDir:  desiredGitPath,
-			ExpectArgs: []string{"git", "rm", "--", from},
+			ExpectArgs: []string{"git", "rm", "--ignore-unmatch", "--", from},
 		},
 	}
 	wc := newIsolatedGitWC(desiredGitPath, mc)
@@ -228,3 +231,169 @@ func TestGitParseRevParseOutput(t *testing.T) {
 		}
 	}
 }
+
+func TestGitUntracked(t *testing.T) {
+	mc := mockCommander{
+		{
+			Out:        *bytes.NewBufferString("projects/foo.json\x00projects/bar baz.json\x00"),
+			ExpectDir:  desiredGitPath,
+			ExpectArgs: []string{"git", "ls-files", "-z", "--others", "--exclude-standard", "--", "catalog.json", "projects"},
+		},
+	}
+	wc := newIsolatedGitWC(desiredGitPath, mc)
+	files, err := wc.Untracked([]string{"catalog.json", "projects"})
+	mc.check(t)
+	if err != nil {
+		t.Errorf("wc.Untracked(...) error: %v", err)
+	}
+	if want := []string{filepath.Join("projects", "foo.json"), filepath.Join("projects", "bar baz.json")}; !reflect.DeepEqual(files, want) {
+		t.Errorf("wc.Untracked(...) = %q; want %q", files, want)
+	}
+}
+
+func TestGitBranch(t *testing.T) {
+	tests := []struct {
+		out  string
+		want string
+	}{
+		{"master\n", "master"},
+		{"HEAD\n", ""},
+	}
+	for _, test := range tests {
+		mc := mockCommander{
+			{
+				Out:        *bytes.NewBufferString(test.out),
+				ExpectDir:  desiredGitPath,
+				ExpectArgs: []string{"git", "rev-parse", "--abbrev-ref", "HEAD"},
+			},
+		}
+		var wc StatusReporter = newIsolatedGitWC(desiredGitPath, mc)
+		b, err := wc.Branch()
+		mc.check(t)
+		if err != nil {
+			t.Errorf("wc.Branch() error: %v", err)
+		} else if b != test.want {
+			t.Errorf("wc.Branch() = %q (output %q); want %q", b, test.out, test.want)
+		}
+	}
+}
+
+func TestGitIsDirty(t *testing.T) {
+	tests := []struct {
+		out  string
+		want bool
+	}{
+		{"", false},
+		{" M main.go\n", true},
+	}
+	for _, test := range tests {
+		mc := mockCommander{
+			{
+				Out:        *bytes.NewBufferString(test.out),
+				ExpectDir:  desiredGitPath,
+				ExpectArgs: []string{"git", "status", "--porcelain", "--untracked-files=no"},
+			},
+		}
+		wc := newIsolatedGitWC(desiredGitPath, mc)
+		dirty, err := wc.IsDirty()
+		mc.check(t)
+		if err != nil {
+			t.Errorf("wc.IsDirty() error: %v", err)
+		} else if dirty != test.want {
+			t.Errorf("wc.IsDirty() = %t (output %q); want %t", dirty, test.out, test.want)
+		}
+	}
+}
+
+func TestGitFiles(t *testing.T) {
+	mc := mockCommander{
+		{
+			Out:        *bytes.NewBufferString("catalog.json\x00projects/foo.json\x00"),
+			ExpectDir:  desiredGitPath,
+			ExpectArgs: []string{"git", "ls-tree", "-r", "-z", "--name-only", "--full-tree", magicGitRev.Rev()},
+		},
+	}
+	var wc RevReader = newIsolatedGitWC(desiredGitPath, mc)
+	files, err := wc.Files(magicGitRev)
+	mc.check(t)
+	if err != nil {
+		t.Errorf("wc.Files(%v) error: %v", magicGitRev, err)
+	}
+	if want := []string{"catalog.json", filepath.Join("projects", "foo.json")}; !reflect.DeepEqual(files, want) {
+		t.Errorf("wc.Files(%v) = %q; want %q", magicGitRev, files, want)
+	}
+}
+
+func TestGitReadFile(t *testing.T) {
+	mc := mockCommander{
+		{
+			Out:        *bytes.NewBufferString("{}\n"),
+			ExpectDir:  desiredGitPath,
+			ExpectArgs: []string{"git", "cat-file", "blob", magicGitRev.Rev() + ":projects/foo.json"},
+		},
+	}
+	wc := newIsolatedGitWC(desiredGitPath, mc)
+	data, err := wc.ReadFile(magicGitRev, filepath.Join("projects", "foo.json"))
+	mc.check(t)
+	if err != nil {
+		t.Errorf("wc.ReadFile(...) error: %v", err)
+	} else if want := "{}\n"; string(data) != want {
+		t.Errorf("wc.ReadFile(...) = %q; want %q", data, want)
+	}
+}
+
+func TestGitRevAt(t *testing.T) {
+	at := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		out string
+		rev Rev
+	}{
+		{"0d9c2b3c7bce68ef9950d237eac5ff67f117bff5\n", magicGitRev},
+		{"", nil},
+	}
+	for _, test := range tests {
+		mc := mockCommander{
+			{
+				Out:        *bytes.NewBufferString(test.out),
+				ExpectDir:  desiredGitPath,
+				ExpectArgs: []string{"git", "rev-list", "-1", "--before=@1546300800", "HEAD"},
+			},
+		}
+		wc := newIsolatedGitWC(desiredGitPath, mc)
+		rev, err := wc.RevAt(at)
+		mc.check(t)
+		switch {
+		case test.rev == nil && err == nil:
+			t.Errorf("wc.RevAt(%v) with output %q = %v; want error", at, test.out, rev)
+		case test.rev != nil && err != nil:
+			t.Errorf("wc.RevAt(%v) with output %q error: %v", at, test.out, err)
+		case test.rev != nil && rev != test.rev:
+			t.Errorf("wc.RevAt(%v) with output %q = %v; want %v", at, test.out, rev, test.rev)
+		}
+	}
+}
+
+func TestGitLog(t *testing.T) {
+	mc := mockCommander{
+		{
+			Out: *bytes.NewBufferString(
+				"0d9c2b3c7bce68ef9950d237eac5ff67f117bff5\n1546300800\nAlice\nput project foo\n" +
+					"0d9c2b3c7bce68ef9950d237eac5ff67f117bff5\n1546214400\nBob\n\n"),
+			ExpectDir:  desiredGitPath,
+			ExpectArgs: []string{"git", "log", "--format=%H%n%at%n%an%n%s", "--", "projects/foo.json", "trash/b11dzGs4SQid.json"},
+		},
+	}
+	var wc Logger = newIsolatedGitWC(desiredGitPath, mc)
+	log, err := wc.Log([]string{filepath.Join("projects", "foo.json"), filepath.Join("trash", "b11dzGs4SQid.json")})
+	mc.check(t)
+	if err != nil {
+		t.Fatal("wc.Log(...) error:", err)
+	}
+	want := []Changeset{
+		{Rev: magicGitRev, Author: "Alice", Time: time.Unix(1546300800, 0), Message: "put project foo"},
+		{Rev: magicGitRev, Author: "Bob", Time: time.Unix(1546214400, 0), Message: ""},
+	}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("wc.Log(...) = %+v; want %+v", log, want)
+	}
+}
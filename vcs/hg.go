@@ -3,6 +3,9 @@ package vcs
 import (
 	"encoding/hex"
 	"errors"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 // Mercurial implements the VCS interface for interacting with Mercurial.
@@ -35,6 +38,23 @@ func (hg *Mercurial) init() {
 			}
 			return hgIdentify(wc, "-r", s)
 		},
+		untracked: func(wc *commandWC, paths []string) ([]string, error) {
+			args := []string{"status", "--unknown", "--no-status", "--print0", "--"}
+			for _, p := range paths {
+				args = append(args, "path:"+p)
+			}
+			out, err := wc.cmd(args...).Output()
+			if err != nil {
+				return nil, err
+			}
+			return splitNul(out), nil
+		},
+		branch: func(wc *commandWC) (string, error) {
+			return wc.outputLine("branch")
+		},
+		dirty: func(wc *commandWC) (bool, error) {
+			return wc.hasOutput("status", "--modified", "--added", "--removed", "--deleted")
+		},
 	}
 	hg.c.init(hg.Program)
 }
@@ -112,6 +132,51 @@ func (wc mercurialWC) Commit(message string, files []string) error {
 	return wc.commandWC.Commit(message, f)
 }
 
+func (wc mercurialWC) Files(rev Rev) ([]string, error) {
+	out, err := wc.cmd("manifest", "-r", rev.Rev()).Output()
+	if err != nil {
+		return nil, &vcsError{Name: wc.c.name, Op: "manifest", Path: wc.path, Err: err}
+	}
+	var files []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			files = append(files, filepath.FromSlash(line))
+		}
+	}
+	return files, nil
+}
+
+func (wc mercurialWC) ReadFile(rev Rev, path string) ([]byte, error) {
+	out, err := wc.cmd("cat", "-r", rev.Rev(), "--", "path:"+filepath.ToSlash(path)).Output()
+	if err != nil {
+		return nil, &vcsError{Name: wc.c.name, Op: "cat", Path: wc.path, Err: err}
+	}
+	return out, nil
+}
+
+func (wc mercurialWC) RevAt(t time.Time) (Rev, error) {
+	return hgIdentify(wc.commandWC, "-r", "last(sort(date('<"+t.Format("2006-01-02 15:04:05 -0700")+"'), date))")
+}
+
+func (wc mercurialWC) Log(paths []string) ([]Changeset, error) {
+	const op = "log"
+	args := []string{"log", "--template", `{node}\n{date|hgdate}\n{author|person}\n{desc|firstline}\n`, "--"}
+	for _, p := range paths {
+		args = append(args, "path:"+filepath.ToSlash(p))
+	}
+	out, err := wc.cmd(args...).Output()
+	if err != nil {
+		return nil, &vcsError{Name: wc.c.name, Op: op, Path: wc.path, Err: err}
+	}
+	log, err := parseLog(out, func(b []byte) (Rev, error) {
+		return parseHgIdentifyOutput(b)
+	})
+	if err != nil {
+		return nil, &vcsError{Name: wc.c.name, Op: op, Path: wc.path, Err: err}
+	}
+	return log, nil
+}
+
 const mercurialRevSize = 20
 
 type mercurialRev [mercurialRevSize]byte
@@ -2,8 +2,10 @@ package vcs
 
 import (
 	"bytes"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 )
 
 const desiredHgPath = "/wc"
@@ -189,3 +191,136 @@ func TestParseIdentifyOutput(t *testing.T) {
 		}
 	}
 }
+
+func TestMercurialUntracked(t *testing.T) {
+	mc := mockCommander{
+		{
+			Out:        *bytes.NewBufferString("projects/foo.json\x00"),
+			ExpectDir:  desiredHgPath,
+			ExpectArgs: []string{"hg", "status", "--unknown", "--no-status", "--print0", "--", "path:catalog.json", "path:projects"},
+		},
+	}
+	wc := newIsolatedMercurialWC(desiredHgPath, mc)
+	files, err := wc.Untracked([]string{"catalog.json", "projects"})
+	mc.check(t)
+	if err != nil {
+		t.Errorf("wc.Untracked(...) error: %v", err)
+	}
+	if want := []string{filepath.Join("projects", "foo.json")}; !reflect.DeepEqual(files, want) {
+		t.Errorf("wc.Untracked(...) = %q; want %q", files, want)
+	}
+}
+
+func TestMercurialBranch(t *testing.T) {
+	mc := mockCommander{
+		{
+			Out:        *bytes.NewBufferString("stable\n"),
+			ExpectDir:  desiredHgPath,
+			ExpectArgs: []string{"hg", "branch"},
+		},
+	}
+	var wc StatusReporter = newIsolatedMercurialWC(desiredHgPath, mc)
+	b, err := wc.Branch()
+	mc.check(t)
+	if err != nil {
+		t.Errorf("wc.Branch() error: %v", err)
+	} else if want := "stable"; b != want {
+		t.Errorf("wc.Branch() = %q; want %q", b, want)
+	}
+}
+
+func TestMercurialIsDirty(t *testing.T) {
+	mc := mockCommander{
+		{
+			Out:        *bytes.NewBufferString("A foo.go\n"),
+			ExpectDir:  desiredHgPath,
+			ExpectArgs: []string{"hg", "status", "--modified", "--added", "--removed", "--deleted"},
+		},
+	}
+	wc := newIsolatedMercurialWC(desiredHgPath, mc)
+	dirty, err := wc.IsDirty()
+	mc.check(t)
+	if err != nil {
+		t.Errorf("wc.IsDirty() error: %v", err)
+	} else if !dirty {
+		t.Error("wc.IsDirty() = false; want true")
+	}
+}
+
+func TestMercurialFiles(t *testing.T) {
+	mc := mockCommander{
+		{
+			Out:        *bytes.NewBufferString("catalog.json\nprojects/foo.json\n"),
+			ExpectDir:  desiredHgPath,
+			ExpectArgs: []string{"hg", "manifest", "-r", magicHgRev.Rev()},
+		},
+	}
+	var wc RevReader = newIsolatedMercurialWC(desiredHgPath, mc)
+	files, err := wc.Files(magicHgRev)
+	mc.check(t)
+	if err != nil {
+		t.Errorf("wc.Files(%v) error: %v", magicHgRev, err)
+	}
+	if want := []string{"catalog.json", filepath.Join("projects", "foo.json")}; !reflect.DeepEqual(files, want) {
+		t.Errorf("wc.Files(%v) = %q; want %q", magicHgRev, files, want)
+	}
+}
+
+func TestMercurialReadFile(t *testing.T) {
+	mc := mockCommander{
+		{
+			Out:        *bytes.NewBufferString("{}\n"),
+			ExpectDir:  desiredHgPath,
+			ExpectArgs: []string{"hg", "cat", "-r", magicHgRev.Rev(), "--", "path:projects/foo.json"},
+		},
+	}
+	wc := newIsolatedMercurialWC(desiredHgPath, mc)
+	data, err := wc.ReadFile(magicHgRev, filepath.Join("projects", "foo.json"))
+	mc.check(t)
+	if err != nil {
+		t.Errorf("wc.ReadFile(...) error: %v", err)
+	} else if want := "{}\n"; string(data) != want {
+		t.Errorf("wc.ReadFile(...) = %q; want %q", data, want)
+	}
+}
+
+func TestMercurialRevAt(t *testing.T) {
+	at := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	mc := mockCommander{
+		{
+			Out:        *bytes.NewBufferString("0d9c2b3c7bce68ef9950d237eac5ff67f117bff5\n"),
+			ExpectDir:  desiredHgPath,
+			ExpectArgs: []string{"hg", "identify", "--debug", "-i", "-r", "last(sort(date('<2019-01-01 00:00:00 +0000'), date))"},
+		},
+	}
+	wc := newIsolatedMercurialWC(desiredHgPath, mc)
+	rev, err := wc.RevAt(at)
+	mc.check(t)
+	if err != nil {
+		t.Errorf("wc.RevAt(%v) error: %v", at, err)
+	} else if rev != magicHgRev {
+		t.Errorf("wc.RevAt(%v) = %v; want %v", at, rev, magicHgRev)
+	}
+}
+
+func TestMercurialLog(t *testing.T) {
+	mc := mockCommander{
+		{
+			Out:        *bytes.NewBufferString("0d9c2b3c7bce68ef9950d237eac5ff67f117bff5\n1546300800 28800\nAlice\nput project foo\n"),
+			ExpectDir:  desiredHgPath,
+			ExpectArgs: []string{"hg", "log", "--template", `{node}\n{date|hgdate}\n{author|person}\n{desc|firstline}\n`, "--", "path:projects/foo.json"},
+		},
+	}
+	var wc Logger = newIsolatedMercurialWC(desiredHgPath, mc)
+	log, err := wc.Log([]string{filepath.Join("projects", "foo.json")})
+	mc.check(t)
+	if err != nil {
+		t.Fatal("wc.Log(...) error:", err)
+	}
+	want := []Changeset{
+		{Rev: magicHgRev, Author: "Alice", Time: time.Unix(1546300800, 0), Message: "put project foo"},
+	}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("wc.Log(...) = %+v; want %+v", log, want)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/xml"
 	"errors"
 	"strconv"
+	"strings"
 )
 
 // Subversion implements the VCS interface for interacting with Subversion.
@@ -40,6 +41,27 @@ func (svn *Subversion) init() {
 			}
 			return subversionRev(n), nil
 		},
+		untracked: func(wc *commandWC, paths []string) ([]string, error) {
+			out, err := wc.cmd(append([]string{"status", "--"}, paths...)...).Output()
+			if err != nil {
+				return nil, err
+			}
+			return parseSvnUnknown(out), nil
+		},
+		branch: func(wc *commandWC) (string, error) {
+			var v struct {
+				Entry struct {
+					URL string `xml:"url"`
+				} `xml:"entry"`
+			}
+			if err := svnInfo(wc, &v); err != nil {
+				return "", err
+			}
+			return svnBranch(v.Entry.URL), nil
+		},
+		dirty: func(wc *commandWC) (bool, error) {
+			return wc.hasOutput("status", "--quiet")
+		},
 	}
 	svn.c.init(svn.Program)
 }
@@ -95,6 +117,33 @@ func (wc subversionWC) Rename(src, dst string) error {
 	return &vcsError{Name: wc.c.name, Op: "move", Path: wc.path, Err: errors.New("rename not supported")}
 }
 
+// parseSvnUnknown returns the unversioned files listed in svn status output.
+func parseSvnUnknown(out []byte) []string {
+	var files []string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(line) > 1 && line[0] == '?' {
+			files = append(files, strings.TrimLeft(line[1:], " "))
+		}
+	}
+	return files
+}
+
+// svnBranch returns the branch name for a working copy URL that follows the
+// standard trunk/branches layout, or the empty string if the URL does not.
+func svnBranch(url string) string {
+	parts := strings.Split(strings.TrimRight(url, "/"), "/")
+	for i, p := range parts {
+		switch {
+		case p == "trunk":
+			return p
+		case p == "branches" && i+1 < len(parts):
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
 type subversionRev int
 
 func (r subversionRev) Rev() string {
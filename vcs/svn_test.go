@@ -2,6 +2,7 @@ package vcs
 
 import (
 	"bytes"
+	"reflect"
 	"testing"
 )
 
@@ -65,3 +66,74 @@ func TestSubversionRename(t *testing.T) {
 		t.Errorf("wc.Rename(%q, %q) expected an error", "foo", "bar")
 	}
 }
+
+func TestParseSvnUnknown(t *testing.T) {
+	out := "?       projects/foo.json\nM       catalog.json\n?       projects/bar.json\n"
+	files := parseSvnUnknown([]byte(out))
+	if want := []string{"projects/foo.json", "projects/bar.json"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("parseSvnUnknown(%q) = %q; want %q", out, files, want)
+	}
+}
+
+func TestSubversionBranch(t *testing.T) {
+	mc := mockCommander{
+		{
+			Out: *bytes.NewBufferString(`<?xml version="1.0" encoding="UTF-8"?>
+<info>
+<entry
+   kind="dir"
+   path="."
+   revision="1302">
+<url>https://svn.example.com/repo/foo/branches/release-1.0</url>
+</entry>
+</info>
+`),
+			ExpectDir:  desiredSvnPath,
+			ExpectArgs: []string{"svn", "info", "--xml"},
+		},
+	}
+	var wc StatusReporter = newIsolatedSubversionWC(desiredSvnPath, mc)
+	b, err := wc.Branch()
+	mc.check(t)
+	if err != nil {
+		t.Errorf("wc.Branch() error: %v", err)
+	} else if want := "release-1.0"; b != want {
+		t.Errorf("wc.Branch() = %q; want %q", b, want)
+	}
+}
+
+func TestSvnBranch(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://svn.example.com/repo/foo/trunk", "trunk"},
+		{"https://svn.example.com/repo/foo/trunk/src", "trunk"},
+		{"https://svn.example.com/repo/foo/branches/fix/", "fix"},
+		{"https://svn.example.com/repo/foo/branches", ""},
+		{"https://svn.example.com/repo/foo", ""},
+	}
+	for _, test := range tests {
+		if b := svnBranch(test.url); b != test.want {
+			t.Errorf("svnBranch(%q) = %q; want %q", test.url, b, test.want)
+		}
+	}
+}
+
+func TestSubversionIsDirty(t *testing.T) {
+	mc := mockCommander{
+		{
+			Out:        *bytes.NewBufferString(""),
+			ExpectDir:  desiredSvnPath,
+			ExpectArgs: []string{"svn", "status", "--quiet"},
+		},
+	}
+	wc := newIsolatedSubversionWC(desiredSvnPath, mc)
+	dirty, err := wc.IsDirty()
+	mc.check(t)
+	if err != nil {
+		t.Errorf("wc.IsDirty() error: %v", err)
+	} else if dirty {
+		t.Error("wc.IsDirty() = true; want false")
+	}
+}
@@ -3,9 +3,13 @@ package vcs
 
 import (
 	"errors"
+	"time"
 )
 
-var errNotWC = errors.New("not a working copy")
+var (
+	errNotWC = errors.New("not a working copy")
+	errNoRev = errors.New("no changeset at or before the given time")
+)
 
 // VCS is a version control system connector.
 type VCS interface {
@@ -48,6 +52,67 @@ type WorkingCopy interface {
 	ParseRev(s string) (Rev, error)
 }
 
+// An UntrackedLister is a WorkingCopy that can find files that are not under
+// version control.
+type UntrackedLister interface {
+	WorkingCopy
+
+	// Untracked returns the files in the given paths (or under them, for
+	// directories) that are neither tracked nor ignored.
+	Untracked(paths []string) ([]string, error)
+}
+
+// A StatusReporter is a WorkingCopy that can describe the local state of its
+// files.
+type StatusReporter interface {
+	WorkingCopy
+
+	// Branch returns the name of the branch that the working copy is on.
+	// It returns the empty string if the working copy is not on a branch,
+	// like a Git checkout of a detached HEAD.
+	Branch() (string, error)
+
+	// IsDirty reports whether any tracked files have uncommitted changes.
+	// Untracked files are not considered.
+	IsDirty() (bool, error)
+}
+
+// A RevReader is a WorkingCopy that can read files as they were in past
+// changesets.
+type RevReader interface {
+	WorkingCopy
+
+	// Files returns the paths of the files tracked in rev, relative to the
+	// root of the working copy.
+	Files(rev Rev) ([]string, error)
+
+	// ReadFile returns the contents of a file as it was in rev.
+	ReadFile(rev Rev, path string) ([]byte, error)
+
+	// RevAt returns the most recent changeset committed at or before t.
+	RevAt(t time.Time) (Rev, error)
+}
+
+// A Logger is a RevReader that can list the changesets in its history.
+type Logger interface {
+	RevReader
+
+	// Log returns the changesets that changed any of the given paths,
+	// most recent first.  If no paths are given, then Log returns every
+	// changeset.
+	Log(paths []string) ([]Changeset, error)
+}
+
+// A Changeset describes a commit in a working copy's history.
+type Changeset struct {
+	Rev    Rev
+	Author string
+	Time   time.Time
+
+	// Message is the first line of the commit message.
+	Message string
+}
+
 // A Rev is a unique identifier for a changeset.
 // The Rev method should return a string that uniquely identifies a changeset
 // across working copies.
@@ -2,9 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"html"
 	"html/template"
 	"log"
+	"mime"
 	"net/http"
 	"net/url"
 	"path/filepath"
@@ -44,7 +46,7 @@ func cmdWeb(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
 	addr := fset.String("listen", "localhost:10710", "address to listen for HTTP")
 	templateDir := fset.String("templatedir", "templates", "template directory")
 	staticDir := fset.String("staticdir", "static", "static directory")
-	refresh := fset.Duration("refresh", 1*time.Minute, "interval between catalog cache refreshes")
+	refresh := fset.Duration("refresh", 0, "interval between full catalog cache refreshes (0 to only follow catalog changes)")
 	parseFlags(fset, args)
 	if fset.NArg() != 0 {
 		cmd.PrintSynopsis(set)
@@ -67,8 +69,13 @@ func cmdWeb(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
 	r.Handle("/project/", &handler{env, handlePostProject}).Methods("POST").Name("postproject")
 	r.Handle("/project/{project}", &handler{env, handleProject}).Methods("GET", "HEAD").Name("project")
 	r.Handle("/project/{project}", &handler{env, handlePutProject}).Methods("PUT").Name("putproject")
+	r.Handle("/project/{project}/history", &handler{env, handleHistory}).Methods("GET", "HEAD").Name("history")
+	r.Handle("/project/{project}/attachments/{name}", &handler{env, handleAttachment}).Methods("GET", "HEAD").Name("attachment")
+	r.Handle("/id/{id}", &handler{env, handleID}).Methods("GET", "HEAD").Name("id")
 	r.Handle("/tag/", &handler{env, handleTagIndex}).Name("tagindex")
 	r.Handle("/tag/{tag}", &handler{env, handleTag}).Name("tag")
+	r.Handle("/trash/", &handler{env, handleTrash}).Methods("GET", "HEAD").Name("trash")
+	r.Handle("/trash/{id}", &handler{env, handleRestore}).Methods("POST").Name("restore")
 	staticDirRoute(r, "/css/", filepath.Join(*staticDir, "css")).Name("css")
 	staticDirRoute(r, "/img/", filepath.Join(*staticDir, "img")).Name("img")
 	staticDirRoute(r, "/js/", filepath.Join(*staticDir, "js")).Name("js")
@@ -96,40 +103,119 @@ func cmdWeb(set *subcmd.Set, cmd *subcmd.Command, args []string) error {
 		return err
 	}
 
+	if err := watchEnv(env); err != nil {
+		log.Println("not watching catalog:", err)
+		if *refresh == 0 {
+			*refresh = 1 * time.Minute
+		}
+	}
+	if *refresh > 0 {
+		go refreshLoop(env, *refresh)
+	}
+
+	return http.ListenAndServe(*addr, env.router)
+}
+
+// refreshLoop rebuilds the cache and searcher at a regular interval.
+func refreshLoop(env *webEnv, interval time.Duration) {
+	for t := range time.Tick(interval) {
+		if err := refreshEnv(env); err == nil {
+			log.Println("refresh took", time.Since(t))
+		} else {
+			log.Println("refresh failed:", err)
+		}
+	}
+}
+
+// watchEnv starts updating the cache and searcher from catalog events.  If an
+// event can't be applied, the cache and searcher are rebuilt.
+func watchEnv(env *webEnv) error {
+	w, ok := env.realCat.(catalog.Watcher)
+	if !ok {
+		return errCatalogNotWatchable
+	}
+	watch, err := w.Watch()
+	if err != nil {
+		return err
+	}
 	go func() {
-		for t := range time.Tick(*refresh) {
-			if err := refreshEnv(env); err == nil {
-				log.Println("refresh took", time.Since(t))
-			} else {
-				log.Println("refresh failed:", err)
+		for ev := range watch.C {
+			if err := applyEvent(env, ev); err != nil {
+				// The cache and searcher may no longer match the
+				// catalog, so rebuild them.
+				log.Printf("applying %v: %v; refreshing", ev, err)
+				if err := refreshEnv(env); err != nil {
+					log.Println("refresh failed:", err)
+				}
 			}
 		}
 	}()
+	return nil
+}
 
-	return http.ListenAndServe(*addr, env.router)
+// applyEvent updates the cache and searcher for a single change.
+func applyEvent(env *webEnv, ev catalog.Event) error {
+	env.Lock()
+	defer env.Unlock()
+
+	if err := env.cat.Apply(ev); err != nil {
+		return err
+	}
+	if idx, ok := env.searcher.(search.Index); ok {
+		return idx.Apply(env.cat, ev)
+	}
+	return nil
 }
 
+// handleIndex lists the catalog's projects.  Archived projects are hidden
+// unless the archived parameter is set.
 func handleIndex(env *webEnv, w http.ResponseWriter, req *http.Request) error {
 	now := time.Now()
-	list, err := env.cat.List()
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	showArchived := req.Form.Get("archived") != ""
+	cat, at, err := requestCatalog(env, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	fieldSchema, err := catalog.GetSchema(cat)
+	if err != nil {
+		return err
+	}
+	list, err := cat.List()
 	if err != nil {
 		return err
 	}
 	sort.Strings(list)
 	projects := make([]*catalog.Project, 0, len(list))
+	nArchived := 0
 	for _, sn := range list {
-		p, err := env.cat.GetProject(sn)
-		if err == nil {
-			projects = append(projects, p)
-		} else {
+		p, err := cat.GetProject(sn)
+		if err != nil {
 			log.Printf("error fetching %s from list: %v", sn, err)
+			continue
+		}
+		if p.CurrentStatus() == catalog.StatusArchived {
+			nArchived++
+			if !showArchived {
+				continue
+			}
 		}
+		projects = append(projects, p)
 	}
 	return env.tmpl.ExecuteTemplate(w, "index.html", struct {
-		Projects []*catalog.Project
-		Now      time.Time
+		Projects     []*catalog.Project
+		At           string
+		Now          time.Time
+		ShowArchived bool
+		NArchived    int
+		Schema       *catalog.Schema
+		Fields       map[string]string
 	}{
-		projects, now,
+		projects, at, now, showArchived, nArchived, fieldSchema, nil,
 	})
 }
 
@@ -181,12 +267,13 @@ func handleSearch(env *webEnv, w http.ResponseWriter, req *http.Request) error {
 		for i := (v.Page - 1) * perPage; i < v.Page*perPage && i < len(results); i++ {
 			r := results[i]
 			p, err := env.cat.GetProject(r.ShortName)
-			if err != nil {
+			if catalog.IsNotFound(err) {
+				// The index has not caught up with a delete.
+				continue
+			} else if err != nil {
 				return err
 			}
-			if p != nil {
-				v.Results = append(v.Results, projectResult{p, r})
-			}
+			v.Results = append(v.Results, projectResult{p, r})
 		}
 	}
 
@@ -210,16 +297,268 @@ func handleProject(env *webEnv, w http.ResponseWriter, req *http.Request) error
 		}
 	}
 
-	proj, err := env.cat.RefreshProject(sn)
+	cat, at, err := requestCatalog(env, req)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	var proj *catalog.Project
+	if at == "" {
+		proj, err = env.cat.RefreshProject(sn)
+	} else {
+		proj, err = cat.GetProject(sn)
+	}
+	if redirectRenamed(env, w, req, err) {
+		return nil
+	} else if err != nil {
 		return err
-	} else if proj == nil {
-		return webapp.NotFound
 	}
 	if jsonAccept > htmlAccept {
 		return webapp.JSONResponse(w, proj)
 	}
-	return env.tmpl.ExecuteTemplate(w, "project.html", proj)
+	fieldSchema, err := catalog.GetSchema(cat)
+	if err != nil {
+		return err
+	}
+	outLinks, inLinks, err := resolveLinks(cat, proj)
+	if err != nil {
+		return err
+	}
+	parent, children, err := resolveSubprojects(cat, proj)
+	if err != nil {
+		return err
+	}
+	attachments, err := catalog.GetAttachments(cat, proj.ID)
+	if err != nil {
+		return err
+	}
+	return env.tmpl.ExecuteTemplate(w, "project.html", struct {
+		*catalog.Project
+		At          string
+		Schema      *catalog.Schema
+		OutLinks    []projectLink
+		InLinks     []projectLink
+		ParentLink  *projectLink
+		Subprojects []projectLink
+		Attachments []catalog.Attachment
+	}{
+		proj, at, fieldSchema, outLinks, inLinks, parent, children, attachments,
+	})
+}
+
+// handleAttachment serves one of a project's attachments.  The content type
+// comes from the attachment's extension or, failing that, its contents.
+func handleAttachment(env *webEnv, w http.ResponseWriter, req *http.Request) error {
+	vars := mux.Vars(req)
+	name := vars["name"]
+	if !catalog.IsValidAttachmentName(name) {
+		return webapp.NotFound
+	}
+	cat, _, err := requestCatalog(env, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	proj, err := cat.GetProject(vars["project"])
+	if rerr, ok := err.(*catalog.RenamedError); ok {
+		http.Redirect(w, req, withQuery(env.routerPath("attachment", "project", rerr.New, "name", name), req), http.StatusMovedPermanently)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	a, ok := cat.(catalog.Attacher)
+	if !ok {
+		return webapp.NotFound
+	}
+	data, err := a.ReadAttachment(proj.ID, name)
+	if err != nil {
+		return err
+	}
+	h := w.Header()
+	h.Set(webapp.HeaderContentType, attachmentType(name, data))
+	h.Set("X-Content-Type-Options", "nosniff")
+	// Attachments may be HTML from anywhere, so don't let them run scripts
+	// as part of the site.
+	h.Set("Content-Security-Policy", "sandbox")
+	_, err = w.Write(data)
+	return err
+}
+
+// attachmentType returns the MIME type of an attachment.
+func attachmentType(name string, data []byte) string {
+	if t := mime.TypeByExtension(filepath.Ext(name)); t != "" {
+		return t
+	}
+	return http.DetectContentType(data)
+}
+
+// A projectLink is a link to or from a project, as shown on its page.
+type projectLink struct {
+	Type catalog.LinkType
+	ID   catalog.ID
+
+	// Other is the project at the other end of the link, or nil if the
+	// project is not in the catalog.
+	Other *catalog.Project
+}
+
+// resolveLinks looks up the projects that proj links to and the projects
+// that link to proj.
+func resolveLinks(cat catalog.Catalog, proj *catalog.Project) (out, in []projectLink, err error) {
+	for _, l := range proj.Links {
+		pl := projectLink{Type: l.Type, ID: l.Target}
+		pl.Other, err = cat.GetProjectByID(l.Target)
+		if err != nil && !catalog.IsNotFound(err) {
+			return nil, nil, err
+		}
+		out = append(out, pl)
+	}
+	inbound, err := catalog.LinksTo(cat, proj.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, l := range inbound {
+		pl := projectLink{Type: l.Type, ID: l.Source}
+		pl.Other, err = cat.GetProjectByID(l.Source)
+		if err != nil {
+			return nil, nil, err
+		}
+		in = append(in, pl)
+	}
+	return out, in, nil
+}
+
+// resolveSubprojects looks up proj's parent and the subprojects that proj
+// contains.  parent is nil if proj is not a subproject.
+func resolveSubprojects(cat catalog.Catalog, proj *catalog.Project) (parent *projectLink, children []projectLink, err error) {
+	if proj.Parent != nil {
+		parent = &projectLink{ID: proj.Parent.ID}
+		parent.Other, err = cat.GetProjectByID(proj.Parent.ID)
+		if err != nil && !catalog.IsNotFound(err) {
+			return nil, nil, err
+		}
+	}
+	names, err := catalog.Subprojects(cat, proj.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, sn := range names {
+		child, err := cat.GetProject(sn)
+		if err != nil {
+			return nil, nil, err
+		}
+		children = append(children, projectLink{ID: child.ID, Other: child})
+	}
+	return parent, children, nil
+}
+
+// fieldFormPrefix starts the name of an HTML form input for a custom field.
+const fieldFormPrefix = projectFormFieldKey + "."
+
+// moveFieldInputs converts inputs named "field.NAME" in an HTML form to
+// NAME=VALUE values of the field key, as accepted by updateProjectForm.
+func moveFieldInputs(form url.Values) {
+	for key, values := range form {
+		if !strings.HasPrefix(key, fieldFormPrefix) {
+			continue
+		}
+		delete(form, key)
+		name := key[len(fieldFormPrefix):]
+		for _, v := range values {
+			form.Add(projectFormFieldKey, name+"="+v)
+		}
+	}
+}
+
+// redirectRenamed sends a permanent redirect to a project's new page if err is
+// a *catalog.RenamedError, and reports whether it did so.
+func redirectRenamed(env *webEnv, w http.ResponseWriter, req *http.Request, err error) bool {
+	rerr, ok := err.(*catalog.RenamedError)
+	if !ok {
+		return false
+	}
+	code := http.StatusMovedPermanently
+	if req.Method != "GET" && req.Method != "HEAD" {
+		// Preserve the method and body.
+		code = http.StatusPermanentRedirect
+	}
+	http.Redirect(w, req, withQuery(env.routerPath("project", "project", rerr.New), req), code)
+	return true
+}
+
+// withQuery returns path with the request's query string, so that parameters
+// like "at" survive a redirect.
+func withQuery(path string, req *http.Request) string {
+	if req.URL.RawQuery == "" {
+		return path
+	}
+	return path + "?" + req.URL.RawQuery
+}
+
+// requestCatalog returns the catalog that a request reads from.  If the
+// request has an "at" parameter, then that is a read-only copy of the catalog
+// as of the revision or date given (see catalogAt), which is returned along
+// with the parameter.  Otherwise, it is the live catalog.
+func requestCatalog(env *webEnv, req *http.Request) (cat catalog.Catalog, at string, err error) {
+	at = req.FormValue("at")
+	if at == "" {
+		return env.cat, "", nil
+	}
+	cat, err = catalogAt(at)
+	if err != nil {
+		return nil, at, err
+	}
+	return cat, at, nil
+}
+
+// handleHistory shows the changes to a project's record, as found in the log
+// of the catalog's working copy.
+func handleHistory(env *webEnv, w http.ResponseWriter, req *http.Request) error {
+	proj, err := env.cat.GetProject(mux.Vars(req)["project"])
+	if rerr, ok := err.(*catalog.RenamedError); ok {
+		http.Redirect(w, req, env.routerPath("history", "project", rerr.New), http.StatusMovedPermanently)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	wc, err := catalogLogger()
+	if err != nil {
+		return err
+	}
+	versions, err := catalog.History(wc, proj.ID)
+	if err != nil {
+		return err
+	}
+	return env.tmpl.ExecuteTemplate(w, "project-history.html", struct {
+		*catalog.Project
+		Versions []*catalog.ProjectVersion
+	}{
+		proj,
+		versions,
+	})
+}
+
+// handleID redirects to the project with an ID (or a unique ID prefix).
+func handleID(env *webEnv, w http.ResponseWriter, req *http.Request) error {
+	prefix := mux.Vars(req)["id"]
+	if len(prefix) < catalog.MinIDPrefixLen {
+		return webapp.NotFound
+	}
+	id, err := catalog.LookupID(env.cat, prefix)
+	if _, ok := err.(*catalog.AmbiguousIDError); ok {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	sn, err := env.cat.ShortName(id)
+	if err != nil {
+		return err
+	} else if sn == "" {
+		return webapp.NotFound
+	}
+	http.Redirect(w, req, env.routerPath("project", "project", sn), http.StatusFound)
+	return nil
 }
 
 func handlePostProject(env *webEnv, w http.ResponseWriter, req *http.Request) error {
@@ -231,7 +570,12 @@ func handlePostProject(env *webEnv, w http.ResponseWriter, req *http.Request) er
 	delete(req.Form, projectFormAddTagsKey)
 	delete(req.Form, projectFormDelTagsKey)
 	delete(req.Form, projectFormPathKey)
-	proj, err := createProjectForm(req.Form, "")
+	moveFieldInputs(req.Form)
+	fieldSchema, err := env.cat.Schema()
+	if err != nil {
+		return err
+	}
+	proj, err := createProjectForm(req.Form, "", fieldSchema)
 	if err != nil {
 		// TODO(light): handle form errors
 		return err
@@ -255,16 +599,21 @@ func handlePutProject(env *webEnv, w http.ResponseWriter, req *http.Request) err
 	}
 
 	proj, err := env.cat.RefreshProject(sn)
-	if err != nil {
+	if redirectRenamed(env, w, req, err) {
+		return nil
+	} else if err != nil {
 		return err
-	} else if proj == nil {
-		return webapp.NotFound
 	}
 
 	delete(req.Form, projectFormAddTagsKey)
 	delete(req.Form, projectFormDelTagsKey)
 	delete(req.Form, projectFormPathKey)
-	if err := updateProjectForm(proj, req.Form, ""); err != nil {
+	moveFieldInputs(req.Form)
+	fieldSchema, err := env.cat.Schema()
+	if err != nil {
+		return err
+	}
+	if err := updateProjectForm(proj, req.Form, "", fieldSchema); err != nil {
 		// TODO(light): handle form errors
 		return err
 	}
@@ -308,11 +657,48 @@ func handleTag(env *webEnv, w http.ResponseWriter, req *http.Request) error {
 		Tag      string
 		Sidebar  tagSidebar
 		Projects []*catalog.Project
+		At       string
+	}{
+		tag, tagSidebar{tags, tag}, projects, "",
+	})
+}
+
+func handleTrash(env *webEnv, w http.ResponseWriter, req *http.Request) error {
+	trash, err := env.cat.Trash()
+	if err != nil {
+		return err
+	}
+	return env.tmpl.ExecuteTemplate(w, "trash.html", struct {
+		Trash []*catalog.TrashedProject
 	}{
-		tag, tagSidebar{tags, tag}, projects,
+		trash,
 	})
 }
 
+// handleRestore moves a project out of the trash and redirects to it.  The
+// optional "shortname" form value restores the project under a new name.
+func handleRestore(env *webEnv, w http.ResponseWriter, req *http.Request) error {
+	id, err := catalog.ParseID(mux.Vars(req)["id"])
+	if err != nil {
+		return webapp.NotFound
+	}
+	sn := req.FormValue("shortname")
+	err = env.cat.RestoreProject(id, sn)
+	if _, ok := err.(*catalog.ProjectError); ok && !catalog.IsNotFound(err) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if sn == "" {
+		if sn, err = env.cat.ShortName(id); err != nil {
+			return err
+		}
+	}
+	http.Redirect(w, req, env.routerPath("project", "project", sn), http.StatusSeeOther)
+	return nil
+}
+
 type handler struct {
 	Env  *webEnv
 	Func func(env *webEnv, w http.ResponseWriter, req *http.Request) error
@@ -341,14 +727,50 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 				log.Printf("%s send error: %v", path, err)
 			}
 		}
-	} else if webapp.IsNotFound(err) {
-		http.NotFound(w, req)
+	} else if webapp.IsNotFound(err) || catalog.IsNotFound(err) {
+		notFound(w, req, err)
 	} else {
 		log.Printf("%s error: %v", path, err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
+// notFound sends a 404 response.  Clients that prefer JSON receive a JSON
+// object instead of a plain text page.
+func notFound(w http.ResponseWriter, req *http.Request, err error) {
+	if !prefersJSON(req) {
+		http.NotFound(w, req)
+		return
+	}
+	var body struct {
+		Error   string `json:"error"`
+		Project string `json:"project,omitempty"`
+	}
+	body.Error = "not found"
+	var perr *catalog.ProjectError
+	if errors.As(err, &perr) {
+		body.Project = perr.ShortName
+	}
+	w.Header().Set(webapp.HeaderContentType, webapp.JSONType)
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(&body)
+}
+
+// prefersJSON reports whether a request's Accept header ranks JSON above HTML.
+func prefersJSON(req *http.Request) bool {
+	h := req.Header.Get(webapp.HeaderAccept)
+	if h == "" {
+		return false
+	}
+	accept, err := webapp.ParseAcceptHeader(h)
+	if err != nil {
+		return false
+	}
+	htmlAccept := accept.Quality("text/html", map[string][]string{"charset": {"utf-8"}})
+	jsonAccept := accept.Quality("application/json", map[string][]string{"charset": {"utf-8"}})
+	return jsonAccept > htmlAccept
+}
+
 func staticDirRoute(r *mux.Router, prefix, path string) *mux.Route {
 	route := prefix + "{path:.*}"
 	fs := http.FileServer(http.Dir(path))
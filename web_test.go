@@ -1,8 +1,12 @@
 package main
 
 import (
+	"net/url"
 	"reflect"
+	"sort"
 	"testing"
+
+	"bitbucket.org/zombiezen/blackforest/catalog"
 )
 
 func TestOrganizeTags(t *testing.T) {
@@ -108,3 +112,111 @@ func TestPageList(t *testing.T) {
 		}
 	}
 }
+
+func TestMoveFieldInputs(t *testing.T) {
+	form := url.Values{
+		"name":        {"Foo"},
+		"field.owner": {"alice"},
+		"field.cost":  {""},
+		"field":       {"lang=go"},
+	}
+	moveFieldInputs(form)
+	sort.Strings(form["field"])
+	want := url.Values{
+		"name":  {"Foo"},
+		"field": {"cost=", "lang=go", "owner=alice"},
+	}
+	if !reflect.DeepEqual(form, want) {
+		t.Errorf("moveFieldInputs(...) = %v; want %v", form, want)
+	}
+}
+
+func TestResolveLinks(t *testing.T) {
+	cat := catalog.NewMemory()
+	missing := catalog.ID{9}
+	projects := []*catalog.Project{
+		{ID: catalog.ID{1}, ShortName: "lib"},
+		{ID: catalog.ID{2}, ShortName: "app", Links: []catalog.Link{{Type: catalog.DependsOn, Target: catalog.ID{1}}, {Type: catalog.PartOf, Target: missing}}},
+		{ID: catalog.ID{3}, ShortName: "fork", Links: []catalog.Link{{Type: catalog.ForkedFrom, Target: catalog.ID{2}}}},
+	}
+	for _, p := range projects {
+		if err := cat.PutProject(p); err != nil {
+			t.Fatal("PutProject error:", err)
+		}
+	}
+	app, err := cat.GetProject("app")
+	if err != nil {
+		t.Fatal("GetProject error:", err)
+	}
+	out, in, err := resolveLinks(cat, app)
+	if err != nil {
+		t.Fatal("resolveLinks error:", err)
+	}
+	if len(out) != 2 || out[0].Other == nil || out[0].Other.ShortName != "lib" || out[0].Type != catalog.DependsOn || out[1].Other != nil || out[1].ID != missing {
+		t.Errorf("resolveLinks(app) out = %+v; want [depends-on lib, part-of missing]", out)
+	}
+	if len(in) != 1 || in[0].Other == nil || in[0].Other.ShortName != "fork" || in[0].Type != catalog.ForkedFrom {
+		t.Errorf("resolveLinks(app) in = %+v; want [fork forked-from]", in)
+	}
+}
+
+func TestResolveSubprojects(t *testing.T) {
+	cat := catalog.NewMemory()
+	projects := []*catalog.Project{
+		{ID: catalog.ID{1}, ShortName: "mono"},
+		{ID: catalog.ID{2}, ShortName: "lib", Parent: &catalog.ParentRef{ID: catalog.ID{1}, Subdir: "lib"}},
+		{ID: catalog.ID{3}, ShortName: "app", Parent: &catalog.ParentRef{ID: catalog.ID{1}, Subdir: "app"}},
+	}
+	for _, p := range projects {
+		if err := cat.PutProject(p); err != nil {
+			t.Fatal("PutProject error:", err)
+		}
+	}
+	mono, err := cat.GetProject("mono")
+	if err != nil {
+		t.Fatal("GetProject error:", err)
+	}
+	parent, children, err := resolveSubprojects(cat, mono)
+	if err != nil {
+		t.Fatal("resolveSubprojects error:", err)
+	}
+	if parent != nil {
+		t.Errorf("resolveSubprojects(mono) parent = %+v; want nil", parent)
+	}
+	if len(children) != 2 || children[0].Other.ShortName != "app" || children[1].Other.ShortName != "lib" {
+		t.Errorf("resolveSubprojects(mono) children = %+v; want [app lib]", children)
+	}
+
+	lib, err := cat.GetProject("lib")
+	if err != nil {
+		t.Fatal("GetProject error:", err)
+	}
+	parent, children, err = resolveSubprojects(cat, lib)
+	if err != nil {
+		t.Fatal("resolveSubprojects error:", err)
+	}
+	if parent == nil || parent.Other == nil || parent.Other.ShortName != "mono" {
+		t.Errorf("resolveSubprojects(lib) parent = %+v; want mono", parent)
+	}
+	if len(children) != 0 {
+		t.Errorf("resolveSubprojects(lib) children = %+v; want none", children)
+	}
+}
+
+func TestAttachmentType(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"design.pdf", "%PDF-1.4", "application/pdf"},
+		{"screenshot.png", "\x89PNG\r\n\x1a\n", "image/png"},
+		{"README", "Hello, World!\n", "text/plain; charset=utf-8"},
+		{"export", "%PDF-1.4", "application/pdf"},
+	}
+	for _, test := range tests {
+		if got := attachmentType(test.name, []byte(test.data)); got != test.want {
+			t.Errorf("attachmentType(%q, %q) = %q; want %q", test.name, test.data, got, test.want)
+		}
+	}
+}